@@ -0,0 +1,82 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/golang/glog"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/prebid/prebid-server/stored_requests"
+)
+
+// GetAccount looks up the config.Account object referenced by the given accountID.
+//
+// Stored account data is merged on top of cfg.AccountDefaults, so stored accounts only need to define
+// the settings which differ from the host defaults. If the account can't be found, the defaults are used.
+//
+// The returned errors are always fatal to the request. If any exist, the returned account will be nil.
+func GetAccount(ctx context.Context, cfg *config.Configuration, fetcher stored_requests.AccountFetcher, accountID string) (account *config.Account, errs []error) {
+	// Check BlacklistedAcctMap until we have deprecated it
+	if _, found := cfg.BlacklistedAcctMap[accountID]; found {
+		return nil, []error{&errortypes.BlacklistedAcct{
+			Message: fmt.Sprintf("Prebid-server has blacklisted Account ID: %s, please reach out to the prebid server host.", accountID),
+		}}
+	}
+	if cfg.AccountRequired && accountID == pbsmetrics.PublisherUnknown {
+		// If specified in the configuration, discard requests that don't come with an account ID.
+		return nil, []error{&errortypes.AcctRequired{
+			Message: fmt.Sprintf("Prebid-server has been configured to discard requests that don't come with an Account ID. Please reach out to the prebid server host."),
+		}}
+	}
+
+	if accountJSON, fetchErrs := fetcher.FetchAccount(ctx, accountID); len(fetchErrs) > 0 || accountJSON == nil {
+		// The account couldn't be loaded, so fall back to the host defaults.
+		// Missing accounts are expected. Anything else means the account backend needs some attention.
+		for _, err := range fetchErrs {
+			if _, ok := err.(stored_requests.NotFoundError); !ok {
+				glog.Warningf("Error fetching Account %s. Using the default account config instead: %v", accountID, err)
+			}
+		}
+		defaultAccount := cfg.AccountDefaults
+		defaultAccount.ID = accountID
+		account = &defaultAccount
+	} else {
+		merged, err := mergeAccount(cfg.AccountDefaults, accountJSON)
+		if err != nil {
+			return nil, []error{fmt.Errorf("Invalid stored config for Account %s: %v", accountID, err)}
+		}
+		account = merged
+		// Allow the ID to be left out of the stored account data
+		if account.ID == "" {
+			account.ID = accountID
+		}
+	}
+
+	if account.Disabled {
+		return nil, []error{&errortypes.BlacklistedAcct{
+			Message: fmt.Sprintf("Prebid-server has disabled Account ID: %s, please reach out to the prebid server host.", accountID),
+		}}
+	}
+	return account, nil
+}
+
+// mergeAccount applies the stored account data to the defaults using JSON Merge Patch semantics.
+func mergeAccount(defaults config.Account, accountJSON json.RawMessage) (*config.Account, error) {
+	defaultsJSON, err := json.Marshal(defaults)
+	if err != nil {
+		return nil, err
+	}
+	mergedJSON, err := jsonpatch.MergePatch(defaultsJSON, accountJSON)
+	if err != nil {
+		return nil, err
+	}
+	account := &config.Account{}
+	if err := json.Unmarshal(mergedJSON, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
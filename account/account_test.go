@@ -0,0 +1,117 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/stretchr/testify/assert"
+)
+
+var mockAccountData = map[string]json.RawMessage{
+	"valid_acct":     json.RawMessage(`{"disabled":false,"default_timeout_ms":300,"price_granularity":"dense"}`),
+	"disabled_acct":  json.RawMessage(`{"disabled":true}`),
+	"enabled_acct":   json.RawMessage(`{"disabled":false}`),
+	"malformed_acct": json.RawMessage(`{"disabled":"invalid type"}`),
+}
+
+type mockAccountFetcher struct {
+}
+
+func (af mockAccountFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	if account, ok := mockAccountData[accountID]; ok {
+		return account, nil
+	}
+	if accountID == "broken_backend" {
+		return nil, []error{errors.New("connection refused")}
+	}
+	return nil, []error{stored_requests.NotFoundError{ID: accountID, DataType: "Account"}}
+}
+
+func TestGetAccount(t *testing.T) {
+	testCases := []struct {
+		accountID string
+		// account_required
+		required bool
+		// account_defaults.disabled
+		disabled bool
+		// expected error, or nil if account should be found
+		err error
+	}{
+		// Blacklisted account is always rejected even in permissive setup
+		{accountID: "bad_acct", required: false, disabled: false, err: &errortypes.BlacklistedAcct{}},
+
+		// empty pubID
+		{accountID: pbsmetrics.PublisherUnknown, required: false, disabled: false, err: nil},
+		{accountID: pbsmetrics.PublisherUnknown, required: true, disabled: false, err: &errortypes.AcctRequired{}},
+		{accountID: pbsmetrics.PublisherUnknown, required: false, disabled: true, err: &errortypes.BlacklistedAcct{}},
+
+		// pubID given but is not a valid host account (does not exist)
+		{accountID: "doesnt_exist_acct", required: false, disabled: false, err: nil},
+		{accountID: "doesnt_exist_acct", required: true, disabled: false, err: nil},
+		{accountID: "doesnt_exist_acct", required: false, disabled: true, err: &errortypes.BlacklistedAcct{}},
+
+		// pubID given and matches a valid host account with Disabled: false
+		{accountID: "enabled_acct", required: false, disabled: false, err: nil},
+		{accountID: "enabled_acct", required: true, disabled: true, err: nil},
+
+		// pubID given and matches a host account explicitly disabled (Disabled: true on account json)
+		{accountID: "disabled_acct", required: false, disabled: false, err: &errortypes.BlacklistedAcct{}},
+
+		// pubID given and matches a host account which has malformed json
+		{accountID: "malformed_acct", required: false, disabled: false, err: errors.New("")},
+
+		// the account backend failed, so fall back to the defaults
+		{accountID: "broken_backend", required: false, disabled: false, err: nil},
+	}
+
+	for _, test := range testCases {
+		description := test.accountID
+		cfg := &config.Configuration{
+			BlacklistedAcctMap: map[string]bool{"bad_acct": true},
+			AccountRequired:    test.required,
+			AccountDefaults:    config.Account{Disabled: test.disabled},
+		}
+
+		account, errors := GetAccount(context.Background(), cfg, mockAccountFetcher{}, test.accountID)
+
+		if test.err == nil {
+			assert.Empty(t, errors, "%s: expected no errors", description)
+			if assert.NotNil(t, account, "%s: expected an account", description) {
+				assert.Equal(t, test.accountID, account.ID, "%s: expected the account ID to be set", description)
+			}
+		} else {
+			if assert.Len(t, errors, 1, "%s: expected one error", description) {
+				assert.IsType(t, test.err, errors[0], "%s: wrong error type", description)
+			}
+			assert.Nil(t, account, "%s: expected no account", description)
+		}
+	}
+}
+
+func TestGetAccountMergesDefaults(t *testing.T) {
+	enforceCCPA := true
+	cfg := &config.Configuration{
+		AccountDefaults: config.Account{
+			DefaultTimeoutMS: 1000,
+			CCPA:             config.AccountCCPA{Enforce: &enforceCCPA},
+			Bidders:          []string{"appnexus"},
+		},
+	}
+
+	account, errs := GetAccount(context.Background(), cfg, mockAccountFetcher{}, "valid_acct")
+
+	assert.Empty(t, errs)
+	assert.Equal(t, "valid_acct", account.ID)
+	assert.Equal(t, uint64(300), account.DefaultTimeoutMS, "Stored account data should override the defaults")
+	assert.True(t, account.CCPA.EnforceOrDefault(false), "Default values should be kept if the stored account doesn't override them")
+	assert.Equal(t, []string{"appnexus"}, account.Bidders, "Default values should be kept if the stored account doesn't override them")
+	if assert.NotNil(t, account.PriceGranularity) {
+		assert.Len(t, account.PriceGranularity.Ranges, 3, "Legacy price granularity strings should be understood")
+	}
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/golang/glog"
 	"github.com/prebid/prebid-server/analytics"
 	"github.com/prebid/prebid-server/analytics/filesystem"
+	"github.com/prebid/prebid-server/analytics/stream"
 	"github.com/prebid/prebid-server/config"
 )
 
@@ -17,6 +21,12 @@ func NewPBSAnalytics(analytics *config.Analytics) analytics.PBSAnalyticsModule {
 			glog.Fatalf("Could not initialize FileLogger for file %v :%v", analytics.File.Filename, err)
 		}
 	}
+	if analytics.Stream.Enabled {
+		client := &http.Client{
+			Timeout: time.Duration(analytics.Stream.TimeoutMS) * time.Millisecond,
+		}
+		modules = append(modules, stream.NewStreamLogger(client, analytics.Stream))
+	}
 	return modules
 }
 
@@ -52,3 +62,27 @@ func (ea enabledAnalytics) LogAmpObject(ao *analytics.AmpObject) {
 		module.LogAmpObject(ao)
 	}
 }
+
+func (ea enabledAnalytics) LogNotificationEventObject(ne *analytics.NotificationEvent) {
+	for _, module := range ea {
+		module.LogNotificationEventObject(ne)
+	}
+}
+
+// closer is implemented by the modules which need to clean up on shutdown, e.g. to send buffered events.
+type closer interface {
+	Close()
+}
+
+// Close shuts down the module, along with every module inside it which needs to clean up.
+// It should be called once Prebid Server has stopped taking requests.
+func Close(module analytics.PBSAnalyticsModule) {
+	switch m := module.(type) {
+	case enabledAnalytics:
+		for _, inner := range m {
+			Close(inner)
+		}
+	case closer:
+		m.Close()
+	}
+}
@@ -50,6 +50,11 @@ func TestSampleModule(t *testing.T) {
 	if count != 5 {
 		t.Errorf("PBSAnalyticsModule failed at LogVideoObject")
 	}
+
+	am.LogNotificationEventObject(&analytics.NotificationEvent{})
+	if count != 6 {
+		t.Errorf("PBSAnalyticsModule failed at LogNotificationEventObject")
+	}
 }
 
 type sampleModule struct {
@@ -66,6 +71,8 @@ func (m *sampleModule) LogSetUIDObject(so *analytics.SetUIDObject) { *m.count++
 
 func (m *sampleModule) LogAmpObject(ao *analytics.AmpObject) { *m.count++ }
 
+func (m *sampleModule) LogNotificationEventObject(ne *analytics.NotificationEvent) { *m.count++ }
+
 func initAnalytics(count *int) analytics.PBSAnalyticsModule {
 	modules := make(enabledAnalytics, 0)
 	modules = append(modules, &sampleModule{count})
@@ -89,3 +96,36 @@ func TestNewPBSAnalytics(t *testing.T) {
 		t.Fatalf("Failed to initialize analytics module")
 	}
 }
+
+func TestNewPBSAnalyticsStream(t *testing.T) {
+	mod := NewPBSAnalytics(&config.Analytics{
+		Stream: config.StreamAnalytics{
+			Enabled:   true,
+			Endpoint:  "http://localhost:9999/events",
+			TimeoutMS: 100,
+			QueueSize: 10,
+			Buffers:   config.StreamBuffers{EventCount: 10, MaxBytes: 1024, FlushIntervalMS: 1000},
+		},
+	})
+	if modules, ok := mod.(enabledAnalytics); !ok || len(modules) != 1 {
+		t.Fatalf("Failed to add the stream analytics module")
+	}
+}
+
+type closingModule struct {
+	sampleModule
+	closed *bool
+}
+
+func (m *closingModule) Close() { *m.closed = true }
+
+func TestClose(t *testing.T) {
+	var count int
+	var closed bool
+	modules := enabledAnalytics{&sampleModule{&count}, &closingModule{sampleModule{&count}, &closed}}
+
+	Close(modules)
+	if !closed {
+		t.Errorf("Close should close the modules which need it")
+	}
+}
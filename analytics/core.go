@@ -2,6 +2,7 @@ package analytics
 
 import (
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/usersync"
 )
@@ -11,7 +12,7 @@ import (
 
 	New modules can use the /analytics/endpoint_data_objects, extract the
 	information required and are responsible for handling all their logging activities inside LogAuctionObject, LogAmpObject
-	LogCookieSyncObject and LogSetUIDObject method implementations.
+	LogCookieSyncObject, LogSetUIDObject and LogNotificationEventObject method implementations.
 */
 
 type PBSAnalyticsModule interface {
@@ -20,6 +21,7 @@ type PBSAnalyticsModule interface {
 	LogCookieSyncObject(*CookieSyncObject)
 	LogSetUIDObject(*SetUIDObject)
 	LogAmpObject(*AmpObject)
+	LogNotificationEventObject(*NotificationEvent)
 }
 
 //Loggable object of a transaction at /openrtb2/auction endpoint
@@ -65,3 +67,9 @@ type CookieSyncObject struct {
 	Errors       []error
 	BidderStatus []*usersync.CookieSyncBidders
 }
+
+//Loggable object of a transaction at /event
+type NotificationEvent struct {
+	Request *EventRequest
+	Account *config.Account
+}
@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// EventType is the kind of notification sent to the /event endpoint.
+type EventType string
+
+const (
+	// Win means that the bid won in the ad server.
+	Win EventType = "win"
+	// Imp means that the bid's creative was rendered.
+	Imp EventType = "imp"
+)
+
+// The query params used by the /event endpoint.
+const (
+	EventParamType      = "t"
+	EventParamBidID     = "b"
+	EventParamAccountID = "a"
+	EventParamBidder    = "bidder"
+	EventParamTimestamp = "ts"
+	EventParamFormat    = "f"
+)
+
+// EventRequest is a notification about a bid which PBS returned.
+type EventRequest struct {
+	Type      EventType `json:"type"`
+	BidID     string    `json:"bidid"`
+	AccountID string    `json:"account_id"`
+	Bidder    string    `json:"bidder,omitempty"`
+	// Timestamp is the time of the auction, in milliseconds since the epoch. It's 0 if unknown.
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+// EventURL returns the URL which should be called to send the event to the /event endpoint on externalURL.
+func EventURL(externalURL string, event *EventRequest) string {
+	values := url.Values{}
+	values.Set(EventParamType, string(event.Type))
+	values.Set(EventParamBidID, event.BidID)
+	values.Set(EventParamAccountID, event.AccountID)
+	if event.Bidder != "" {
+		values.Set(EventParamBidder, event.Bidder)
+	}
+	if event.Timestamp > 0 {
+		values.Set(EventParamTimestamp, strconv.FormatInt(event.Timestamp, 10))
+	}
+	return externalURL + "/event?" + values.Encode()
+}
@@ -64,6 +64,19 @@ func TestCookieSyncObject_ToJson(t *testing.T) {
 	}
 }
 
+func TestNotificationEventObject_ToJson(t *testing.T) {
+	ne := &analytics.NotificationEvent{
+		Request: &analytics.EventRequest{
+			Type:      analytics.Win,
+			BidID:     "bid",
+			AccountID: "account",
+		},
+	}
+	if neJson := jsonifyNotificationEventObject(ne); strings.Contains(neJson, "Transactional Logs Error") {
+		t.Fatalf("NotificationEvent failed to convert to json")
+	}
+}
+
 func TestFileLogger_LogObjects(t *testing.T) {
 	if _, err := os.Stat(TEST_DIR); os.IsNotExist(err) {
 		if err = os.MkdirAll(TEST_DIR, 0755); err != nil {
@@ -77,6 +90,7 @@ func TestFileLogger_LogObjects(t *testing.T) {
 		fl.LogAmpObject(&analytics.AmpObject{})
 		fl.LogSetUIDObject(&analytics.SetUIDObject{})
 		fl.LogCookieSyncObject(&analytics.CookieSyncObject{})
+		fl.LogNotificationEventObject(&analytics.NotificationEvent{})
 	} else {
 		t.Fatalf("Couldn't initialize file logger: %v", err)
 	}
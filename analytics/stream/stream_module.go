@@ -0,0 +1,326 @@
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prebid/prebid-server/analytics"
+	"github.com/prebid/prebid-server/config"
+)
+
+type eventType string
+
+const (
+	eventAuction    eventType = "/openrtb2/auction"
+	eventAmp        eventType = "/openrtb2/amp"
+	eventVideo      eventType = "/openrtb2/video"
+	eventSetUID     eventType = "/set_uid"
+	eventCookieSync eventType = "/cookie_sync"
+	eventEvent      eventType = "/event"
+)
+
+// StreamLogger is an analytics module which sends batches of events to an HTTP collector.
+//
+// Each batch is POSTed as newline-delimited JSON, so any collector which accepts JSON lines
+// (e.g. a Kafka REST proxy) will work. The Log methods never block: events are queued and
+// batched on a separate goroutine, and they're dropped if the queue is full. Call Close on shutdown
+// to send the events which are still queued.
+type StreamLogger struct {
+	client        *http.Client
+	endpoint      string
+	gzip          bool
+	maxRetries    int
+	retryBackoff  time.Duration
+	maxEvents     int
+	maxBytes      int
+	flushInterval time.Duration
+	closeTimeout  time.Duration
+	sampleRates   map[eventType]float64
+	// random returns a number in [0, 1). It's a field so that tests can control sampling.
+	random func() float64
+
+	queue   chan []byte
+	dropped uint64
+	// closing tells the batching goroutine to send what's left, and stopped is closed once it has.
+	closing   chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStreamLogger makes a StreamLogger and starts its batching goroutine.
+func NewStreamLogger(client *http.Client, cfg config.StreamAnalytics) *StreamLogger {
+	logger := &StreamLogger{
+		client:        client,
+		endpoint:      cfg.Endpoint,
+		gzip:          cfg.Gzip,
+		maxRetries:    cfg.MaxRetries,
+		retryBackoff:  time.Duration(cfg.RetryBackoffMS) * time.Millisecond,
+		maxEvents:     cfg.Buffers.EventCount,
+		maxBytes:      cfg.Buffers.MaxBytes,
+		flushInterval: time.Duration(cfg.Buffers.FlushIntervalMS) * time.Millisecond,
+		closeTimeout:  time.Duration(cfg.ShutdownTimeoutMS) * time.Millisecond,
+		sampleRates: map[eventType]float64{
+			eventAuction:    cfg.SamplingRates.Auction,
+			eventAmp:        cfg.SamplingRates.Amp,
+			eventVideo:      cfg.SamplingRates.Video,
+			eventSetUID:     cfg.SamplingRates.SetUID,
+			eventCookieSync: cfg.SamplingRates.CookieSync,
+			eventEvent:      cfg.SamplingRates.Event,
+		},
+		random:  rand.Float64,
+		queue:   make(chan []byte, cfg.QueueSize),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go logger.run()
+	return logger
+}
+
+func (l *StreamLogger) LogAuctionObject(ao *analytics.AuctionObject) {
+	if ao == nil || !l.sampled(eventAuction) {
+		return
+	}
+	type alias analytics.AuctionObject
+	l.enqueue(eventAuction, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventAuction), (*alias)(ao)})
+}
+
+func (l *StreamLogger) LogVideoObject(vo *analytics.VideoObject) {
+	if vo == nil || !l.sampled(eventVideo) {
+		return
+	}
+	type alias analytics.VideoObject
+	l.enqueue(eventVideo, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventVideo), (*alias)(vo)})
+}
+
+func (l *StreamLogger) LogSetUIDObject(so *analytics.SetUIDObject) {
+	if so == nil || !l.sampled(eventSetUID) {
+		return
+	}
+	type alias analytics.SetUIDObject
+	l.enqueue(eventSetUID, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventSetUID), (*alias)(so)})
+}
+
+func (l *StreamLogger) LogCookieSyncObject(cso *analytics.CookieSyncObject) {
+	if cso == nil || !l.sampled(eventCookieSync) {
+		return
+	}
+	type alias analytics.CookieSyncObject
+	l.enqueue(eventCookieSync, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventCookieSync), (*alias)(cso)})
+}
+
+func (l *StreamLogger) LogAmpObject(ao *analytics.AmpObject) {
+	if ao == nil || !l.sampled(eventAmp) {
+		return
+	}
+	type alias analytics.AmpObject
+	l.enqueue(eventAmp, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventAmp), (*alias)(ao)})
+}
+
+func (l *StreamLogger) LogNotificationEventObject(ne *analytics.NotificationEvent) {
+	if ne == nil || !l.sampled(eventEvent) {
+		return
+	}
+	type alias analytics.NotificationEvent
+	l.enqueue(eventEvent, &struct {
+		eventHeader
+		*alias
+	}{newEventHeader(eventEvent), (*alias)(ne)})
+}
+
+// Close sends the queued events, waiting up to the configured shutdown timeout for them to go out.
+// Events which are logged after Close are never sent.
+func (l *StreamLogger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.closing)
+		select {
+		case <-l.stopped:
+		case <-time.After(l.closeTimeout):
+			glog.Warningf("Stream analytics: gave up on the queued events after waiting %v.", l.closeTimeout)
+		}
+	})
+}
+
+// Dropped returns the number of sampled events which were thrown away because the queue was full.
+func (l *StreamLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+// eventHeader is added to the top of every event, so the collector can tell them apart.
+type eventHeader struct {
+	Type eventType `json:"type"`
+	// Timestamp is the time the event was logged, in milliseconds since the epoch.
+	Timestamp int64 `json:"timestamp"`
+}
+
+func newEventHeader(typ eventType) eventHeader {
+	return eventHeader{
+		Type:      typ,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+}
+
+func (l *StreamLogger) sampled(typ eventType) bool {
+	rate := l.sampleRates[typ]
+	return rate >= 1 || l.random() < rate
+}
+
+// enqueue queues the event for the next batch, or drops it if the queue is full.
+func (l *StreamLogger) enqueue(typ eventType, event interface{}) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		glog.Errorf("Stream analytics: failed to marshal %s event: %v", typ, err)
+		return
+	}
+
+	select {
+	case l.queue <- b:
+	default:
+		if atomic.AddUint64(&l.dropped, 1)%1000 == 1 {
+			glog.Warningf("Stream analytics: the event queue is full. %d events have been dropped.", l.Dropped())
+		}
+	}
+}
+
+// run batches queued events, and sends each batch when it hits one of the configured limits.
+// Batches are sent synchronously, so a slow collector fills up the queue rather than piling up requests.
+func (l *StreamLogger) run() {
+	defer close(l.stopped)
+	var batch bytes.Buffer
+	count := 0
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		l.send(batch.Bytes(), count)
+		batch.Reset()
+		count = 0
+	}
+
+	add := func(event []byte) {
+		if count > 0 && batch.Len()+len(event)+1 > l.maxBytes {
+			flush()
+		}
+		batch.Write(event)
+		batch.WriteByte('\n')
+		count++
+		if count >= l.maxEvents || batch.Len() >= l.maxBytes {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case event := <-l.queue:
+			add(event)
+		case <-ticker.C:
+			flush()
+		case <-l.closing:
+			for {
+				select {
+				case event := <-l.queue:
+					add(event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send POSTs a batch to the collector, retrying on connection errors and 5xx or 429 responses.
+func (l *StreamLogger) send(batch []byte, count int) {
+	body, err := l.encode(batch)
+	if err != nil {
+		glog.Errorf("Stream analytics: failed to compress %d events: %v", count, err)
+		return
+	}
+
+	backoff := l.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = l.post(body)
+		if err == nil {
+			return
+		}
+		if _, retryable := err.(*retryableError); !retryable || attempt >= l.maxRetries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	glog.Errorf("Stream analytics: dropped %d events: %v", count, err)
+}
+
+func (l *StreamLogger) encode(batch []byte) ([]byte, error) {
+	if !l.gzip {
+		return append([]byte(nil), batch...), nil
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(batch); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (l *StreamLogger) post(body []byte) error {
+	req, err := http.NewRequest("POST", l.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if l.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return &retryableError{err.Error()}
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return &retryableError{fmt.Sprintf("the collector returned status %d", resp.StatusCode)}
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("the collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type retryableError struct {
+	message string
+}
+
+func (err *retryableError) Error() string {
+	return err.message
+}
@@ -0,0 +1,294 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/analytics"
+	"github.com/prebid/prebid-server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchByEventCount(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 4
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogAuctionObject(&analytics.AuctionObject{Status: http.StatusOK, Request: &openrtb.BidRequest{ID: "auction"}})
+	logger.LogAmpObject(&analytics.AmpObject{Status: http.StatusOK, Origin: "amp.example.com"})
+	logger.LogAmpObject(nil)
+	logger.LogSetUIDObject(&analytics.SetUIDObject{Status: http.StatusOK, Bidder: "appnexus", UID: "123"})
+	logger.LogNotificationEventObject(&analytics.NotificationEvent{Request: &analytics.EventRequest{Type: analytics.Win, BidID: "bid"}})
+
+	events := awaitBatch(t, batches)
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, "/openrtb2/auction", events[0]["type"])
+		assert.Equal(t, "auction", events[0]["Request"].(map[string]interface{})["id"])
+		assert.NotZero(t, events[0]["timestamp"])
+		assert.Equal(t, "/openrtb2/amp", events[1]["type"])
+		assert.Equal(t, "amp.example.com", events[1]["Origin"])
+		assert.Equal(t, "/set_uid", events[2]["type"])
+		assert.Equal(t, "123", events[2]["UID"])
+		assert.Equal(t, "/event", events[3]["type"])
+		assert.Equal(t, "bid", events[3]["Request"].(map[string]interface{})["bidid"])
+	}
+}
+
+func TestBatchByBytes(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.MaxBytes = 250
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogCookieSyncObject(&analytics.CookieSyncObject{Status: http.StatusOK})
+	logger.LogCookieSyncObject(&analytics.CookieSyncObject{Status: http.StatusOK})
+	logger.LogCookieSyncObject(&analytics.CookieSyncObject{Status: http.StatusOK})
+
+	assert.Len(t, awaitBatch(t, batches), 2, "The third event shouldn't fit in the first batch")
+}
+
+func TestBatchByFlushInterval(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.FlushIntervalMS = 20
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogVideoObject(&analytics.VideoObject{Status: http.StatusOK})
+
+	events := awaitBatch(t, batches)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "/openrtb2/video", events[0]["type"])
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts int32
+	collector, batches := newCollector(t, func(w http.ResponseWriter) bool {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	})
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 1
+	cfg.MaxRetries = 2
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogSetUIDObject(&analytics.SetUIDObject{Status: http.StatusOK})
+
+	assert.Len(t, awaitBatch(t, batches), 1)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+}
+
+func TestNoRetriesOnClientErrors(t *testing.T) {
+	var attempts int32
+	collector, batches := newCollector(t, func(w http.ResponseWriter) bool {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	})
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 1
+	cfg.MaxRetries = 2
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogSetUIDObject(&analytics.SetUIDObject{Status: http.StatusOK})
+	logger.LogSetUIDObject(&analytics.SetUIDObject{Status: http.StatusOK})
+
+	assertNoBatch(t, batches)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestSampling(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 2
+	cfg.SamplingRates.Auction = 0
+	cfg.SamplingRates.Video = 0.5
+	logger := NewStreamLogger(collector.Client(), cfg)
+	random := 0.7
+	logger.random = func() float64 { return random }
+
+	logger.LogAuctionObject(&analytics.AuctionObject{})
+	logger.LogVideoObject(&analytics.VideoObject{})
+	random = 0.2
+	logger.LogVideoObject(&analytics.VideoObject{Status: http.StatusOK})
+	logger.LogCookieSyncObject(&analytics.CookieSyncObject{})
+
+	events := awaitBatch(t, batches)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "/openrtb2/video", events[0]["type"])
+		assert.Equal(t, float64(http.StatusOK), events[0]["Status"])
+		assert.Equal(t, "/cookie_sync", events[1]["type"])
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	unblock := make(chan struct{})
+	collector, batches := newCollector(t, func(w http.ResponseWriter) bool {
+		<-unblock
+		return true
+	})
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 1
+	cfg.QueueSize = 1
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	// The first event gets stuck at the collector, and the second fills up the queue.
+	logger.LogSetUIDObject(&analytics.SetUIDObject{})
+	time.Sleep(20 * time.Millisecond)
+	logger.LogSetUIDObject(&analytics.SetUIDObject{})
+	logger.LogSetUIDObject(&analytics.SetUIDObject{})
+	logger.LogSetUIDObject(&analytics.SetUIDObject{})
+	close(unblock)
+
+	assert.Len(t, awaitBatch(t, batches), 1)
+	assert.Len(t, awaitBatch(t, batches), 1)
+	assertNoBatch(t, batches)
+	assert.Equal(t, uint64(2), logger.Dropped())
+}
+
+func TestCloseSendsQueuedEvents(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogAuctionObject(&analytics.AuctionObject{Status: http.StatusOK})
+	logger.LogVideoObject(&analytics.VideoObject{Status: http.StatusOK})
+	logger.Close()
+
+	assert.Len(t, awaitBatch(t, batches), 2, "The queued events should be sent before the flush interval")
+	logger.Close()
+	assertNoBatch(t, batches)
+}
+
+func TestCloseTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	collector, _ := newCollector(t, func(w http.ResponseWriter) bool {
+		<-unblock
+		return false
+	})
+	defer collector.Close()
+	defer close(unblock)
+	cfg := newConfig(collector.URL)
+	cfg.ShutdownTimeoutMS = 20
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogSetUIDObject(&analytics.SetUIDObject{})
+	start := time.Now()
+	logger.Close()
+
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "Close shouldn't wait longer than the shutdown timeout")
+}
+
+func TestNilObjects(t *testing.T) {
+	collector, batches := newCollector(t, nil)
+	defer collector.Close()
+	cfg := newConfig(collector.URL)
+	cfg.Buffers.EventCount = 1
+	logger := NewStreamLogger(collector.Client(), cfg)
+
+	logger.LogAuctionObject(nil)
+	logger.LogVideoObject(nil)
+	logger.LogSetUIDObject(nil)
+	logger.LogCookieSyncObject(nil)
+	logger.LogAmpObject(nil)
+	logger.LogNotificationEventObject(nil)
+
+	assertNoBatch(t, batches)
+}
+
+func newConfig(endpoint string) config.StreamAnalytics {
+	return config.StreamAnalytics{
+		Enabled:           true,
+		Endpoint:          endpoint,
+		Gzip:              true,
+		TimeoutMS:         1000,
+		QueueSize:         100,
+		RetryBackoffMS:    1,
+		ShutdownTimeoutMS: 1000,
+		Buffers: config.StreamBuffers{
+			EventCount:      100,
+			MaxBytes:        1024 * 1024,
+			FlushIntervalMS: 60000,
+		},
+		SamplingRates: config.StreamSampleRates{
+			Auction:    1,
+			Amp:        1,
+			Video:      1,
+			SetUID:     1,
+			CookieSync: 1,
+			Event:      1,
+		},
+	}
+}
+
+// newCollector starts a server which decodes each batch it accepts and sends it down the channel.
+// If accept is defined, it runs first and the batch is only decoded if it returns true.
+func newCollector(t *testing.T, accept func(w http.ResponseWriter) bool) (*httptest.Server, chan []map[string]interface{}) {
+	batches := make(chan []map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept != nil && !accept(w) {
+			return
+		}
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, err := ioutil.ReadAll(reader)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var events []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			var event map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+			events = append(events, event)
+		}
+		batches <- events
+	}))
+	return server, batches
+}
+
+func awaitBatch(t *testing.T, batches chan []map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+	select {
+	case events := <-batches:
+		return events
+	case <-time.After(time.Second):
+		t.Fatalf("The collector didn't receive a batch")
+		return nil
+	}
+}
+
+func assertNoBatch(t *testing.T, batches chan []map[string]interface{}) {
+	t.Helper()
+	select {
+	case events := <-batches:
+		t.Errorf("The collector received an unexpected batch: %v", events)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
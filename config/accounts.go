@@ -0,0 +1,131 @@
+package config
+
+import (
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// Account represents the settings Prebid Server applies to requests from a single publisher account.
+//
+// Accounts are loaded by ID through the stored_requests AccountFetcher and merged on top of
+// Configuration.AccountDefaults, so every field should have a sensible zero value.
+type Account struct {
+	ID       string `mapstructure:"id" json:"id"`
+	Disabled bool   `mapstructure:"disabled" json:"disabled"`
+	// DefaultTimeoutMS overrides auction_timeouts_ms.default for requests which don't define tmax.
+	// It is still capped by auction_timeouts_ms.max. Use 0 to keep the host default.
+	DefaultTimeoutMS uint64 `mapstructure:"default_timeout_ms" json:"default_timeout_ms,omitempty"`
+	// PriceGranularity is used for targeting if the request doesn't define ext.prebid.targeting.pricegranularity.
+	PriceGranularity *openrtb_ext.PriceGranularity `mapstructure:"price_granularity" json:"price_granularity,omitempty"`
+	GDPR             AccountGDPR                   `mapstructure:"gdpr" json:"gdpr"`
+	CCPA             AccountCCPA                   `mapstructure:"ccpa" json:"ccpa"`
+	// Bidders restricts the auction to the listed bidders (or aliases). An empty list allows every bidder.
+	Bidders []string      `mapstructure:"bidders" json:"bidders,omitempty"`
+	Hooks   AccountHooks  `mapstructure:"hooks" json:"hooks"`
+	Debug   AccountDebug  `mapstructure:"debug" json:"debug"`
+	Events  AccountEvents `mapstructure:"events" json:"events"`
+	// BidValidation overrides the host's bid_validation settings.
+	BidValidation AccountBidValidation `mapstructure:"bid_validation" json:"bid_validation"`
+}
+
+// AccountHooks represents account-specific module configuration
+type AccountHooks struct {
+	// Modules holds the account config for each module, keyed by module name. It's passed to the module's
+	// hooks alongside the host config which the module was built with.
+	Modules map[string]map[string]interface{} `mapstructure:"modules" json:"modules,omitempty"`
+	// ExecutionPlan lists more modules to run for this account's requests. They run after the ones in
+	// hooks.execution_plan.
+	ExecutionPlan HookExecutionPlan `mapstructure:"execution_plan" json:"execution_plan"`
+}
+
+// AccountGDPR represents account-specific GDPR configuration
+type AccountGDPR struct {
+	// Enabled can be set to false to turn off GDPR enforcement for this account.
+	Enabled *bool `mapstructure:"enabled" json:"enabled,omitempty"`
+}
+
+// AccountCCPA represents account-specific CCPA configuration
+type AccountCCPA struct {
+	// Enforce overrides the host level ccpa.enforce setting, if defined.
+	Enforce *bool `mapstructure:"enforce" json:"enforce,omitempty"`
+}
+
+// AccountDebug represents account-specific debug configuration
+type AccountDebug struct {
+	// Allowed overrides the host level debug.allowed setting, if defined.
+	Allowed *bool `mapstructure:"allowed" json:"allowed,omitempty"`
+}
+
+// AccountEvents represents account-specific event notification configuration
+type AccountEvents struct {
+	// Enabled adds win and impression event URLs to the account's bids, and lets the /event endpoint
+	// accept notifications for the account.
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+}
+
+// AccountBidValidation represents account-specific bid validation configuration
+type AccountBidValidation struct {
+	// Mode overrides the host level bid_validation.mode setting, if defined.
+	Mode BidValidationMode `mapstructure:"mode" json:"mode,omitempty"`
+}
+
+// EnabledOrDefault returns whether GDPR should be enforced for the account, falling back to
+// the given host value if the account doesn't say.
+func (a *AccountGDPR) EnabledOrDefault(hostEnabled bool) bool {
+	if a.Enabled != nil {
+		return *a.Enabled
+	}
+	return hostEnabled
+}
+
+// EnforceOrDefault returns whether CCPA should be enforced for the account, falling back to
+// the given host value if the account doesn't say.
+func (a *AccountCCPA) EnforceOrDefault(hostEnforce bool) bool {
+	if a.Enforce != nil {
+		return *a.Enforce
+	}
+	return hostEnforce
+}
+
+// AllowedOrDefault returns whether the account may see debug info in its responses, falling back to
+// the given host value if the account doesn't say.
+func (a *AccountDebug) AllowedOrDefault(hostAllowed bool) bool {
+	if a.Allowed != nil {
+		return *a.Allowed
+	}
+	return hostAllowed
+}
+
+// ModeOrDefault returns how bids should be validated for the account, falling back to
+// the given host value if the account doesn't say, or asks for a mode which doesn't exist.
+func (a *AccountBidValidation) ModeOrDefault(hostMode BidValidationMode) BidValidationMode {
+	if a.Mode.valid() {
+		return a.Mode
+	}
+	return hostMode
+}
+
+// BidderAllowed returns true if the account allows requests to be sent to the given bidder.
+func (a *Account) BidderAllowed(bidder string) bool {
+	if len(a.Bidders) == 0 {
+		return true
+	}
+	for _, allowed := range a.Bidders {
+		if allowed == bidder {
+			return true
+		}
+	}
+	return false
+}
+
+// AuctionTimeouts returns the host timeouts with the account's default timeout applied, if it has one.
+func (a *Account) AuctionTimeouts(host AuctionTimeouts) AuctionTimeouts {
+	if a.DefaultTimeoutMS == 0 {
+		return host
+	}
+	timeouts := host
+	timeouts.Default = a.DefaultTimeoutMS
+	if timeouts.Max > 0 && timeouts.Default > timeouts.Max {
+		timeouts.Default = timeouts.Max
+	}
+	return timeouts
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountAuctionTimeouts(t *testing.T) {
+	host := AuctionTimeouts{Default: 300, Max: 1000}
+
+	testCases := []struct {
+		description      string
+		defaultTimeoutMS uint64
+		expected         AuctionTimeouts
+	}{
+		{"No account default", 0, AuctionTimeouts{Default: 300, Max: 1000}},
+		{"Account default under max", 500, AuctionTimeouts{Default: 500, Max: 1000}},
+		{"Account default capped by max", 1500, AuctionTimeouts{Default: 1000, Max: 1000}},
+	}
+
+	for _, test := range testCases {
+		account := Account{DefaultTimeoutMS: test.defaultTimeoutMS}
+		assert.Equal(t, test.expected, account.AuctionTimeouts(host), test.description)
+	}
+}
+
+func TestAccountBidderAllowed(t *testing.T) {
+	all := Account{}
+	assert.True(t, all.BidderAllowed("appnexus"), "Empty bidder list should allow every bidder")
+
+	restricted := Account{Bidders: []string{"appnexus"}}
+	assert.True(t, restricted.BidderAllowed("appnexus"), "Listed bidder should be allowed")
+	assert.False(t, restricted.BidderAllowed("rubicon"), "Unlisted bidder should not be allowed")
+}
+
+func TestAccountPrivacyDefaults(t *testing.T) {
+	enabled := false
+	account := Account{GDPR: AccountGDPR{Enabled: &enabled}}
+
+	assert.False(t, account.GDPR.EnabledOrDefault(true), "Account GDPR setting should win")
+	assert.True(t, account.CCPA.EnforceOrDefault(true), "Host CCPA setting should apply when the account doesn't define one")
+}
+
+func TestAccountDebugAllowed(t *testing.T) {
+	allowed := false
+	account := Account{}
+
+	assert.True(t, account.Debug.AllowedOrDefault(true), "Host debug setting should apply when the account doesn't define one")
+	account.Debug.Allowed = &allowed
+	assert.False(t, account.Debug.AllowedOrDefault(true), "Account debug setting should win")
+}
+
+func TestAccountBidValidationMode(t *testing.T) {
+	account := Account{}
+	assert.Equal(t, BidValidationWarn, account.BidValidation.ModeOrDefault(BidValidationWarn), "Host mode should apply when the account doesn't define one")
+
+	account.BidValidation.Mode = BidValidationEnforce
+	assert.Equal(t, BidValidationEnforce, account.BidValidation.ModeOrDefault(BidValidationWarn), "Account mode should win")
+
+	account.BidValidation.Mode = "strict"
+	assert.Equal(t, BidValidationWarn, account.BidValidation.ModeOrDefault(BidValidationWarn), "Unknown account modes should be ignored")
+}
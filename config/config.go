@@ -39,6 +39,12 @@ type Configuration struct {
 	CategoryMapping StoredRequestsSlim `mapstructure:"category_mapping"`
 	// Note that StoredVideo refers to stored video requests, and has nothing to do with caching video creatives.
 	StoredVideo StoredRequestsSlim `mapstructure:"stored_video_req"`
+	// Accounts configures the backends used to load per-publisher Account settings.
+	Accounts StoredRequestsSlim `mapstructure:"accounts"`
+	// AccountDefaults are the settings used for every account. Stored account data is merged on top of these.
+	AccountDefaults Account `mapstructure:"account_defaults"`
+	// StoredResponses configures the backends used to load Stored Auction Responses and Stored Bid Responses.
+	StoredResponses StoredRequestsSlim `mapstructure:"stored_responses"`
 
 	// Adapters should have a key for every openrtb_ext.BidderName, converted to lower-case.
 	// Se also: https://github.com/spf13/viper/issues/371#issuecomment-335388559
@@ -48,8 +54,14 @@ type Configuration struct {
 	AMPTimeoutAdjustment int64              `mapstructure:"amp_timeout_adjustment_ms"`
 	GDPR                 GDPR               `mapstructure:"gdpr"`
 	CCPA                 CCPA               `mapstructure:"ccpa"`
+	PriceFloors          PriceFloors        `mapstructure:"price_floors"`
+	Hooks                Hooks              `mapstructure:"hooks"`
 	CurrencyConverter    CurrencyConverter  `mapstructure:"currency_converter"`
 	DefReqConfig         DefReqConfig       `mapstructure:"default_request"`
+	Debug                Debug              `mapstructure:"debug"`
+	VASTTracking         VASTTracking       `mapstructure:"vast_tracking"`
+	BidValidation        BidValidation      `mapstructure:"bid_validation"`
+	TrafficShaping       TrafficShaping     `mapstructure:"traffic_shaping"`
 
 	VideoStoredRequestRequired bool `mapstructure:"video_stored_request_required"`
 
@@ -61,6 +73,8 @@ type Configuration struct {
 	BlacklistedAcctMap map[string]bool
 	// Is publisher/account ID required to be submitted in the OpenRTB2 request
 	AccountRequired bool `mapstructure:"account_required"`
+	// Should the legacy /auction endpoint run its auctions on the OpenRTB exchange, instead of the legacy adapters
+	LegacyAuctionUseExchange bool `mapstructure:"legacy_auction_use_exchange"`
 	// Local private file containing SSL certificates
 	PemCertsFile string `mapstructure:"certificates_file"`
 }
@@ -94,12 +108,22 @@ func (cfg *Configuration) validate() configErrors {
 	var errs configErrors
 	errs = cfg.AuctionTimeouts.validate(errs)
 	errs = cfg.StoredRequests.validate(errs)
+	errs = cfg.CategoryMapping.validate("category_mapping", errs)
+	errs = cfg.StoredVideo.validate("stored_video_req", errs)
+	errs = cfg.Accounts.validate("accounts", errs)
+	errs = cfg.StoredResponses.validate("stored_responses", errs)
 	errs = cfg.Metrics.validate(errs)
 	if cfg.MaxRequestSize < 0 {
 		errs = append(errs, fmt.Errorf("cfg.max_request_size must be >= 0. Got %d", cfg.MaxRequestSize))
 	}
+	errs = cfg.Analytics.validate(errs)
 	errs = cfg.GDPR.validate(errs)
 	errs = cfg.CurrencyConverter.validate(errs)
+	errs = cfg.PriceFloors.validate(errs)
+	errs = cfg.Hooks.validate(errs)
+	errs = cfg.VASTTracking.validate(errs)
+	errs = cfg.BidValidation.validate(errs)
+	errs = cfg.TrafficShaping.validate(errs)
 	errs = validateAdapters(cfg.Adapters, errs)
 	return errs
 }
@@ -165,8 +189,134 @@ type CCPA struct {
 	Enforce bool `mapstructure:"enforce"`
 }
 
+// Debug configures the debug info which can be returned in response.ext.debug.
+type Debug struct {
+	// Allowed can be set to false to ignore requests for debug info. Accounts can override it.
+	Allowed bool `mapstructure:"allowed"`
+}
+
+// VASTTracking configures the impression tracker which is added to the VAST of video bids before they're cached.
+type VASTTracking struct {
+	// ImpressionURL is a template for the tracker URL. Tracking is disabled if it's empty.
+	// The following macros will be replaced with URL-escaped values:
+	//
+	//   {{.Bidder}}    -- The bidder which made the bid
+	//   {{.BidID}}     -- The ID of the bid
+	//   {{.AccountID}} -- The ID of the account which made the request
+	//   {{.Timestamp}} -- The time of the auction, in milliseconds since the epoch
+	//
+	// For more info on templates, see: https://golang.org/pkg/text/template/
+	ImpressionURL string `mapstructure:"impression_url"`
+}
+
+func (cfg *VASTTracking) validate(errs configErrors) configErrors {
+	if cfg.ImpressionURL == "" {
+		return errs
+	}
+	trackerTemplate, err := template.New("vastTrackerTemplate").Parse(cfg.ImpressionURL)
+	if err != nil {
+		return append(errs, fmt.Errorf("Invalid vast_tracking.impression_url template: %s. %v", cfg.ImpressionURL, err))
+	}
+	dummyMacroValues := macros.VASTTrackerTemplateParams{
+		Bidder:    dummyBidder,
+		BidID:     dummyBidID,
+		AccountID: dummyPublisherID,
+		Timestamp: dummyTimestamp,
+	}
+	resolvedURL, err := macros.ResolveMacros(*trackerTemplate, dummyMacroValues)
+	if err != nil {
+		return append(errs, fmt.Errorf("Unable to resolve vast_tracking.impression_url: %s. %v", cfg.ImpressionURL, err))
+	}
+	if !validator.IsURL(resolvedURL) || !validator.IsRequestURL(resolvedURL) {
+		errs = append(errs, fmt.Errorf("vast_tracking.impression_url: %s is not a valid URL", resolvedURL))
+	}
+	return errs
+}
+
+// BidValidation configures the checks which make sure that bids suit the request they answer. Bids must match
+// one of the sizes and media types which their imp asked for, and must not use the request's badv or bcat.
+type BidValidation struct {
+	// Mode is the default for accounts which don't define their own. An empty Mode is the same as "skip".
+	Mode BidValidationMode `mapstructure:"mode"`
+}
+
+// BidValidationMode decides what happens to bids which fail validation.
+type BidValidationMode string
+
+const (
+	// BidValidationSkip turns the checks off.
+	BidValidationSkip BidValidationMode = "skip"
+	// BidValidationWarn keeps bids which fail, but reports a warning for each one.
+	BidValidationWarn BidValidationMode = "warn"
+	// BidValidationEnforce drops bids which fail from the auction, and reports a warning for each one.
+	BidValidationEnforce BidValidationMode = "enforce"
+)
+
+func (mode BidValidationMode) valid() bool {
+	return mode == BidValidationSkip || mode == BidValidationWarn || mode == BidValidationEnforce
+}
+
+func (cfg *BidValidation) validate(errs configErrors) configErrors {
+	if cfg.Mode != "" && !cfg.Mode.valid() {
+		errs = append(errs, fmt.Errorf("bid_validation.mode must be one of \"%s\", \"%s\" or \"%s\". Got \"%s\"", BidValidationSkip, BidValidationWarn, BidValidationEnforce, cfg.Mode))
+	}
+	return errs
+}
+
+// TrafficShaping configures the exchange to skip the bidders which rarely bid on the request's inventory.
+// Bid rates are tracked per bidder, site domain or app bundle, media type and country.
+type TrafficShaping struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinBidRate is the fraction of requests which a bidder must bid on for its requests to always be sent.
+	MinBidRate float64 `mapstructure:"min_bid_rate"`
+	// ExplorePercent is the percentage of requests which are sent to a bidder no matter how low its bid rate is,
+	// so that its bid rate keeps up if it starts bidding.
+	ExplorePercent float64 `mapstructure:"explore_percent"`
+	// MinRequests is the number of requests which a bidder must have seen for the inventory before its
+	// bid rate is trusted.
+	MinRequests int `mapstructure:"min_requests"`
+	// WindowRequests limits the history, so that recent requests count for more. The counts are halved
+	// each time they reach it. Use 0 to keep the whole history.
+	WindowRequests int `mapstructure:"window_requests"`
+}
+
+func (cfg *TrafficShaping) validate(errs configErrors) configErrors {
+	if cfg.MinBidRate < 0 || cfg.MinBidRate > 1 {
+		errs = append(errs, fmt.Errorf("traffic_shaping.min_bid_rate must be in the range [0, 1]. Got %g", cfg.MinBidRate))
+	}
+	if cfg.ExplorePercent < 0 || cfg.ExplorePercent > 100 {
+		errs = append(errs, fmt.Errorf("traffic_shaping.explore_percent must be in the range [0, 100]. Got %g", cfg.ExplorePercent))
+	}
+	if cfg.MinRequests < 0 {
+		errs = append(errs, fmt.Errorf("traffic_shaping.min_requests must not be negative. Got %d", cfg.MinRequests))
+	}
+	if cfg.WindowRequests != 0 && cfg.WindowRequests < 2*cfg.MinRequests {
+		errs = append(errs, fmt.Errorf("traffic_shaping.window_requests must be 0 or at least twice traffic_shaping.min_requests. Got %d", cfg.WindowRequests))
+	}
+	return errs
+}
+
+// PriceFloors configures the floors which the exchange enforces on every auction.
+type PriceFloors struct {
+	Enabled bool `mapstructure:"enabled"`
+	// RulesFile is the path to a JSON file with the floor rules. See the floors package for the format.
+	RulesFile string `mapstructure:"rules_file"`
+}
+
+func (cfg *PriceFloors) validate(errs configErrors) configErrors {
+	if cfg.Enabled && cfg.RulesFile == "" {
+		errs = append(errs, fmt.Errorf("price_floors.rules_file must be set when price_floors.enabled is true"))
+	}
+	return errs
+}
+
 type Analytics struct {
-	File FileLogs `mapstructure:"file"`
+	File   FileLogs        `mapstructure:"file"`
+	Stream StreamAnalytics `mapstructure:"stream"`
+}
+
+func (cfg *Analytics) validate(errs configErrors) configErrors {
+	return cfg.Stream.validate(errs)
 }
 
 type CurrencyConverter struct {
@@ -181,6 +331,90 @@ func (cfg *CurrencyConverter) validate(errs configErrors) configErrors {
 	return errs
 }
 
+// StreamAnalytics configures the analytics module which sends batches of events to an HTTP collector.
+type StreamAnalytics struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Endpoint is the collector URL. Each batch is POSTed as newline-delimited JSON.
+	Endpoint string `mapstructure:"endpoint"`
+	// Gzip compresses the batches before they're sent.
+	Gzip bool `mapstructure:"gzip"`
+	// TimeoutMS limits each POST to the collector.
+	TimeoutMS int `mapstructure:"timeout_ms"`
+	// QueueSize is the number of events which can wait to be batched. Events are dropped while the queue is full.
+	QueueSize int `mapstructure:"queue_size"`
+	// MaxRetries is the number of times a failed batch will be resent before it's dropped.
+	MaxRetries int `mapstructure:"max_retries"`
+	// RetryBackoffMS is the wait before the first retry. It doubles on each retry after that.
+	RetryBackoffMS int `mapstructure:"retry_backoff_ms"`
+	// ShutdownTimeoutMS is how long Prebid Server waits on shutdown for the queued events to be sent.
+	ShutdownTimeoutMS int               `mapstructure:"shutdown_timeout_ms"`
+	Buffers           StreamBuffers     `mapstructure:"buffers"`
+	SamplingRates     StreamSampleRates `mapstructure:"sampling_rates"`
+}
+
+// StreamBuffers defines when a batch gets sent. It's sent as soon as any of these limits are reached.
+type StreamBuffers struct {
+	EventCount      int `mapstructure:"event_count"`
+	MaxBytes        int `mapstructure:"max_bytes"`
+	FlushIntervalMS int `mapstructure:"flush_interval_ms"`
+}
+
+// StreamSampleRates are the fractions of each type of event which get sent. Use 0 to send none, and 1 to send all.
+type StreamSampleRates struct {
+	Auction    float64 `mapstructure:"auction"`
+	Amp        float64 `mapstructure:"amp"`
+	Video      float64 `mapstructure:"video"`
+	SetUID     float64 `mapstructure:"setuid"`
+	CookieSync float64 `mapstructure:"cookie_sync"`
+	Event      float64 `mapstructure:"event"`
+}
+
+func (cfg *StreamAnalytics) validate(errs configErrors) configErrors {
+	if !cfg.Enabled {
+		return errs
+	}
+	if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("analytics.stream.endpoint must be a valid URL. Got %q", cfg.Endpoint))
+	}
+	if cfg.TimeoutMS <= 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.timeout_ms must be positive. Got %d", cfg.TimeoutMS))
+	}
+	if cfg.QueueSize <= 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.queue_size must be positive. Got %d", cfg.QueueSize))
+	}
+	if cfg.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.max_retries must be >= 0. Got %d", cfg.MaxRetries))
+	}
+	if cfg.RetryBackoffMS < 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.retry_backoff_ms must be >= 0. Got %d", cfg.RetryBackoffMS))
+	}
+	if cfg.ShutdownTimeoutMS < 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.shutdown_timeout_ms must be >= 0. Got %d", cfg.ShutdownTimeoutMS))
+	}
+	if cfg.Buffers.EventCount <= 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.buffers.event_count must be positive. Got %d", cfg.Buffers.EventCount))
+	}
+	if cfg.Buffers.MaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.buffers.max_bytes must be positive. Got %d", cfg.Buffers.MaxBytes))
+	}
+	if cfg.Buffers.FlushIntervalMS <= 0 {
+		errs = append(errs, fmt.Errorf("analytics.stream.buffers.flush_interval_ms must be positive. Got %d", cfg.Buffers.FlushIntervalMS))
+	}
+	errs = validateSampleRate("auction", cfg.SamplingRates.Auction, errs)
+	errs = validateSampleRate("amp", cfg.SamplingRates.Amp, errs)
+	errs = validateSampleRate("video", cfg.SamplingRates.Video, errs)
+	errs = validateSampleRate("setuid", cfg.SamplingRates.SetUID, errs)
+	errs = validateSampleRate("cookie_sync", cfg.SamplingRates.CookieSync, errs)
+	return validateSampleRate("event", cfg.SamplingRates.Event, errs)
+}
+
+func validateSampleRate(event string, rate float64, errs configErrors) configErrors {
+	if rate < 0 || rate > 1 {
+		errs = append(errs, fmt.Errorf("analytics.stream.sampling_rates.%s must be in the range [0, 1]. Got %g", event, rate))
+	}
+	return errs
+}
+
 // FileLogs Corresponding config for FileLogger as a PBS Analytics Module
 type FileLogs struct {
 	Filename string `mapstructure:"filename"`
@@ -208,6 +442,9 @@ const (
 	dummyGDPR        string = "0"
 	dummyGDPRConsent string = "someGDPRConsentString"
 	dummyCCPA        string = "1NYN"
+	dummyBidder      string = "appnexus"
+	dummyBidID       string = "bid-1"
+	dummyTimestamp   string = "1600000000000"
 )
 
 type Adapter struct {
@@ -239,6 +476,44 @@ type Adapter struct {
 	// needed for Facebook
 	PlatformID string `mapstructure:"platform_id"`
 	AppSecret  string `mapstructure:"app_secret"`
+
+	// MaxIdleConns gives the bidder its own pool of HTTP connections, which keeps up to this many idle connections.
+	// If it's 0, the bidder shares the pool configured in http_client.
+	MaxIdleConns int `mapstructure:"max_idle_connections"`
+	// TimeoutMarginMs is taken off the auction's remaining time for the requests to this bidder, so that the
+	// connections to a slow bidder are given up before the auction ends.
+	TimeoutMarginMs int64 `mapstructure:"timeout_margin_ms"`
+	// Throttle caps the rate of requests which are sent to this bidder.
+	Throttle AdapterThrottle `mapstructure:"throttle"`
+}
+
+// AdapterThrottle caps the rate of requests which are sent to a bidder. Requests over the limit skip the bidder.
+//
+// The limits are token buckets: the bidder can be sent a burst of requests at once, and then QPS requests per second.
+// If a burst isn't set, it's one second's worth of requests.
+type AdapterThrottle struct {
+	// QPS caps the requests per second to the bidder from all accounts. 0 means no limit.
+	QPS   float64 `mapstructure:"qps"`
+	Burst int     `mapstructure:"burst"`
+	// AccountQPS caps the requests per second to the bidder from each account. 0 means no limit.
+	AccountQPS   float64 `mapstructure:"account_qps"`
+	AccountBurst int     `mapstructure:"account_burst"`
+}
+
+func (cfg *AdapterThrottle) validate(adapterName string, errs configErrors) configErrors {
+	if cfg.QPS < 0 {
+		errs = append(errs, fmt.Errorf("adapters.%s.throttle.qps must not be negative. Got %g", adapterName, cfg.QPS))
+	}
+	if cfg.Burst < 0 {
+		errs = append(errs, fmt.Errorf("adapters.%s.throttle.burst must not be negative. Got %d", adapterName, cfg.Burst))
+	}
+	if cfg.AccountQPS < 0 {
+		errs = append(errs, fmt.Errorf("adapters.%s.throttle.account_qps must not be negative. Got %g", adapterName, cfg.AccountQPS))
+	}
+	if cfg.AccountBurst < 0 {
+		errs = append(errs, fmt.Errorf("adapters.%s.throttle.account_burst must not be negative. Got %d", adapterName, cfg.AccountBurst))
+	}
+	return errs
 }
 
 // validateAdapterEndpoint makes sure that an adapter has a valid endpoint
@@ -315,6 +590,14 @@ func validateAdapters(adapterMap map[string]Adapter, errs configErrors) configEr
 
 			// Verify that valid user_sync URLs are specified in the config
 			errs = validateAdapterUserSyncURL(adapter.UserSyncURL, adapterName, errs)
+
+			if adapter.MaxIdleConns < 0 {
+				errs = append(errs, fmt.Errorf("adapters.%s.max_idle_connections must not be negative. Got %d", adapterName, adapter.MaxIdleConns))
+			}
+			if adapter.TimeoutMarginMs < 0 {
+				errs = append(errs, fmt.Errorf("adapters.%s.timeout_margin_ms must not be negative. Got %d", adapterName, adapter.TimeoutMarginMs))
+			}
+			errs = adapter.Throttle.validate(adapterName, errs)
 		}
 	}
 	return errs
@@ -329,6 +612,8 @@ type Metrics struct {
 type DisabledMetrics struct {
 	// True if we want to stop collecting account-to-adapter metrics
 	AccountAdapterDetails bool `mapstructure:"account_adapter_details"`
+	// True if we don't want to collect metrics about the HTTP connections to each adapter
+	AdapterConnectionMetrics bool `mapstructure:"adapter_connection_metrics"`
 }
 
 func (cfg *Metrics) validate(errs configErrors) configErrors {
@@ -585,6 +870,7 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("http_client.idle_connection_timeout_seconds", 60)
 	// no metrics configured by default (metrics{host|database|username|password})
 	v.SetDefault("metrics.disabled_metrics.account_adapter_details", false)
+	v.SetDefault("metrics.disabled_metrics.adapter_connection_metrics", true)
 	v.SetDefault("metrics.influxdb.host", "")
 	v.SetDefault("metrics.influxdb.database", "")
 	v.SetDefault("metrics.influxdb.username", "")
@@ -601,6 +887,10 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("category_mapping.filesystem.enabled", true)
 	v.SetDefault("category_mapping.filesystem.directorypath", "./static/category-mapping")
 	v.SetDefault("category_mapping.http.endpoint", "")
+	v.SetDefault("category_mapping.kv_store.enabled", false)
+	v.SetDefault("category_mapping.kv_store.path", "")
+	v.SetDefault("category_mapping.kv_store.load_endpoint", "")
+	v.SetDefault("category_mapping.kv_store.max_load_bytes", 1024*1024*64)
 	v.SetDefault("stored_requests.filesystem", false)
 	v.SetDefault("stored_requests.directorypath", "./stored_requests/data/by_id")
 	v.SetDefault("stored_requests.postgres.connection.dbname", "")
@@ -619,10 +909,22 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("stored_requests.postgres.poll_for_updates.amp_query", "")
 	v.SetDefault("stored_requests.http.endpoint", "")
 	v.SetDefault("stored_requests.http.amp_endpoint", "")
+	v.SetDefault("stored_requests.kv_store.enabled", false)
+	v.SetDefault("stored_requests.kv_store.path", "")
+	v.SetDefault("stored_requests.kv_store.load_endpoint", "")
+	v.SetDefault("stored_requests.kv_store.max_load_bytes", 1024*1024*64)
 	v.SetDefault("stored_requests.in_memory_cache.type", "none")
 	v.SetDefault("stored_requests.in_memory_cache.ttl_seconds", 0)
 	v.SetDefault("stored_requests.in_memory_cache.request_cache_size_bytes", 0)
 	v.SetDefault("stored_requests.in_memory_cache.imp_cache_size_bytes", 0)
+	v.SetDefault("stored_requests.redis_cache.enabled", false)
+	v.SetDefault("stored_requests.redis_cache.address", "")
+	v.SetDefault("stored_requests.redis_cache.password", "")
+	v.SetDefault("stored_requests.redis_cache.db", 0)
+	v.SetDefault("stored_requests.redis_cache.ttl_seconds", 0)
+	v.SetDefault("stored_requests.redis_cache.timeout_ms", 50)
+	v.SetDefault("stored_requests.redis_cache.pool_size", 10)
+	v.SetDefault("stored_requests.redis_cache.key_prefix", "pbs:stored_requests:")
 	v.SetDefault("stored_requests.cache_events_api", false)
 	v.SetDefault("stored_requests.http_events.endpoint", "")
 	v.SetDefault("stored_requests.http_events.amp_endpoint", "")
@@ -644,15 +946,100 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("stored_video_req.postgres.poll_for_updates.timeout_ms", 0)
 	v.SetDefault("stored_video_req.postgres.poll_for_updates.query", "")
 	v.SetDefault("stored_video_req.http.endpoint", "")
+	v.SetDefault("stored_video_req.kv_store.enabled", false)
+	v.SetDefault("stored_video_req.kv_store.path", "")
+	v.SetDefault("stored_video_req.kv_store.load_endpoint", "")
+	v.SetDefault("stored_video_req.kv_store.max_load_bytes", 1024*1024*64)
 	v.SetDefault("stored_video_req.in_memory_cache.type", "none")
 	v.SetDefault("stored_video_req.in_memory_cache.ttl_seconds", 0)
 	v.SetDefault("stored_video_req.in_memory_cache.request_cache_size_bytes", 0)
 	v.SetDefault("stored_video_req.in_memory_cache.imp_cache_size_bytes", 0)
+	v.SetDefault("stored_video_req.redis_cache.enabled", false)
+	v.SetDefault("stored_video_req.redis_cache.address", "")
+	v.SetDefault("stored_video_req.redis_cache.password", "")
+	v.SetDefault("stored_video_req.redis_cache.db", 0)
+	v.SetDefault("stored_video_req.redis_cache.ttl_seconds", 0)
+	v.SetDefault("stored_video_req.redis_cache.timeout_ms", 50)
+	v.SetDefault("stored_video_req.redis_cache.pool_size", 10)
+	v.SetDefault("stored_video_req.redis_cache.key_prefix", "pbs:stored_video_req:")
 	v.SetDefault("stored_video_req.cache_events.enabled", false)
 	v.SetDefault("stored_video_req.cache_events.endpoint", "")
 	v.SetDefault("stored_video_req.http_events.endpoint", "")
 	v.SetDefault("stored_video_req.http_events.refresh_rate_seconds", 0)
 	v.SetDefault("stored_video_req.http_events.timeout_ms", 0)
+	v.SetDefault("accounts.filesystem.enabled", false)
+	v.SetDefault("accounts.filesystem.directorypath", "./stored_requests/data/by_id")
+	v.SetDefault("accounts.postgres.connection.dbname", "")
+	v.SetDefault("accounts.postgres.connection.host", "")
+	v.SetDefault("accounts.postgres.connection.port", 0)
+	v.SetDefault("accounts.postgres.connection.user", "")
+	v.SetDefault("accounts.postgres.connection.password", "")
+	v.SetDefault("accounts.postgres.fetcher.query", "")
+	v.SetDefault("accounts.postgres.initialize_caches.timeout_ms", 0)
+	v.SetDefault("accounts.postgres.initialize_caches.query", "")
+	v.SetDefault("accounts.postgres.poll_for_updates.refresh_rate_seconds", 0)
+	v.SetDefault("accounts.postgres.poll_for_updates.timeout_ms", 0)
+	v.SetDefault("accounts.postgres.poll_for_updates.query", "")
+	v.SetDefault("accounts.http.endpoint", "")
+	v.SetDefault("accounts.kv_store.enabled", false)
+	v.SetDefault("accounts.kv_store.path", "")
+	v.SetDefault("accounts.kv_store.load_endpoint", "")
+	v.SetDefault("accounts.kv_store.max_load_bytes", 1024*1024*64)
+	v.SetDefault("accounts.in_memory_cache.type", "none")
+	v.SetDefault("accounts.in_memory_cache.ttl_seconds", 0)
+	v.SetDefault("accounts.in_memory_cache.request_cache_size_bytes", 0)
+	v.SetDefault("accounts.in_memory_cache.imp_cache_size_bytes", 0)
+	v.SetDefault("accounts.redis_cache.enabled", false)
+	v.SetDefault("accounts.redis_cache.address", "")
+	v.SetDefault("accounts.redis_cache.password", "")
+	v.SetDefault("accounts.redis_cache.db", 0)
+	v.SetDefault("accounts.redis_cache.ttl_seconds", 0)
+	v.SetDefault("accounts.redis_cache.timeout_ms", 50)
+	v.SetDefault("accounts.redis_cache.pool_size", 10)
+	v.SetDefault("accounts.redis_cache.key_prefix", "pbs:accounts:")
+	v.SetDefault("accounts.cache_events.enabled", false)
+	v.SetDefault("accounts.cache_events.endpoint", "/storedrequests/accounts")
+	v.SetDefault("accounts.http_events.endpoint", "")
+	v.SetDefault("accounts.http_events.refresh_rate_seconds", 0)
+	v.SetDefault("accounts.http_events.timeout_ms", 0)
+	v.SetDefault("stored_responses.filesystem.enabled", false)
+	v.SetDefault("stored_responses.filesystem.directorypath", "./stored_requests/data/by_id")
+	v.SetDefault("stored_responses.postgres.connection.dbname", "")
+	v.SetDefault("stored_responses.postgres.connection.host", "")
+	v.SetDefault("stored_responses.postgres.connection.port", 0)
+	v.SetDefault("stored_responses.postgres.connection.user", "")
+	v.SetDefault("stored_responses.postgres.connection.password", "")
+	v.SetDefault("stored_responses.postgres.fetcher.query", "")
+	v.SetDefault("stored_responses.postgres.initialize_caches.timeout_ms", 0)
+	v.SetDefault("stored_responses.postgres.initialize_caches.query", "")
+	v.SetDefault("stored_responses.postgres.poll_for_updates.refresh_rate_seconds", 0)
+	v.SetDefault("stored_responses.postgres.poll_for_updates.timeout_ms", 0)
+	v.SetDefault("stored_responses.postgres.poll_for_updates.query", "")
+	v.SetDefault("stored_responses.http.endpoint", "")
+	v.SetDefault("stored_responses.kv_store.enabled", false)
+	v.SetDefault("stored_responses.kv_store.path", "")
+	v.SetDefault("stored_responses.kv_store.load_endpoint", "")
+	v.SetDefault("stored_responses.kv_store.max_load_bytes", 1024*1024*64)
+	v.SetDefault("stored_responses.in_memory_cache.type", "none")
+	v.SetDefault("stored_responses.in_memory_cache.ttl_seconds", 0)
+	v.SetDefault("stored_responses.in_memory_cache.request_cache_size_bytes", 0)
+	v.SetDefault("stored_responses.in_memory_cache.imp_cache_size_bytes", 0)
+	v.SetDefault("stored_responses.redis_cache.enabled", false)
+	v.SetDefault("stored_responses.redis_cache.address", "")
+	v.SetDefault("stored_responses.redis_cache.password", "")
+	v.SetDefault("stored_responses.redis_cache.db", 0)
+	v.SetDefault("stored_responses.redis_cache.ttl_seconds", 0)
+	v.SetDefault("stored_responses.redis_cache.timeout_ms", 50)
+	v.SetDefault("stored_responses.redis_cache.pool_size", 10)
+	v.SetDefault("stored_responses.redis_cache.key_prefix", "pbs:stored_responses:")
+	v.SetDefault("stored_responses.cache_events.enabled", false)
+	v.SetDefault("stored_responses.cache_events.endpoint", "/storedrequests/responses")
+	v.SetDefault("stored_responses.http_events.endpoint", "")
+	v.SetDefault("stored_responses.http_events.refresh_rate_seconds", 0)
+	v.SetDefault("stored_responses.http_events.timeout_ms", 0)
+	v.SetDefault("account_defaults.disabled", false)
+	v.SetDefault("account_defaults.default_timeout_ms", 0)
+	v.SetDefault("account_defaults.events.enabled", false)
 
 	for _, bidder := range openrtb_ext.BidderMap {
 		setBidderDefaults(v, strings.ToLower(string(bidder)))
@@ -720,6 +1107,23 @@ func SetupViper(v *viper.Viper, filename string) {
 
 	v.SetDefault("max_request_size", 1024*256)
 	v.SetDefault("analytics.file.filename", "")
+	v.SetDefault("analytics.stream.enabled", false)
+	v.SetDefault("analytics.stream.endpoint", "")
+	v.SetDefault("analytics.stream.gzip", true)
+	v.SetDefault("analytics.stream.timeout_ms", 2000)
+	v.SetDefault("analytics.stream.queue_size", 10000)
+	v.SetDefault("analytics.stream.max_retries", 3)
+	v.SetDefault("analytics.stream.retry_backoff_ms", 100)
+	v.SetDefault("analytics.stream.shutdown_timeout_ms", 5000)
+	v.SetDefault("analytics.stream.buffers.event_count", 100)
+	v.SetDefault("analytics.stream.buffers.max_bytes", 1024*1024)
+	v.SetDefault("analytics.stream.buffers.flush_interval_ms", 5000)
+	v.SetDefault("analytics.stream.sampling_rates.auction", 1)
+	v.SetDefault("analytics.stream.sampling_rates.amp", 1)
+	v.SetDefault("analytics.stream.sampling_rates.video", 1)
+	v.SetDefault("analytics.stream.sampling_rates.setuid", 1)
+	v.SetDefault("analytics.stream.sampling_rates.cookie_sync", 1)
+	v.SetDefault("analytics.stream.sampling_rates.event", 1)
 	v.SetDefault("amp_timeout_adjustment_ms", 0)
 	v.SetDefault("gdpr.host_vendor_id", 0)
 	v.SetDefault("gdpr.usersync_if_ambiguous", false)
@@ -727,6 +1131,18 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("gdpr.timeouts_ms.active_vendorlist_fetch", 0)
 	v.SetDefault("gdpr.non_standard_publishers", []string{""})
 	v.SetDefault("ccpa.enforce", false)
+	v.SetDefault("debug.allowed", true)
+	v.SetDefault("vast_tracking.impression_url", "")
+	v.SetDefault("bid_validation.mode", string(BidValidationSkip))
+	v.SetDefault("traffic_shaping.enabled", false)
+	v.SetDefault("traffic_shaping.min_bid_rate", 0.01)
+	v.SetDefault("traffic_shaping.explore_percent", 5)
+	v.SetDefault("traffic_shaping.min_requests", 200)
+	v.SetDefault("traffic_shaping.window_requests", 10000)
+	v.SetDefault("price_floors.enabled", false)
+	v.SetDefault("price_floors.rules_file", "")
+	v.SetDefault("hooks.enabled", false)
+	v.SetDefault("hooks.default_timeout_ms", 20)
 	v.SetDefault("currency_converter.fetch_url", "https://cdn.jsdelivr.net/gh/prebid/currency-file@1/latest.json")
 	v.SetDefault("currency_converter.fetch_interval_seconds", 1800) // fetch currency rates every 30 minutes
 	v.SetDefault("default_request.type", "")
@@ -735,6 +1151,7 @@ func SetupViper(v *viper.Viper, filename string) {
 	v.SetDefault("blacklisted_apps", []string{""})
 	v.SetDefault("blacklisted_accts", []string{""})
 	v.SetDefault("account_required", false)
+	v.SetDefault("legacy_auction_use_exchange", false)
 	v.SetDefault("certificates_file", "")
 
 	// Set environment variable support:
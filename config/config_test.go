@@ -31,9 +31,15 @@ func TestDefaults(t *testing.T) {
 	cmpInts(t, "currency_converter.fetch_interval_seconds", cfg.CurrencyConverter.FetchIntervalSeconds, 1800)
 	cmpStrings(t, "currency_converter.fetch_url", cfg.CurrencyConverter.FetchURL, "https://cdn.jsdelivr.net/gh/prebid/currency-file@1/latest.json")
 	cmpBools(t, "account_required", cfg.AccountRequired, false)
+	cmpBools(t, "legacy_auction_use_exchange", cfg.LegacyAuctionUseExchange, false)
+	cmpBools(t, "stored_requests.kv_store.enabled", cfg.StoredRequests.KVStore.Enabled, false)
+	cmpBools(t, "category_mapping.kv_store.enabled", cfg.CategoryMapping.KVStore.Enabled, false)
+	cmpInts(t, "stored_requests.kv_store.max_load_bytes", int(cfg.StoredRequests.KVStore.MaxLoadBytes), 1024*1024*64)
 	cmpInts(t, "metrics.influxdb.collection_rate_seconds", cfg.Metrics.Influxdb.MetricSendInterval, 20)
 	cmpBools(t, "account_adapter_details", cfg.Metrics.Disabled.AccountAdapterDetails, false)
+	cmpBools(t, "adapter_connection_metrics", cfg.Metrics.Disabled.AdapterConnectionMetrics, true)
 	cmpStrings(t, "certificates_file", cfg.PemCertsFile, "")
+	cmpBools(t, "debug.allowed", cfg.Debug.Allowed, true)
 }
 
 var fullConfig = []byte(`
@@ -81,6 +87,7 @@ metrics:
     metric_send_interval: 30
   disabled_metrics:
     account_adapter_details: true
+    adapter_connection_metrics: false
 datacache:
   type: postgres
   filename: /usr/db/db.db
@@ -90,6 +97,8 @@ adapters:
   appnexus:
     endpoint: http://ib.adnxs.com/some/endpoint
     extra_info: "{\"native\":\"http://www.native.org/endpoint\",\"video\":\"http://www.video.org/endpoint\"}"
+    max_idle_connections: 20
+    timeout_margin_ms: 50
   audienceNetwork:
     endpoint: http://facebook.com/pbs
     usersync_url: http://facebook.com/ortb/prebid-s2s
@@ -110,6 +119,7 @@ adapters:
      usersync_url: https://tag.adkernel.com/syncr?gdpr={{.GDPR}}&gdpr_consent={{.GDPRConsent}}&r=
 blacklisted_apps: ["spamAppID","sketchy-app-id"]
 account_required: true
+legacy_auction_use_exchange: true
 certificates_file: /etc/ssl/cert.pem
 `)
 
@@ -233,6 +243,8 @@ func TestFullConfig(t *testing.T) {
 	cmpBools(t, "cfg.GDPR.NonStandardPublisherMap", found, false)
 
 	cmpBools(t, "ccpa.enforce", cfg.CCPA.Enforce, true)
+	cmpInts(t, "adapters.appnexus.max_idle_connections", cfg.Adapters["appnexus"].MaxIdleConns, 20)
+	cmpInts(t, "adapters.appnexus.timeout_margin_ms", int(cfg.Adapters["appnexus"].TimeoutMarginMs), 50)
 
 	//Assert the NonStandardPublishers was correctly unmarshalled
 	cmpStrings(t, "blacklisted_apps", cfg.BlacklistedApps[0], "spamAppID")
@@ -274,7 +286,9 @@ func TestFullConfig(t *testing.T) {
 	cmpStrings(t, "adapters.rhythmone.endpoint", cfg.Adapters[string(openrtb_ext.BidderRhythmone)].Endpoint, "http://tag.1rx.io/rmp")
 	cmpStrings(t, "adapters.rhythmone.usersync_url", cfg.Adapters[string(openrtb_ext.BidderRhythmone)].UserSyncURL, "https://sync.1rx.io/usersync2/rmphb?gdpr={{.GDPR}}&gdpr_consent={{.GDPRConsent}}&us_privacy={{.USPrivacy}}&redir=http%3A%2F%2Fprebid-server.prebid.org%2F%2Fsetuid%3Fbidder%3Drhythmone%26gdpr%3D{{.GDPR}}%26gdpr_consent%3D{{.GDPRConsent}}%26uid%3D%5BRX_UUID%5D")
 	cmpBools(t, "account_required", cfg.AccountRequired, true)
+	cmpBools(t, "legacy_auction_use_exchange", cfg.LegacyAuctionUseExchange, true)
 	cmpBools(t, "account_adapter_details", cfg.Metrics.Disabled.AccountAdapterDetails, true)
+	cmpBools(t, "adapter_connection_metrics", cfg.Metrics.Disabled.AdapterConnectionMetrics, false)
 	cmpStrings(t, "certificates_file", cfg.PemCertsFile, "/etc/ssl/cert.pem")
 }
 
@@ -348,6 +362,34 @@ func TestNegativeRequestSize(t *testing.T) {
 	assertOneError(t, cfg.validate(), "cfg.max_request_size must be >= 0. Got -1")
 }
 
+func TestNegativeAdapterConnectionConfig(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	appnexus := cfg.Adapters["appnexus"]
+	appnexus.MaxIdleConns = -1
+	cfg.Adapters["appnexus"] = appnexus
+	assertOneError(t, cfg.validate(), "adapters.appnexus.max_idle_connections must not be negative. Got -1")
+
+	appnexus.MaxIdleConns = 0
+	appnexus.TimeoutMarginMs = -1
+	cfg.Adapters["appnexus"] = appnexus
+	assertOneError(t, cfg.validate(), "adapters.appnexus.timeout_margin_ms must not be negative. Got -1")
+}
+
+func TestNegativeAdapterThrottle(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	appnexus := cfg.Adapters["appnexus"]
+	appnexus.Throttle = AdapterThrottle{QPS: -1, Burst: -2, AccountQPS: -3, AccountBurst: -4}
+	cfg.Adapters["appnexus"] = appnexus
+
+	errs := cfg.validate()
+	if assert.Len(t, errs, 4) {
+		assert.EqualError(t, errs[0], "adapters.appnexus.throttle.qps must not be negative. Got -1")
+		assert.EqualError(t, errs[1], "adapters.appnexus.throttle.burst must not be negative. Got -2")
+		assert.EqualError(t, errs[2], "adapters.appnexus.throttle.account_qps must not be negative. Got -3")
+		assert.EqualError(t, errs[3], "adapters.appnexus.throttle.account_burst must not be negative. Got -4")
+	}
+}
+
 func TestNegativeVendorID(t *testing.T) {
 	cfg := newDefaultConfig(t)
 	cfg.GDPR.HostVendorID = -1
@@ -367,6 +409,144 @@ func TestOverflowedVendorID(t *testing.T) {
 	assertOneError(t, cfg.validate(), "gdpr.host_vendor_id must be in the range [0, 65535]. Got 65536")
 }
 
+func TestInvalidStreamAnalytics(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.Analytics.Stream.Enabled = true
+	cfg.Analytics.Stream.Endpoint = "http://collector.example.com/events"
+	assert.Empty(t, cfg.validate(), "The stream analytics defaults should be valid")
+
+	cfg.Analytics.Stream.SamplingRates.Amp = 1.5
+	assertOneError(t, cfg.validate(), "analytics.stream.sampling_rates.amp must be in the range [0, 1]. Got 1.5")
+
+	cfg.Analytics.Stream.SamplingRates.Amp = 1
+	cfg.Analytics.Stream.Endpoint = ""
+	assertOneError(t, cfg.validate(), "analytics.stream.endpoint must be a valid URL. Got \"\"")
+
+	cfg.Analytics.Stream.Endpoint = "http://collector.example.com/events"
+	cfg.Analytics.Stream.ShutdownTimeoutMS = -1
+	assertOneError(t, cfg.validate(), "analytics.stream.shutdown_timeout_ms must be >= 0. Got -1")
+}
+
+func TestInvalidHooksTimeout(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.Hooks.Enabled = true
+	cfg.Hooks.DefaultTimeoutMS = 0
+	assertOneError(t, cfg.validate(), "hooks.default_timeout_ms must be positive when hooks.enabled is true. Got 0")
+}
+
+func TestInvalidHooksExecutionPlan(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.Hooks.Enabled = true
+	cfg.Hooks.ExecutionPlan = HookExecutionPlan{
+		Endpoints: map[string]HookEndpointPlan{
+			"/openrtb2/auction": {Stages: map[string][]HookInvocation{
+				"entrypoint": {{Module: "acme_optimizer"}, {Module: "acme_other", TimeoutMS: -1}},
+			}},
+		},
+	}
+	assertOneError(t, cfg.validate(), "hooks.execution_plan.endpoints./openrtb2/auction.stages.entrypoint[1].timeout_ms must be >= 0. Got -1")
+}
+
+func TestInvalidHooksModuleNames(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.Hooks.Enabled = true
+	cfg.Hooks.Modules = map[string]map[string]interface{}{"acme.optimizer": {}}
+	assertOneError(t, cfg.validate(), "hooks.modules.acme.optimizer is not a valid module name. Module names can't contain dots")
+
+	cfg.Hooks.Modules = nil
+	cfg.Hooks.ExecutionPlan = HookExecutionPlan{
+		Endpoints: map[string]HookEndpointPlan{
+			"/openrtb2/auction": {Stages: map[string][]HookInvocation{
+				"entrypoint": {{Module: "acme_optimizer"}, {Module: "acme.optimizer"}},
+			}},
+		},
+	}
+	assertOneError(t, cfg.validate(), `hooks.execution_plan.endpoints./openrtb2/auction.stages.entrypoint[1].module "acme.optimizer" is not a valid module name. Module names can't contain dots`)
+}
+
+func TestHooksModulesFromViper(t *testing.T) {
+	v := viper.New()
+	SetupViper(v, "")
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewBuffer([]byte(`
+hooks:
+  enabled: true
+  modules:
+    acme_optimizer:
+      enabled: true
+  execution_plan:
+    endpoints:
+      /openrtb2/auction:
+        stages:
+          entrypoint:
+            - module: acme_optimizer
+`))); err != nil {
+		t.Fatalf("Failed to read the config: %v", err)
+	}
+	cfg, err := New(v)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]map[string]interface{}{"acme_optimizer": {"enabled": true}}, cfg.Hooks.Modules)
+}
+
+func TestVASTTrackingImpressionURL(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.VASTTracking.ImpressionURL = "https://tracker.com/imp?bidder={{.Bidder}}&bid={{.BidID}}&account={{.AccountID}}&ts={{.Timestamp}}"
+	assert.Empty(t, cfg.validate())
+
+	cfg.VASTTracking.ImpressionURL = "https://tracker.com/imp?bidder={{.Bidder"
+	assert.Len(t, cfg.validate(), 1, "Invalid templates should be rejected")
+
+	cfg.VASTTracking.ImpressionURL = "https://tracker.com/imp?user={{.UserID}}"
+	assert.Len(t, cfg.validate(), 1, "Unknown macros should be rejected")
+
+	cfg.VASTTracking.ImpressionURL = "tracker/{{.BidID}}"
+	assertOneError(t, cfg.validate(), "vast_tracking.impression_url: tracker/bid-1 is not a valid URL")
+}
+
+func TestInvalidBidValidationMode(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	assert.Equal(t, BidValidationSkip, cfg.BidValidation.Mode)
+
+	cfg.BidValidation.Mode = "strict"
+	assertOneError(t, cfg.validate(), `bid_validation.mode must be one of "skip", "warn" or "enforce". Got "strict"`)
+}
+
+func TestTrafficShaping(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	assert.False(t, cfg.TrafficShaping.Enabled)
+	assert.Empty(t, cfg.validate(), "The defaults should be valid")
+
+	cfg.TrafficShaping = TrafficShaping{MinBidRate: 1.5, ExplorePercent: -1, MinRequests: -2}
+	errs := cfg.validate()
+	if assert.Len(t, errs, 3) {
+		assert.EqualError(t, errs[0], "traffic_shaping.min_bid_rate must be in the range [0, 1]. Got 1.5")
+		assert.EqualError(t, errs[1], "traffic_shaping.explore_percent must be in the range [0, 100]. Got -1")
+		assert.EqualError(t, errs[2], "traffic_shaping.min_requests must not be negative. Got -2")
+	}
+
+	cfg.TrafficShaping = TrafficShaping{MinRequests: 100, WindowRequests: 150}
+	assertOneError(t, cfg.validate(), "traffic_shaping.window_requests must be 0 or at least twice traffic_shaping.min_requests. Got 150")
+}
+
+func TestKVStorePath(t *testing.T) {
+	cfg := newDefaultConfig(t)
+	cfg.StoredRequests.KVStore = KVFetcherConfig{Enabled: true, Path: "/var/pbs/stored.db", LoadEndpoint: "/storedrequests/load", MaxLoadBytes: 1024}
+	assert.Empty(t, cfg.validate())
+
+	cfg.StoredRequests.KVStore.MaxLoadBytes = 0
+	assertOneError(t, cfg.validate(), "stored_requests.kv_store.max_load_bytes must be positive if stored_requests.kv_store.load_endpoint is set. Got 0")
+	cfg.StoredRequests.KVStore.MaxLoadBytes = 1024
+
+	cfg.StoredRequests.KVStore.Path = ""
+	assertOneError(t, cfg.validate(), "stored_requests.kv_store.path must be set if stored_requests.kv_store.enabled=true")
+
+	cfg.StoredRequests.KVStore = KVFetcherConfig{}
+	cfg.CategoryMapping.KVStore.Enabled = true
+	assertOneError(t, cfg.validate(), "category_mapping.kv_store.path must be set if category_mapping.kv_store.enabled=true")
+}
+
 func TestNegativeCurrencyConverterFetchInterval(t *testing.T) {
 	cfg := Configuration{
 		CurrencyConverter: CurrencyConverter{
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hooks configures the modules which can run custom logic at fixed stages of the auction.
+// See the modules package for the stages and the interfaces which modules implement.
+type Hooks struct {
+	Enabled bool `mapstructure:"enabled"`
+	// DefaultTimeoutMS is the time budget for hook invocations which don't define their own timeout_ms.
+	DefaultTimeoutMS int `mapstructure:"default_timeout_ms"`
+	// Modules holds the host config for each module, keyed by module name. Modules are only built
+	// if they have an entry here. Module names can't contain dots, since viper would split the keys on them.
+	Modules map[string]map[string]interface{} `mapstructure:"modules"`
+	// ExecutionPlan defines which modules run on every request.
+	ExecutionPlan HookExecutionPlan `mapstructure:"execution_plan"`
+}
+
+// HookExecutionPlan lists the modules which run at each stage of each endpoint.
+//
+// For example:
+//
+//   endpoints:
+//     /openrtb2/auction:
+//       stages:
+//         processed_auction_request:
+//           - module: acme_optimizer
+//             timeout_ms: 10
+type HookExecutionPlan struct {
+	Endpoints map[string]HookEndpointPlan `mapstructure:"endpoints" json:"endpoints,omitempty"`
+}
+
+// HookEndpointPlan lists the modules which run at each stage of a single endpoint.
+type HookEndpointPlan struct {
+	Stages map[string][]HookInvocation `mapstructure:"stages" json:"stages,omitempty"`
+}
+
+// HookInvocation runs a single module at some stage. Modules run in the order they're listed.
+type HookInvocation struct {
+	Module string `mapstructure:"module" json:"module"`
+	// TimeoutMS is the time budget for this invocation. Use 0 for hooks.default_timeout_ms.
+	TimeoutMS int `mapstructure:"timeout_ms" json:"timeout_ms,omitempty"`
+}
+
+func (cfg *Hooks) validate(errs configErrors) configErrors {
+	if !cfg.Enabled {
+		return errs
+	}
+	if cfg.DefaultTimeoutMS <= 0 {
+		errs = append(errs, fmt.Errorf("hooks.default_timeout_ms must be positive when hooks.enabled is true. Got %d", cfg.DefaultTimeoutMS))
+	}
+	for name := range cfg.Modules {
+		if strings.Contains(name, ".") {
+			errs = append(errs, fmt.Errorf("hooks.modules.%s is not a valid module name. Module names can't contain dots", name))
+		}
+	}
+	return cfg.ExecutionPlan.validate("hooks.execution_plan", errs)
+}
+
+func (plan *HookExecutionPlan) validate(path string, errs configErrors) configErrors {
+	for endpoint, endpointPlan := range plan.Endpoints {
+		for stage, invocations := range endpointPlan.Stages {
+			for i, invocation := range invocations {
+				if invocation.Module == "" {
+					errs = append(errs, fmt.Errorf("%s.endpoints.%s.stages.%s[%d].module must be defined", path, endpoint, stage, i))
+				} else if strings.Contains(invocation.Module, ".") {
+					errs = append(errs, fmt.Errorf("%s.endpoints.%s.stages.%s[%d].module %q is not a valid module name. Module names can't contain dots", path, endpoint, stage, i, invocation.Module))
+				}
+				if invocation.TimeoutMS < 0 {
+					errs = append(errs, fmt.Errorf("%s.endpoints.%s.stages.%s[%d].timeout_ms must be >= 0. Got %d", path, endpoint, stage, i, invocation.TimeoutMS))
+				}
+			}
+		}
+	}
+	return errs
+}
@@ -24,9 +24,15 @@ type StoredRequests struct {
 	// HTTP configures an instance of stored_requests/backends/http/http_fetcher.go.
 	// If non-nil, Stored Requests will be fetched from the endpoint described there.
 	HTTP HTTPFetcherConfig `mapstructure:"http"`
+	// KVStore configures an instance of stored_requests/backends/kv_fetcher/fetcher.go.
+	// AMP Stored Requests are read from the same file.
+	KVStore KVFetcherConfig `mapstructure:"kv_store"`
 	// InMemoryCache configures an instance of stored_requests/caches/memory/cache.go.
 	// If non-nil, Stored Requests will be saved in an in-memory cache.
 	InMemoryCache InMemoryCache `mapstructure:"in_memory_cache"`
+	// RedisCache configures an instance of stored_requests/caches/redis/cache.go.
+	// If enabled, Stored Requests will be shared between PBS instances through Redis. It's used after the in-memory cache.
+	RedisCache RedisCache `mapstructure:"redis_cache"`
 	// CacheEventsAPI configures an instance of stored_requests/events/api/api.go.
 	// If non-nil, Stored Request Caches can be updated or invalidated through API endpoints.
 	// This is intended to be a useful development tool and not recommended for a production environment.
@@ -49,9 +55,15 @@ type StoredRequestsSlim struct {
 	// HTTP configures an instance of stored_requests/backends/http/http_fetcher.go.
 	// If non-nil, Stored Requests will be fetched from the endpoint described there.
 	HTTP HTTPFetcherConfigSlim `mapstructure:"http"`
+	// KVStore configures an instance of stored_requests/backends/kv_fetcher/fetcher.go.
+	// If enabled, Stored Requests will be fetched from a single file on the local disk.
+	KVStore KVFetcherConfig `mapstructure:"kv_store"`
 	// InMemoryCache configures an instance of stored_requests/caches/memory/cache.go.
 	// If non-nil, Stored Requests will be saved in an in-memory cache.
 	InMemoryCache InMemoryCache `mapstructure:"in_memory_cache"`
+	// RedisCache configures an instance of stored_requests/caches/redis/cache.go.
+	// If enabled, Stored Requests will be shared between PBS instances through Redis. It's used after the in-memory cache.
+	RedisCache RedisCache `mapstructure:"redis_cache"`
 	// CacheEvents configures an instance of stored_requests/events/api/api.go.
 	// This is a sub-object containing the endpoint name to use for this API endpoint.
 	CacheEvents CacheEventsConfig `mapstructure:"cache_events"`
@@ -107,6 +119,31 @@ type FileFetcherConfig struct {
 	Path string `mapstructure:"directorypath"`
 }
 
+// KVFetcherConfig configures a stored_requests/backends/kv_fetcher/fetcher.go
+type KVFetcherConfig struct {
+	// Enabled should be true if Stored Requests should be loaded from the file.
+	Enabled bool `mapstructure:"enabled"`
+	// Path to the file. It's created by the first load if it doesn't exist.
+	Path string `mapstructure:"path"`
+	// LoadEndpoint is the url path of an endpoint which bulk loads data into the file. It's disabled if empty.
+	// Fetchers which use the same Path share the loaded data, so only one of them needs an endpoint.
+	// It should not be exposed to public networks without authentication.
+	LoadEndpoint string `mapstructure:"load_endpoint"`
+	// MaxLoadBytes is the largest request body which the LoadEndpoint accepts.
+	MaxLoadBytes int64 `mapstructure:"max_load_bytes"`
+}
+
+// validate checks the config in the given section, like "stored_requests".
+func (cfg *KVFetcherConfig) validate(section string, errs configErrors) configErrors {
+	if cfg.Enabled && cfg.Path == "" {
+		errs = append(errs, fmt.Errorf("%s.kv_store.path must be set if %s.kv_store.enabled=true", section, section))
+	}
+	if cfg.Enabled && cfg.LoadEndpoint != "" && cfg.MaxLoadBytes <= 0 {
+		errs = append(errs, fmt.Errorf("%s.kv_store.max_load_bytes must be positive if %s.kv_store.load_endpoint is set. Got %d", section, section, cfg.MaxLoadBytes))
+	}
+	return errs
+}
+
 // HTTPFetcherConfigSlim configures a stored_requests/backends/http_fetcher/fetcher.go
 type HTTPFetcherConfigSlim struct {
 	Endpoint string `mapstructure:"endpoint"`
@@ -136,7 +173,17 @@ func (cfg *StoredRequests) validate(errs configErrors) configErrors {
 		}
 	}
 	errs = cfg.InMemoryCache.validate(errs)
+	errs = cfg.RedisCache.validate("stored_requests", errs)
 	errs = cfg.Postgres.validate(errs)
+	errs = cfg.KVStore.validate("stored_requests", errs)
+	return errs
+}
+
+// validate checks the options which the sections using StoredRequestsSlim share with stored_requests.
+// The section is the config key, like "accounts".
+func (cfg *StoredRequestsSlim) validate(section string, errs configErrors) configErrors {
+	errs = cfg.RedisCache.validate(section, errs)
+	errs = cfg.KVStore.validate(section, errs)
 	return errs
 }
 
@@ -499,3 +546,35 @@ func (cfg *InMemoryCache) validate(errs configErrors) configErrors {
 	}
 	return errs
 }
+
+// RedisCache configures a stored_requests/caches/redis/cache.go
+type RedisCache struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Address is the host:port of the Redis server.
+	Address  string `mapstructure:"address"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// TTL is the number of seconds that values will stay in Redis. TTL <= 0 means that they never expire.
+	TTL       int `mapstructure:"ttl_seconds"`
+	TimeoutMS int `mapstructure:"timeout_ms"`
+	// PoolSize is the max number of idle connections which are kept open.
+	PoolSize int `mapstructure:"pool_size"`
+	// KeyPrefix is added to every key, so that different data types and PBS clusters can share a Redis server.
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+func (cfg *RedisCache) validate(section string, errs configErrors) configErrors {
+	if !cfg.Enabled {
+		return errs
+	}
+	if cfg.Address == "" {
+		errs = append(errs, fmt.Errorf("%s.redis_cache.address must be defined when %s.redis_cache.enabled=true", section, section))
+	}
+	if cfg.TimeoutMS <= 0 {
+		errs = append(errs, fmt.Errorf("%s.redis_cache.timeout_ms must be > 0. Got %d", section, cfg.TimeoutMS))
+	}
+	if cfg.PoolSize < 0 {
+		errs = append(errs, fmt.Errorf("%s.redis_cache.pool_size must be >= 0. Got %d", section, cfg.PoolSize))
+	}
+	return errs
+}
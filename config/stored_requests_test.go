@@ -114,6 +114,43 @@ func TestInMemoryCacheValidation(t *testing.T) {
 	}).validate(nil))
 }
 
+func TestRedisCacheValidation(t *testing.T) {
+	assertNoErrs(t, (&RedisCache{}).validate("stored_requests", nil))
+	assertNoErrs(t, (&RedisCache{
+		Enabled:   true,
+		Address:   "localhost:6379",
+		TimeoutMS: 50,
+	}).validate("stored_requests", nil))
+	assertErrsExist(t, (&RedisCache{
+		Enabled:   true,
+		TimeoutMS: 50,
+	}).validate("stored_requests", nil))
+	assertErrsExist(t, (&RedisCache{
+		Enabled: true,
+		Address: "localhost:6379",
+	}).validate("stored_requests", nil))
+	assertErrsExist(t, (&RedisCache{
+		Enabled:   true,
+		Address:   "localhost:6379",
+		TimeoutMS: 50,
+		PoolSize:  -1,
+	}).validate("stored_requests", nil))
+}
+
+func TestStoredRequestsSlimValidation(t *testing.T) {
+	errs := (&StoredRequestsSlim{
+		RedisCache: RedisCache{
+			Enabled:   true,
+			TimeoutMS: 50,
+		},
+	}).validate("accounts", nil)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error. Got %v", errs)
+	}
+	assertStringsEqual(t, errs[0].Error(), "accounts.redis_cache.address must be defined when accounts.redis_cache.enabled=true")
+	assertNoErrs(t, (&StoredRequestsSlim{}).validate("accounts", nil))
+}
+
 func assertErrsExist(t *testing.T, err configErrors) {
 	t.Helper()
 	if len(err) == 0 {
@@ -0,0 +1,44 @@
+package currencies
+
+// AggregateConversions looks up rates in a request's custom rates first, and falls back to the server's rates
+// for any conversion which the custom rates don't have.
+type AggregateConversions struct {
+	customRates Conversions
+	serverRates Conversions
+}
+
+// NewAggregateConversions creates a new AggregateConversions. The customRates take priority over the serverRates.
+func NewAggregateConversions(customRates Conversions, serverRates Conversions) *AggregateConversions {
+	return &AggregateConversions{
+		customRates: customRates,
+		serverRates: serverRates,
+	}
+}
+
+// GetRate returns the conversion rate between two currencies, using the custom rates if they have one.
+func (a *AggregateConversions) GetRate(from string, to string) (float64, error) {
+	if rate, err := a.customRates.GetRate(from, to); err == nil {
+		return rate, nil
+	}
+	return a.serverRates.GetRate(from, to)
+}
+
+// GetRates returns the server's rates, with the custom rates merged on top of them.
+func (a *AggregateConversions) GetRates() *map[string]map[string]float64 {
+	merged := make(map[string]map[string]float64)
+	for _, rates := range []Conversions{a.serverRates, a.customRates} {
+		conversions := rates.GetRates()
+		if conversions == nil {
+			continue
+		}
+		for from, toRates := range *conversions {
+			if merged[from] == nil {
+				merged[from] = make(map[string]float64, len(toRates))
+			}
+			for to, rate := range toRates {
+				merged[from][to] = rate
+			}
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,69 @@
+package currencies_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/prebid/prebid-server/currencies"
+)
+
+func TestGetRate_AggregateConversions(t *testing.T) {
+
+	// Setup:
+	customRates := currencies.NewRates(time.Time{}, map[string]map[string]float64{
+		"USD": {
+			"GBP": 0.5,
+		},
+	})
+	serverRates := currencies.NewRates(time.Time{}, map[string]map[string]float64{
+		"USD": {
+			"GBP": 0.8,
+			"EUR": 0.9,
+		},
+	})
+	rates := currencies.NewAggregateConversions(customRates, serverRates)
+
+	testCases := []struct {
+		from         string
+		to           string
+		expectedRate float64
+		hasError     bool
+	}{
+		{from: "USD", to: "GBP", expectedRate: 0.5, hasError: false},
+		{from: "GBP", to: "USD", expectedRate: 2, hasError: false},
+		{from: "USD", to: "EUR", expectedRate: 0.9, hasError: false},
+		{from: "EUR", to: "EUR", expectedRate: 1, hasError: false},
+		{from: "USD", to: "JPY", expectedRate: 0, hasError: true},
+		{from: "USD", to: "", expectedRate: 0, hasError: true},
+	}
+
+	for _, tc := range testCases {
+		// Execute:
+		rate, err := rates.GetRate(tc.from, tc.to)
+
+		// Verify:
+		if tc.hasError {
+			assert.NotNil(t, err, "err shouldn't be nil")
+			assert.Equal(t, float64(0), rate, "rate should be 0")
+		} else {
+			assert.Nil(t, err, "err should be nil")
+			assert.Equal(t, tc.expectedRate, rate, "rate doesn't match the expected one")
+		}
+	}
+}
+
+func TestGetRates_AggregateConversions(t *testing.T) {
+	customRates := currencies.NewRates(time.Time{}, map[string]map[string]float64{
+		"USD": {"GBP": 0.5},
+	})
+	rates := currencies.NewAggregateConversions(customRates, currencies.NewConstantRates())
+	assert.Equal(t, &map[string]map[string]float64{"USD": {"GBP": 0.5}}, rates.GetRates())
+
+	serverRates := currencies.NewRates(time.Time{}, map[string]map[string]float64{
+		"USD": {"GBP": 0.8, "EUR": 0.9},
+	})
+	rates = currencies.NewAggregateConversions(customRates, serverRates)
+	assert.Equal(t, &map[string]map[string]float64{"USD": {"GBP": 0.5, "EUR": 0.9}}, rates.GetRates())
+}
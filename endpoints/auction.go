@@ -64,9 +64,11 @@ type auction struct {
 	metricsEngine pbsmetrics.MetricsEngine
 	dataCache     cache.Cache
 	exchanges     map[string]adapters.Adapter
+	// exchange runs the auctions instead of the legacy adapters if cfg.LegacyAuctionUseExchange is set.
+	exchange exchange.Exchange
 }
 
-func Auction(cfg *config.Configuration, syncers map[openrtb_ext.BidderName]usersync.Usersyncer, gdprPerms gdpr.Permissions, metricsEngine pbsmetrics.MetricsEngine, dataCache cache.Cache, exchanges map[string]adapters.Adapter) httprouter.Handle {
+func Auction(cfg *config.Configuration, syncers map[openrtb_ext.BidderName]usersync.Usersyncer, gdprPerms gdpr.Permissions, metricsEngine pbsmetrics.MetricsEngine, dataCache cache.Cache, exchanges map[string]adapters.Adapter, ex exchange.Exchange) httprouter.Handle {
 	a := &auction{
 		cfg:           cfg,
 		syncers:       syncers,
@@ -74,6 +76,7 @@ func Auction(cfg *config.Configuration, syncers map[openrtb_ext.BidderName]users
 		metricsEngine: metricsEngine,
 		dataCache:     dataCache,
 		exchanges:     exchanges,
+		exchange:      ex,
 	}
 	return a.auction
 }
@@ -112,6 +115,15 @@ func (a *auction) auction(w http.ResponseWriter, r *http.Request, _ httprouter.P
 		TID:          req.Tid,
 		BidderStatus: req.Bidders,
 	}
+	if a.cfg.LegacyAuctionUseExchange {
+		if err := a.auctionOnExchange(ctx, req, &resp, labels); err != nil {
+			writeAuctionError(w, "Error running the auction", err)
+			labels.RequestStatus = pbsmetrics.RequestStatusErr
+			return
+		}
+		a.writeResponse(ctx, w, req, &resp, account.PriceGranularity, &labels)
+		return
+	}
 	ch := make(chan bidResult)
 	sentBids := 0
 	for _, bidder := range req.Bidders {
@@ -158,13 +170,18 @@ func (a *auction) auction(w http.ResponseWriter, r *http.Request, _ httprouter.P
 			resp.Bids = append(resp.Bids, bid)
 		}
 	}
-	if err := cacheAccordingToMarkup(req, &resp, ctx, a, &labels); err != nil {
+	a.writeResponse(ctx, w, req, &resp, account.PriceGranularity, &labels)
+}
+
+// writeResponse caches the bids and adds the targeting keywords, if the request asks for them, and writes the response.
+func (a *auction) writeResponse(ctx context.Context, w http.ResponseWriter, req *pbs.PBSRequest, resp *pbs.PBSResponse, priceGranularity string, labels *pbsmetrics.Labels) {
+	if err := cacheAccordingToMarkup(req, resp, ctx, a, labels); err != nil {
 		writeAuctionError(w, "Prebid cache failed", err)
 		labels.RequestStatus = pbsmetrics.RequestStatusErr
 		return
 	}
 	if req.SortBids == 1 {
-		sortBidsAddKeywordsMobile(resp.Bids, req, account.PriceGranularity)
+		sortBidsAddKeywordsMobile(resp.Bids, req, priceGranularity)
 	}
 	if glog.V(2) {
 		glog.Infof("Request for %d ad units on url %s by account %s got %d bids", len(req.AdUnits), req.Url, req.AccountID, len(resp.Bids))
@@ -495,8 +512,20 @@ func (a *auction) recordMetrics(req *pbs.PBSRequest, labels pbsmetrics.Labels) {
 
 func (a *auction) processUserSync(req *pbs.PBSRequest, bidder *pbs.PBSBidder, blabels pbsmetrics.AdapterLabels, ex adapters.Adapter, ctx *context.Context) bool {
 	var skip bool = false
+	if a.addUsersyncInfo(*ctx, req, bidder) {
+		blabels.CookieFlag = pbsmetrics.CookieFlagNo
+		if ex.SkipNoCookies() {
+			skip = true
+		}
+	}
+	return skip
+}
+
+// addUsersyncInfo marks the bidder as having no cookie if the user hasn't synced with it yet, and adds the info
+// which the client needs to sync them, if privacy allows it. It returns true if the bidder has no cookie.
+func (a *auction) addUsersyncInfo(ctx context.Context, req *pbs.PBSRequest, bidder *pbs.PBSBidder) bool {
 	if req.App != nil {
-		return skip
+		return false
 	}
 	// If exchanges[bidderCode] exists, then a.syncers[bidderCode] exists *except for districtm*.
 	// OpenRTB handles aliases differently, so this hack will keep legacy code working. For all other
@@ -506,7 +535,10 @@ func (a *auction) processUserSync(req *pbs.PBSRequest, bidder *pbs.PBSBidder, bl
 	if syncerCode == "districtm" {
 		syncerCode = "appnexus"
 	}
-	syncer := a.syncers[openrtb_ext.BidderName(syncerCode)]
+	syncer, ok := a.syncers[openrtb_ext.BidderName(syncerCode)]
+	if !ok {
+		return false
+	}
 	uid, _, _ := req.Cookie.GetUID(syncer.FamilyName())
 	if uid == "" {
 		bidder.NoCookie = true
@@ -516,7 +548,7 @@ func (a *auction) processUserSync(req *pbs.PBSRequest, bidder *pbs.PBSBidder, bl
 				Consent: req.ParseConsent(),
 			},
 		}
-		if a.shouldUsersync(*ctx, openrtb_ext.BidderName(syncerCode), privacyPolicies.GDPR) {
+		if a.shouldUsersync(ctx, openrtb_ext.BidderName(syncerCode), privacyPolicies.GDPR) {
 			syncInfo, err := syncer.GetUsersyncInfo(privacyPolicies)
 			if err == nil {
 				bidder.UsersyncInfo = syncInfo
@@ -524,10 +556,7 @@ func (a *auction) processUserSync(req *pbs.PBSRequest, bidder *pbs.PBSBidder, bl
 				glog.Errorf("Failed to get usersync info for %s: %v", syncerCode, err)
 			}
 		}
-		blabels.CookieFlag = pbsmetrics.CookieFlagNo
-		if ex.SkipNoCookies() {
-			skip = true
-		}
+		return true
 	}
-	return skip
+	return false
 }
@@ -0,0 +1,202 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbs"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/prebid/prebid-server/usersync"
+)
+
+// This file translates legacy /auction requests into OpenRTB, so that they can run on the exchange,
+// and translates the exchange's responses back. Legacy caching and targeting still apply to the results,
+// so the response looks the same to Prebid Mobile as it does with the legacy adapters.
+
+// legacyAliases are the bidder codes which the legacy adapters accept, but which aren't core bidders.
+var legacyAliases = map[string]string{
+	"districtm": string(openrtb_ext.BidderAppnexus),
+}
+
+// auctionOnExchange runs the auction for every bidder in the request on the exchange, and adds
+// their bids to resp. It only returns an error if the auction couldn't run at all.
+func (a *auction) auctionOnExchange(ctx context.Context, req *pbs.PBSRequest, resp *pbs.PBSResponse, labels pbsmetrics.Labels) error {
+	bidders := make([]*pbs.PBSBidder, 0, len(req.Bidders))
+	for _, bidder := range req.Bidders {
+		if !isExchangeBidder(bidder.BidderCode) {
+			bidder.Error = "Unsupported bidder"
+			continue
+		}
+		a.addUsersyncInfo(ctx, req, bidder)
+		bidders = append(bidders, bidder)
+	}
+	if len(bidders) == 0 {
+		return nil
+	}
+
+	bidRequest, err := toOpenRTBRequest(req, bidders)
+	if err != nil {
+		// The legacy adapters each fail on requests which can't be made into OpenRTB, so report it the same way
+		for _, bidder := range bidders {
+			bidder.Error = err.Error()
+		}
+		return nil
+	}
+
+	var usersyncs exchange.IdFetcher = req.Cookie
+	if req.Cookie == nil {
+		usersyncs = usersync.NewPBSCookie()
+	}
+	// Legacy requests don't look up stored accounts, so they get the host's account defaults
+	account := a.cfg.AccountDefaults
+	account.ID = req.AccountID
+	bidResponse, err := a.exchange.HoldAuction(ctx, bidRequest, usersyncs, labels, &account, nil, nil)
+	if err != nil {
+		return err
+	}
+	bids, err := fromOpenRTBResponse(bidResponse, bidders)
+	if err != nil {
+		return err
+	}
+	resp.Bids = append(resp.Bids, bids...)
+	return nil
+}
+
+func isExchangeBidder(bidderCode string) bool {
+	if _, ok := openrtb_ext.BidderMap[bidderCode]; ok {
+		return true
+	}
+	_, ok := legacyAliases[bidderCode]
+	return ok
+}
+
+// toOpenRTBRequest makes a request with an imp for each ad unit. The imp's ext has the params of every bidder
+// which bids on the ad unit.
+func toOpenRTBRequest(req *pbs.PBSRequest, bidders []*pbs.PBSBidder) (*openrtb.BidRequest, error) {
+	// The legacy adapters make the imps from the bidder's ad units, so this bidder gets all of them
+	allUnits := &pbs.PBSBidder{}
+	impExts := make(map[string]map[string]json.RawMessage)
+	var aliases map[string]string
+	for _, bidder := range bidders {
+		for _, unit := range bidder.AdUnits {
+			if _, ok := impExts[unit.Code]; !ok {
+				impExts[unit.Code] = make(map[string]json.RawMessage)
+				allUnits.AdUnits = append(allUnits.AdUnits, unit)
+			}
+			impExts[unit.Code][bidder.BidderCode] = unit.Params
+		}
+		if coreBidder, ok := legacyAliases[bidder.BidderCode]; ok {
+			if aliases == nil {
+				aliases = make(map[string]string)
+			}
+			aliases[bidder.BidderCode] = coreBidder
+		}
+	}
+
+	bidRequest, err := adapters.MakeOpenRTBGeneric(req, allUnits, "", []pbs.MediaType{pbs.MEDIA_TYPE_BANNER, pbs.MEDIA_TYPE_VIDEO})
+	if err != nil {
+		return nil, err
+	}
+	for i := range bidRequest.Imp {
+		if bidRequest.Imp[i].Ext, err = json.Marshal(impExts[bidRequest.Imp[i].ID]); err != nil {
+			return nil, err
+		}
+	}
+	if req.IsDebug {
+		bidRequest.Test = 1
+	}
+	if len(aliases) > 0 {
+		if bidRequest.Ext, err = json.Marshal(openrtb_ext.ExtRequest{Prebid: openrtb_ext.ExtRequestPrebid{Aliases: aliases}}); err != nil {
+			return nil, err
+		}
+	}
+	return &bidRequest, nil
+}
+
+// fromOpenRTBResponse returns the bids in the legacy format, and fills in the status of each bidder.
+func fromOpenRTBResponse(bidResponse *openrtb.BidResponse, bidders []*pbs.PBSBidder) (pbs.PBSBidSlice, error) {
+	var responseExt openrtb_ext.ExtBidResponse
+	if len(bidResponse.Ext) > 0 {
+		if err := json.Unmarshal(bidResponse.Ext, &responseExt); err != nil {
+			return nil, fmt.Errorf("Failed to read the auction response ext: %v", err)
+		}
+	}
+
+	seatBids := make(map[string][]openrtb.Bid, len(bidResponse.SeatBid))
+	for _, seatBid := range bidResponse.SeatBid {
+		seatBids[seatBid.Seat] = append(seatBids[seatBid.Seat], seatBid.Bid...)
+	}
+
+	var allBids pbs.PBSBidSlice
+	for _, bidder := range bidders {
+		bidderName := openrtb_ext.BidderName(bidder.BidderCode)
+		bidder.ResponseTime = responseExt.ResponseTimeMillis[bidderName]
+		bidder.Error = legacyBidderError(responseExt.Errors[bidderName])
+		if responseExt.Debug != nil {
+			for _, call := range responseExt.Debug.HttpCalls[bidderName] {
+				bidder.Debug = append(bidder.Debug, &pbs.BidderDebug{
+					RequestURI:   call.Uri,
+					RequestBody:  call.RequestBody,
+					ResponseBody: call.ResponseBody,
+					StatusCode:   call.Status,
+				})
+			}
+		}
+
+		bids := make(pbs.PBSBidSlice, 0, len(seatBids[bidder.BidderCode]))
+		for _, bid := range seatBids[bidder.BidderCode] {
+			unit := bidder.LookupAdUnit(bid.ImpID)
+			if unit == nil {
+				continue
+			}
+			var bidExt openrtb_ext.ExtBid
+			if len(bid.Ext) > 0 {
+				if err := json.Unmarshal(bid.Ext, &bidExt); err != nil {
+					return nil, fmt.Errorf("Failed to read the ext of bid %s from %s: %v", bid.ID, bidder.BidderCode, err)
+				}
+			}
+			bids = append(bids, &pbs.PBSBid{
+				BidID:             unit.BidID,
+				AdUnitCode:        bid.ImpID,
+				Creative_id:       bid.CrID,
+				CreativeMediaType: string(bidExt.Prebid.Type),
+				BidderCode:        bidder.BidderCode,
+				Price:             bid.Price,
+				NURL:              bid.NURL,
+				Adm:               bid.AdM,
+				Width:             bid.W,
+				Height:            bid.H,
+				DealId:            bid.DealID,
+				ResponseTime:      bidder.ResponseTime,
+			})
+		}
+
+		if len(bids) == 0 {
+			bidder.NoBid = bidder.Error == ""
+			continue
+		}
+		bids = checkForValidBidSize(bids, bidder)
+		bidder.NumBids = len(bids)
+		allBids = append(allBids, bids...)
+	}
+	return allBids, nil
+}
+
+// legacyBidderError joins the bidder's errors into one message, using the legacy message for timeouts.
+func legacyBidderError(errs []openrtb_ext.ExtBidderError) string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		if err.Code == errortypes.TimeoutCode {
+			return "Timed out"
+		}
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,229 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/cache/dummycache"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbs"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
+	"github.com/prebid/prebid-server/prebid_cache_client"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyMobileBidders is the config for the ad unit in legacyMobileRequest.
+const legacyMobileBidders = `[
+	{"bidder": "appnexus", "bid_id": "test_bidid_an", "params": {"placementId": 10433394}},
+	{"bidder": "rubicon", "bid_id": "test_bidid_rp", "params": {"accountId": 1001, "siteId": 113932, "zoneId": 535510}},
+	{"bidder": "pubmatic", "bid_id": "test_bidid_pm", "params": {"publisherId": "156209", "adSlot": "slot1@300x250"}},
+	{"bidder": "sovrn", "bid_id": "test_bidid_sv", "params": {"tagid": "315045"}},
+	{"bidder": "unknown", "bid_id": "test_bidid_un", "params": {}}
+]`
+
+func TestAuctionOnExchangeParity(t *testing.T) {
+	legacyAdapters := map[string]adapters.Adapter{
+		"appnexus": &mockLegacyAdapter{bids: pbs.PBSBidSlice{{
+			BidID: "test_bidid_an", AdUnitCode: "test_adunitcode", BidderCode: "appnexus", Creative_id: "cr-an",
+			CreativeMediaType: "banner", Price: 2, Adm: "test_adm_an", Width: 300, Height: 250, DealId: "1234",
+		}}},
+		"rubicon": &mockLegacyAdapter{bids: pbs.PBSBidSlice{{
+			BidID: "test_bidid_rp", AdUnitCode: "test_adunitcode", BidderCode: "rubicon", Creative_id: "cr-rp",
+			CreativeMediaType: "banner", Price: 1.5, Adm: "test_adm_rp",
+		}}},
+		"pubmatic": &mockLegacyAdapter{},
+		"sovrn":    &mockLegacyAdapter{err: &errortypes.BadServerResponse{Message: "Unexpected status code: 500"}},
+	}
+	legacyResp := runLegacyAuction(t, &config.Configuration{}, legacyAdapters, nil)
+	if !assert.Len(t, legacyResp.Bids, 2, "The legacy adapters should bid") || !assert.Len(t, legacyResp.BidderStatus, 5) {
+		return
+	}
+
+	ex := &mockLegacyExchange{response: &openrtb.BidResponse{
+		ID: "abcd",
+		SeatBid: []openrtb.SeatBid{
+			{Seat: "appnexus", Bid: []openrtb.Bid{{
+				ID: "an-1", ImpID: "test_adunitcode", CrID: "cr-an", Price: 2, AdM: "test_adm_an", W: 300, H: 250, DealID: "1234",
+				Ext: json.RawMessage(`{"prebid":{"type":"banner"}}`),
+			}}},
+			{Seat: "rubicon", Bid: []openrtb.Bid{{
+				ID: "rp-1", ImpID: "test_adunitcode", CrID: "cr-rp", Price: 1.5, AdM: "test_adm_rp",
+				Ext: json.RawMessage(`{"prebid":{"type":"banner"}}`),
+			}}},
+		},
+		Ext: json.RawMessage(`{"errors":{"sovrn":[{"code":3,"message":"Unexpected status code: 500"}]},"responsetimemillis":{"appnexus":12,"rubicon":15,"pubmatic":9,"sovrn":20}}`),
+	}}
+	priceGranularity := openrtb_ext.PriceGranularityFromString("high")
+	accountDefaults := config.Account{DefaultTimeoutMS: 800, PriceGranularity: &priceGranularity}
+	exchangeResp := runLegacyAuction(t, &config.Configuration{LegacyAuctionUseExchange: true, AccountDefaults: accountDefaults}, nil, ex)
+
+	assert.Equal(t, normalizeLegacyResponse(legacyResp), normalizeLegacyResponse(exchangeResp), "The exchange should give the same response as the legacy adapters")
+
+	if assert.NotNil(t, ex.lastRequest, "The request never made it into the exchange") && assert.Len(t, ex.lastRequest.Imp, 1) {
+		assert.JSONEq(t, `{
+			"appnexus": {"placementId": 10433394},
+			"rubicon": {"accountId": 1001, "siteId": 113932, "zoneId": 535510},
+			"pubmatic": {"publisherId": "156209", "adSlot": "slot1@300x250"},
+			"sovrn": {"tagid": "315045"}
+		}`, string(ex.lastRequest.Imp[0].Ext), "The imp should have the params of every supported bidder")
+	}
+	assert.Equal(t, 12, exchangeResp.BidderStatus[0].ResponseTime, "The response times should come from the exchange")
+	if assert.Len(t, exchangeResp.Bids, 2) {
+		assert.Equal(t, "cached-test_adm_an", normalizeLegacyResponse(exchangeResp).Bids[0].CacheID, "The request asks for the markup to be cached")
+	}
+
+	expectedAccount := accountDefaults
+	expectedAccount.ID = "aecd6ef7-b992-4e99-9bb8-65e2d984e1dd"
+	assert.Equal(t, &expectedAccount, ex.lastAccount, "The account should start from the host's account defaults")
+}
+
+func TestAuctionOnExchangeError(t *testing.T) {
+	ex := &mockLegacyExchange{err: context.DeadlineExceeded}
+	resp := runLegacyAuction(t, &config.Configuration{LegacyAuctionUseExchange: true}, nil, ex)
+	assert.Equal(t, "Error running the auction: context deadline exceeded", resp.Status)
+	assert.Empty(t, resp.Bids)
+}
+
+func TestToOpenRTBRequest(t *testing.T) {
+	req := &pbs.PBSRequest{
+		Tid:           "abcd",
+		TimeoutMillis: 500,
+		IsDebug:       true,
+		App:           &openrtb.App{Bundle: "com.example.app"},
+		Bidders: []*pbs.PBSBidder{
+			{BidderCode: "appnexus", AdUnits: []pbs.PBSAdUnit{
+				{Code: "unit-1", BidID: "an-1", Sizes: []openrtb.Format{{W: 300, H: 250}}, MediaTypes: []pbs.MediaType{pbs.MEDIA_TYPE_BANNER}, Params: json.RawMessage(`{"placementId":1}`)},
+			}},
+			{BidderCode: "districtm", AdUnits: []pbs.PBSAdUnit{
+				{Code: "unit-1", BidID: "dm-1", Sizes: []openrtb.Format{{W: 300, H: 250}}, MediaTypes: []pbs.MediaType{pbs.MEDIA_TYPE_BANNER}, Params: json.RawMessage(`{"placementId":2}`)},
+				{Code: "unit-2", BidID: "dm-2", Sizes: []openrtb.Format{{W: 640, H: 480}}, MediaTypes: []pbs.MediaType{pbs.MEDIA_TYPE_VIDEO}, Video: pbs.PBSVideo{Mimes: []string{"video/mp4"}}, Params: json.RawMessage(`{"placementId":3}`)},
+			}},
+		},
+	}
+
+	bidRequest, err := toOpenRTBRequest(req, req.Bidders)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "abcd", bidRequest.ID)
+	assert.Equal(t, int64(500), bidRequest.TMax)
+	assert.Equal(t, int8(1), bidRequest.Test, "Debug requests should be test requests, to get the debug info")
+	assert.Equal(t, req.App, bidRequest.App)
+	assert.JSONEq(t, `{"prebid":{"aliases":{"districtm":"appnexus"}}}`, string(bidRequest.Ext))
+	if assert.Len(t, bidRequest.Imp, 2, "There should be an imp for each ad unit") {
+		assert.Equal(t, "unit-1", bidRequest.Imp[0].ID)
+		assert.NotNil(t, bidRequest.Imp[0].Banner)
+		assert.JSONEq(t, `{"appnexus":{"placementId":1},"districtm":{"placementId":2}}`, string(bidRequest.Imp[0].Ext))
+		assert.Equal(t, "unit-2", bidRequest.Imp[1].ID)
+		assert.NotNil(t, bidRequest.Imp[1].Video)
+		assert.JSONEq(t, `{"districtm":{"placementId":3}}`, string(bidRequest.Imp[1].Ext))
+	}
+}
+
+func TestLegacyBidderError(t *testing.T) {
+	assert.Equal(t, "", legacyBidderError(nil))
+	assert.Equal(t, "first; second", legacyBidderError([]openrtb_ext.ExtBidderError{{Message: "first"}, {Message: "second"}}))
+	assert.Equal(t, "Timed out", legacyBidderError([]openrtb_ext.ExtBidderError{{Message: "first"}, {Code: errortypes.TimeoutCode, Message: "timeout"}}))
+}
+
+func runLegacyAuction(t *testing.T, cfg *config.Configuration, legacyAdapters map[string]adapters.Adapter, ex exchange.Exchange) *pbs.PBSResponse {
+	t.Helper()
+	cfg.AuctionTimeouts = config.AuctionTimeouts{Default: 2000, Max: 2000}
+	dataCache, _ := dummycache.New()
+	dataCache.Config().Set("ad5ffb41-3492-40f3-9c25-ade093eb4e5f", legacyMobileBidders)
+	cacheServer := httptest.NewServer(http.HandlerFunc(admCacheServer))
+	defer cacheServer.Close()
+	prebid_cache_client.InitPrebidCache(cacheServer.URL)
+	endpoint := Auction(cfg, nil, &auctionMockPermissions{}, &metricsConf.DummyMetricsEngine{}, dataCache, legacyAdapters, ex)
+
+	recorder := httptest.NewRecorder()
+	endpoint(recorder, httptest.NewRequest("POST", "/auction", bytes.NewBufferString(legacyMobileRequest)), nil)
+
+	var resp pbs.PBSResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to read the response: %v", err)
+	}
+	return &resp
+}
+
+// admCacheServer is a Prebid Cache which makes the UUIDs from the bids' adm. Unlike DummyPrebidCacheServer,
+// the UUIDs don't depend on the order of the bids, which the legacy path collects in the order the bidders respond.
+func admCacheServer(w http.ResponseWriter, r *http.Request) {
+	var put putAnyRequest
+	if err := json.NewDecoder(r.Body).Decode(&put); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := response{Responses: make([]responseObject, len(put.Puts))}
+	for i, p := range put.Puts {
+		adm, _ := jsonparser.GetString(p.Value, "adm")
+		resp.Responses[i].UUID = "cached-" + adm
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// normalizeLegacyResponse clears the response times, which are measured by the legacy path, and sorts the bids,
+// which the legacy path collects in the order the bidders respond.
+func normalizeLegacyResponse(resp *pbs.PBSResponse) *pbs.PBSResponse {
+	normalized := *resp
+	normalized.BidderStatus = make([]*pbs.PBSBidder, len(resp.BidderStatus))
+	for i, bidder := range resp.BidderStatus {
+		bidderCopy := *bidder
+		bidderCopy.ResponseTime = 0
+		normalized.BidderStatus[i] = &bidderCopy
+	}
+	normalized.Bids = make(pbs.PBSBidSlice, len(resp.Bids))
+	for i, bid := range resp.Bids {
+		bidCopy := *bid
+		bidCopy.ResponseTime = 0
+		normalized.Bids[i] = &bidCopy
+	}
+	sort.Slice(normalized.Bids, func(i, j int) bool {
+		return normalized.Bids[i].BidderCode < normalized.Bids[j].BidderCode
+	})
+	return &normalized
+}
+
+type mockLegacyAdapter struct {
+	bids pbs.PBSBidSlice
+	err  error
+}
+
+func (a *mockLegacyAdapter) Name() string {
+	return "mock"
+}
+
+func (a *mockLegacyAdapter) SkipNoCookies() bool {
+	return false
+}
+
+func (a *mockLegacyAdapter) Call(ctx context.Context, req *pbs.PBSRequest, bidder *pbs.PBSBidder) (pbs.PBSBidSlice, error) {
+	return a.bids, a.err
+}
+
+type mockLegacyExchange struct {
+	lastRequest *openrtb.BidRequest
+	lastAccount *config.Account
+	response    *openrtb.BidResponse
+	err         error
+}
+
+func (e *mockLegacyExchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, usersyncs exchange.IdFetcher, labels pbsmetrics.Labels, account *config.Account, categoriesFetcher *stored_requests.CategoryFetcher, hookExecutor *modules.Executor) (*openrtb.BidResponse, error) {
+	e.lastRequest = bidRequest
+	e.lastAccount = account
+	return e.response, e.err
+}
@@ -24,8 +24,8 @@ import (
 	"github.com/spf13/viper"
 )
 
-func TestSortBidsAndAddKeywordsForMobile(t *testing.T) {
-	body := []byte(`{
+// legacyMobileRequest is a request from the Prebid Mobile SDK. Its ad unit's bidders are in the config "ad5ffb41-3492-40f3-9c25-ade093eb4e5f".
+const legacyMobileRequest = `{
 	   "max_key_length":20,
 	   "user":{
 	      "gender":"F",
@@ -66,8 +66,10 @@ func TestSortBidsAndAddKeywordsForMobile(t *testing.T) {
 	   },
 	   "tid":"abcd",
 	   "account_id":"aecd6ef7-b992-4e99-9bb8-65e2d984e1dd"
-	}
-    `)
+	}`
+
+func TestSortBidsAndAddKeywordsForMobile(t *testing.T) {
+	body := []byte(legacyMobileRequest)
 	r := httptest.NewRequest("POST", "/auction", bytes.NewBuffer(body))
 	d, _ := dummycache.New()
 	hcc := config.HostCookie{}
@@ -0,0 +1,130 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	accountService "github.com/prebid/prebid-server/account"
+	"github.com/prebid/prebid-server/analytics"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/stored_requests"
+)
+
+// eventAccountTimeout is the time budget for loading the account of an event.
+const eventAccountTimeout = 50 * time.Millisecond
+
+// The values of the "f" query param, which picks the response format.
+const (
+	eventFormatBlank = "b"
+	eventFormatImage = "i"
+)
+
+// trackingPixel is a 1x1 transparent PNG, which is returned if the event URL is used as an image.
+var trackingPixel = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x48, 0x44, 0x52,
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4,
+	0x89, 0x00, 0x00, 0x00, 0x0b, 0x49, 0x44, 0x41, 0x54, 0x78, 0xda, 0x63, 0x60, 0x00, 0x02, 0x00,
+	0x00, 0x05, 0x00, 0x01, 0xe9, 0xfa, 0xdc, 0xd8, 0x00, 0x00, 0x00, 0x00, 0x49, 0x45, 0x4e, 0x44,
+	0xae, 0x42, 0x60, 0x82,
+}
+
+// NewEventEndpoint returns the /event endpoint, which lets PBS know whether the bids it returned won in
+// the ad server or were rendered. Each event is passed on to the analytics modules.
+//
+// Events are only accepted for accounts which have events enabled.
+func NewEventEndpoint(cfg *config.Configuration, accounts stored_requests.AccountFetcher, pbsAnalytics analytics.PBSAnalyticsModule) httprouter.Handle {
+	deps := &eventDeps{
+		cfg:          cfg,
+		accounts:     accounts,
+		pbsAnalytics: pbsAnalytics,
+	}
+	return deps.Endpoint
+}
+
+type eventDeps struct {
+	cfg          *config.Configuration
+	accounts     stored_requests.AccountFetcher
+	pbsAnalytics analytics.PBSAnalyticsModule
+}
+
+func (deps *eventDeps) Endpoint(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+
+	eventRequest, err := parseEventRequest(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Invalid request: %s\n", err.Error())))
+		return
+	}
+	format := query.Get(analytics.EventParamFormat)
+	if format != "" && format != eventFormatBlank && format != eventFormatImage {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Invalid request: unknown format '%s'\n", format)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventAccountTimeout)
+	defer cancel()
+	account, errs := accountService.GetAccount(ctx, deps.cfg, deps.accounts, eventRequest.AccountID)
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(fmt.Sprintf("Invalid request: %s\n", errs[0].Error())))
+		return
+	}
+	if !account.Events.Enabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(fmt.Sprintf("Account '%s' doesn't support events\n", eventRequest.AccountID)))
+		return
+	}
+
+	deps.pbsAnalytics.LogNotificationEventObject(&analytics.NotificationEvent{
+		Request: eventRequest,
+		Account: account,
+	})
+
+	if format == eventFormatImage {
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		w.Write(trackingPixel)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseEventRequest reads the event from the query params.
+func parseEventRequest(query url.Values) (*analytics.EventRequest, error) {
+	eventRequest := &analytics.EventRequest{
+		Type:      analytics.EventType(query.Get(analytics.EventParamType)),
+		BidID:     query.Get(analytics.EventParamBidID),
+		AccountID: query.Get(analytics.EventParamAccountID),
+		Bidder:    query.Get(analytics.EventParamBidder),
+	}
+
+	switch eventRequest.Type {
+	case analytics.Win, analytics.Imp:
+	case "":
+		return nil, errors.New("type (t) is required")
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", eventRequest.Type)
+	}
+	if eventRequest.BidID == "" {
+		return nil, errors.New("bid ID (b) is required")
+	}
+	if eventRequest.AccountID == "" {
+		return nil, errors.New("account ID (a) is required")
+	}
+	if ts := query.Get(analytics.EventParamTimestamp); ts != "" {
+		timestamp, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || timestamp < 0 {
+			return nil, fmt.Errorf("timestamp (ts) must be a positive number. Got '%s'", ts)
+		}
+		eventRequest.Timestamp = timestamp
+	}
+	return eventRequest, nil
+}
@@ -0,0 +1,127 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prebid/prebid-server/analytics"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBadRequests(t *testing.T) {
+	testCases := []struct {
+		description string
+		query       string
+	}{
+		{"missing type", "b=bid&a=acct"},
+		{"unknown type", "t=click&b=bid&a=acct"},
+		{"missing bid ID", "t=win&a=acct"},
+		{"missing account ID", "t=win&b=bid"},
+		{"bad timestamp", "t=win&b=bid&a=acct&ts=yesterday"},
+		{"negative timestamp", "t=win&b=bid&a=acct&ts=-1"},
+		{"unknown format", "t=win&b=bid&a=acct&f=x"},
+	}
+
+	for _, test := range testCases {
+		logger := &eventAnalyticsMock{}
+		recorder := doEventRequest(eventAccountsMock{"acct": `{"events":{"enabled":true}}`}, logger, test.query)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, test.description)
+		assert.Empty(t, logger.events, test.description)
+	}
+}
+
+func TestEventAccountDisabled(t *testing.T) {
+	logger := &eventAnalyticsMock{}
+	recorder := doEventRequest(eventAccountsMock{"acct": `{"events":{"enabled":false}}`}, logger, "t=win&b=bid&a=acct")
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Empty(t, logger.events)
+
+	recorder = doEventRequest(eventAccountsMock{}, logger, "t=win&b=bid&a=unknown")
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Events should be disabled by default")
+	assert.Empty(t, logger.events)
+}
+
+func TestEventLogged(t *testing.T) {
+	logger := &eventAnalyticsMock{}
+	recorder := doEventRequest(eventAccountsMock{"acct": `{"events":{"enabled":true}}`}, logger, "t=imp&b=bid&a=acct&bidder=appnexus&ts=1500")
+
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Body.Bytes())
+	if assert.Len(t, logger.events, 1) {
+		assert.Equal(t, &analytics.EventRequest{
+			Type:      analytics.Imp,
+			BidID:     "bid",
+			AccountID: "acct",
+			Bidder:    "appnexus",
+			Timestamp: 1500,
+		}, logger.events[0].Request)
+		assert.Equal(t, "acct", logger.events[0].Account.ID)
+	}
+}
+
+func TestEventImageFormat(t *testing.T) {
+	logger := &eventAnalyticsMock{}
+	recorder := doEventRequest(eventAccountsMock{"acct": `{"events":{"enabled":true}}`}, logger, "t=win&b=bid&a=acct&f=i")
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, trackingPixel, recorder.Body.Bytes())
+	assert.Len(t, logger.events, 1)
+}
+
+func TestEventURLRoundTrip(t *testing.T) {
+	event := &analytics.EventRequest{
+		Type:      analytics.Win,
+		BidID:     "bid&1",
+		AccountID: "acct",
+		Bidder:    "appnexus",
+		Timestamp: 1500,
+	}
+	logger := &eventAnalyticsMock{}
+	url := analytics.EventURL("", event)
+
+	recorder := doEventRequest(eventAccountsMock{"acct": `{"events":{"enabled":true}}`}, logger, url[len("/event?"):])
+
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	if assert.Len(t, logger.events, 1) {
+		assert.Equal(t, event, logger.events[0].Request)
+	}
+}
+
+func doEventRequest(accounts eventAccountsMock, logger *eventAnalyticsMock, query string) *httptest.ResponseRecorder {
+	endpoint := NewEventEndpoint(&config.Configuration{}, accounts, logger)
+	request := httptest.NewRequest("GET", "/event?"+query, nil)
+	recorder := httptest.NewRecorder()
+	endpoint(recorder, request, nil)
+	return recorder
+}
+
+type eventAccountsMock map[string]string
+
+func (m eventAccountsMock) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	if account, ok := m[accountID]; ok {
+		return json.RawMessage(account), nil
+	}
+	return nil, []error{stored_requests.NotFoundError{ID: accountID, DataType: "Account"}}
+}
+
+type eventAnalyticsMock struct {
+	events []*analytics.NotificationEvent
+}
+
+func (m *eventAnalyticsMock) LogAuctionObject(*analytics.AuctionObject)       {}
+func (m *eventAnalyticsMock) LogVideoObject(*analytics.VideoObject)           {}
+func (m *eventAnalyticsMock) LogCookieSyncObject(*analytics.CookieSyncObject) {}
+func (m *eventAnalyticsMock) LogSetUIDObject(*analytics.SetUIDObject)         {}
+func (m *eventAnalyticsMock) LogAmpObject(*analytics.AmpObject)               {}
+func (m *eventAnalyticsMock) LogNotificationEventObject(event *analytics.NotificationEvent) {
+	m.events = append(m.events, event)
+}
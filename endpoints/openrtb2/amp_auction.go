@@ -20,11 +20,11 @@ import (
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/prebid/prebid-server/privacy"
 	"github.com/prebid/prebid-server/privacy/ccpa"
-	"github.com/prebid/prebid-server/privacy/gdpr"
 	"github.com/prebid/prebid-server/stored_requests"
 	"github.com/prebid/prebid-server/stored_requests/backends/empty_fetcher"
 	"github.com/prebid/prebid-server/usersync"
@@ -32,10 +32,20 @@ import (
 
 const defaultAmpRequestTimeoutMillis = 900
 
+// The values of the consent_type param, which AMP's consent component sets.
+const (
+	ampConsentTypeTCFV1     = "1"
+	ampConsentTypeTCFV2     = "2"
+	ampConsentTypeUSPrivacy = "3"
+)
+
 type AmpResponse struct {
 	Targeting map[string]string                                       `json:"targeting"`
 	Debug     *openrtb_ext.ExtResponseDebug                           `json:"debug,omitempty"`
 	Errors    map[openrtb_ext.BidderName][]openrtb_ext.ExtBidderError `json:"errors,omitempty"`
+	Warnings  map[openrtb_ext.BidderName][]openrtb_ext.ExtBidderError `json:"warnings,omitempty"`
+	// Ext holds prebid.modules, if any modules ran.
+	Ext json.RawMessage `json:"ext,omitempty"`
 }
 
 // NewAmpEndpoint modifies the OpenRTB endpoint to handle AMP requests. This will basically modify the parsing
@@ -45,15 +55,17 @@ func NewAmpEndpoint(
 	validator openrtb_ext.BidderParamValidator,
 	requestsById stored_requests.Fetcher,
 	categories stored_requests.CategoryFetcher,
+	accounts stored_requests.AccountFetcher,
 	cfg *config.Configuration,
 	met pbsmetrics.MetricsEngine,
 	pbsAnalytics analytics.PBSAnalyticsModule,
 	disabledBidders map[string]string,
 	defReqJSON []byte,
 	bidderMap map[string]openrtb_ext.BidderName,
+	hooks *modules.Registry,
 ) (httprouter.Handle, error) {
 
-	if ex == nil || validator == nil || requestsById == nil || cfg == nil || met == nil {
+	if ex == nil || validator == nil || requestsById == nil || accounts == nil || cfg == nil || met == nil {
 		return nil, errors.New("NewAmpEndpoint requires non-nil arguments.")
 	}
 
@@ -65,13 +77,15 @@ func NewAmpEndpoint(
 		requestsById,
 		empty_fetcher.EmptyFetcher{},
 		categories,
+		accounts,
 		cfg,
 		met,
 		pbsAnalytics,
 		disabledBidders,
 		defRequest,
 		defReqJSON,
-		bidderMap}).AmpAuction), nil
+		bidderMap,
+		hooks}).AmpAuction), nil
 
 }
 
@@ -119,7 +133,13 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 	w.Header().Set("AMP-Access-Control-Allow-Source-Origin", origin)
 	w.Header().Set("Access-Control-Expose-Headers", "AMP-Access-Control-Allow-Source-Origin")
 
-	req, errL := deps.parseAmpRequest(r)
+	hookExecutor := deps.hooks.NewExecutor(modules.EndpointAmp)
+	req, errL := deps.parseAmpRequest(r, hookExecutor)
+
+	if rejectErr := modules.FindRejectError(errL); rejectErr != nil {
+		deps.writeRejectedAmp(w, rejectErr, hookExecutor, false, &ao, &labels)
+		return
+	}
 
 	if fatalError(errL) {
 		w.WriteHeader(http.StatusBadRequest)
@@ -131,15 +151,6 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 		return
 	}
 
-	ctx := context.Background()
-	var cancel context.CancelFunc
-	if req.TMax > 0 {
-		ctx, cancel = context.WithDeadline(ctx, start.Add(time.Duration(req.TMax)*time.Millisecond))
-	} else {
-		ctx, cancel = context.WithDeadline(ctx, start.Add(time.Duration(defaultAmpRequestTimeoutMillis)*time.Millisecond))
-	}
-	defer cancel()
-
 	usersyncs := usersync.ParsePBSCookieFromRequest(r, &(deps.cfg.HostCookie))
 	if usersyncs.LiveSyncCount() == 0 {
 		labels.CookieFlag = pbsmetrics.CookieFlagNo
@@ -147,10 +158,11 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 		labels.CookieFlag = pbsmetrics.CookieFlagYes
 	}
 	labels.PubID = effectivePubID(req.Site.Publisher)
-	// Blacklist account now that we have resolved the value
-	if acctIdErr := validateAccount(deps.cfg, labels.PubID); acctIdErr != nil {
-		errL = append(errL, acctIdErr)
-		erVal := errortypes.DecodeError(acctIdErr)
+	// Look up account now that we have resolved the pubID value
+	account, acctIDErrs := deps.getAccount(labels.PubID)
+	if len(acctIDErrs) > 0 {
+		errL = append(errL, acctIDErrs...)
+		erVal := errortypes.DecodeError(acctIDErrs[0])
 		if erVal == errortypes.BlacklistedAppCode || erVal == errortypes.BlacklistedAcctCode {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			labels.RequestStatus = pbsmetrics.RequestStatusBlacklisted
@@ -165,10 +177,29 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 		return
 	}
 
-	response, err := deps.ex.HoldAuction(ctx, req, usersyncs, labels, &deps.categories)
-	ao.AuctionResponse = response
+	hookExecutor.SetAccount(account)
+	req, rejectErr := hookExecutor.ExecuteProcessedAuctionRequestStage(req)
+	if rejectErr != nil {
+		deps.writeRejectedAmp(w, rejectErr, hookExecutor, deps.isDebug(req, account), &ao, &labels)
+		return
+	}
+
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if req.TMax > 0 {
+		ctx, cancel = context.WithDeadline(ctx, start.Add(time.Duration(req.TMax)*time.Millisecond))
+	} else if account.DefaultTimeoutMS > 0 {
+		timeouts := account.AuctionTimeouts(deps.cfg.AuctionTimeouts)
+		ctx, cancel = context.WithDeadline(ctx, start.Add(time.Duration(timeouts.Default)*time.Millisecond))
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, start.Add(time.Duration(defaultAmpRequestTimeoutMillis)*time.Millisecond))
+	}
+	defer cancel()
+
+	response, err := deps.ex.HoldAuction(ctx, req, usersyncs, labels, account, &deps.categories, hookExecutor)
 
 	if err != nil {
+		ao.AuctionResponse = response
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "Critical error while running the auction: %v", err)
 		glog.Errorf("/openrtb2/amp Critical error: %v", err)
@@ -177,6 +208,9 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 		return
 	}
 
+	response = hookExecutor.ExecuteAuctionResponseStage(response)
+	ao.AuctionResponse = response
+
 	// Need to extract the targeting parameters from the response, as those are all that
 	// go in the AMP response
 	targets := map[string]string{}
@@ -216,18 +250,31 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 	ampResponse := AmpResponse{
 		Targeting: targets,
 		Errors:    extResponse.Errors,
+		Warnings:  extResponse.Warnings,
+	}
+	// The request's own warnings, like malformed consent params, are reported under "prebid"
+	for _, err := range errL {
+		if errortypes.DecodeError(err) != errortypes.WarningCode {
+			continue
+		}
+		if ampResponse.Warnings == nil {
+			ampResponse.Warnings = make(map[openrtb_ext.BidderName][]openrtb_ext.ExtBidderError)
+		}
+		ampResponse.Warnings[openrtb_ext.PrebidExtKey] = append(ampResponse.Warnings[openrtb_ext.PrebidExtKey], openrtb_ext.ExtBidderError{
+			Code:    errortypes.WarningCode,
+			Message: err.Error(),
+		})
 	}
 
 	ao.AmpTargetingValues = targets
 
-	// add debug information if requested
-	if req.Test == 1 && eRErr == nil {
-		if extResponse.Debug != nil {
-			ampResponse.Debug = extResponse.Debug
-		} else {
-			glog.Errorf("Test set on request but debug not present in response: %v", err)
-			ao.Errors = append(ao.Errors, fmt.Errorf("Test set on request but debug not present in response: %v", err))
-		}
+	if ampResponse.Ext, err = hookExecutor.WriteModulesExt(nil, deps.isDebug(req, account)); err != nil {
+		ao.Errors = append(ao.Errors, fmt.Errorf("Failed to add the module outcomes to the AMP response: %v", err))
+	}
+
+	// add debug information if requested. The exchange leaves it out if the account isn't allowed to see it.
+	if deps.isDebug(req, account) && eRErr == nil && extResponse.Debug != nil {
+		ampResponse.Debug = extResponse.Debug
 	}
 
 	// Fixes #231
@@ -243,16 +290,40 @@ func (deps *endpointDeps) AmpAuction(w http.ResponseWriter, r *http.Request, _ h
 	}
 }
 
+// writeRejectedAmp answers an AMP request which a module rejected.
+func (deps *endpointDeps) writeRejectedAmp(w http.ResponseWriter, rejectErr *modules.RejectError, hookExecutor *modules.Executor, debug bool, ao *analytics.AmpObject, labels *pbsmetrics.Labels) {
+	ao.Errors = append(ao.Errors, rejectErr)
+	ampResponse, err := rejectedAmpResponse(hookExecutor, debug)
+	if err != nil {
+		labels.RequestStatus = pbsmetrics.RequestStatusErr
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Critical error while rejecting the request: %v", err)
+		ao.Status = http.StatusInternalServerError
+		ao.Errors = append(ao.Errors, err)
+		return
+	}
+	ao.AmpTargetingValues = ampResponse.Targeting
+	if err := writeJSONResponse(w, ampResponse); err != nil {
+		labels.RequestStatus = pbsmetrics.RequestStatusNetworkErr
+		ao.Errors = append(ao.Errors, fmt.Errorf("/openrtb2/amp Failed to send response: %v", err))
+	}
+}
+
 // parseRequest turns the HTTP request into an OpenRTB request.
 // If the errors list is empty, then the returned request will be valid according to the OpenRTB 2.5 spec.
 // In case of "strong recommendations" in the spec, it tends to be restrictive. If a better workaround is
 // possible, it will return errors with messages that suggest improvements.
 //
 // If the errors list has at least one element, then no guarantees are made about the returned request.
-func (deps *endpointDeps) parseAmpRequest(httpRequest *http.Request) (req *openrtb.BidRequest, errs []error) {
-	// Load the stored request for the AMP ID.
-	req, errs = deps.loadRequestJSONForAmp(httpRequest)
-	if len(errs) > 0 {
+func (deps *endpointDeps) parseAmpRequest(httpRequest *http.Request, hookExecutor *modules.Executor) (req *openrtb.BidRequest, errs []error) {
+	// AMP requests are GETs, so the entrypoint hooks don't get a body.
+	if _, rejectErr := hookExecutor.ExecuteEntrypointStage(httpRequest, nil); rejectErr != nil {
+		return &openrtb.BidRequest{}, []error{rejectErr}
+	}
+
+	// Load the stored request for the AMP ID. Malformed params only cause warnings.
+	req, errs = deps.loadRequestJSONForAmp(httpRequest, hookExecutor)
+	if fatalError(errs) {
 		return
 	}
 
@@ -260,8 +331,8 @@ func (deps *endpointDeps) parseAmpRequest(httpRequest *http.Request) (req *openr
 	deps.setFieldsImplicitly(httpRequest, req)
 
 	// Need to ensure cache and targeting are turned on
-	errs = defaultRequestExt(req)
-	if len(errs) > 0 {
+	if extErrs := defaultRequestExt(req); len(extErrs) > 0 {
+		errs = append(errs, extErrs...)
 		return
 	}
 
@@ -276,7 +347,7 @@ func (deps *endpointDeps) parseAmpRequest(httpRequest *http.Request) (req *openr
 }
 
 // Load the stored OpenRTB request for an incoming AMP request, or return the errors found.
-func (deps *endpointDeps) loadRequestJSONForAmp(httpRequest *http.Request) (req *openrtb.BidRequest, errs []error) {
+func (deps *endpointDeps) loadRequestJSONForAmp(httpRequest *http.Request, hookExecutor *modules.Executor) (req *openrtb.BidRequest, errs []error) {
 	req = &openrtb.BidRequest{}
 	errs = nil
 
@@ -302,7 +373,11 @@ func (deps *endpointDeps) loadRequestJSONForAmp(httpRequest *http.Request) (req
 	}
 
 	// The fetched config becomes the entire OpenRTB request
-	requestJSON := storedRequests[ampID]
+	requestJSON, rejectErr := hookExecutor.ExecuteRawAuctionRequestStage(storedRequests[ampID])
+	if rejectErr != nil {
+		errs = []error{rejectErr}
+		return
+	}
 	if err := json.Unmarshal(requestJSON, req); err != nil {
 		errs = []error{err}
 		return
@@ -335,15 +410,13 @@ func (deps *endpointDeps) loadRequestJSONForAmp(httpRequest *http.Request) (req
 		*req.Imp[0].Secure = 1
 	}
 
-	err := deps.overrideWithParams(httpRequest, req)
-	if err != nil {
-		errs = []error{err}
-	}
-
+	errs = deps.overrideWithParams(httpRequest, req)
 	return
 }
 
-func (deps *endpointDeps) overrideWithParams(httpRequest *http.Request, req *openrtb.BidRequest) error {
+// overrideWithParams applies the AMP request's query params to the stored request. It returns warnings
+// for the params which were malformed and ignored, or an error if the request couldn't be updated.
+func (deps *endpointDeps) overrideWithParams(httpRequest *http.Request, req *openrtb.BidRequest) []error {
 	if req.Site == nil {
 		req.Site = &openrtb.Site{}
 	}
@@ -382,23 +455,77 @@ func (deps *endpointDeps) overrideWithParams(httpRequest *http.Request, req *ope
 		req.Imp[0].TagID = slot
 	}
 
-	privacyPolicies := privacy.Policies{
-		GDPR: gdpr.Policy{
-			Consent: httpRequest.URL.Query().Get("gdpr_consent"),
-		},
-		CCPA: ccpa.Policy{
-			Value: httpRequest.URL.Query().Get("us_privacy"),
-		},
-	}
+	privacyPolicies, warnings := readAmpPrivacyPolicies(httpRequest.URL.Query())
 	if err := privacyPolicies.Write(req); err != nil {
-		return err
+		return []error{err}
 	}
 
 	if timeout, err := strconv.ParseInt(httpRequest.FormValue("timeout"), 10, 64); err == nil {
 		req.TMax = timeout - deps.cfg.AMPTimeoutAdjustment
 	}
 
-	return nil
+	return warnings
+}
+
+// readAmpPrivacyPolicies reads the consent which AMP's consent component passes in the consent_string,
+// consent_type, gdpr_applies and addtl_consent params. The consent_type decides whether the consent_string
+// is a TCF consent string or a US Privacy string. If there's no consent_type, it's a US Privacy string
+// if it looks like one.
+//
+// Requests without a consent_string fall back to the older gdpr_consent and us_privacy params.
+// Malformed values are left out of the policies, and returned as warnings.
+func readAmpPrivacyPolicies(query url.Values) (privacy.Policies, []error) {
+	var policies privacy.Policies
+	var warnings []error
+
+	consent := query.Get("consent_string")
+	consentType := query.Get("consent_type")
+	if consent == "" {
+		policies.GDPR.Consent = query.Get("gdpr_consent")
+		policies.CCPA.Value = query.Get("us_privacy")
+	} else {
+		if consentType == "" {
+			if (ccpa.Policy{Value: consent}).Validate() == nil {
+				consentType = ampConsentTypeUSPrivacy
+			}
+		}
+		switch consentType {
+		case ampConsentTypeUSPrivacy:
+			policies.CCPA.Value = consent
+			if err := policies.CCPA.Validate(); err != nil {
+				warnings = append(warnings, &errortypes.Warning{Message: fmt.Sprintf("CCPA consent is invalid and will be ignored. (%s)", err.Error())})
+				policies.CCPA.Value = ""
+			}
+		case ampConsentTypeTCFV1, ampConsentTypeTCFV2, "":
+			policies.GDPR.Consent = consent
+			if version, err := policies.GDPR.ConsentVersion(); err != nil {
+				warnings = append(warnings, &errortypes.Warning{Message: fmt.Sprintf("GDPR consent is invalid and will be ignored. (%s)", err.Error())})
+				policies.GDPR.Consent = ""
+			} else if consentType != "" && strconv.Itoa(version) != consentType {
+				warnings = append(warnings, &errortypes.Warning{Message: fmt.Sprintf("GDPR consent is a TCF v%d string, but consent_type is %s. It will be ignored.", version, consentType)})
+				policies.GDPR.Consent = ""
+			}
+		default:
+			warnings = append(warnings, &errortypes.Warning{Message: fmt.Sprintf("consent_type %s isn't supported. The consent_string will be ignored.", consentType)})
+		}
+	}
+
+	// gdpr_applies and addtl_consent go with TCF consent, so they're ignored along with US Privacy strings
+	if consentType == ampConsentTypeUSPrivacy {
+		return policies, warnings
+	}
+	switch gdprApplies := query.Get("gdpr_applies"); gdprApplies {
+	case "true":
+		policies.GDPR.Signal = "1"
+	case "false":
+		policies.GDPR.Signal = "0"
+	case "":
+	default:
+		warnings = append(warnings, &errortypes.Warning{Message: fmt.Sprintf("gdpr_applies must be true or false. Got %s. It will be ignored.", gdprApplies)})
+	}
+	policies.GDPR.AdditionalConsent = query.Get("addtl_consent")
+
+	return policies, warnings
 }
 
 func makeFormatReplacement(overrideWidth uint64, overrideHeight uint64, width uint64, height uint64, multisize string) []openrtb.Format {
@@ -512,6 +639,11 @@ func defaultRequestExt(req *openrtb.BidRequest) (errs []error) {
 	if setDefaults {
 		newExt, err := json.Marshal(extRequest)
 		if err == nil {
+			// The exchange applies the account's price granularity when the request doesn't set one,
+			// so don't fill in the host default here.
+			if _, _, _, err := jsonparser.Get(req.Ext, "prebid", "targeting", "pricegranularity"); err != nil {
+				newExt = jsonparser.Delete(newExt, "prebid", "targeting", "pricegranularity")
+			}
 			req.Ext = newExt
 		} else {
 			errs = []error{err}
@@ -10,16 +10,24 @@ import (
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/prebid/prebid-server/stored_requests"
 	"github.com/prebid/prebid-server/stored_requests/backends/empty_fetcher"
 
+	"github.com/buger/jsonparser"
 	"github.com/mxmCherry/openrtb"
 	analyticsConf "github.com/prebid/prebid-server/analytics/config"
 	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
+	"github.com/prebid/prebid-server/privacy"
+	"github.com/prebid/prebid-server/privacy/ccpa"
+	"github.com/prebid/prebid-server/privacy/gdpr"
 	metrics "github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,12 +55,14 @@ func TestGoodAmpRequests(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{goodRequests},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	for requestID := range goodRequests {
@@ -101,12 +111,14 @@ func TestAMPPageInfo(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&curl=%s", url.QueryEscape(page)), nil)
 	recorder := httptest.NewRecorder()
@@ -145,12 +157,14 @@ func TestConsentThroughEndpoint(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&gdpr_consent=%s", consentString), nil)
 	recorder := httptest.NewRecorder()
@@ -208,12 +222,14 @@ func TestConsentThroughEndpointNilUser(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&gdpr_consent=%s", consentString), nil)
 	recorder := httptest.NewRecorder()
@@ -268,12 +284,14 @@ func TestConsentThroughEndpointNilUserExt(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&gdpr_consent=%s", consentString), nil)
 	recorder := httptest.NewRecorder()
@@ -328,12 +346,14 @@ func TestSubstituteRequestConsentWithEndpointConsent(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&gdpr_consent=%s", consentString), nil)
 	recorder := httptest.NewRecorder()
@@ -388,12 +408,14 @@ func TestDontSubstituteRequestConsentWithBlankEndpointConsent(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&gdpr_consent=%s", httpURLConsentString), nil)
 	recorder := httptest.NewRecorder()
@@ -443,12 +465,14 @@ func TestDontSubstituteRequestConsentNoEndpointConsent(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	consentStringLessHttpRequest := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=1"), nil)
 	recorder := httptest.NewRecorder()
@@ -486,12 +510,14 @@ func TestAMPSiteExt(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{stored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		nil,
 		nil,
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	request, err := http.NewRequest("GET", "/openrtb2/auction/amp?tag_id=1", nil)
 	if !assert.NoError(t, err) {
@@ -526,12 +552,14 @@ func TestAmpBadRequests(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{badRequests},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 	for requestID := range badRequests {
 		request := httptest.NewRequest("GET", fmt.Sprintf("/openrtb2/auction/amp?tag_id=%s", requestID), nil)
@@ -557,12 +585,14 @@ func TestAmpDebug(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{requests},
 		empty_fetcher.EmptyFetcher{},
-		&config.Configuration{MaxRequestSize: maxSize},
+		empty_fetcher.EmptyFetcher{},
+		&config.Configuration{MaxRequestSize: maxSize, Debug: config.Debug{Allowed: true}},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	for requestID := range requests {
@@ -619,6 +649,81 @@ func TestAmpTargetingDefaults(t *testing.T) {
 	}
 }
 
+func TestAmpAccountDefaults(t *testing.T) {
+	lowGranularity := openrtb_ext.PriceGranularityFromString("low")
+	testCases := []struct {
+		description         string
+		storedRequest       string
+		account             config.Account
+		hostTimeouts        config.AuctionTimeouts
+		expectedGranularity bool
+		expectedTimeout     time.Duration
+	}{
+		{
+			description:     "No targeting in the request leaves the price granularity to the exchange",
+			storedRequest:   `{"id":"some-request-id","site":{"page":"test.somepage.com"},"imp":[{"id":"my-imp-id","banner":{"format":[{"w":300,"h":600}]},"ext":{"appnexus":{"placementId":12883451}}}]}`,
+			account:         config.Account{PriceGranularity: &lowGranularity},
+			expectedTimeout: time.Duration(defaultAmpRequestTimeoutMillis) * time.Millisecond,
+		},
+		{
+			description:         "The request's price granularity is kept",
+			storedRequest:       validRequest(t, "site.json"),
+			account:             config.Account{PriceGranularity: &lowGranularity},
+			expectedGranularity: true,
+			expectedTimeout:     time.Duration(defaultAmpRequestTimeoutMillis) * time.Millisecond,
+		},
+		{
+			description:         "The account timeout is used if it's below the host max",
+			storedRequest:       validRequest(t, "site.json"),
+			account:             config.Account{DefaultTimeoutMS: 800},
+			hostTimeouts:        config.AuctionTimeouts{Default: 500, Max: 1000},
+			expectedGranularity: true,
+			expectedTimeout:     800 * time.Millisecond,
+		},
+		{
+			description:         "The account timeout is capped at the host max",
+			storedRequest:       validRequest(t, "site.json"),
+			account:             config.Account{DefaultTimeoutMS: 5000},
+			hostTimeouts:        config.AuctionTimeouts{Default: 500, Max: 1000},
+			expectedGranularity: true,
+			expectedTimeout:     1000 * time.Millisecond,
+		},
+	}
+
+	for _, test := range testCases {
+		exchange := &mockAmpExchange{}
+		endpoint, _ := NewAmpEndpoint(
+			exchange,
+			newParamsValidator(t),
+			&mockAmpStoredReqFetcher{map[string]json.RawMessage{"1": json.RawMessage(test.storedRequest)}},
+			empty_fetcher.EmptyFetcher{},
+			empty_fetcher.EmptyFetcher{},
+			&config.Configuration{
+				MaxRequestSize:  maxSize,
+				AccountDefaults: test.account,
+				AuctionTimeouts: test.hostTimeouts,
+			},
+			&metricsConf.DummyMetricsEngine{},
+			analyticsConf.NewPBSAnalytics(&config.Analytics{}),
+			nil,
+			nil,
+			openrtb_ext.BidderMap,
+			nil,
+		)
+		start := time.Now()
+		request := httptest.NewRequest("GET", "/openrtb2/auction/amp?tag_id=1", nil)
+		recorder := httptest.NewRecorder()
+		endpoint(recorder, request, nil)
+
+		if !assert.NotNil(t, exchange.lastRequest, "%s: endpoint responded with %d: %s", test.description, recorder.Code, recorder.Body.String()) {
+			continue
+		}
+		_, _, _, err := jsonparser.Get(exchange.lastRequest.Ext, "prebid", "targeting", "pricegranularity")
+		assert.Equal(t, test.expectedGranularity, err == nil, "%s: ext was %s", test.description, string(exchange.lastRequest.Ext))
+		assert.WithinDuration(t, start.Add(test.expectedTimeout), exchange.lastDeadline, 100*time.Millisecond, test.description)
+	}
+}
+
 func TestQueryParamOverrides(t *testing.T) {
 	requests := map[string]json.RawMessage{
 		"1": json.RawMessage(validRequest(t, "site.json")),
@@ -630,12 +735,14 @@ func TestQueryParamOverrides(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{requests},
 		empty_fetcher.EmptyFetcher{},
-		&config.Configuration{MaxRequestSize: maxSize},
+		empty_fetcher.EmptyFetcher{},
+		&config.Configuration{MaxRequestSize: maxSize, Debug: config.Debug{Allowed: true}},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	requestID := "1"
@@ -758,12 +865,14 @@ func TestCCPAPresent(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{reqStored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	usPrivacy := "1YYN"
@@ -809,12 +918,14 @@ func TestCCPANotPresent(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{reqStored},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	httpReq := httptest.NewRequest("GET", "/openrtb2/auction/amp?tag_id=1", nil)
@@ -835,6 +946,142 @@ func TestCCPANotPresent(t *testing.T) {
 	}
 }
 
+func TestReadAmpPrivacyPolicies(t *testing.T) {
+	const tcf1Consent = "BOa71ZYOa71ZYAbABBENA8-AAAAbN7_______9______9uz_Gv_r_f__33e8_39v_h_7_-___m_-3zV4-_lvR11yPA1OrfIrwFhiAw"
+	const tcf2Consent = "COzTVhaOzTVhaGvAAAENAiCIAP_AAH_AAAAAAEEUACCKAAA"
+
+	testCases := []struct {
+		description      string
+		query            string
+		expectedPolicies privacy.Policies
+		expectedWarnings int
+	}{
+		{
+			description: "Legacy params",
+			query:       "gdpr_consent=legacy&us_privacy=1YYN",
+			expectedPolicies: privacy.Policies{
+				GDPR: gdpr.Policy{Consent: "legacy"},
+				CCPA: ccpa.Policy{Value: "1YYN"},
+			},
+		},
+		{
+			description: "TCF v2",
+			query:       "consent_string=" + tcf2Consent + "&consent_type=2&gdpr_applies=true&addtl_consent=1~7.12",
+			expectedPolicies: privacy.Policies{
+				GDPR: gdpr.Policy{Signal: "1", Consent: tcf2Consent, AdditionalConsent: "1~7.12"},
+			},
+		},
+		{
+			description: "TCF v1 without a consent_type",
+			query:       "consent_string=" + tcf1Consent + "&gdpr_applies=false",
+			expectedPolicies: privacy.Policies{
+				GDPR: gdpr.Policy{Signal: "0", Consent: tcf1Consent},
+			},
+		},
+		{
+			description: "US Privacy",
+			query:       "consent_string=1YNN&consent_type=3&gdpr_applies=true",
+			expectedPolicies: privacy.Policies{
+				CCPA: ccpa.Policy{Value: "1YNN"},
+			},
+		},
+		{
+			description: "US Privacy without a consent_type",
+			query:       "consent_string=1YNN",
+			expectedPolicies: privacy.Policies{
+				CCPA: ccpa.Policy{Value: "1YNN"},
+			},
+		},
+		{
+			description:      "Malformed US Privacy",
+			query:            "consent_string=1XYZ&consent_type=3",
+			expectedWarnings: 1,
+		},
+		{
+			description: "Malformed TCF consent",
+			query:       "consent_string=malformed&consent_type=2&gdpr_applies=true",
+			expectedPolicies: privacy.Policies{
+				GDPR: gdpr.Policy{Signal: "1"},
+			},
+			expectedWarnings: 1,
+		},
+		{
+			description:      "TCF version doesn't match the consent_type",
+			query:            "consent_string=" + tcf1Consent + "&consent_type=2",
+			expectedWarnings: 1,
+		},
+		{
+			description:      "Unknown consent_type and gdpr_applies",
+			query:            "consent_string=" + tcf2Consent + "&consent_type=4&gdpr_applies=1",
+			expectedWarnings: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		query, err := url.ParseQuery(test.query)
+		if !assert.NoError(t, err, test.description) {
+			continue
+		}
+		policies, warnings := readAmpPrivacyPolicies(query)
+		assert.Equal(t, test.expectedPolicies, policies, test.description)
+		assert.Len(t, warnings, test.expectedWarnings, test.description)
+		for _, warning := range warnings {
+			assert.Equal(t, errortypes.WarningCode, errortypes.DecodeError(warning), test.description)
+		}
+	}
+}
+
+func TestAmpConsentParams(t *testing.T) {
+	req, err := getTestBidRequest(false, false, "", "digitrustId")
+	if err != nil {
+		t.Fatalf("Failed to marshal the complete openrtb.BidRequest object %v", err)
+	}
+
+	exchange := &mockAmpExchange{}
+	endpoint, _ := NewAmpEndpoint(
+		exchange,
+		newParamsValidator(t),
+		&mockAmpStoredReqFetcher{map[string]json.RawMessage{"1": json.RawMessage(req)}},
+		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
+		&config.Configuration{MaxRequestSize: maxSize},
+		pbsmetrics.NewMetrics(metrics.NewRegistry(), openrtb_ext.BidderList(), config.DisabledMetrics{}),
+		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
+		map[string]string{},
+		[]byte{},
+		openrtb_ext.BidderMap,
+		nil,
+	)
+
+	httpReq := httptest.NewRequest("GET", "/openrtb2/auction/amp?tag_id=1&consent_string=malformed&consent_type=2&gdpr_applies=true&addtl_consent=1~7.12", nil)
+	httpRecorder := httptest.NewRecorder()
+	endpoint(httpRecorder, httpReq, nil)
+
+	if !assert.NotNil(t, exchange.lastRequest, "Endpoint responded with %d: %s", httpRecorder.Code, httpRecorder.Body.String()) {
+		return
+	}
+	if assert.NotNil(t, exchange.lastRequest.Regs) {
+		var regs openrtb_ext.ExtRegs
+		assert.NoError(t, json.Unmarshal(exchange.lastRequest.Regs.Ext, &regs))
+		if assert.NotNil(t, regs.GDPR) {
+			assert.Equal(t, int8(1), *regs.GDPR)
+		}
+	}
+	var userExt openrtb_ext.ExtUser
+	assert.NoError(t, json.Unmarshal(exchange.lastRequest.User.Ext, &userExt))
+	assert.Empty(t, userExt.Consent, "The malformed consent should be ignored")
+	if assert.NotNil(t, userExt.ConsentedProvidersSettings) {
+		assert.Equal(t, "1~7.12", userExt.ConsentedProvidersSettings.ConsentedProviders)
+	}
+
+	var response AmpResponse
+	assert.NoError(t, json.Unmarshal(httpRecorder.Body.Bytes(), &response))
+	if assert.Len(t, response.Warnings[openrtb_ext.PrebidExtKey], 1) {
+		assert.Equal(t, errortypes.WarningCode, response.Warnings[openrtb_ext.PrebidExtKey][0].Code)
+		assert.Contains(t, response.Warnings[openrtb_ext.PrebidExtKey][0].Message, "GDPR consent is invalid")
+	}
+}
+
 type formatOverrideSpec struct {
 	width          uint64
 	height         uint64
@@ -854,12 +1101,14 @@ func (s formatOverrideSpec) execute(t *testing.T) {
 		newParamsValidator(t),
 		&mockAmpStoredReqFetcher{requests},
 		empty_fetcher.EmptyFetcher{},
-		&config.Configuration{MaxRequestSize: maxSize},
+		empty_fetcher.EmptyFetcher{},
+		&config.Configuration{MaxRequestSize: maxSize, Debug: config.Debug{Allowed: true}},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	)
 
 	url := fmt.Sprintf("/openrtb2/auction/amp?tag_id=1&debug=1&w=%d&h=%d&ow=%d&oh=%d&ms=%s", s.width, s.height, s.overrideWidth, s.overrideHeight, s.multisize)
@@ -899,11 +1148,13 @@ func (cf *mockAmpStoredReqFetcher) FetchRequests(ctx context.Context, requestIDs
 }
 
 type mockAmpExchange struct {
-	lastRequest *openrtb.BidRequest
+	lastRequest  *openrtb.BidRequest
+	lastDeadline time.Time
 }
 
-func (m *mockAmpExchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, ids exchange.IdFetcher, labels pbsmetrics.Labels, categoriesFetcher *stored_requests.CategoryFetcher) (*openrtb.BidResponse, error) {
+func (m *mockAmpExchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, ids exchange.IdFetcher, labels pbsmetrics.Labels, account *config.Account, categoriesFetcher *stored_requests.CategoryFetcher, hookExecutor *modules.Executor) (*openrtb.BidResponse, error) {
 	m.lastRequest = bidRequest
+	m.lastDeadline, _ = ctx.Deadline()
 
 	response := &openrtb.BidResponse{
 		SeatBid: []openrtb.SeatBid{{
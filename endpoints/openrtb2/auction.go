@@ -20,10 +20,12 @@ import (
 	"github.com/mxmCherry/openrtb"
 	"github.com/mxmCherry/openrtb/native"
 	nativeRequests "github.com/mxmCherry/openrtb/native/request"
+	accountService "github.com/prebid/prebid-server/account"
 	"github.com/prebid/prebid-server/analytics"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/prebid/prebid-server/prebid"
@@ -32,13 +34,14 @@ import (
 	"github.com/prebid/prebid-server/stored_requests/backends/empty_fetcher"
 	"github.com/prebid/prebid-server/usersync"
 	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/currency"
 )
 
 const storedRequestTimeoutMillis = 50
 
-func NewEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamValidator, requestsById stored_requests.Fetcher, categories stored_requests.CategoryFetcher, cfg *config.Configuration, met pbsmetrics.MetricsEngine, pbsAnalytics analytics.PBSAnalyticsModule, disabledBidders map[string]string, defReqJSON []byte, bidderMap map[string]openrtb_ext.BidderName) (httprouter.Handle, error) {
+func NewEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamValidator, requestsById stored_requests.Fetcher, categories stored_requests.CategoryFetcher, accounts stored_requests.AccountFetcher, cfg *config.Configuration, met pbsmetrics.MetricsEngine, pbsAnalytics analytics.PBSAnalyticsModule, disabledBidders map[string]string, defReqJSON []byte, bidderMap map[string]openrtb_ext.BidderName, hooks *modules.Registry) (httprouter.Handle, error) {
 
-	if ex == nil || validator == nil || requestsById == nil || cfg == nil || met == nil {
+	if ex == nil || validator == nil || requestsById == nil || accounts == nil || cfg == nil || met == nil {
 		return nil, errors.New("NewEndpoint requires non-nil arguments.")
 	}
 	defRequest := defReqJSON != nil && len(defReqJSON) > 0
@@ -49,13 +52,15 @@ func NewEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamValidato
 		requestsById,
 		empty_fetcher.EmptyFetcher{},
 		categories,
+		accounts,
 		cfg,
 		met,
 		pbsAnalytics,
 		disabledBidders,
 		defRequest,
 		defReqJSON,
-		bidderMap}).Auction), nil
+		bidderMap,
+		hooks}).Auction), nil
 }
 
 type endpointDeps struct {
@@ -64,6 +69,7 @@ type endpointDeps struct {
 	storedReqFetcher stored_requests.Fetcher
 	videoFetcher     stored_requests.Fetcher
 	categories       stored_requests.CategoryFetcher
+	accounts         stored_requests.AccountFetcher
 	cfg              *config.Configuration
 	metricsEngine    pbsmetrics.MetricsEngine
 	analytics        analytics.PBSAnalyticsModule
@@ -71,6 +77,7 @@ type endpointDeps struct {
 	defaultRequest   bool
 	defReqJSON       []byte
 	bidderMap        map[string]openrtb_ext.BidderName
+	hooks            *modules.Registry
 }
 
 func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -101,19 +108,16 @@ func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ http
 		deps.analytics.LogAuctionObject(&ao)
 	}()
 
-	req, errL := deps.parseRequest(r)
+	hookExecutor := deps.hooks.NewExecutor(modules.EndpointAuction)
+	req, errL := deps.parseRequest(r, hookExecutor)
 
-	if fatalError(errL) && writeError(errL, w, &labels) {
+	if rejectErr := modules.FindRejectError(errL); rejectErr != nil {
+		deps.writeRejectedAuction(w, req, rejectErr, hookExecutor, false, &ao, &labels)
 		return
 	}
 
-	ctx := context.Background()
-
-	timeout := deps.cfg.AuctionTimeouts.LimitAuctionTimeout(time.Duration(req.TMax) * time.Millisecond)
-	if timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithDeadline(ctx, start.Add(timeout))
-		defer cancel()
+	if fatalError(errL) && writeError(errL, w, &labels) {
+		return
 	}
 
 	usersyncs := usersync.ParsePBSCookieFromRequest(r, &(deps.cfg.HostCookie))
@@ -131,15 +135,32 @@ func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ http
 		labels.PubID = effectivePubID(req.Site.Publisher)
 	}
 
-	if acctIdErr := validateAccount(deps.cfg, labels.PubID); acctIdErr != nil {
-		errL = append(errL, acctIdErr)
+	account, acctIDErrs := deps.getAccount(labels.PubID)
+	if len(acctIDErrs) > 0 {
+		errL = append(errL, acctIDErrs...)
 		writeError(errL, w, &labels)
 		return
 	}
 
-	response, err := deps.ex.HoldAuction(ctx, req, usersyncs, labels, &deps.categories)
+	hookExecutor.SetAccount(account)
+	req, rejectErr := hookExecutor.ExecuteProcessedAuctionRequestStage(req)
+	if rejectErr != nil {
+		deps.writeRejectedAuction(w, req, rejectErr, hookExecutor, deps.isDebug(req, account), &ao, &labels)
+		return
+	}
+
+	ctx := context.Background()
+
+	timeouts := account.AuctionTimeouts(deps.cfg.AuctionTimeouts)
+	timeout := timeouts.LimitAuctionTimeout(time.Duration(req.TMax) * time.Millisecond)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(timeout))
+		defer cancel()
+	}
+
+	response, err := deps.ex.HoldAuction(ctx, req, usersyncs, labels, account, &deps.categories, hookExecutor)
 	ao.Request = req
-	ao.Response = response
 	if err != nil {
 		labels.RequestStatus = pbsmetrics.RequestStatusErr
 		w.WriteHeader(http.StatusInternalServerError)
@@ -150,6 +171,12 @@ func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ http
 		return
 	}
 
+	response = hookExecutor.ExecuteAuctionResponseStage(response)
+	if response.Ext, err = hookExecutor.WriteModulesExt(response.Ext, deps.isDebug(req, account)); err != nil {
+		ao.Errors = append(ao.Errors, fmt.Errorf("Failed to add the module outcomes to the response: %v", err))
+	}
+	ao.Response = response
+
 	// Fixes #231
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
@@ -166,6 +193,26 @@ func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ http
 	}
 }
 
+// writeRejectedAuction answers a request which a module rejected.
+func (deps *endpointDeps) writeRejectedAuction(w http.ResponseWriter, req *openrtb.BidRequest, rejectErr *modules.RejectError, hookExecutor *modules.Executor, debug bool, ao *analytics.AuctionObject, labels *pbsmetrics.Labels) {
+	ao.Request = req
+	ao.Errors = append(ao.Errors, rejectErr)
+	response, err := rejectedAuctionResponse(req.ID, rejectErr, hookExecutor, debug)
+	if err != nil {
+		labels.RequestStatus = pbsmetrics.RequestStatusErr
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Critical error while rejecting the request: %v", err)
+		ao.Status = http.StatusInternalServerError
+		ao.Errors = append(ao.Errors, err)
+		return
+	}
+	ao.Response = response
+	if err := writeJSONResponse(w, response); err != nil {
+		labels.RequestStatus = pbsmetrics.RequestStatusNetworkErr
+		ao.Errors = append(ao.Errors, fmt.Errorf("/openrtb2/auction Failed to send response: %v", err))
+	}
+}
+
 // parseRequest turns the HTTP request into an OpenRTB request. This is guaranteed to return:
 //
 //   - A context which times out appropriately, given the request.
@@ -176,7 +223,7 @@ func (deps *endpointDeps) Auction(w http.ResponseWriter, r *http.Request, _ http
 // possible, it will return errors with messages that suggest improvements.
 //
 // If the errors list has at least one element, then no guarantees are made about the returned request.
-func (deps *endpointDeps) parseRequest(httpRequest *http.Request) (req *openrtb.BidRequest, errs []error) {
+func (deps *endpointDeps) parseRequest(httpRequest *http.Request, hookExecutor *modules.Executor) (req *openrtb.BidRequest, errs []error) {
 	req = &openrtb.BidRequest{}
 	errs = nil
 
@@ -198,6 +245,12 @@ func (deps *endpointDeps) parseRequest(httpRequest *http.Request) (req *openrtb.
 		}
 	}
 
+	requestJson, rejectErr := hookExecutor.ExecuteEntrypointStage(httpRequest, requestJson)
+	if rejectErr != nil {
+		errs = []error{rejectErr}
+		return
+	}
+
 	timeout := parseTimeout(requestJson, time.Duration(storedRequestTimeoutMillis)*time.Millisecond)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -207,6 +260,11 @@ func (deps *endpointDeps) parseRequest(httpRequest *http.Request) (req *openrtb.
 		return
 	}
 
+	if requestJson, rejectErr = hookExecutor.ExecuteRawAuctionRequestStage(requestJson); rejectErr != nil {
+		errs = []error{rejectErr}
+		return
+	}
+
 	if err := json.Unmarshal(requestJson, req); err != nil {
 		errs = []error{err}
 		return
@@ -263,10 +321,14 @@ func (deps *endpointDeps) validateRequest(req *openrtb.BidRequest) []error {
 	}
 
 	var aliases map[string]string
+	var eidPermissions []openrtb_ext.ExtRequestPrebidDataEidPermission
 	if bidExt, err := deps.parseBidExt(req.Ext); err != nil {
 		return []error{err}
 	} else if bidExt != nil {
 		aliases = bidExt.Prebid.Aliases
+		if bidExt.Prebid.Data != nil {
+			eidPermissions = bidExt.Prebid.Data.EidPermissions
+		}
 
 		if err := deps.validateAliases(aliases); err != nil {
 			return []error{err}
@@ -275,6 +337,22 @@ func (deps *endpointDeps) validateRequest(req *openrtb.BidRequest) []error {
 		if err := validateBidAdjustmentFactors(bidExt.Prebid.BidAdjustmentFactors, aliases); err != nil {
 			return []error{err}
 		}
+
+		if err := validateCustomRates(bidExt.Prebid.CurrencyConversions); err != nil {
+			return []error{err}
+		}
+
+		if err := validateSChains(bidExt.Prebid.SChains); err != nil {
+			return []error{err}
+		}
+
+		if err := validateMultiBids(bidExt.Prebid.MultiBid); err != nil {
+			return []error{err}
+		}
+
+		if err := validateFirstPartyData(&bidExt.Prebid, aliases, req.App != nil); err != nil {
+			return []error{err}
+		}
 	}
 
 	if (req.Site == nil && req.App == nil) || (req.Site != nil && req.App != nil) {
@@ -292,7 +370,7 @@ func (deps *endpointDeps) validateRequest(req *openrtb.BidRequest) []error {
 		return errL
 	}
 
-	if err := validateUser(req.User, aliases); err != nil {
+	if err := validateUser(req.User, aliases, eidPermissions); err != nil {
 		errL = append(errL, err)
 		return errL
 	}
@@ -345,6 +423,108 @@ func validateBidAdjustmentFactors(adjustmentFactors map[string]float64, aliases
 	return nil
 }
 
+// validateCustomRates makes sure that ext.prebid.currency.rates only uses real currency codes and positive rates.
+func validateCustomRates(customRates *openrtb_ext.ExtRequestCurrency) error {
+	if customRates == nil {
+		return nil
+	}
+	for fromCurrency, rates := range customRates.ConversionRates {
+		if _, err := currency.ParseISO(fromCurrency); err != nil {
+			return fmt.Errorf("request.ext.prebid.currency.rates: currency code %s is not recognized or malformed", fromCurrency)
+		}
+		for toCurrency, rate := range rates {
+			if _, err := currency.ParseISO(toCurrency); err != nil {
+				return fmt.Errorf("request.ext.prebid.currency.rates.%s: currency code %s is not recognized or malformed", fromCurrency, toCurrency)
+			}
+			if rate <= 0 {
+				return fmt.Errorf("request.ext.prebid.currency.rates.%s.%s must be a positive number. Got %f", fromCurrency, toCurrency, rate)
+			}
+		}
+	}
+	return nil
+}
+
+func validateSChains(sChains []*openrtb_ext.ExtRequestPrebidSChain) error {
+	sChainsByBidder := make(map[string]int, len(sChains))
+	for index, sChain := range sChains {
+		if sChain == nil {
+			return fmt.Errorf("request.ext.prebid.schains[%d] must be an object", index)
+		}
+		if len(sChain.Bidders) == 0 {
+			return fmt.Errorf("request.ext.prebid.schains[%d].bidders must contain at least one bidder, or \"%s\"", index, openrtb_ext.SChainWildcard)
+		}
+		for _, bidder := range sChain.Bidders {
+			if firstIndex, ok := sChainsByBidder[bidder]; ok {
+				return fmt.Errorf("request.ext.prebid.schains contains multiple schains for bidder %s (at indexes %d and %d); it must contain no more than one per bidder.", bidder, firstIndex, index)
+			}
+			sChainsByBidder[bidder] = index
+		}
+		if err := validateSChain(&sChain.SChain, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSChain(sChain *openrtb_ext.ExtRequestPrebidSChainSChain, index int) error {
+	if sChain.Complete != 0 && sChain.Complete != 1 {
+		return fmt.Errorf("request.ext.prebid.schains[%d].schain.complete must be either 0 or 1. Got %d", index, sChain.Complete)
+	}
+	if sChain.Ver == "" {
+		return fmt.Errorf("request.ext.prebid.schains[%d].schain missing required field: \"ver\"", index)
+	}
+	if len(sChain.Nodes) == 0 {
+		return fmt.Errorf("request.ext.prebid.schains[%d].schain.nodes must contain at least one node", index)
+	}
+	for nodeIndex, node := range sChain.Nodes {
+		if node == nil {
+			return fmt.Errorf("request.ext.prebid.schains[%d].schain.nodes[%d] must be an object", index, nodeIndex)
+		}
+		if node.ASI == "" {
+			return fmt.Errorf("request.ext.prebid.schains[%d].schain.nodes[%d] missing required field: \"asi\"", index, nodeIndex)
+		}
+		if node.SID == "" {
+			return fmt.Errorf("request.ext.prebid.schains[%d].schain.nodes[%d] missing required field: \"sid\"", index, nodeIndex)
+		}
+		if node.HP != 0 && node.HP != 1 {
+			return fmt.Errorf("request.ext.prebid.schains[%d].schain.nodes[%d].hp must be either 0 or 1. Got %d", index, nodeIndex, node.HP)
+		}
+	}
+	return nil
+}
+
+func validateMultiBids(multiBids []*openrtb_ext.ExtRequestPrebidMultiBid) error {
+	multiBidsByBidder := make(map[string]int, len(multiBids))
+	for index, multiBid := range multiBids {
+		if multiBid == nil {
+			return fmt.Errorf("request.ext.prebid.multibid[%d] must be an object", index)
+		}
+		if (multiBid.Bidder == "") == (len(multiBid.Bidders) == 0) {
+			return fmt.Errorf("request.ext.prebid.multibid[%d] must define either bidder or bidders, but not both", index)
+		}
+		if multiBid.TargetBidderCodePrefix != "" && multiBid.Bidder == "" {
+			return fmt.Errorf("request.ext.prebid.multibid[%d].targetbiddercodeprefix can only be used with bidder", index)
+		}
+		if len(multiBid.TargetBidderCodePrefix) > openrtb_ext.MaxTargetBidderCodePrefixLength {
+			return fmt.Errorf("request.ext.prebid.multibid[%d].targetbiddercodeprefix must be no longer than %d characters, so that its targeting keys fit in %d. Got %s", index, openrtb_ext.MaxTargetBidderCodePrefixLength, openrtb_ext.MaxTargetingKeyLength, multiBid.TargetBidderCodePrefix)
+		}
+		if multiBid.MaxBids < 1 || multiBid.MaxBids > openrtb_ext.MaxMultiBids {
+			return fmt.Errorf("request.ext.prebid.multibid[%d].maxbids must be in the range [1, %d]. Got %d", index, openrtb_ext.MaxMultiBids, multiBid.MaxBids)
+		}
+		bidders := multiBid.Bidders
+		if multiBid.Bidder != "" {
+			bidders = []string{multiBid.Bidder}
+		}
+		for _, bidder := range bidders {
+			if firstIndex, ok := multiBidsByBidder[bidder]; ok {
+				return fmt.Errorf("request.ext.prebid.multibid contains multiple entries for bidder %s (at indexes %d and %d); it must contain no more than one per bidder.", bidder, firstIndex, index)
+			}
+			multiBidsByBidder[bidder] = index
+		}
+	}
+	return nil
+}
+
 func (deps *endpointDeps) validateImp(imp *openrtb.Imp, aliases map[string]string, index int) []error {
 	if imp.ID == "" {
 		return []error{fmt.Errorf("request.imp[%d] missing required field: \"id\"", index)}
@@ -709,8 +889,8 @@ func (deps *endpointDeps) validateImpExt(imp *openrtb.Imp, aliases map[string]st
 	// migrate from imp[...].ext.${BIDDER} to imp[...].ext.prebid.bidder.${BIDDER}
 	// at this time
 	// https://github.com/prebid/prebid-server/pull/846#issuecomment-476352224
+	var prebidExt openrtb_ext.ExtImpPrebid
 	if rawPrebidExt, ok := bidderExts[openrtb_ext.PrebidExtKey]; ok {
-		var prebidExt openrtb_ext.ExtImpPrebid
 		if err := json.Unmarshal(rawPrebidExt, &prebidExt); err == nil && prebidExt.Bidder != nil {
 			for bidder, ext := range prebidExt.Bidder {
 				if ext == nil {
@@ -722,10 +902,17 @@ func (deps *endpointDeps) validateImpExt(imp *openrtb.Imp, aliases map[string]st
 		}
 	}
 
+	if rawContext, ok := bidderExts[openrtb_ext.ContextExtKey]; ok {
+		var context map[string]json.RawMessage
+		if err := json.Unmarshal(rawContext, &context); err != nil {
+			return []error{fmt.Errorf("request.imp[%d].ext.%s must be an object", impIndex, openrtb_ext.ContextExtKey)}
+		}
+	}
+
 	/* Process all the bidder exts in the request */
 	disabledBidders := []string{}
 	for bidder, ext := range bidderExts {
-		if bidder != openrtb_ext.PrebidExtKey {
+		if bidder != openrtb_ext.PrebidExtKey && bidder != openrtb_ext.ContextExtKey {
 			coreBidder := bidder
 			if tmp, isAlias := aliases[bidder]; isAlias {
 				coreBidder = tmp
@@ -745,6 +932,10 @@ func (deps *endpointDeps) validateImpExt(imp *openrtb.Imp, aliases map[string]st
 		}
 	}
 
+	if err := validateStoredResponses(&prebidExt, bidderExts, impIndex); err != nil {
+		return []error{err}
+	}
+
 	// defer deleting disabled bidders so we don't disrupt the loop
 	if len(disabledBidders) > 0 {
 		for _, bidder := range disabledBidders {
@@ -766,6 +957,27 @@ func (deps *endpointDeps) validateImpExt(imp *openrtb.Imp, aliases map[string]st
 	return errL
 }
 
+// validateStoredResponses makes sure the Stored Responses referenced by imp.ext.prebid can be used by the exchange.
+func validateStoredResponses(prebidExt *openrtb_ext.ExtImpPrebid, bidderExts map[string]json.RawMessage, impIndex int) error {
+	if prebidExt.StoredAuctionResponse != nil {
+		if prebidExt.StoredAuctionResponse.ID == "" {
+			return fmt.Errorf("request.imp[%d].ext.prebid.storedauctionresponse.id is required", impIndex)
+		}
+		if len(prebidExt.StoredBidResponse) > 0 {
+			return fmt.Errorf("request.imp[%d].ext.prebid can't have both a storedauctionresponse and a storedbidresponse", impIndex)
+		}
+	}
+	for i, storedBidResponse := range prebidExt.StoredBidResponse {
+		if storedBidResponse.ID == "" {
+			return fmt.Errorf("request.imp[%d].ext.prebid.storedbidresponse[%d].id is required", impIndex, i)
+		}
+		if _, ok := bidderExts[storedBidResponse.Bidder]; !ok || storedBidResponse.Bidder == openrtb_ext.PrebidExtKey || storedBidResponse.Bidder == openrtb_ext.ContextExtKey {
+			return fmt.Errorf("request.imp[%d].ext.prebid.storedbidresponse[%d].bidder must be one of the bidders in request.imp[%d].ext", impIndex, i, impIndex)
+		}
+	}
+	return nil
+}
+
 func (deps *endpointDeps) parseBidExt(ext json.RawMessage) (*openrtb_ext.ExtRequest, error) {
 	if len(ext) < 1 {
 		return nil, nil
@@ -828,7 +1040,11 @@ func (deps *endpointDeps) validateApp(app *openrtb.App) error {
 	return nil
 }
 
-func validateUser(user *openrtb.User, aliases map[string]string) error {
+func validateUser(user *openrtb.User, aliases map[string]string, eidPermissions []openrtb_ext.ExtRequestPrebidDataEidPermission) error {
+	if err := validateEidPermissions(eidPermissions, aliases); err != nil {
+		return err
+	}
+
 	// DigiTrust support
 	if user != nil && user.Ext != nil {
 		// Creating ExtUser object to check if DigiTrust is valid
@@ -890,6 +1106,106 @@ func validateUser(user *openrtb.User, aliases map[string]string) error {
 	return nil
 }
 
+// validateEidPermissions makes sure that the rules in ext.prebid.data.eidpermissions each name
+// a unique eid source, and only allow bidders which this request could send to.
+func validateEidPermissions(eidPermissions []openrtb_ext.ExtRequestPrebidDataEidPermission, aliases map[string]string) error {
+	uniqueSources := make(map[string]struct{}, len(eidPermissions))
+	for index, permission := range eidPermissions {
+		if permission.Source == "" {
+			return fmt.Errorf("request.ext.prebid.data.eidpermissions[%d] missing required field: \"source\"", index)
+		}
+		if _, ok := uniqueSources[permission.Source]; ok {
+			return fmt.Errorf("request.ext.prebid.data.eidpermissions must contain unique sources. Found %s more than once", permission.Source)
+		}
+		uniqueSources[permission.Source] = struct{}{}
+
+		if len(permission.Bidders) == 0 {
+			return fmt.Errorf("request.ext.prebid.data.eidpermissions[%d].bidders must contain at least one bidder, or \"%s\"", index, openrtb_ext.EidPermissionsWildcard)
+		}
+		for _, bidder := range permission.Bidders {
+			if bidder == openrtb_ext.EidPermissionsWildcard {
+				continue
+			}
+			if !isBidderOrAlias(bidder, aliases) {
+				return fmt.Errorf("request.ext.prebid.data.eidpermissions[%d].bidders contains %s, which is neither a known bidder name nor an alias in request.ext.prebid.aliases.", index, bidder)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFirstPartyData makes sure that ext.prebid.data.bidders and ext.prebid.bidderconfig only name
+// bidders which this request could send to, and that each bidder config can be merged into the request.
+func validateFirstPartyData(prebid *openrtb_ext.ExtRequestPrebid, aliases map[string]string, isApp bool) error {
+	if prebid.Data != nil {
+		for _, bidder := range prebid.Data.Bidders {
+			if !isBidderOrAlias(bidder, aliases) {
+				return fmt.Errorf("request.ext.prebid.data.bidders contains %s, which is neither a known bidder name nor an alias in request.ext.prebid.aliases.", bidder)
+			}
+		}
+	}
+
+	configIndexes := make(map[string]int)
+	for index, bidderConfig := range prebid.BidderConfigs {
+		if len(bidderConfig.Bidders) == 0 {
+			return fmt.Errorf("request.ext.prebid.bidderconfig[%d].bidders must contain at least one bidder", index)
+		}
+		for _, bidder := range bidderConfig.Bidders {
+			if !isBidderOrAlias(bidder, aliases) {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].bidders contains %s, which is neither a known bidder name nor an alias in request.ext.prebid.aliases.", index, bidder)
+			}
+			if firstIndex, ok := configIndexes[bidder]; ok {
+				return fmt.Errorf("request.ext.prebid.bidderconfig contains multiple configs for bidder %s (at indexes %d and %d); it must contain no more than one per bidder.", bidder, firstIndex, index)
+			}
+			configIndexes[bidder] = index
+		}
+		if bidderConfig.Config == nil || bidderConfig.Config.ORTB2 == nil {
+			return fmt.Errorf("request.ext.prebid.bidderconfig[%d] missing required field: \"config.ortb2\"", index)
+		}
+
+		ortb2 := bidderConfig.Config.ORTB2
+		if len(ortb2.Site) > 0 {
+			if isApp {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].config.ortb2.site can't be used because the request has an app", index)
+			}
+			if err := validateORTB2Fragment(ortb2.Site, &openrtb.Site{}); err != nil {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].config.ortb2.site is not a valid site: %v", index, err)
+			}
+		}
+		if len(ortb2.App) > 0 {
+			if !isApp {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].config.ortb2.app can't be used because the request has a site", index)
+			}
+			if err := validateORTB2Fragment(ortb2.App, &openrtb.App{}); err != nil {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].config.ortb2.app is not a valid app: %v", index, err)
+			}
+		}
+		if len(ortb2.User) > 0 {
+			if err := validateORTB2Fragment(ortb2.User, &openrtb.User{}); err != nil {
+				return fmt.Errorf("request.ext.prebid.bidderconfig[%d].config.ortb2.user is not a valid user: %v", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateORTB2Fragment makes sure that the fragment is an object which can be merged into the given type.
+func validateORTB2Fragment(fragment json.RawMessage, object interface{}) error {
+	if _, dataType, _, _ := jsonparser.Get(fragment); dataType != jsonparser.Object {
+		return errors.New("it must be an object")
+	}
+	return json.Unmarshal(fragment, object)
+}
+
+// isBidderOrAlias returns true if the bidder is a known bidder name, or an alias defined by the request.
+func isBidderOrAlias(bidder string, aliases map[string]string) bool {
+	if _, ok := openrtb_ext.BidderMap[bidder]; ok {
+		return true
+	}
+	_, ok := aliases[bidder]
+	return ok
+}
+
 func validateRegs(regs *openrtb.Regs) error {
 	if regs != nil && len(regs.Ext) > 0 {
 		var regsExt openrtb_ext.ExtRegs
@@ -918,6 +1234,7 @@ func (deps *endpointDeps) setFieldsImplicitly(httpReq *http.Request, bidReq *ope
 	setImpsImplicitly(httpReq, bidReq.Imp)
 
 	setAuctionTypeImplicitly(bidReq)
+	setDebugImplicitly(httpReq, bidReq)
 }
 
 // setDeviceImplicitly uses implicit info from httpReq to populate bidReq.Device
@@ -935,6 +1252,21 @@ func setAuctionTypeImplicitly(bidReq *openrtb.BidRequest) {
 	return
 }
 
+// setDebugImplicitly sets ext.prebid.debug if the debug=1 query param was sent, so that debug info can be
+// requested without editing the request body. The exchange decides whether the account is allowed to see it.
+func setDebugImplicitly(httpReq *http.Request, bidReq *openrtb.BidRequest) {
+	if httpReq.URL.Query().Get("debug") != "1" {
+		return
+	}
+	if len(bidReq.Ext) == 0 {
+		bidReq.Ext = json.RawMessage(`{"prebid":{"debug":true}}`)
+		return
+	}
+	if ext, err := jsonparser.Set(bidReq.Ext, []byte("true"), openrtb_ext.PrebidExtKey, "debug"); err == nil {
+		bidReq.Ext = ext
+	}
+}
+
 // setSiteImplicitly uses implicit info from httpReq to populate bidReq.Site
 func setSiteImplicitly(httpReq *http.Request, bidReq *openrtb.BidRequest) {
 	if bidReq.Site == nil || bidReq.Site.Page == "" || bidReq.Site.Domain == "" {
@@ -1219,14 +1551,16 @@ func effectivePubID(pub *openrtb.Publisher) string {
 	return pbsmetrics.PublisherUnknown
 }
 
-func validateAccount(cfg *config.Configuration, pubID string) error {
-	var err error = nil
-	if cfg.AccountRequired && pubID == pbsmetrics.PublisherUnknown {
-		// If specified in the configuration, discard requests that don't come with an account ID.
-		err = error(&errortypes.AcctRequired{Message: fmt.Sprintf("Prebid-server has been configured to discard requests that don't come with an Account ID. Please reach out to the prebid server host.")})
-	} else if _, found := cfg.BlacklistedAcctMap[pubID]; found {
-		// Blacklist account now that we have resolved the value
-		err = error(&errortypes.BlacklistedAcct{Message: fmt.Sprintf("Prebid-server has blacklisted Account ID: %s, please reach out to the prebid server host.", pubID)})
-	}
-	return err
+// getAccount loads the Account config for the given publisher ID.
+// The account backend gets the same time budget as the Stored Request backends.
+func (deps *endpointDeps) getAccount(pubID string) (*config.Account, []error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(storedRequestTimeoutMillis)*time.Millisecond)
+	defer cancel()
+	return accountService.GetAccount(ctx, deps.cfg, deps.accounts, pubID)
+}
+
+// isDebug reports whether the response may carry debug info, such as the module trace.
+// It makes the same decision as the exchange, so the two never disagree.
+func (deps *endpointDeps) isDebug(req *openrtb.BidRequest, account *config.Account) bool {
+	return exchange.IsDebug(req, account.Debug.AllowedOrDefault(deps.cfg.Debug.Allowed))
 }
@@ -78,16 +78,20 @@ func BenchmarkOpenrtbEndpoint(b *testing.B) {
 			infos,
 			gdpr.AlwaysAllow{},
 			currencies.NewRateConverterDefault(),
+			nil,
+			nil,
 		),
 		paramValidator,
 		empty_fetcher.EmptyFetcher{},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
 		map[string]string{},
 		[]byte{},
 		nil,
+		nil,
 	)
 
 	b.ResetTimer()
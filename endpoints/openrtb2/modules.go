@@ -0,0 +1,59 @@
+package openrtb2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/modules"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// rejectedAuctionResponse builds the /openrtb2/auction response for a request which a module rejected.
+// Callers get an ordinary no-bid with the module's No-Bid Reason, rather than an error.
+func rejectedAuctionResponse(requestID string, rejectErr *modules.RejectError, hookExecutor *modules.Executor, debug bool) (*openrtb.BidResponse, error) {
+	nbr := openrtb.NoBidReasonCode(rejectErr.NbrCode)
+	ext, err := hookExecutor.WriteModulesExt(nil, debug)
+	if err != nil {
+		return nil, err
+	}
+	return &openrtb.BidResponse{
+		ID:  requestID,
+		NBR: &nbr,
+		Ext: ext,
+	}, nil
+}
+
+// rejectedAmpResponse builds the /openrtb2/amp response for a request which a module rejected.
+func rejectedAmpResponse(hookExecutor *modules.Executor, debug bool) (*AmpResponse, error) {
+	ext, err := hookExecutor.WriteModulesExt(nil, debug)
+	if err != nil {
+		return nil, err
+	}
+	return &AmpResponse{
+		Targeting: map[string]string{},
+		Ext:       ext,
+	}, nil
+}
+
+// rejectedVideoResponse builds the /openrtb2/video response for a request which a module rejected.
+func rejectedVideoResponse(hookExecutor *modules.Executor, debug bool) (*openrtb_ext.BidResponseVideo, error) {
+	ext, err := hookExecutor.WriteModulesExt(nil, debug)
+	if err != nil {
+		return nil, err
+	}
+	return &openrtb_ext.BidResponseVideo{
+		AdPods: []*openrtb_ext.AdPod{},
+		Ext:    ext,
+	}, nil
+}
+
+// writeJSONResponse sends the response the same way the endpoints send successful auctions.
+func writeJSONResponse(w http.ResponseWriter, response interface{}) error {
+	// Fixes #231
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	w.Header().Set("Content-Type", "application/json")
+	return enc.Encode(response)
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -22,22 +23,24 @@ import (
 	"github.com/prebid/prebid-server/analytics"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/prebid/prebid-server/privacy/gdpr"
 	"github.com/prebid/prebid-server/stored_requests"
 	"github.com/prebid/prebid-server/usersync"
 )
 
 var defaultRequestTimeout int64 = 5000
 
-func NewVideoEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamValidator, requestsById stored_requests.Fetcher, videoFetcher stored_requests.Fetcher, categories stored_requests.CategoryFetcher, cfg *config.Configuration, met pbsmetrics.MetricsEngine, pbsAnalytics analytics.PBSAnalyticsModule, disabledBidders map[string]string, defReqJSON []byte, bidderMap map[string]openrtb_ext.BidderName) (httprouter.Handle, error) {
+func NewVideoEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamValidator, requestsById stored_requests.Fetcher, videoFetcher stored_requests.Fetcher, categories stored_requests.CategoryFetcher, accounts stored_requests.AccountFetcher, cfg *config.Configuration, met pbsmetrics.MetricsEngine, pbsAnalytics analytics.PBSAnalyticsModule, disabledBidders map[string]string, defReqJSON []byte, bidderMap map[string]openrtb_ext.BidderName, hooks *modules.Registry) (httprouter.Handle, error) {
 
-	if ex == nil || validator == nil || requestsById == nil || cfg == nil || met == nil {
+	if ex == nil || validator == nil || requestsById == nil || accounts == nil || cfg == nil || met == nil {
 		return nil, errors.New("NewVideoEndpoint requires non-nil arguments.")
 	}
 	defRequest := defReqJSON != nil && len(defReqJSON) > 0
 
-	return httprouter.Handle((&endpointDeps{ex, validator, requestsById, videoFetcher, categories, cfg, met, pbsAnalytics, disabledBidders, defRequest, defReqJSON, bidderMap}).VideoAuctionEndpoint), nil
+	return httprouter.Handle((&endpointDeps{ex, validator, requestsById, videoFetcher, categories, accounts, cfg, met, pbsAnalytics, disabledBidders, defRequest, defReqJSON, bidderMap, hooks}).VideoAuctionEndpoint), nil
 }
 
 /*
@@ -52,6 +55,7 @@ func NewVideoEndpoint(ex exchange.Exchange, validator openrtb_ext.BidderParamVal
 7. Call setFieldsImplicitly from auction.go to get basic data from the HTTP request into an OpenRTB bid request to start building the OpenRTB bid request.
 8. Loop through ad pods to build array of Imps into OpenRTB request, for each pod:
 	a. Load the stored impression to use as the basis for impressions generated for this pod from the configid field.
+		If the pod has bidders, they replace the bidders in the stored impression.
 	b. NumImps = adpoddurationsec / MIN_VALUE(allowedDurations)
 	c. Build impression array for this pod:
 		I.Create array of NumImps entries initialized to the base impression loaded from the configid.
@@ -95,6 +99,13 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	hookExecutor := deps.hooks.NewExecutor(modules.EndpointVideo)
+	requestJson, rejectErr := hookExecutor.ExecuteEntrypointStage(r, requestJson)
+	if rejectErr != nil {
+		writeRejectedVideo(w, rejectErr, hookExecutor, false, &vo, &labels)
+		return
+	}
+
 	resolvedRequest := requestJson
 
 	//load additional data - stored simplified req
@@ -119,6 +130,11 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 			return
 		}
 	}
+	if resolvedRequest, rejectErr = hookExecutor.ExecuteRawAuctionRequestStage(resolvedRequest); rejectErr != nil {
+		writeRejectedVideo(w, rejectErr, hookExecutor, false, &vo, &labels)
+		return
+	}
+
 	//unmarshal and validate combined result
 	videoBidReq, errL, podErrors := deps.parseVideoRequest(resolvedRequest)
 	if len(errL) > 0 {
@@ -138,7 +154,10 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 	}
 
 	//create full open rtb req from full video request
-	mergeData(videoBidReq, bidReq)
+	if err := mergeData(videoBidReq, bidReq); err != nil {
+		handleError(&labels, w, []error{err}, &vo)
+		return
+	}
 
 	initialPodNumber := len(videoBidReq.PodConfig.Pods)
 	if len(podErrors) > 0 {
@@ -172,14 +191,6 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	ctx := context.Background()
-	timeout := deps.cfg.AuctionTimeouts.LimitAuctionTimeout(time.Duration(bidReq.TMax) * time.Millisecond)
-	if timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithDeadline(ctx, start.Add(timeout))
-		defer cancel()
-	}
-
 	usersyncs := usersync.ParsePBSCookieFromRequest(r, &(deps.cfg.HostCookie))
 	if bidReq.App != nil {
 		labels.Source = pbsmetrics.DemandApp
@@ -194,13 +205,30 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 		labels.PubID = effectivePubID(bidReq.Site.Publisher)
 	}
 
-	if acctIdErr := validateAccount(deps.cfg, labels.PubID); acctIdErr != nil {
-		errL = append(errL, acctIdErr)
+	account, acctIDErrs := deps.getAccount(labels.PubID)
+	if len(acctIDErrs) > 0 {
+		errL = append(errL, acctIDErrs...)
 		handleError(&labels, w, errL, &vo)
 		return
 	}
+
+	hookExecutor.SetAccount(account)
+	if bidReq, rejectErr = hookExecutor.ExecuteProcessedAuctionRequestStage(bidReq); rejectErr != nil {
+		writeRejectedVideo(w, rejectErr, hookExecutor, deps.isDebug(bidReq, account), &vo, &labels)
+		return
+	}
+
+	ctx := context.Background()
+	timeouts := account.AuctionTimeouts(deps.cfg.AuctionTimeouts)
+	timeout := timeouts.LimitAuctionTimeout(time.Duration(bidReq.TMax) * time.Millisecond)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(timeout))
+		defer cancel()
+	}
+
 	//execute auction logic
-	response, err := deps.ex.HoldAuction(ctx, bidReq, usersyncs, labels, &deps.categories)
+	response, err := deps.ex.HoldAuction(ctx, bidReq, usersyncs, labels, account, &deps.categories, hookExecutor)
 	vo.Request = bidReq
 	vo.Response = response
 	if err != nil {
@@ -209,16 +237,27 @@ func (deps *endpointDeps) VideoAuctionEndpoint(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	response = hookExecutor.ExecuteAuctionResponseStage(response)
+	vo.Response = response
+
 	//build simplified response
-	bidResp, err := buildVideoResponse(response, podErrors)
+	// Pods only compete on category and advertiser when brand categories are included
+	var dedupePolicy openrtb_ext.PodDedupePolicy
+	if videoBidReq.IncludeBrandCategory != nil {
+		dedupePolicy = videoBidReq.PodConfig.DedupePolicyOrDefault()
+	}
+	bidResp, err := buildVideoResponse(response, podErrors, dedupePolicy)
 	if err != nil {
 		errL := []error{err}
 		handleError(&labels, w, errL, &vo)
 		return
 	}
-	if bidReq.Test == 1 {
+	if deps.isDebug(bidReq, account) {
 		bidResp.Ext = response.Ext
 	}
+	if bidResp.Ext, err = hookExecutor.WriteModulesExt(bidResp.Ext, deps.isDebug(bidReq, account)); err != nil {
+		vo.Errors = append(vo.Errors, fmt.Errorf("Failed to add the module outcomes to the video response: %v", err))
+	}
 
 	vo.VideoResponse = bidResp
 
@@ -242,6 +281,21 @@ func cleanupVideoBidRequest(videoReq *openrtb_ext.BidRequestVideo, podErrors []P
 	return videoReq
 }
 
+// writeRejectedVideo answers a video request which a module rejected.
+func writeRejectedVideo(w http.ResponseWriter, rejectErr *modules.RejectError, hookExecutor *modules.Executor, debug bool, vo *analytics.VideoObject, labels *pbsmetrics.Labels) {
+	vo.Errors = append(vo.Errors, rejectErr)
+	videoResponse, err := rejectedVideoResponse(hookExecutor, debug)
+	if err != nil {
+		handleError(labels, w, []error{err}, vo)
+		return
+	}
+	vo.VideoResponse = videoResponse
+	if err := writeJSONResponse(w, videoResponse); err != nil {
+		labels.RequestStatus = pbsmetrics.RequestStatusNetworkErr
+		vo.Errors = append(vo.Errors, fmt.Errorf("/openrtb2/video Failed to send response: %v", err))
+	}
+}
+
 func handleError(labels *pbsmetrics.Labels, w http.ResponseWriter, errL []error, vo *analytics.VideoObject) {
 	labels.RequestStatus = pbsmetrics.RequestStatusErr
 	var errors string
@@ -287,6 +341,12 @@ func (deps *endpointDeps) createImpressions(videoReq *openrtb_ext.BidRequestVide
 			podErrors = append(podErrors, podErr)
 			continue
 		}
+		if len(pod.Bidders) > 0 {
+			if errMsgs := deps.setPodBidders(&storedImp, pod); len(errMsgs) > 0 {
+				podErrors = append(podErrors, PodError{PodId: pod.PodId, PodIndex: ind, ErrMsgs: errMsgs})
+				continue
+			}
+		}
 
 		numImps := pod.AdPodDurationSec / minDuration
 		if reqExactDur {
@@ -321,6 +381,61 @@ func (deps *endpointDeps) createImpressions(videoReq *openrtb_ext.BidRequestVide
 	return finalImpsArray, podErrors
 }
 
+// setPodBidders replaces the bidders in the stored imp with the pod's bidders, and validates their params.
+// It returns the error messages for the pod, if any.
+func (deps *endpointDeps) setPodBidders(imp *openrtb.Imp, pod openrtb_ext.Pod) []string {
+	storedExt := make(map[string]json.RawMessage)
+	if len(imp.Ext) > 0 {
+		if err := json.Unmarshal(imp.Ext, &storedExt); err != nil {
+			return []string{fmt.Sprintf("unable to read the ext of configid %s, Pod id: %d", pod.ConfigId, pod.PodId)}
+		}
+	}
+
+	ext := make(map[string]json.RawMessage, len(pod.Bidders)+2)
+	for _, key := range []string{openrtb_ext.PrebidExtKey, openrtb_ext.ContextExtKey} {
+		if value, ok := storedExt[key]; ok {
+			ext[key] = value
+		}
+	}
+
+	var errMsgs []string
+	for _, bidder := range sortedBidders(pod.Bidders) {
+		params := pod.Bidders[bidder]
+		if storedParams, ok := storedExt[bidder]; ok {
+			merged, err := jsonpatch.MergePatch(storedParams, params)
+			if err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("unable to merge PodConfig.Pods.Bidders.%s onto configid %s: %v, Pod id: %d", bidder, pod.ConfigId, err, pod.PodId))
+				continue
+			}
+			params = merged
+		}
+		if err := deps.paramsValidator.Validate(deps.bidderMap[bidder], params); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("PodConfig.Pods.Bidders.%s failed validation: %v, Pod id: %d", bidder, err, pod.PodId))
+			continue
+		}
+		ext[bidder] = params
+	}
+	if len(errMsgs) > 0 {
+		return errMsgs
+	}
+
+	impExt, err := json.Marshal(ext)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	imp.Ext = impExt
+	return nil
+}
+
+func sortedBidders(bidders map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(bidders))
+	for bidder := range bidders {
+		names = append(names, bidder)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -367,12 +482,16 @@ func minMax(array []int) (int, int) {
 	return min, max
 }
 
-func buildVideoResponse(bidresponse *openrtb.BidResponse, podErrors []PodError) (*openrtb_ext.BidResponseVideo, error) {
+// buildVideoResponse groups the winning bids by pod. If dedupePolicy isn't empty, bids in a pod which share
+// a category or an advertiser domain are deduplicated using it.
+func buildVideoResponse(bidresponse *openrtb.BidResponse, podErrors []PodError, dedupePolicy openrtb_ext.PodDedupePolicy) (*openrtb_ext.BidResponseVideo, error) {
 
 	adPods := make([]*openrtb_ext.AdPod, 0)
+	podBids := make(map[int64][]videoPodBid)
 	anyBidsReturned := false
 	for _, seatBid := range bidresponse.SeatBid {
-		for _, bid := range seatBid.Bid {
+		for bidInd := range seatBid.Bid {
+			bid := &seatBid.Bid[bidInd]
 			anyBidsReturned = true
 
 			var tempRespBidExt openrtb_ext.ExtBid
@@ -393,18 +512,20 @@ func buildVideoResponse(bidresponse *openrtb.BidResponse, podErrors []PodError)
 				HbCacheID:  tempRespBidExt.Prebid.Targeting[string(openrtb_ext.HbVastCacheKey)],
 			}
 
-			adPod := findAdPod(podId, adPods)
-			if adPod == nil {
-				adPod = &openrtb_ext.AdPod{
-					PodId:     podId,
-					Targeting: make([]openrtb_ext.VideoTargeting, 0, 0),
-				}
-				adPods = append(adPods, adPod)
+			if findAdPod(podId, adPods) == nil {
+				adPods = append(adPods, &openrtb_ext.AdPod{PodId: podId})
+			}
+			podBid := videoPodBid{bid: bid, targeting: videoTargeting}
+			if tempRespBidExt.Prebid.Video != nil {
+				podBid.duration = tempRespBidExt.Prebid.Video.Duration
 			}
-			adPod.Targeting = append(adPod.Targeting, videoTargeting)
+			podBids[podId] = append(podBids[podId], podBid)
 
 		}
 	}
+	for _, adPod := range adPods {
+		adPod.Targeting, adPod.Exclusions = dedupePodBids(podBids[adPod.PodId], dedupePolicy)
+	}
 
 	//check if there are any bids in response.
 	//if there are no bids - empty response should be returned, no cache errors
@@ -428,6 +549,102 @@ func buildVideoResponse(bidresponse *openrtb.BidResponse, podErrors []PodError)
 	return &openrtb_ext.BidResponseVideo{AdPods: adPods}, nil
 }
 
+// videoPodBid is a bid which won one of the imps made for a pod.
+type videoPodBid struct {
+	bid       *openrtb.Bid
+	targeting openrtb_ext.VideoTargeting
+	duration  int
+}
+
+// dedupePodBids keeps one bid for each category and advertiser domain in the pod, using the policy to choose
+// between them. The bids which were left out are returned as exclusions. An empty policy keeps every bid.
+//
+// The bids which are kept stay in the order they came in.
+func dedupePodBids(bids []videoPodBid, policy openrtb_ext.PodDedupePolicy) ([]openrtb_ext.VideoTargeting, []openrtb_ext.VideoExclusion) {
+	targeting := make([]openrtb_ext.VideoTargeting, 0, len(bids))
+	if policy == "" {
+		for _, podBid := range bids {
+			targeting = append(targeting, podBid.targeting)
+		}
+		return targeting, nil
+	}
+
+	ranking := make([]int, len(bids))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return isBetterPodBid(bids[ranking[i]], bids[ranking[j]], policy)
+	})
+
+	var exclusions []openrtb_ext.VideoExclusion
+	kept := make([]bool, len(bids))
+	categories := make(map[string]struct{})
+	domains := make(map[string]struct{})
+	for _, bidInd := range ranking {
+		podBid := bids[bidInd]
+		category := podBidCategory(podBid.targeting.HbPbCatDur)
+		if _, ok := categories[category]; ok && category != "" {
+			exclusions = append(exclusions, openrtb_ext.VideoExclusion{
+				BidID:      podBid.bid.ID,
+				HbPbCatDur: podBid.targeting.HbPbCatDur,
+				Category:   category,
+			})
+			continue
+		}
+		if domain := findTakenDomain(podBid.bid.ADomain, domains); domain != "" {
+			exclusions = append(exclusions, openrtb_ext.VideoExclusion{
+				BidID:      podBid.bid.ID,
+				HbPbCatDur: podBid.targeting.HbPbCatDur,
+				ADomain:    domain,
+			})
+			continue
+		}
+		kept[bidInd] = true
+		if category != "" {
+			categories[category] = struct{}{}
+		}
+		for _, domain := range podBid.bid.ADomain {
+			domains[strings.ToLower(domain)] = struct{}{}
+		}
+	}
+
+	for bidInd, podBid := range bids {
+		if kept[bidInd] {
+			targeting = append(targeting, podBid.targeting)
+		}
+	}
+	return targeting, exclusions
+}
+
+func isBetterPodBid(a videoPodBid, b videoPodBid, policy openrtb_ext.PodDedupePolicy) bool {
+	if policy == openrtb_ext.PodDedupePolicyDuration && a.duration != b.duration {
+		return a.duration > b.duration
+	}
+	return a.bid.Price > b.bid.Price
+}
+
+// podBidCategory returns the category from hb_pb_cat_dur, which looks like "{price}_{category}_{duration}s"
+// when brand categories are included.
+func podBidCategory(hbPbCatDur string) string {
+	first := strings.Index(hbPbCatDur, "_")
+	last := strings.LastIndex(hbPbCatDur, "_")
+	if first == -1 || last <= first {
+		return ""
+	}
+	return hbPbCatDur[first+1 : last]
+}
+
+// findTakenDomain returns the first of the advertiser domains which is already taken, or "" if none of them are.
+func findTakenDomain(adomain []string, taken map[string]struct{}) string {
+	for _, domain := range adomain {
+		if _, ok := taken[strings.ToLower(domain)]; ok {
+			return domain
+		}
+	}
+	return ""
+}
+
 func findAdPod(podInd int64, pods []*openrtb_ext.AdPod) *openrtb_ext.AdPod {
 	for _, pod := range pods {
 		if pod.PodId == podInd {
@@ -473,11 +690,19 @@ func mergeData(videoRequest *openrtb_ext.BidRequestVideo, bidRequest *openrtb.Bi
 
 	if &videoRequest.User != nil {
 		bidRequest.User = &openrtb.User{
-			BuyerUID: videoRequest.User.Buyeruids["appnexus"], //TODO: map to string merging
 			Yob:      videoRequest.User.Yob,
 			Gender:   videoRequest.User.Gender,
 			Keywords: videoRequest.User.Keywords,
 		}
+		if len(videoRequest.User.Buyeruids) > 0 {
+			userExt, err := json.Marshal(openrtb_ext.ExtUser{
+				Prebid: &openrtb_ext.ExtUserPrebid{BuyerUIDs: videoRequest.User.Buyeruids},
+			})
+			if err != nil {
+				return err
+			}
+			bidRequest.User.Ext = userExt
+		}
 	}
 
 	if len(videoRequest.BCat) != 0 {
@@ -505,10 +730,17 @@ func mergeData(videoRequest *openrtb_ext.BidRequestVideo, bidRequest *openrtb.Bi
 	}
 
 	if videoRequest.Regs != nil {
-		bidRequest.Regs = videoRequest.Regs
+		// The GDPR signal is written into regs.ext below, so copy it to leave the video request alone.
+		regs := *videoRequest.Regs
+		regs.Ext = append(json.RawMessage(nil), regs.Ext...)
+		bidRequest.Regs = &regs
 	}
 
-	return nil
+	gdprPolicy := gdpr.Policy{Consent: videoRequest.User.Gdpr.ConsentString}
+	if videoRequest.User.Gdpr.ConsentRequired {
+		gdprPolicy.Signal = "1"
+	}
+	return gdprPolicy.Write(bidRequest)
 }
 
 func createBidExtension(videoRequest *openrtb_ext.BidRequestVideo) ([]byte, error) {
@@ -532,13 +764,8 @@ func createBidExtension(videoRequest *openrtb_ext.BidRequestVideo) ([]byte, erro
 		durationRangeSec = videoRequest.PodConfig.DurationRangeSec
 	}
 
-	priceGranularity := openrtb_ext.PriceGranularityFromString("med")
-	if videoRequest.PriceGranularity.Precision != 0 {
-		priceGranularity = videoRequest.PriceGranularity
-	}
-
 	targeting := openrtb_ext.ExtRequestTargeting{
-		PriceGranularity:     priceGranularity,
+		PriceGranularity:     videoRequest.PriceGranularity,
 		IncludeWinners:       true,
 		IncludeBrandCategory: inclBrandCat,
 		DurationRangeSec:     durationRangeSec,
@@ -559,6 +786,11 @@ func createBidExtension(videoRequest *openrtb_ext.BidRequestVideo) ([]byte, erro
 	if err != nil {
 		return nil, err
 	}
+	// Leave the price granularity out if the request doesn't set one, so that the exchange
+	// can apply the account's price granularity, or the "med" default.
+	if videoRequest.PriceGranularity.Precision == 0 {
+		reqJSON = jsonparser.Delete(reqJSON, "prebid", "targeting", "pricegranularity")
+	}
 	return reqJSON, nil
 }
 
@@ -602,6 +834,10 @@ func (deps *endpointDeps) validateVideoRequest(req *openrtb_ext.BidRequestVideo)
 		err := errors.New("request missing required field: PodConfig.Pods")
 		errL = append(errL, err)
 	}
+	if policy := req.PodConfig.DedupePolicy; policy != "" && policy != openrtb_ext.PodDedupePolicyPrice && policy != openrtb_ext.PodDedupePolicyDuration {
+		err := fmt.Errorf("request.podconfig.dedupepolicy must be \"%s\" or \"%s\". Got \"%s\"", openrtb_ext.PodDedupePolicyPrice, openrtb_ext.PodDedupePolicyDuration, policy)
+		errL = append(errL, err)
+	}
 	podErrors := make([]PodError, 0, 0)
 	podIdsSet := make(map[int]bool)
 	for ind, pod := range req.PodConfig.Pods {
@@ -629,6 +865,15 @@ func (deps *endpointDeps) validateVideoRequest(req *openrtb_ext.BidRequestVideo)
 			err := fmt.Sprintf("request missing or incorrect required field: PodConfig.Pods.ConfigId, Pod index: %d", ind)
 			podErr.ErrMsgs = append(podErr.ErrMsgs, err)
 		}
+		for _, bidder := range sortedBidders(pod.Bidders) {
+			if _, ok := deps.bidderMap[bidder]; !ok {
+				err := fmt.Sprintf("request.podconfig.pods.bidders contains unknown bidder: %s, Pod index: %d", bidder, ind)
+				podErr.ErrMsgs = append(podErr.ErrMsgs, err)
+			} else if params := pod.Bidders[bidder]; len(params) == 0 || params[0] != '{' {
+				err := fmt.Sprintf("request.podconfig.pods.bidders.%s must be an object, Pod index: %d", bidder, ind)
+				podErr.ErrMsgs = append(podErr.ErrMsgs, err)
+			}
+		}
 		if len(podErr.ErrMsgs) > 0 {
 			podErr.PodId = pod.PodId
 			podErr.PodIndex = ind
@@ -4,16 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/buger/jsonparser"
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/analytics"
 	analyticsConf "github.com/prebid/prebid-server/analytics/config"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/exchange"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/prebid/prebid-server/stored_requests"
@@ -168,6 +171,8 @@ func TestCreateBidExtensionExactDurTrueNoPriceRange(t *testing.T) {
 	}
 	assert.Equal(t, resExt.Prebid.Targeting.DurationRangeSec, []int(nil), "Duration range seconds is incorrect")
 	assert.Equal(t, resExt.Prebid.Targeting.PriceGranularity, openrtb_ext.PriceGranularityFromString("med"), "Price granularity is incorrect")
+	_, _, _, err = jsonparser.Get(res, "prebid", "targeting", "pricegranularity")
+	assert.Equal(t, jsonparser.KeyPathNotFoundError, err, "The price granularity should be left to the exchange, so that the account's can apply")
 }
 
 func TestVideoEndpointNoPods(t *testing.T) {
@@ -289,6 +294,119 @@ func TestVideoEndpointValidationsCritical(t *testing.T) {
 	assert.Equal(t, "request missing required field: Video.Protocols", errors[5].Error(), "Errors array should contain 6 error messages")
 }
 
+func TestVideoEndpointValidationsDedupePolicy(t *testing.T) {
+	ex := &mockExchangeVideo{}
+	deps := mockDeps(t, ex)
+
+	testCases := []struct {
+		policy        openrtb_ext.PodDedupePolicy
+		expectedError string
+	}{
+		{policy: ""},
+		{policy: openrtb_ext.PodDedupePolicyPrice},
+		{policy: openrtb_ext.PodDedupePolicyDuration},
+		{policy: "category", expectedError: `request.podconfig.dedupepolicy must be "price" or "duration". Got "category"`},
+	}
+
+	for _, test := range testCases {
+		req := openrtb_ext.BidRequestVideo{
+			PodConfig: openrtb_ext.PodConfig{
+				DurationRangeSec: []int{15, 30},
+				Pods:             []openrtb_ext.Pod{{PodId: 1, AdPodDurationSec: 30, ConfigId: "qwerty"}},
+				DedupePolicy:     test.policy,
+			},
+			App: &openrtb.App{Bundle: "pbs.com"},
+			Video: openrtb_ext.SimplifiedVideo{
+				Mimes:     []string{"mp4"},
+				Protocols: []openrtb.Protocol{15},
+			},
+		}
+
+		errors, _ := deps.validateVideoRequest(&req)
+		if test.expectedError == "" {
+			assert.Len(t, errors, 0, "Policy %q should be valid", test.policy)
+		} else if assert.Len(t, errors, 1, "Policy %q should be invalid", test.policy) {
+			assert.EqualError(t, errors[0], test.expectedError)
+		}
+	}
+}
+
+func TestVideoEndpointPodBidders(t *testing.T) {
+	ex := &mockExchangeVideo{}
+	reqBody := `{
+		"storedrequestid": "80ce30c53c16e6ede735f123ef6e32361bfc7b22",
+		"podconfig": {
+			"durationrangesec": [30],
+			"requireexactduration": true,
+			"pods": [
+				{"podid": 1, "adpoddurationsec": 30, "configid": "fba10607-0c12-43d1-ad07-b8a513bc75d6", "bidders": {"appnexus": {"placementId": 12345}}},
+				{"podid": 2, "adpoddurationsec": 30, "configid": "8b452b41-2681-4a20-9086-6f16ffad7773", "bidders": {"appnexus": {}}},
+				{"podid": 3, "adpoddurationsec": 30, "configid": "87d82a45-35c3-46cc-9315-2e3eeb91d0f2"},
+				{"podid": 6, "adpoddurationsec": 30, "configid": "87d82a45-35c3-46cc-9315-2e3eeb91d0f2", "bidders": {"appnexus": {"placementId": "bad"}}}
+			]
+		},
+		"site": {"page": "prebid.com"},
+		"video": {"mimes": ["video/mp4"], "protocols": [1]}
+	}`
+	req := httptest.NewRequest("POST", "/openrtb2/video", strings.NewReader(reqBody))
+	recorder := httptest.NewRecorder()
+
+	deps := mockDeps(t, ex)
+	deps.VideoAuctionEndpoint(recorder, req, nil)
+
+	if ex.lastRequest == nil {
+		t.Fatalf("The request never made it into the Exchange.")
+	}
+	impExts := make(map[string]string, len(ex.lastRequest.Imp))
+	for _, imp := range ex.lastRequest.Imp {
+		impExts[imp.ID] = string(imp.Ext)
+	}
+	assert.Equal(t, map[string]string{
+		"1_0": `{"appnexus":{"placementId":12345}}`,
+		"2_0": `{"appnexus":{"placementId":15016213}}`,
+		"3_0": `{"appnexus": {"placementId": 15062775}}`,
+	}, impExts, "The pod bidders should replace the bidders in the stored imps")
+
+	resp := &openrtb_ext.BidResponseVideo{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), resp); err != nil {
+		t.Fatalf("Unable to umarshal response.")
+	}
+	podErr := findAdPod(6, resp.AdPods)
+	if assert.NotNil(t, podErr, "The pod with invalid bidder params should be in the response") && assert.Len(t, podErr.Errors, 1) {
+		assert.Contains(t, podErr.Errors[0], "PodConfig.Pods.Bidders.appnexus failed validation")
+	}
+}
+
+func TestVideoEndpointValidationsPodBidders(t *testing.T) {
+	ex := &mockExchangeVideo{}
+	deps := mockDeps(t, ex)
+
+	req := openrtb_ext.BidRequestVideo{
+		PodConfig: openrtb_ext.PodConfig{
+			DurationRangeSec: []int{30},
+			Pods: []openrtb_ext.Pod{
+				{PodId: 1, AdPodDurationSec: 30, ConfigId: "qwerty", Bidders: map[string]json.RawMessage{"appnexus": json.RawMessage(`{}`)}},
+				{PodId: 2, AdPodDurationSec: 30, ConfigId: "qwerty", Bidders: map[string]json.RawMessage{"unknown": json.RawMessage(`{}`), "appnexus": json.RawMessage(`[]`)}},
+			},
+		},
+		App: &openrtb.App{Bundle: "pbs.com"},
+		Video: openrtb_ext.SimplifiedVideo{
+			Mimes:     []string{"mp4"},
+			Protocols: []openrtb.Protocol{15},
+		},
+	}
+
+	errors, podErrors := deps.validateVideoRequest(&req)
+	assert.Len(t, errors, 0, "Errors should be empty")
+	if assert.Len(t, podErrors, 1, "Only the second pod should have errors") {
+		assert.Equal(t, 2, podErrors[0].PodId)
+		assert.Equal(t, []string{
+			"request.podconfig.pods.bidders.appnexus must be an object, Pod index: 1",
+			"request.podconfig.pods.bidders contains unknown bidder: unknown, Pod index: 1",
+		}, podErrors[0].ErrMsgs)
+	}
+}
+
 func TestVideoEndpointValidationsPodErrors(t *testing.T) {
 	ex := &mockExchangeVideo{}
 	deps := mockDeps(t, ex)
@@ -513,7 +631,7 @@ func TestVideoBuildVideoResponseMissedCacheForOneBid(t *testing.T) {
 	seatBids = append(seatBids, seatBid)
 	openRtbBidResp.SeatBid = seatBids
 
-	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors)
+	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors, "")
 	assert.NoError(t, err, "Should be no error")
 	assert.Len(t, bidRespVideo.AdPods, 1, "AdPods length should be 1")
 	assert.Len(t, bidRespVideo.AdPods[0].Targeting, 2, "AdPod Targeting length should be 2")
@@ -550,7 +668,7 @@ func TestVideoBuildVideoResponseMissedCacheForAllBids(t *testing.T) {
 	seatBids = append(seatBids, seatBid)
 	openRtbBidResp.SeatBid = seatBids
 
-	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors)
+	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors, "")
 	assert.Nil(t, bidRespVideo, "bid response should be nil")
 	assert.Equal(t, "caching failed for all bids", err.Error(), "error should be caching failed for all bids")
 }
@@ -589,7 +707,7 @@ func TestVideoBuildVideoResponsePodErrors(t *testing.T) {
 	podErr2.PodIndex = 2
 	podErrors = append(podErrors, podErr2)
 
-	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors)
+	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors, "")
 	assert.NoError(t, err, "Error should be nil")
 	assert.Len(t, bidRespVideo.AdPods, 3, "AdPods length should be 3")
 	assert.Len(t, bidRespVideo.AdPods[0].Targeting, 2, "First ad pod should be correct and contain 2 targeting elements")
@@ -601,11 +719,88 @@ func TestVideoBuildVideoResponseNoBids(t *testing.T) {
 	openRtbBidResp := openrtb.BidResponse{}
 	podErrors := make([]PodError, 0, 0)
 	openRtbBidResp.SeatBid = make([]openrtb.SeatBid, 0)
-	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors)
+	bidRespVideo, err := buildVideoResponse(&openRtbBidResp, podErrors, "")
 	assert.NoError(t, err, "Error should be nil")
 	assert.Len(t, bidRespVideo.AdPods, 0, "AdPods length should be 0")
 }
 
+func TestVideoBuildVideoResponseDedupe(t *testing.T) {
+	bidExt := func(hbPbCatDur string, duration int) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`{"prebid":{"targeting":{"hb_bidder":"appnexus","hb_pb":"17.00","hb_pb_cat_dur":"%s","hb_size":"1x1","hb_uuid":"837ea3b7-5598-4958-8c45-8e9ef2bf7cc1"},"type":"video","video":{"duration":%d}}}`, hbPbCatDur, duration))
+	}
+	openRtbBidResp := openrtb.BidResponse{
+		SeatBid: []openrtb.SeatBid{{
+			Bid: []openrtb.Bid{
+				{ID: "01", ImpID: "1_0", Price: 15, ADomain: []string{"a.com"}, Ext: bidExt("15.00_395_15s", 15)},
+				{ID: "02", ImpID: "1_1", Price: 17, ADomain: []string{"b.com"}, Ext: bidExt("17.00_395_30s", 30)},
+				{ID: "03", ImpID: "1_2", Price: 12, ADomain: []string{"B.com"}, Ext: bidExt("12.00_406_30s", 30)},
+				{ID: "04", ImpID: "1_3", Price: 10, ADomain: []string{"c.com"}, Ext: bidExt("10.00_123_15s", 15)},
+				{ID: "05", ImpID: "2_0", Price: 10, ADomain: []string{"b.com"}, Ext: bidExt("10.00_395_30s", 30)},
+			},
+		}},
+	}
+
+	testCases := []struct {
+		description        string
+		policy             openrtb_ext.PodDedupePolicy
+		expectedPodBids    [][]string
+		expectedExclusions [][]openrtb_ext.VideoExclusion
+	}{
+		{
+			description:        "No policy keeps every bid",
+			policy:             "",
+			expectedPodBids:    [][]string{{"15.00_395_15s", "17.00_395_30s", "12.00_406_30s", "10.00_123_15s"}, {"10.00_395_30s"}},
+			expectedExclusions: [][]openrtb_ext.VideoExclusion{nil, nil},
+		},
+		{
+			description:     "Price policy keeps the highest bid for each category and advertiser",
+			policy:          openrtb_ext.PodDedupePolicyPrice,
+			expectedPodBids: [][]string{{"17.00_395_30s", "10.00_123_15s"}, {"10.00_395_30s"}},
+			expectedExclusions: [][]openrtb_ext.VideoExclusion{
+				{
+					{BidID: "01", HbPbCatDur: "15.00_395_15s", Category: "395"},
+					{BidID: "03", HbPbCatDur: "12.00_406_30s", ADomain: "B.com"},
+				},
+				nil,
+			},
+		},
+		{
+			description:     "Duration policy keeps the longest bid, then the highest",
+			policy:          openrtb_ext.PodDedupePolicyDuration,
+			expectedPodBids: [][]string{{"17.00_395_30s", "10.00_123_15s"}, {"10.00_395_30s"}},
+			expectedExclusions: [][]openrtb_ext.VideoExclusion{
+				{
+					{BidID: "03", HbPbCatDur: "12.00_406_30s", ADomain: "B.com"},
+					{BidID: "01", HbPbCatDur: "15.00_395_15s", Category: "395"},
+				},
+				nil,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		bidRespVideo, err := buildVideoResponse(&openRtbBidResp, nil, test.policy)
+		if !assert.NoError(t, err, test.description) || !assert.Len(t, bidRespVideo.AdPods, 2, test.description) {
+			continue
+		}
+		for podInd, adPod := range bidRespVideo.AdPods {
+			podBids := make([]string, 0, len(adPod.Targeting))
+			for _, targeting := range adPod.Targeting {
+				podBids = append(podBids, targeting.HbPbCatDur)
+			}
+			assert.Equal(t, test.expectedPodBids[podInd], podBids, test.description)
+			assert.Equal(t, test.expectedExclusions[podInd], adPod.Exclusions, test.description)
+		}
+	}
+}
+
+func TestPodBidCategory(t *testing.T) {
+	assert.Equal(t, "395", podBidCategory("20.00_395_30s"))
+	assert.Equal(t, "IAB1-5", podBidCategory("20.00_IAB1-5_30s"))
+	assert.Equal(t, "", podBidCategory("20.00_30s"), "No category without brand categories")
+	assert.Equal(t, "", podBidCategory(""))
+}
+
 func TestMergeOpenRTBToVideoRequest(t *testing.T) {
 	var bidReq = &openrtb.BidRequest{}
 	var videoReq = &openrtb_ext.BidRequestVideo{}
@@ -649,6 +844,40 @@ func TestMergeOpenRTBToVideoRequest(t *testing.T) {
 	assert.Equal(t, videoReq.Regs, bidReq.Regs, "Regs is incorrect")
 }
 
+func TestMergeOpenRTBToVideoRequestUser(t *testing.T) {
+	bidReq := &openrtb.BidRequest{}
+	videoReq := &openrtb_ext.BidRequestVideo{
+		User: openrtb_ext.SimplifiedUser{
+			Buyeruids: map[string]string{"appnexus": "unique_id_an", "rubicon": "unique_id_rubi"},
+			Gdpr:      openrtb_ext.Gdpr{ConsentRequired: true, ConsentString: "BONV8oqONXwgmADACHENAO7pqzAAppY"},
+			Yob:       1991,
+		},
+	}
+
+	assert.NoError(t, mergeData(videoReq, bidReq))
+
+	assert.Empty(t, bidReq.User.BuyerUID, "The buyeruids go in User.Ext")
+	assert.Equal(t, int64(1991), bidReq.User.Yob, "User.Yob is incorrect")
+	assert.JSONEq(t, `{"prebid":{"buyeruids":{"appnexus":"unique_id_an","rubicon":"unique_id_rubi"}},"consent":"BONV8oqONXwgmADACHENAO7pqzAAppY"}`, string(bidReq.User.Ext), "User.Ext is incorrect")
+	assert.JSONEq(t, `{"gdpr":1}`, string(bidReq.Regs.Ext), "Regs.Ext is incorrect")
+}
+
+func TestMergeOpenRTBToVideoRequestGDPR(t *testing.T) {
+	bidReq := &openrtb.BidRequest{}
+	videoReq := &openrtb_ext.BidRequestVideo{
+		User: openrtb_ext.SimplifiedUser{
+			Gdpr: openrtb_ext.Gdpr{ConsentRequired: true, ConsentString: `BONV8oqONXwgmADACHENAO7pqzAAppY","injected":"1`},
+		},
+		Regs: &openrtb.Regs{Ext: json.RawMessage(`{"us_privacy":"1NYN"}`)},
+	}
+
+	assert.NoError(t, mergeData(videoReq, bidReq))
+
+	assert.JSONEq(t, `{"consent":"BONV8oqONXwgmADACHENAO7pqzAAppY\",\"injected\":\"1"}`, string(bidReq.User.Ext), "The consent string should be escaped")
+	assert.JSONEq(t, `{"us_privacy":"1NYN","gdpr":1}`, string(bidReq.Regs.Ext), "Regs.Ext is incorrect")
+	assert.JSONEq(t, `{"us_privacy":"1NYN"}`, string(videoReq.Regs.Ext), "The video request's Regs shouldn't change")
+}
+
 func TestHandleError(t *testing.T) {
 	vo := analytics.VideoObject{
 		Status: 200,
@@ -708,6 +937,7 @@ func mockDepsWithMetrics(t *testing.T, ex *mockExchangeVideo) (*endpointDeps, *p
 		&mockVideoStoredReqFetcher{},
 		&mockVideoStoredReqFetcher{},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		mockModule,
@@ -715,6 +945,7 @@ func mockDepsWithMetrics(t *testing.T, ex *mockExchangeVideo) (*endpointDeps, *p
 		false,
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	}
 
 	return edep, theMetrics, mockModule
@@ -739,6 +970,8 @@ func (m *mockAnalyticsModule) LogSetUIDObject(so *analytics.SetUIDObject) { retu
 
 func (m *mockAnalyticsModule) LogAmpObject(ao *analytics.AmpObject) { return }
 
+func (m *mockAnalyticsModule) LogNotificationEventObject(ne *analytics.NotificationEvent) { return }
+
 func mockDeps(t *testing.T, ex *mockExchangeVideo) *endpointDeps {
 	theMetrics := pbsmetrics.NewMetrics(metrics.NewRegistry(), openrtb_ext.BidderList(), config.DisabledMetrics{})
 	edep := &endpointDeps{
@@ -747,6 +980,7 @@ func mockDeps(t *testing.T, ex *mockExchangeVideo) *endpointDeps {
 		&mockVideoStoredReqFetcher{},
 		&mockVideoStoredReqFetcher{},
 		empty_fetcher.EmptyFetcher{},
+		empty_fetcher.EmptyFetcher{},
 		&config.Configuration{MaxRequestSize: maxSize},
 		theMetrics,
 		analyticsConf.NewPBSAnalytics(&config.Analytics{}),
@@ -754,6 +988,7 @@ func mockDeps(t *testing.T, ex *mockExchangeVideo) *endpointDeps {
 		false,
 		[]byte{},
 		openrtb_ext.BidderMap,
+		nil,
 	}
 
 	return edep
@@ -770,28 +1005,31 @@ type mockExchangeVideo struct {
 	lastRequest *openrtb.BidRequest
 }
 
-func (m *mockExchangeVideo) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, ids exchange.IdFetcher, labels pbsmetrics.Labels, categoriesFetcher *stored_requests.CategoryFetcher) (*openrtb.BidResponse, error) {
+func (m *mockExchangeVideo) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, ids exchange.IdFetcher, labels pbsmetrics.Labels, account *config.Account, categoriesFetcher *stored_requests.CategoryFetcher, hookExecutor *modules.Executor) (*openrtb.BidResponse, error) {
 	m.lastRequest = bidRequest
-	ext := []byte(`{"prebid":{"targeting":{"hb_bidder":"appnexus","hb_pb":"20.00","hb_pb_cat_dur":"20.00_395_30s","hb_size":"1x1", "hb_uuid":"837ea3b7-5598-4958-8c45-8e9ef2bf7cc1"},"type":"video"},"bidder":{"appnexus":{"brand_id":1,"auction_id":7840037870526938650,"bidder_id":2,"bid_ad_type":1,"creative_info":{"video":{"duration":30,"mimes":["video\/mp4"]}}}}}`)
+	// Each bid in a pod gets its own category, so that none of them are deduplicated
+	ext := func(category int) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`{"prebid":{"targeting":{"hb_bidder":"appnexus","hb_pb":"20.00","hb_pb_cat_dur":"20.00_%d_30s","hb_size":"1x1", "hb_uuid":"837ea3b7-5598-4958-8c45-8e9ef2bf7cc1"},"type":"video"},"bidder":{"appnexus":{"brand_id":1,"auction_id":7840037870526938650,"bidder_id":2,"bid_ad_type":1,"creative_info":{"video":{"duration":30,"mimes":["video\/mp4"]}}}}}`, category))
+	}
 	return &openrtb.BidResponse{
 		SeatBid: []openrtb.SeatBid{{
 			Bid: []openrtb.Bid{
-				{ID: "01", ImpID: "1_0", Ext: ext},
-				{ID: "02", ImpID: "1_1", Ext: ext},
-				{ID: "03", ImpID: "1_2", Ext: ext},
-				{ID: "04", ImpID: "1_3", Ext: ext},
-				{ID: "05", ImpID: "2_0", Ext: ext},
-				{ID: "06", ImpID: "2_1", Ext: ext},
-				{ID: "07", ImpID: "2_2", Ext: ext},
-				{ID: "08", ImpID: "3_0", Ext: ext},
-				{ID: "09", ImpID: "3_1", Ext: ext},
-				{ID: "10", ImpID: "3_2", Ext: ext},
-				{ID: "11", ImpID: "3_3", Ext: ext},
-				{ID: "12", ImpID: "3_5", Ext: ext},
-				{ID: "13", ImpID: "4_0", Ext: ext},
-				{ID: "14", ImpID: "5_0", Ext: ext},
-				{ID: "15", ImpID: "5_1", Ext: ext},
-				{ID: "16", ImpID: "5_2", Ext: ext},
+				{ID: "01", ImpID: "1_0", Ext: ext(395)},
+				{ID: "02", ImpID: "1_1", Ext: ext(396)},
+				{ID: "03", ImpID: "1_2", Ext: ext(397)},
+				{ID: "04", ImpID: "1_3", Ext: ext(398)},
+				{ID: "05", ImpID: "2_0", Ext: ext(395)},
+				{ID: "06", ImpID: "2_1", Ext: ext(396)},
+				{ID: "07", ImpID: "2_2", Ext: ext(397)},
+				{ID: "08", ImpID: "3_0", Ext: ext(395)},
+				{ID: "09", ImpID: "3_1", Ext: ext(396)},
+				{ID: "10", ImpID: "3_2", Ext: ext(397)},
+				{ID: "11", ImpID: "3_3", Ext: ext(398)},
+				{ID: "12", ImpID: "3_5", Ext: ext(400)},
+				{ID: "13", ImpID: "4_0", Ext: ext(395)},
+				{ID: "14", ImpID: "5_0", Ext: ext(395)},
+				{ID: "15", ImpID: "5_1", Ext: ext(396)},
+				{ID: "16", ImpID: "5_2", Ext: ext(397)},
 			},
 		}},
 	}, nil
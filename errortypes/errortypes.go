@@ -13,6 +13,9 @@ const (
 	BlacklistedAcctCode
 	AcctRequiredCode
 	WarningCode
+	InvalidBidWarningCode
+	BidderThrottledCode
+	ModuleRejectedCode
 )
 
 // We should use this code for any Error interface that is not in this package
@@ -170,6 +173,36 @@ func (err *Warning) Code() int {
 	return WarningCode
 }
 
+// InvalidBidWarning is used when a bid doesn't match what the request asked for.
+// Depending on the bid validation mode, the bid may or may not have been removed from the auction.
+type InvalidBidWarning struct {
+	Message string
+}
+
+func (err *InvalidBidWarning) Error() string {
+	return err.Message
+}
+
+// Code returns the error code
+func (err *InvalidBidWarning) Code() int {
+	return InvalidBidWarningCode
+}
+
+// BidderThrottled is used when a bidder was skipped because it's over the rate of requests which
+// the host allows it to be sent.
+type BidderThrottled struct {
+	Message string
+}
+
+func (err *BidderThrottled) Error() string {
+	return err.Message
+}
+
+// Code returns the error code
+func (err *BidderThrottled) Code() int {
+	return BidderThrottledCode
+}
+
 // DecodeError provides the error code for an error, as defined above
 func DecodeError(err error) int {
 	if ce, ok := err.(Coder); ok {
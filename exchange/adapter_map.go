@@ -60,12 +60,13 @@ import (
 	"github.com/prebid/prebid-server/adapters/yieldmo"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 )
 
 // The newAdapterMap function is segregated to its own file to make it a simple and clean location for each Adapter
 // to register itself. No wading through Exchange code to find it.
 
-func newAdapterMap(client *http.Client, cfg *config.Configuration, infos adapters.BidderInfos) map[openrtb_ext.BidderName]adaptedBidder {
+func newAdapterMap(client *http.Client, cfg *config.Configuration, infos adapters.BidderInfos, me pbsmetrics.MetricsEngine) map[openrtb_ext.BidderName]adaptedBidder {
 	ortbBidders := map[openrtb_ext.BidderName]adapters.Bidder{
 		openrtb_ext.Bidder33Across:     ttx.New33AcrossBidder(cfg.Adapters[string(openrtb_ext.Bidder33Across)].Endpoint),
 		openrtb_ext.BidderAdform:       adform.NewAdformBidder(client, cfg.Adapters[string(openrtb_ext.BidderAdform)].Endpoint),
@@ -150,7 +151,8 @@ func newAdapterMap(client *http.Client, cfg *config.Configuration, infos adapter
 	for name, bidder := range ortbBidders {
 		// Clean out any disabled bidders
 		if infos[string(name)].Status == adapters.StatusActive {
-			allBidders[name] = adaptBidder(adapters.EnforceBidderInfo(bidder, infos[string(name)]), client)
+			adapterCfg := cfg.Adapters[strings.ToLower(string(name))]
+			allBidders[name] = adaptBidder(adapters.EnforceBidderInfo(bidder, infos[string(name)]), bidderClient(client, adapterCfg), name, me, adapterCfg)
 		}
 	}
 
@@ -162,6 +164,32 @@ func newAdapterMap(client *http.Client, cfg *config.Configuration, infos adapter
 	return allBidders
 }
 
+// bidderClient returns the client for a bidder's requests. Bidders which set max_idle_connections get their own
+// pool of connections, so that a slow bidder can't use up the connections which the other bidders need.
+func bidderClient(client *http.Client, cfg config.Adapter) *http.Client {
+	if client == nil || cfg.MaxIdleConns == 0 {
+		return client
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 transport.Proxy,
+			DialContext:           transport.DialContext,
+			TLSClientConfig:       transport.TLSClientConfig,
+			TLSHandshakeTimeout:   transport.TLSHandshakeTimeout,
+			IdleConnTimeout:       transport.IdleConnTimeout,
+			ResponseHeaderTimeout: transport.ResponseHeaderTimeout,
+			ExpectContinueTimeout: transport.ExpectContinueTimeout,
+			MaxIdleConns:          cfg.MaxIdleConns,
+			MaxIdleConnsPerHost:   cfg.MaxIdleConns,
+		},
+		Timeout: client.Timeout,
+	}
+}
+
 // DisableBidders get all bidders but disabled ones
 func DisableBidders(biddersInfo adapters.BidderInfos, disabledBidders map[string]string) (bidderMap map[string]openrtb_ext.BidderName) {
 	bidderMap = make(map[string]openrtb_ext.BidderName)
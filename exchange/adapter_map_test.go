@@ -1,17 +1,21 @@
 package exchange
 
 import (
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prebid/prebid-server/adapters"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewAdapterMap(t *testing.T) {
 	cfg := &config.Configuration{Adapters: blankAdapterConfig(openrtb_ext.BidderList())}
-	adapterMap := newAdapterMap(nil, cfg, adapters.ParseBidderInfos(cfg.Adapters, "../static/bidder-info", openrtb_ext.BidderList()))
+	adapterMap := newAdapterMap(nil, cfg, adapters.ParseBidderInfos(cfg.Adapters, "../static/bidder-info", openrtb_ext.BidderList()), &metricsConf.DummyMetricsEngine{})
 	for _, bidderName := range openrtb_ext.BidderMap {
 		if bidder, ok := adapterMap[bidderName]; bidder == nil || !ok {
 			t.Errorf("adapterMap missing expected Bidder: %s", string(bidderName))
@@ -38,7 +42,7 @@ func TestNewAdapterMapDisabledAdapters(t *testing.T) {
 			}
 		}
 	}
-	adapterMap := newAdapterMap(nil, &config.Configuration{Adapters: cfgAdapters}, adapters.ParseBidderInfos(cfgAdapters, "../static/bidder-info", bidderList))
+	adapterMap := newAdapterMap(nil, &config.Configuration{Adapters: cfgAdapters}, adapters.ParseBidderInfos(cfgAdapters, "../static/bidder-info", bidderList), &metricsConf.DummyMetricsEngine{})
 	for _, bidderName := range openrtb_ext.BidderMap {
 		if bidder, ok := adapterMap[bidderName]; bidder == nil || !ok {
 			if inList(bidderList, bidderName) {
@@ -68,3 +72,23 @@ func blankAdapterConfig(bidderList []openrtb_ext.BidderName) map[string]config.A
 	}
 	return adapters
 }
+
+func TestBidderClient(t *testing.T) {
+	shared := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        400,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     60 * time.Second,
+		},
+	}
+
+	assert.Equal(t, shared, bidderClient(shared, config.Adapter{}), "Bidders without max_idle_connections share the client")
+
+	client := bidderClient(shared, config.Adapter{MaxIdleConns: 25})
+	if assert.NotEqual(t, shared, client, "Bidders with max_idle_connections get their own client") {
+		transport := client.Transport.(*http.Transport)
+		assert.Equal(t, 25, transport.MaxIdleConns)
+		assert.Equal(t, 25, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 60*time.Second, transport.IdleConnTimeout)
+	}
+}
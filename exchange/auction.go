@@ -5,19 +5,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	uuid "github.com/gofrs/uuid"
 	"github.com/golang/glog"
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/analytics"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/prebid_cache_client"
 )
 
-func newAuction(seatBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, numImps int) *auction {
+func newAuction(seatBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, numImps int, multiBid map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid) *auction {
 	winningBids := make(map[string]*pbsOrtbBid, numImps)
-	winningBidsByBidder := make(map[string]map[openrtb_ext.BidderName]*pbsOrtbBid, numImps)
+	winningBidsByBidder := make(map[string]map[openrtb_ext.BidderName][]*pbsOrtbBid, numImps)
 
 	for bidderName, seatBid := range seatBids {
 		if seatBid != nil {
@@ -28,39 +30,78 @@ func newAuction(seatBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, numImps int
 					winningBids[bid.bid.ImpID] = bid
 				}
 				if bidMap, ok := winningBidsByBidder[bid.bid.ImpID]; ok {
-					bestSoFar, ok := bidMap[bidderName]
-					if !ok || cpm > bestSoFar.bid.Price {
-						bidMap[bidderName] = bid
-					}
+					bidMap[bidderName] = append(bidMap[bidderName], bid)
 				} else {
-					winningBidsByBidder[bid.bid.ImpID] = make(map[openrtb_ext.BidderName]*pbsOrtbBid)
-					winningBidsByBidder[bid.bid.ImpID][bidderName] = bid
+					winningBidsByBidder[bid.bid.ImpID] = make(map[openrtb_ext.BidderName][]*pbsOrtbBid)
+					winningBidsByBidder[bid.bid.ImpID][bidderName] = []*pbsOrtbBid{bid}
 				}
 			}
 		}
 	}
 
+	for _, bidMap := range winningBidsByBidder {
+		for bidderName, bids := range bidMap {
+			// The stable sort makes sure that ties go to whichever bid the bidder returned first.
+			sort.SliceStable(bids, func(i, j int) bool {
+				return bids[i].bid.Price > bids[j].bid.Price
+			})
+			if maxBids := maxBidsFor(multiBid, bidderName); len(bids) > maxBids {
+				bidMap[bidderName] = bids[:maxBids]
+			}
+		}
+	}
+
 	return &auction{
 		winningBids:         winningBids,
 		winningBidsByBidder: winningBidsByBidder,
 	}
 }
 
+// getMultiBid maps each bidder in ext.prebid.multibid to its config.
+func getMultiBid(multiBids []*openrtb_ext.ExtRequestPrebidMultiBid) map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid {
+	if len(multiBids) == 0 {
+		return nil
+	}
+	multiBid := make(map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid, len(multiBids))
+	for _, thisMultiBid := range multiBids {
+		if thisMultiBid == nil {
+			continue
+		}
+		if thisMultiBid.Bidder != "" {
+			multiBid[openrtb_ext.BidderName(thisMultiBid.Bidder)] = thisMultiBid
+		}
+		for _, bidder := range thisMultiBid.Bidders {
+			multiBid[openrtb_ext.BidderName(bidder)] = thisMultiBid
+		}
+	}
+	return multiBid
+}
+
+// maxBidsFor returns the number of bids per imp which the bidder can have in the auction.
+func maxBidsFor(multiBid map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid, bidderName openrtb_ext.BidderName) int {
+	if thisMultiBid, ok := multiBid[bidderName]; ok && thisMultiBid.MaxBids > 1 {
+		return thisMultiBid.MaxBids
+	}
+	return 1
+}
+
 func (a *auction) setRoundedPrices(priceGranularity openrtb_ext.PriceGranularity) {
 	roundedPrices := make(map[*pbsOrtbBid]string, 5*len(a.winningBids))
 	for _, topBidsPerImp := range a.winningBidsByBidder {
-		for _, topBidPerBidder := range topBidsPerImp {
-			roundedPrice, err := GetCpmStringValue(topBidPerBidder.bid.Price, priceGranularity)
-			if err != nil {
-				glog.Errorf(`Error rounding price according to granularity. This shouldn't happen unless /openrtb2 input validation is buggy. Granularity was "%v".`, priceGranularity)
+		for _, topBidsPerBidder := range topBidsPerImp {
+			for _, topBid := range topBidsPerBidder {
+				roundedPrice, err := GetCpmStringValue(topBid.bid.Price, priceGranularity)
+				if err != nil {
+					glog.Errorf(`Error rounding price according to granularity. This shouldn't happen unless /openrtb2 input validation is buggy. Granularity was "%v".`, priceGranularity)
+				}
+				roundedPrices[topBid] = roundedPrice
 			}
-			roundedPrices[topBidPerBidder] = roundedPrice
 		}
 	}
 	a.roundedPrices = roundedPrices
 }
 
-func (a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client, targData *targetData, bidRequest *openrtb.BidRequest, ttlBuffer int64, defaultTTLs *config.DefaultTTLs, bidCategory map[string]string) []error {
+func (a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client, targData *targetData, bidRequest *openrtb.BidRequest, ttlBuffer int64, defaultTTLs *config.DefaultTTLs, bidCategory map[string]string, events *eventTracking, vastTracker *vastImpressionTracker) []error {
 	var bids, vast, includeBidderKeys, includeWinners bool = targData.includeCacheBids, targData.includeCacheVast, targData.includeBidderKeys, targData.includeWinners
 	if !((bids || vast) && (includeBidderKeys || includeWinners)) {
 		return nil
@@ -89,59 +130,72 @@ func (a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client,
 		expByImp[imp.ID] = imp.Exp
 	}
 	for _, topBidsPerImp := range a.winningBidsByBidder {
-		for _, topBidPerBidder := range topBidsPerImp {
-			impID := topBidPerBidder.bid.ImpID
-			isOverallWinner := a.winningBids[impID] == topBidPerBidder
-			if !includeBidderKeys && !isOverallWinner {
-				continue
-			}
-			var customCacheKey string
-			var catDur string
-			useCustomCacheKey := false
-			if competitiveExclusion && isOverallWinner {
-				// set custom cache key for winning bid when competitive exclusion applies
-				catDur = bidCategory[topBidPerBidder.bid.ID]
-				if len(catDur) > 0 {
-					customCacheKey = fmt.Sprintf("%s_%s", catDur, hbCacheID)
-					useCustomCacheKey = true
+		for bidderName, topBidsPerBidder := range topBidsPerImp {
+			for index, topBidPerBidder := range topBidsPerBidder {
+				impID := topBidPerBidder.bid.ImpID
+				isOverallWinner := a.winningBids[impID] == topBidPerBidder
+				if !includeBidderKeys && !isOverallWinner {
+					continue
 				}
-			}
-			if bids {
-				if jsonBytes, err := json.Marshal(topBidPerBidder.bid); err == nil {
-					if useCustomCacheKey {
-						// not allowed if bids is true; log error and cache normally
-						errs = append(errs, errors.New("cannot use custom cache key for non-vast bids"))
+				// Bids which won't get targeting keys can't be found in the cache, so there's no point in caching them.
+				if _, ok := targData.targetBidder(bidderName, index); !ok {
+					continue
+				}
+				var customCacheKey string
+				var catDur string
+				useCustomCacheKey := false
+				if competitiveExclusion && isOverallWinner {
+					// set custom cache key for winning bid when competitive exclusion applies
+					catDur = bidCategory[topBidPerBidder.bid.ID]
+					if len(catDur) > 0 {
+						customCacheKey = fmt.Sprintf("%s_%s", catDur, hbCacheID)
+						useCustomCacheKey = true
 					}
-					toCache = append(toCache, prebid_cache_client.Cacheable{
-						Type:       prebid_cache_client.TypeJSON,
-						Data:       jsonBytes,
-						TTLSeconds: cacheTTL(expByImp[impID], topBidPerBidder.bid.Exp, defTTL(topBidPerBidder.bidType, defaultTTLs), ttlBuffer),
-					})
-					bidIndices[len(toCache)-1] = topBidPerBidder.bid
-				} else {
-					errs = append(errs, err)
 				}
-			}
-			if vast && topBidPerBidder.bidType == openrtb_ext.BidTypeVideo {
-				vast := makeVAST(topBidPerBidder.bid)
-				if jsonBytes, err := json.Marshal(vast); err == nil {
-					if useCustomCacheKey {
+				if bids {
+					if jsonBytes, err := json.Marshal(topBidPerBidder.bid); err == nil {
+						if useCustomCacheKey {
+							// not allowed if bids is true; log error and cache normally
+							errs = append(errs, errors.New("cannot use custom cache key for non-vast bids"))
+						}
 						toCache = append(toCache, prebid_cache_client.Cacheable{
-							Type:       prebid_cache_client.TypeXML,
+							Type:       prebid_cache_client.TypeJSON,
 							Data:       jsonBytes,
 							TTLSeconds: cacheTTL(expByImp[impID], topBidPerBidder.bid.Exp, defTTL(topBidPerBidder.bidType, defaultTTLs), ttlBuffer),
-							Key:        customCacheKey,
 						})
+						bidIndices[len(toCache)-1] = topBidPerBidder.bid
 					} else {
-						toCache = append(toCache, prebid_cache_client.Cacheable{
-							Type:       prebid_cache_client.TypeXML,
-							Data:       jsonBytes,
-							TTLSeconds: cacheTTL(expByImp[impID], topBidPerBidder.bid.Exp, defTTL(topBidPerBidder.bidType, defaultTTLs), ttlBuffer),
-						})
+						errs = append(errs, err)
+					}
+				}
+				if vast && topBidPerBidder.bidType == openrtb_ext.BidTypeVideo {
+					vast, err := makeVAST(topBidPerBidder.bid, events.makeEventURL(analytics.Imp, topBidPerBidder.bid, bidderName))
+					if err != nil {
+						errs = append(errs, err)
+					}
+					vast, err = vastTracker.inject(vast, topBidPerBidder.bid, bidderName)
+					if err != nil {
+						errs = append(errs, err)
+					}
+					if jsonBytes, err := json.Marshal(vast); err == nil {
+						if useCustomCacheKey {
+							toCache = append(toCache, prebid_cache_client.Cacheable{
+								Type:       prebid_cache_client.TypeXML,
+								Data:       jsonBytes,
+								TTLSeconds: cacheTTL(expByImp[impID], topBidPerBidder.bid.Exp, defTTL(topBidPerBidder.bidType, defaultTTLs), ttlBuffer),
+								Key:        customCacheKey,
+							})
+						} else {
+							toCache = append(toCache, prebid_cache_client.Cacheable{
+								Type:       prebid_cache_client.TypeXML,
+								Data:       jsonBytes,
+								TTLSeconds: cacheTTL(expByImp[impID], topBidPerBidder.bid.Exp, defTTL(topBidPerBidder.bidType, defaultTTLs), ttlBuffer),
+							})
+						}
+						vastIndices[len(toCache)-1] = topBidPerBidder.bid
+					} else {
+						errs = append(errs, err)
 					}
-					vastIndices[len(toCache)-1] = topBidPerBidder.bid
-				} else {
-					errs = append(errs, err)
 				}
 			}
 		}
@@ -178,15 +232,28 @@ func (a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client,
 
 // makeVAST returns some VAST XML for the given bid. If AdM is defined,
 // it takes precedence. Otherwise the Nurl will be wrapped in a redirect tag.
-func makeVAST(bid *openrtb.Bid) string {
+// Either way, the impTracker URL is added as an <Impression> if one is given.
+// If the tracker can't be added to the AdM, the AdM is returned unchanged along with an error.
+func makeVAST(bid *openrtb.Bid, impTracker string) (string, error) {
 	if bid.AdM == "" {
+		impression := ""
+		if impTracker != "" {
+			impression = `<![CDATA[` + impTracker + `]]>`
+		}
 		return `<VAST version="3.0"><Ad><Wrapper>` +
 			`<AdSystem>prebid.org wrapper</AdSystem>` +
 			`<VASTAdTagURI><![CDATA[` + bid.NURL + `]]></VASTAdTagURI>` +
-			`<Impression></Impression><Creatives></Creatives>` +
-			`</Wrapper></Ad></VAST>`
+			`<Impression>` + impression + `</Impression><Creatives></Creatives>` +
+			`</Wrapper></Ad></VAST>`, nil
+	}
+	if impTracker == "" {
+		return bid.AdM, nil
+	}
+	vast, err := injectImpressionTracker(bid.AdM, impTracker)
+	if err != nil {
+		return bid.AdM, fmt.Errorf("Failed to add the impression event tracker to bid %s: %v", bid.ID, err)
 	}
-	return bid.AdM
+	return vast, nil
 }
 
 func valOrZero(useVal bool, val int) int {
@@ -246,8 +313,9 @@ func defTTL(bidType openrtb_ext.BidType, defaultTTLs *config.DefaultTTLs) (ttl i
 type auction struct {
 	// winningBids is a map from imp.id to the highest overall CPM bid in that imp.
 	winningBids map[string]*pbsOrtbBid
-	// winningBidsByBidder stores the highest bid on each imp by each bidder.
-	winningBidsByBidder map[string]map[openrtb_ext.BidderName]*pbsOrtbBid
+	// winningBidsByBidder stores the highest bids on each imp by each bidder, sorted from highest to lowest.
+	// Bidders only have more than one bid here if ext.prebid.multibid allows it.
+	winningBidsByBidder map[string]map[openrtb_ext.BidderName][]*pbsOrtbBid
 	// roundedPrices stores the price strings rounded for each bid according to the price granularity.
 	roundedPrices map[*pbsOrtbBid]string
 	// cacheIds stores the UUIDs from Prebid Cache for fetching the full bid JSON.
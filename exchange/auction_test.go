@@ -22,7 +22,8 @@ func TestMakeVASTGiven(t *testing.T) {
 	bid := &openrtb.Bid{
 		AdM: expect,
 	}
-	vast := makeVAST(bid)
+	vast, err := makeVAST(bid, "")
+	assert.NoError(t, err)
 	assert.Equal(t, expect, vast)
 }
 
@@ -36,10 +37,114 @@ func TestMakeVASTNurl(t *testing.T) {
 	bid := &openrtb.Bid{
 		NURL: url,
 	}
-	vast := makeVAST(bid)
+	vast, err := makeVAST(bid, "")
+	assert.NoError(t, err)
 	assert.Equal(t, expect, vast)
 }
 
+func TestMakeVASTNurlWithImpTracker(t *testing.T) {
+	const url = "http://domain.com/win-notify/1"
+	const tracker = "http://prebid-server.com/event?t=imp&b=1&a=acct"
+	const expect = `<VAST version="3.0"><Ad><Wrapper>` +
+		`<AdSystem>prebid.org wrapper</AdSystem>` +
+		`<VASTAdTagURI><![CDATA[` + url + `]]></VASTAdTagURI>` +
+		`<Impression><![CDATA[` + tracker + `]]></Impression><Creatives></Creatives>` +
+		`</Wrapper></Ad></VAST>`
+	bid := &openrtb.Bid{
+		NURL: url,
+	}
+	vast, err := makeVAST(bid, tracker)
+	assert.NoError(t, err)
+	assert.Equal(t, expect, vast)
+}
+
+func TestMakeVASTGivenWithImpTracker(t *testing.T) {
+	const tracker = "http://prebid-server.com/event?t=imp&b=1&a=acct"
+	bid := &openrtb.Bid{
+		ID:  "1",
+		AdM: `<VAST version="3.0"><Ad><InLine><Impression><![CDATA[http://bidder.com/imp]]></Impression><Creatives></Creatives></InLine></Ad></VAST>`,
+	}
+	vast, err := makeVAST(bid, tracker)
+	assert.NoError(t, err)
+	assert.Equal(t, `<VAST version="3.0"><Ad><InLine><Impression><![CDATA[`+tracker+`]]></Impression><Impression><![CDATA[http://bidder.com/imp]]></Impression><Creatives></Creatives></InLine></Ad></VAST>`, vast)
+
+	bid.AdM = `<VAST version="3.0"><Ad>`
+	vast, err = makeVAST(bid, tracker)
+	assert.Error(t, err, "Malformed VAST")
+	assert.Equal(t, bid.AdM, vast, "Malformed VAST should be returned unchanged")
+}
+
+func TestNewAuctionMultiBid(t *testing.T) {
+	makeBid := func(id string, impID string, price float64) *pbsOrtbBid {
+		return &pbsOrtbBid{bid: &openrtb.Bid{ID: id, ImpID: impID, Price: price}}
+	}
+	seatBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		openrtb_ext.BidderAppnexus: {bids: []*pbsOrtbBid{
+			makeBid("apn-1", "imp-1", 1),
+			makeBid("apn-2", "imp-1", 3),
+			makeBid("apn-3", "imp-1", 2),
+			makeBid("apn-4", "imp-1", 0.5),
+			makeBid("apn-5", "imp-2", 1),
+		}},
+		openrtb_ext.BidderRubicon: {bids: []*pbsOrtbBid{
+			makeBid("rubicon-1", "imp-1", 4),
+			makeBid("rubicon-2", "imp-1", 5),
+		}},
+	}
+	multiBid := getMultiBid([]*openrtb_ext.ExtRequestPrebidMultiBid{
+		{Bidder: "appnexus", MaxBids: 3, TargetBidderCodePrefix: "apn"},
+	})
+
+	auc := newAuction(seatBids, 2, multiBid)
+
+	bidIDs := func(bids []*pbsOrtbBid) []string {
+		ids := make([]string, 0, len(bids))
+		for _, bid := range bids {
+			ids = append(ids, bid.bid.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"apn-2", "apn-3", "apn-1"}, bidIDs(auc.winningBidsByBidder["imp-1"][openrtb_ext.BidderAppnexus]), "Appnexus should keep its top 3 bids, from highest to lowest")
+	assert.Equal(t, []string{"apn-5"}, bidIDs(auc.winningBidsByBidder["imp-2"][openrtb_ext.BidderAppnexus]))
+	assert.Equal(t, []string{"rubicon-2"}, bidIDs(auc.winningBidsByBidder["imp-1"][openrtb_ext.BidderRubicon]), "Bidders without multibid should only keep their top bid")
+	assert.Equal(t, "rubicon-2", auc.winningBids["imp-1"].bid.ID)
+	assert.Equal(t, "apn-5", auc.winningBids["imp-2"].bid.ID)
+}
+
+func TestDoCacheMultiBid(t *testing.T) {
+	makeBid := func(id string, price float64) *pbsOrtbBid {
+		return &pbsOrtbBid{bid: &openrtb.Bid{ID: id, ImpID: "imp-1", Price: price}, bidType: openrtb_ext.BidTypeBanner}
+	}
+	seatBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		openrtb_ext.BidderAppnexus: {bids: []*pbsOrtbBid{makeBid("apn-1", 3), makeBid("apn-2", 2)}},
+		openrtb_ext.BidderRubicon:  {bids: []*pbsOrtbBid{makeBid("rubicon-1", 1), makeBid("rubicon-2", 0.5)}},
+	}
+	multiBid := getMultiBid([]*openrtb_ext.ExtRequestPrebidMultiBid{
+		{Bidder: "appnexus", MaxBids: 2, TargetBidderCodePrefix: "apn"},
+		{Bidder: "rubicon", MaxBids: 2},
+	})
+	auc := newAuction(seatBids, 1, multiBid)
+	auc.setRoundedPrices(openrtb_ext.PriceGranularityFromString("med"))
+	targData := &targetData{
+		includeBidderKeys: true,
+		includeCacheBids:  true,
+		multiBid:          multiBid,
+	}
+	cache := &mockCache{}
+
+	auc.doCache(context.Background(), cache, targData, &openrtb.BidRequest{Imp: []openrtb.Imp{{ID: "imp-1"}}}, 60, &config.DefaultTTLs{}, nil, nil, nil)
+
+	var cachedIDs []string
+	for _, item := range cache.items {
+		var bid openrtb.Bid
+		if err := json.Unmarshal(item.Data, &bid); err != nil {
+			t.Fatalf("Failed to parse the cached bid: %v", err)
+		}
+		cachedIDs = append(cachedIDs, bid.ID)
+	}
+	assert.ElementsMatch(t, []string{"apn-1", "apn-2", "rubicon-1"}, cachedIDs, "Extra bids without a bidder code prefix get no targeting keys, so they shouldn't be cached")
+}
+
 // TestCacheJSON executes tests for all the *.json files in cachetest.
 // customcachekey.json test here verifies custom cache key not used for non-vast video
 func TestCacheJSON(t *testing.T) {
@@ -118,7 +223,7 @@ func loadCacheSpec(filename string) (*cacheSpec, error) {
 func runCacheSpec(t *testing.T, fileDisplayName string, specData *cacheSpec) {
 	var bid *pbsOrtbBid
 	winningBidsByImp := make(map[string]*pbsOrtbBid)
-	winningBidsByBidder := make(map[string]map[openrtb_ext.BidderName]*pbsOrtbBid)
+	winningBidsByBidder := make(map[string]map[openrtb_ext.BidderName][]*pbsOrtbBid)
 	roundedPrices := make(map[*pbsOrtbBid]string)
 	bidCategory := make(map[string]string)
 
@@ -139,12 +244,12 @@ func runCacheSpec(t *testing.T, fileDisplayName string, specData *cacheSpec) {
 		// Map this bid if it's the highest we've seen from this bidder so far
 		if _, ok := winningBidsByBidder[bid.bid.ImpID]; ok {
 			bestSoFar, ok := winningBidsByBidder[bid.bid.ImpID][pbsBid.Bidder]
-			if !ok || cpm > bestSoFar.bid.Price {
-				winningBidsByBidder[bid.bid.ImpID][pbsBid.Bidder] = bid
+			if !ok || cpm > bestSoFar[0].bid.Price {
+				winningBidsByBidder[bid.bid.ImpID][pbsBid.Bidder] = []*pbsOrtbBid{bid}
 			}
 		} else {
-			winningBidsByBidder[bid.bid.ImpID] = make(map[openrtb_ext.BidderName]*pbsOrtbBid)
-			winningBidsByBidder[bid.bid.ImpID][pbsBid.Bidder] = bid
+			winningBidsByBidder[bid.bid.ImpID] = make(map[openrtb_ext.BidderName][]*pbsOrtbBid)
+			winningBidsByBidder[bid.bid.ImpID][pbsBid.Bidder] = []*pbsOrtbBid{bid}
 		}
 
 		if len(pbsBid.Bid.Cat) == 1 {
@@ -188,7 +293,7 @@ func runCacheSpec(t *testing.T, fileDisplayName string, specData *cacheSpec) {
 		winningBidsByBidder: winningBidsByBidder,
 		roundedPrices:       roundedPrices,
 	}
-	_ = testAuction.doCache(ctx, cache, targData, &specData.BidRequest, 60, &specData.DefaultTTLs, bidCategory)
+	_ = testAuction.doCache(ctx, cache, targData, &specData.BidRequest, 60, &specData.DefaultTTLs, bidCategory, nil, nil)
 
 	if len(specData.ExpectedCacheables) > len(cache.items) {
 		t.Errorf("%s:  [CACHE_ERROR] Less elements were cached than expected \n", fileDisplayName)
@@ -3,19 +3,25 @@ package exchange
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
 
 	"github.com/mxmCherry/openrtb"
 	nativeRequests "github.com/mxmCherry/openrtb/native/request"
 	nativeResponse "github.com/mxmCherry/openrtb/native/response"
 	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/currencies"
 	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 	"golang.org/x/net/context/ctxhttp"
 )
 
@@ -41,7 +47,12 @@ type adaptedBidder interface {
 	//
 	// Any errors will be user-facing in the API.
 	// Error messages should help publishers understand what might account for "bad" bids.
-	requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo) (*pbsOrtbSeatBid, []error)
+	//
+	// storedResponses maps imp IDs to Stored Bid Responses. These are used in place of the bidder's
+	// HTTP responses for those imps.
+	//
+	// If debug is true, the seat bid should include the HTTP calls which were made.
+	requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error)
 }
 
 // pbsOrtbBid is a Bid returned by an adaptedBidder.
@@ -66,9 +77,12 @@ type pbsOrtbSeatBid struct {
 	// currency is the currency in which the bids are made.
 	// Should be a valid currency ISO code.
 	currency string
-	// httpCalls is the list of debugging info. It should only be populated if the request.test == 1.
+	// httpCalls is the list of debugging info. It should only be populated if debug is enabled for the auction.
 	// This will become response.ext.debug.httpcalls.{bidder} on the final Response.
 	httpCalls []*openrtb_ext.ExtHttpCall
+	// rejectedBids are the bids which were removed because they failed validation.
+	// These will become response.ext.debug.rejectedbids.{bidder} in debug mode.
+	rejectedBids []openrtb_ext.ExtRejectedBid
 	// ext contains the extension for this seatbid.
 	// if len(bids) > 0, this will become response.seatbid[i].ext.{bidder} on the final OpenRTB response.
 	// if len(bids) == 0, this will be ignored because the OpenRTB spec doesn't allow a SeatBid with 0 Bids.
@@ -79,22 +93,36 @@ type pbsOrtbSeatBid struct {
 //
 // The name refers to the "Adapter" architecture pattern, and should not be confused with a Prebid "Adapter"
 // (which is being phased out and replaced by Bidder for OpenRTB auctions)
-func adaptBidder(bidder adapters.Bidder, client *http.Client) adaptedBidder {
+func adaptBidder(bidder adapters.Bidder, client *http.Client, name openrtb_ext.BidderName, me pbsmetrics.MetricsEngine, cfg config.Adapter) adaptedBidder {
 	return &bidderAdapter{
-		Bidder: bidder,
-		Client: client,
+		Bidder:        bidder,
+		BidderName:    name,
+		Client:        client,
+		me:            me,
+		timeoutMargin: time.Duration(cfg.TimeoutMarginMs) * time.Millisecond,
 	}
 }
 
 type bidderAdapter struct {
-	Bidder adapters.Bidder
-	Client *http.Client
+	Bidder     adapters.Bidder
+	BidderName openrtb_ext.BidderName
+	Client     *http.Client
+	me         pbsmetrics.MetricsEngine
+	// timeoutMargin is taken off the auction's deadline for the requests to this bidder.
+	timeoutMargin time.Duration
 }
 
-func (bidder *bidderAdapter) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo) (*pbsOrtbSeatBid, []error) {
-	reqData, errs := bidder.Bidder.MakeRequests(request, reqInfo)
+func (bidder *bidderAdapter) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error) {
+	liveRequest, storedCalls, errs := bidder.storedResponseCalls(request, storedResponses, reqInfo)
+
+	var reqData []*adapters.RequestData
+	if len(liveRequest.Imp) > 0 || len(storedResponses) == 0 {
+		var moreErrs []error
+		reqData, moreErrs = bidder.Bidder.MakeRequests(liveRequest, reqInfo)
+		errs = append(errs, moreErrs...)
+	}
 
-	if len(reqData) == 0 {
+	if len(reqData) == 0 && len(storedCalls) == 0 {
 		// If the adapter failed to generate both requests and errors, this is an error.
 		if len(errs) == 0 {
 			errs = append(errs, &errortypes.FailedToRequestBids{Message: "The adapter failed to generate any bid requests, but also failed to generate an error explaining why"})
@@ -102,9 +130,14 @@ func (bidder *bidderAdapter) requestBid(ctx context.Context, request *openrtb.Bi
 		return nil, errs
 	}
 
+	// Stored responses are ready right away.
+	responseChannel := make(chan *httpCallInfo, len(reqData)+len(storedCalls))
+	for _, storedCall := range storedCalls {
+		responseChannel <- storedCall
+	}
+
 	// Make any HTTP requests in parallel.
 	// If the bidder only needs to make one, save some cycles by just using the current one.
-	responseChannel := make(chan *httpCallInfo, len(reqData))
 	if len(reqData) == 1 {
 		responseChannel <- bidder.doRequest(ctx, reqData[0])
 	} else {
@@ -124,10 +157,10 @@ func (bidder *bidderAdapter) requestBid(ctx context.Context, request *openrtb.Bi
 
 	// If the bidder made multiple requests, we still want them to enter as many bids as possible...
 	// even if the timeout occurs sometime halfway through.
-	for i := 0; i < len(reqData); i++ {
+	for i := 0; i < len(reqData)+len(storedCalls); i++ {
 		httpInfo := <-responseChannel
-		// If this is a test bid, capture debugging info from the requests.
-		if request.Test == 1 {
+		// If debug is enabled, capture debugging info from the requests.
+		if debug {
 			seatBid.httpCalls = append(seatBid.httpCalls, makeExt(httpInfo))
 		}
 
@@ -200,6 +233,45 @@ func (bidder *bidderAdapter) requestBid(ctx context.Context, request *openrtb.Bi
 	return seatBid, errs
 }
 
+// storedResponseCalls splits the imps which have Stored Bid Responses out of the request. The bidder still builds
+// its usual HTTP request for each of them, so that MakeBids sees the same data it would for a live call, but the
+// stored response takes the place of the call to the bidder's server.
+func (bidder *bidderAdapter) storedResponseCalls(request *openrtb.BidRequest, storedResponses map[string]json.RawMessage, reqInfo *adapters.ExtraRequestInfo) (*openrtb.BidRequest, []*httpCallInfo, []error) {
+	if len(storedResponses) == 0 {
+		return request, nil, nil
+	}
+
+	liveRequest := *request
+	liveRequest.Imp = make([]openrtb.Imp, 0, len(request.Imp))
+	var storedCalls []*httpCallInfo
+	var errs []error
+	for _, imp := range request.Imp {
+		storedResponse, ok := storedResponses[imp.ID]
+		if !ok {
+			liveRequest.Imp = append(liveRequest.Imp, imp)
+			continue
+		}
+
+		storedRequest := *request
+		storedRequest.Imp = []openrtb.Imp{imp}
+		reqData, moreErrs := bidder.Bidder.MakeRequests(&storedRequest, reqInfo)
+		errs = append(errs, moreErrs...)
+		if len(reqData) == 0 {
+			continue
+		}
+		// The stored response covers the whole imp, so it's only used once even if the bidder splits the imp across requests.
+		storedCalls = append(storedCalls, &httpCallInfo{
+			request: reqData[0],
+			response: &adapters.ResponseData{
+				StatusCode: http.StatusOK,
+				Body:       storedResponse,
+				Headers:    http.Header{},
+			},
+		})
+	}
+	return &liveRequest, storedCalls, errs
+}
+
 func addNativeTypes(bid *openrtb.Bid, request *openrtb.BidRequest) (*nativeResponse.Response, []error) {
 	var errs []error
 	var nativeMarkup *nativeResponse.Response
@@ -291,7 +363,13 @@ func (bidder *bidderAdapter) doRequest(ctx context.Context, req *adapters.Reques
 	}
 	httpReq.Header = req.Headers
 
-	httpResp, err := ctxhttp.Do(ctx, bidder.Client, httpReq)
+	if deadline, ok := ctx.Deadline(); ok && bidder.timeoutMargin > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-bidder.timeoutMargin))
+		defer cancel()
+	}
+
+	httpResp, err := ctxhttp.Do(bidder.addClientTrace(ctx), bidder.Client, httpReq)
 	if err != nil {
 		if err == context.DeadlineExceeded {
 			err = &errortypes.Timeout{Message: err.Error()}
@@ -328,6 +406,107 @@ func (bidder *bidderAdapter) doRequest(ctx context.Context, req *adapters.Reques
 	}
 }
 
+// addClientTrace returns a context which records the connection metrics for a request to the bidder.
+func (bidder *bidderAdapter) addClientTrace(ctx context.Context) context.Context {
+	connTrace := &connectionTrace{
+		bidder: bidder.BidderName,
+		me:     bidder.me,
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn:              connTrace.getConn,
+		GotConn:              connTrace.gotConn,
+		DNSStart:             connTrace.dnsStart,
+		DNSDone:              connTrace.dnsDone,
+		ConnectStart:         connTrace.connectStart,
+		ConnectDone:          connTrace.connectDone,
+		TLSHandshakeStart:    connTrace.tlsHandshakeStart,
+		TLSHandshakeDone:     connTrace.tlsHandshakeDone,
+		GotFirstResponseByte: connTrace.gotFirstResponseByte,
+	})
+}
+
+// connectionTrace times the steps of a bidder's request which happen before it gets a response.
+//
+// The net/http Transport dials new connections on another goroutine, and may dial more than one address
+// at a time, so the times are guarded by a mutex.
+type connectionTrace struct {
+	bidder openrtb_ext.BidderName
+	me     pbsmetrics.MetricsEngine
+
+	lock          sync.Mutex
+	getConnStart  time.Time
+	gotConnAt     time.Time
+	dnsStartAt    time.Time
+	connectStarts map[string]time.Time
+	tlsStartAt    time.Time
+}
+
+func (t *connectionTrace) getConn(hostPort string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.getConnStart = time.Now()
+}
+
+func (t *connectionTrace) gotConn(info httptrace.GotConnInfo) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.gotConnAt = time.Now()
+	t.me.RecordAdapterConnections(t.bidder, info.Reused, t.gotConnAt.Sub(t.getConnStart))
+}
+
+func (t *connectionTrace) dnsStart(info httptrace.DNSStartInfo) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.dnsStartAt = time.Now()
+}
+
+func (t *connectionTrace) dnsDone(info httptrace.DNSDoneInfo) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if info.Err == nil && !t.dnsStartAt.IsZero() {
+		t.me.RecordAdapterDNSTime(t.bidder, time.Since(t.dnsStartAt))
+	}
+}
+
+func (t *connectionTrace) connectStart(network, addr string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.connectStarts == nil {
+		t.connectStarts = make(map[string]time.Time, 1)
+	}
+	t.connectStarts[network+addr] = time.Now()
+}
+
+func (t *connectionTrace) connectDone(network, addr string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if start, ok := t.connectStarts[network+addr]; ok && err == nil {
+		t.me.RecordAdapterConnectTime(t.bidder, time.Since(start))
+	}
+}
+
+func (t *connectionTrace) tlsHandshakeStart() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tlsStartAt = time.Now()
+}
+
+func (t *connectionTrace) tlsHandshakeDone(state tls.ConnectionState, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err == nil && !t.tlsStartAt.IsZero() {
+		t.me.RecordAdapterTLSHandshakeTime(t.bidder, time.Since(t.tlsStartAt))
+	}
+}
+
+func (t *connectionTrace) gotFirstResponseByte() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.gotConnAt.IsZero() {
+		t.me.RecordAdapterTimeToFirstByte(t.bidder, time.Since(t.gotConnAt))
+	}
+}
+
 type httpCallInfo struct {
 	request  *adapters.RequestData
 	response *adapters.ResponseData
@@ -12,9 +12,14 @@ import (
 
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 // TestSingleBidder makes sure that the following things work if the Bidder needs only one request.
@@ -59,9 +64,9 @@ func TestSingleBidder(t *testing.T) {
 		},
 		bidResponse: mockBidderResponse,
 	}
-	bidder := adaptBidder(bidderImpl, server.Client())
+	bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 	currencyConverter := currencies.NewRateConverterDefault()
-	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", bidAdjustment, currencyConverter.Rates(), &adapters.ExtraRequestInfo{})
+	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", bidAdjustment, currencyConverter.Rates(), &adapters.ExtraRequestInfo{}, nil, false)
 
 	// Make sure the goodSingleBidder was called with the expected arguments.
 	if bidderImpl.httpResponse == nil {
@@ -144,9 +149,9 @@ func TestMultiBidder(t *testing.T) {
 			}},
 		bidResponse: mockBidderResponse,
 	}
-	bidder := adaptBidder(bidderImpl, server.Client())
+	bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 	currencyConverter := currencies.NewRateConverterDefault()
-	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", 1.0, currencyConverter.Rates(), &adapters.ExtraRequestInfo{})
+	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", 1.0, currencyConverter.Rates(), &adapters.ExtraRequestInfo{}, nil, false)
 
 	if seatBid == nil {
 		t.Fatalf("SeatBid should exist, because bids exist.")
@@ -184,6 +189,7 @@ func TestBidderTimeout(t *testing.T) {
 	bidder := &bidderAdapter{
 		Bidder: &mixedMultiBidder{},
 		Client: server.Client(),
+		me:     &metricsConf.DummyMetricsEngine{},
 	}
 
 	callInfo := bidder.doRequest(ctx, &adapters.RequestData{
@@ -204,6 +210,7 @@ func TestInvalidRequest(t *testing.T) {
 	bidder := &bidderAdapter{
 		Bidder: &mixedMultiBidder{},
 		Client: server.Client(),
+		me:     &metricsConf.DummyMetricsEngine{},
 	}
 
 	callInfo := bidder.doRequest(context.Background(), &adapters.RequestData{
@@ -225,6 +232,7 @@ func TestConnectionClose(t *testing.T) {
 	bidder := &bidderAdapter{
 		Bidder: &mixedMultiBidder{},
 		Client: server.Client(),
+		me:     &metricsConf.DummyMetricsEngine{},
 	}
 
 	callInfo := bidder.doRequest(context.Background(), &adapters.RequestData{
@@ -236,6 +244,57 @@ func TestConnectionClose(t *testing.T) {
 	}
 }
 
+// TestTimeoutMargin makes sure that bidderAdapter.doRequest gives up early on bidders with a timeout margin.
+func TestTimeoutMargin(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(200)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	bidder := adaptBidder(&mixedMultiBidder{}, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{}).(*bidderAdapter)
+	callInfo := bidder.doRequest(ctx, &adapters.RequestData{
+		Method: "POST",
+		Uri:    server.URL,
+	})
+	assert.NoError(t, callInfo.err, "Without a margin")
+
+	bidder = adaptBidder(&mixedMultiBidder{}, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{TimeoutMarginMs: 480}).(*bidderAdapter)
+	callInfo = bidder.doRequest(ctx, &adapters.RequestData{
+		Method: "POST",
+		Uri:    server.URL,
+	})
+	assert.IsType(t, &errortypes.Timeout{}, callInfo.err, "With a margin")
+	assert.Nil(t, callInfo.response, "With a margin")
+}
+
+// TestConnectionMetrics makes sure that bidderAdapter.doRequest records the connection metrics for the bidder.
+func TestConnectionMetrics(t *testing.T) {
+	server := httptest.NewServer(mockHandler(200, "getBody", "postBody"))
+	defer server.Close()
+
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterConnections", openrtb_ext.BidderAppnexus, false, mock.AnythingOfType("time.Duration")).Once()
+	metricsMock.On("RecordAdapterConnections", openrtb_ext.BidderAppnexus, true, mock.AnythingOfType("time.Duration")).Once()
+	metricsMock.On("RecordAdapterConnectTime", openrtb_ext.BidderAppnexus, mock.AnythingOfType("time.Duration")).Once()
+	metricsMock.On("RecordAdapterTimeToFirstByte", openrtb_ext.BidderAppnexus, mock.AnythingOfType("time.Duration")).Twice()
+
+	bidder := adaptBidder(&mixedMultiBidder{}, server.Client(), openrtb_ext.BidderAppnexus, metricsMock, config.Adapter{}).(*bidderAdapter)
+	for i := 0; i < 2; i++ {
+		callInfo := bidder.doRequest(context.Background(), &adapters.RequestData{
+			Method: "POST",
+			Uri:    server.URL,
+		})
+		assert.NoError(t, callInfo.err)
+	}
+
+	metricsMock.AssertExpectations(t)
+}
+
 type bid struct {
 	currency string
 	price    float64
@@ -502,7 +561,7 @@ func TestMultiCurrencies(t *testing.T) {
 		)
 
 		// Execute:
-		bidder := adaptBidder(bidderImpl, server.Client())
+		bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 		currencyConverter := currencies.NewRateConverter(
 			&http.Client{},
 			mockedHTTPServer.URL,
@@ -515,6 +574,8 @@ func TestMultiCurrencies(t *testing.T) {
 			1,
 			currencyConverter.Rates(),
 			&adapters.ExtraRequestInfo{},
+			nil,
+			false,
 		)
 
 		// Verify:
@@ -650,7 +711,7 @@ func TestMultiCurrencies_RateConverterNotSet(t *testing.T) {
 		}
 
 		// Execute:
-		bidder := adaptBidder(bidderImpl, server.Client())
+		bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 		currencyConverter := currencies.NewRateConverterDefault()
 		seatBid, errs := bidder.requestBid(
 			context.Background(),
@@ -659,6 +720,8 @@ func TestMultiCurrencies_RateConverterNotSet(t *testing.T) {
 			1,
 			currencyConverter.Rates(),
 			&adapters.ExtraRequestInfo{},
+			nil,
+			false,
 		)
 
 		// Verify:
@@ -816,7 +879,7 @@ func TestMultiCurrencies_RequestCurrencyPick(t *testing.T) {
 		}
 
 		// Execute:
-		bidder := adaptBidder(bidderImpl, server.Client())
+		bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 		currencyConverter := currencies.NewRateConverter(
 			&http.Client{},
 			mockedHTTPServer.URL,
@@ -831,6 +894,8 @@ func TestMultiCurrencies_RequestCurrencyPick(t *testing.T) {
 			1,
 			currencyConverter.Rates(),
 			&adapters.ExtraRequestInfo{},
+			nil,
+			false,
 		)
 
 		// Verify:
@@ -931,7 +996,7 @@ func TestServerCallDebugging(t *testing.T) {
 			Headers: http.Header{},
 		},
 	}
-	bidder := adaptBidder(bidderImpl, server.Client())
+	bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 	currencyConverter := currencies.NewRateConverterDefault()
 
 	bids, _ := bidder.requestBid(
@@ -943,6 +1008,8 @@ func TestServerCallDebugging(t *testing.T) {
 		1.0,
 		currencyConverter.Rates(),
 		&adapters.ExtraRequestInfo{},
+		nil,
+		true,
 	)
 
 	if len(bids.httpCalls) != 1 {
@@ -1043,7 +1110,7 @@ func TestMobileNativeTypes(t *testing.T) {
 			},
 			bidResponse: tc.mockBidderResponse,
 		}
-		bidder := adaptBidder(bidderImpl, server.Client())
+		bidder := adaptBidder(bidderImpl, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 		currencyConverter := currencies.NewRateConverterDefault()
 
 		seatBids, _ := bidder.requestBid(
@@ -1053,6 +1120,8 @@ func TestMobileNativeTypes(t *testing.T) {
 			1.0,
 			currencyConverter.Rates(),
 			&adapters.ExtraRequestInfo{},
+			nil,
+			false,
 		)
 
 		var actualValue string
@@ -1064,9 +1133,9 @@ func TestMobileNativeTypes(t *testing.T) {
 }
 
 func TestErrorReporting(t *testing.T) {
-	bidder := adaptBidder(&bidRejector{}, nil)
+	bidder := adaptBidder(&bidRejector{}, nil, "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 	currencyConverter := currencies.NewRateConverterDefault()
-	bids, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", 1.0, currencyConverter.Rates(), &adapters.ExtraRequestInfo{})
+	bids, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, "test", 1.0, currencyConverter.Rates(), &adapters.ExtraRequestInfo{}, nil, false)
 	if bids != nil {
 		t.Errorf("There should be no seatbid if no http requests are returned.")
 	}
@@ -2,14 +2,18 @@ package exchange
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 	"golang.org/x/text/currency"
 )
 
@@ -28,8 +32,8 @@ type validatedBidder struct {
 	bidder adaptedBidder
 }
 
-func (v *validatedBidder) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo) (*pbsOrtbSeatBid, []error) {
-	seatBid, errs := v.bidder.requestBid(ctx, request, name, bidAdjustment, conversions, reqInfo)
+func (v *validatedBidder) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error) {
+	seatBid, errs := v.bidder.requestBid(ctx, request, name, bidAdjustment, conversions, reqInfo, storedResponses, debug)
 	if validationErrors := removeInvalidBids(request, seatBid); len(validationErrors) > 0 {
 		errs = append(errs, validationErrors...)
 	}
@@ -45,6 +49,9 @@ func removeInvalidBids(request *openrtb.BidRequest, seatBid *pbsOrtbSeatBid) []e
 
 	// By design, default currency is USD.
 	if cerr := validateCurrency(request.Cur, seatBid.currency); cerr != nil {
+		for _, bid := range seatBid.bids {
+			rejectInvalidBid(seatBid, bid, cerr)
+		}
 		seatBid.bids = nil
 		return []error{cerr}
 	}
@@ -56,12 +63,33 @@ func removeInvalidBids(request *openrtb.BidRequest, seatBid *pbsOrtbSeatBid) []e
 			validBids = append(validBids, bid)
 		} else {
 			errs = append(errs, berr)
+			rejectInvalidBid(seatBid, bid, berr)
 		}
 	}
 	seatBid.bids = validBids
 	return errs
 }
 
+// rejectInvalidBid records a bid which failed validation, so that it can be reported in debug mode.
+func rejectInvalidBid(seatBid *pbsOrtbSeatBid, bid *pbsOrtbBid, err error) {
+	rejectBid(seatBid, bid, pbsmetrics.RejectReasonInvalidBid, err)
+}
+
+// rejectBid records a bid which was removed for the given reason, so that it can be reported in debug mode.
+func rejectBid(seatBid *pbsOrtbSeatBid, bid *pbsOrtbBid, reason pbsmetrics.RejectReason, err error) {
+	rejected := openrtb_ext.ExtRejectedBid{
+		Currency: seatBid.currency,
+		Reason:   string(reason),
+		Message:  err.Error(),
+	}
+	if bid.bid != nil {
+		rejected.ImpID = bid.bid.ImpID
+		rejected.BidID = bid.bid.ID
+		rejected.Price = bid.bid.Price
+	}
+	seatBid.rejectedBids = append(seatBid.rejectedBids, rejected)
+}
+
 // validateCurrency will run currency validation checks and return true if it passes, false otherwise.
 func validateCurrency(requestAllowedCurrencies []string, bidCurrency string) error {
 	// Default currency is `USD` by design.
@@ -119,3 +147,138 @@ func validateBid(bid *pbsOrtbBid) (bool, error) {
 
 	return true, nil
 }
+
+// validateBidsAgainstRequest checks that the bids match what the request asked for. It checks that:
+//
+//   - banner bids have one of the sizes in the imp's banner.format (or banner.w and banner.h, if there are no formats),
+//   - the bid's media type is one which the imp asked for,
+//   - none of the bid's adomain are in the request's badv, and
+//   - none of the bid's cat are in the request's bcat.
+//
+// Every bid which fails a check gets an errortypes.InvalidBidWarning. In BidValidationEnforce mode, those bids are
+// also removed from the seatBid. In BidValidationSkip mode (or any other mode), nothing is checked.
+func validateBidsAgainstRequest(request *openrtb.BidRequest, seatBid *pbsOrtbSeatBid, mode config.BidValidationMode) []error {
+	if mode != config.BidValidationWarn && mode != config.BidValidationEnforce {
+		return nil
+	}
+	if seatBid == nil || len(seatBid.bids) == 0 {
+		return nil
+	}
+
+	imps := make(map[string]*openrtb.Imp, len(request.Imp))
+	for i := range request.Imp {
+		imps[request.Imp[i].ID] = &request.Imp[i]
+	}
+
+	var warnings []error
+	validBids := make([]*pbsOrtbBid, 0, len(seatBid.bids))
+	for _, bid := range seatBid.bids {
+		reason, err := checkBidAgainstRequest(request, imps, bid)
+		if err == nil {
+			validBids = append(validBids, bid)
+			continue
+		}
+		warnings = append(warnings, &errortypes.InvalidBidWarning{Message: err.Error()})
+		if mode == config.BidValidationEnforce {
+			rejectBid(seatBid, bid, reason, err)
+		} else {
+			validBids = append(validBids, bid)
+		}
+	}
+	seatBid.bids = validBids
+	return warnings
+}
+
+// checkBidAgainstRequest returns an error and the reason to reject the bid if it doesn't match what the request asked for.
+// Bids for imps which aren't in the request are left to the rest of the auction to deal with.
+func checkBidAgainstRequest(request *openrtb.BidRequest, imps map[string]*openrtb.Imp, bid *pbsOrtbBid) (pbsmetrics.RejectReason, error) {
+	if bid.bid == nil {
+		return "", nil
+	}
+	imp, ok := imps[bid.bid.ImpID]
+	if !ok {
+		return "", nil
+	}
+
+	if !impHasMediaType(imp, bid.bidType) {
+		return pbsmetrics.RejectReasonInvalidMediaType, fmt.Errorf("Bid \"%s\" is a %s bid, but imp \"%s\" didn't ask for %s", bid.bid.ID, bid.bidType, imp.ID, bid.bidType)
+	}
+	if bid.bidType == openrtb_ext.BidTypeBanner && !bannerSizeAllowed(imp.Banner, bid.bid.W, bid.bid.H) {
+		return pbsmetrics.RejectReasonInvalidSize, fmt.Errorf("Bid \"%s\" has size %dx%d, which imp \"%s\" didn't ask for", bid.bid.ID, bid.bid.W, bid.bid.H, imp.ID)
+	}
+	for _, adomain := range bid.bid.ADomain {
+		if blocked := blockedAdvertiser(request.BAdv, adomain); blocked != "" {
+			return pbsmetrics.RejectReasonBlockedAdvertiser, fmt.Errorf("Bid \"%s\" has adomain \"%s\", which is blocked by badv \"%s\"", bid.bid.ID, adomain, blocked)
+		}
+	}
+	for _, cat := range bid.bid.Cat {
+		if blocked := blockedCategory(request.BCat, cat); blocked != "" {
+			return pbsmetrics.RejectReasonBlockedCategory, fmt.Errorf("Bid \"%s\" has cat \"%s\", which is blocked by bcat \"%s\"", bid.bid.ID, cat, blocked)
+		}
+	}
+	return "", nil
+}
+
+func impHasMediaType(imp *openrtb.Imp, bidType openrtb_ext.BidType) bool {
+	switch bidType {
+	case openrtb_ext.BidTypeBanner:
+		return imp.Banner != nil
+	case openrtb_ext.BidTypeVideo:
+		return imp.Video != nil
+	case openrtb_ext.BidTypeAudio:
+		return imp.Audio != nil
+	case openrtb_ext.BidTypeNative:
+		return imp.Native != nil
+	}
+	return false
+}
+
+// bannerSizeAllowed returns true if the banner asked for a w x h creative.
+// Bids without a size, and banners without any fixed sizes, can't be checked, so they're allowed.
+func bannerSizeAllowed(banner *openrtb.Banner, w uint64, h uint64) bool {
+	if w == 0 && h == 0 {
+		return true
+	}
+	checked := false
+	for _, format := range banner.Format {
+		// Flex ad formats use wratio and hratio instead of a fixed size.
+		if format.W == 0 && format.H == 0 {
+			continue
+		}
+		if format.W == w && format.H == h {
+			return true
+		}
+		checked = true
+	}
+	if checked {
+		return false
+	}
+	if banner.W != nil && banner.H != nil {
+		return *banner.W == w && *banner.H == h
+	}
+	return true
+}
+
+// blockedAdvertiser returns the entry in badv which blocks the adomain, or an empty string if there isn't one.
+// Subdomains of a blocked domain are blocked too.
+func blockedAdvertiser(badv []string, adomain string) string {
+	adomain = strings.ToLower(adomain)
+	for _, blocked := range badv {
+		lowerBlocked := strings.ToLower(blocked)
+		if adomain == lowerBlocked || strings.HasSuffix(adomain, "."+lowerBlocked) {
+			return blocked
+		}
+	}
+	return ""
+}
+
+// blockedCategory returns the entry in bcat which blocks the cat, or an empty string if there isn't one.
+// Blocking an IAB tier 1 category (e.g. "IAB7") blocks its subcategories (e.g. "IAB7-1") too.
+func blockedCategory(bcat []string, cat string) string {
+	for _, blocked := range bcat {
+		if cat == blocked || strings.HasPrefix(cat, blocked+"-") {
+			return blocked
+		}
+	}
+	return ""
+}
@@ -2,12 +2,16 @@ package exchange
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,7 +46,7 @@ func TestAllValidBids(t *testing.T) {
 			},
 		},
 	})
-	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{})
+	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, nil, false)
 	assert.Len(t, seatBid.bids, 3)
 	assert.Len(t, errs, 0)
 }
@@ -83,7 +87,7 @@ func TestAllBadBids(t *testing.T) {
 			},
 		},
 	})
-	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{})
+	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, nil, false)
 	assert.Len(t, seatBid.bids, 0)
 	assert.Len(t, errs, 5)
 }
@@ -126,9 +130,14 @@ func TestMixedBids(t *testing.T) {
 			},
 		},
 	})
-	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{})
+	seatBid, errs := bidder.requestBid(context.Background(), &openrtb.BidRequest{}, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, nil, false)
 	assert.Len(t, seatBid.bids, 2)
 	assert.Len(t, errs, 3)
+	if assert.Len(t, seatBid.rejectedBids, 3, "Invalid bids should be kept for the debug output") {
+		assert.Equal(t, "thatBid", seatBid.rejectedBids[0].BidID)
+		assert.Equal(t, "invalid_bid", seatBid.rejectedBids[0].Reason)
+		assert.Equal(t, errs[0].Error(), seatBid.rejectedBids[0].Message)
+	}
 }
 
 func TestCurrencyBids(t *testing.T) {
@@ -246,17 +255,123 @@ func TestCurrencyBids(t *testing.T) {
 			Cur: tc.brqCur,
 		}
 
-		seatBid, errs := bidder.requestBid(context.Background(), request, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{})
+		seatBid, errs := bidder.requestBid(context.Background(), request, openrtb_ext.BidderAppnexus, 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, nil, false)
 		assert.Len(t, seatBid.bids, expectedValidBids)
 		assert.Len(t, errs, expectedErrs)
 	}
 }
 
+func TestValidateBidsAgainstRequest(t *testing.T) {
+	w, h := uint64(728), uint64(90)
+	request := &openrtb.BidRequest{
+		Imp: []openrtb.Imp{
+			{ID: "formats", Banner: &openrtb.Banner{Format: []openrtb.Format{{W: 300, H: 250}, {W: 300, H: 600}}}},
+			{ID: "fixed", Banner: &openrtb.Banner{W: &w, H: &h}},
+			{ID: "video", Video: &openrtb.Video{}},
+		},
+		BAdv: []string{"blocked.com"},
+		BCat: []string{"IAB7", "IAB25-3"},
+	}
+
+	testCases := []struct {
+		description string
+		bid         *pbsOrtbBid
+		reason      pbsmetrics.RejectReason
+	}{
+		{
+			description: "Banner size from the formats",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "formats", W: 300, H: 600}, bidType: openrtb_ext.BidTypeBanner},
+		},
+		{
+			description: "Banner size not in the formats",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "formats", W: 320, H: 50}, bidType: openrtb_ext.BidTypeBanner},
+			reason:      pbsmetrics.RejectReasonInvalidSize,
+		},
+		{
+			description: "Banner without a size",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "formats"}, bidType: openrtb_ext.BidTypeBanner},
+		},
+		{
+			description: "Banner size from banner.w and banner.h",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "fixed", W: 728, H: 90}, bidType: openrtb_ext.BidTypeBanner},
+		},
+		{
+			description: "Banner size not banner.w and banner.h",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "fixed", W: 300, H: 250}, bidType: openrtb_ext.BidTypeBanner},
+			reason:      pbsmetrics.RejectReasonInvalidSize,
+		},
+		{
+			description: "Media type which the imp didn't ask for",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", W: 300, H: 250}, bidType: openrtb_ext.BidTypeBanner},
+			reason:      pbsmetrics.RejectReasonInvalidMediaType,
+		},
+		{
+			description: "Blocked adomain",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", ADomain: []string{"ok.com", "Blocked.com"}}, bidType: openrtb_ext.BidTypeVideo},
+			reason:      pbsmetrics.RejectReasonBlockedAdvertiser,
+		},
+		{
+			description: "Subdomain of a blocked adomain",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", ADomain: []string{"www.blocked.com"}}, bidType: openrtb_ext.BidTypeVideo},
+			reason:      pbsmetrics.RejectReasonBlockedAdvertiser,
+		},
+		{
+			description: "Domain which only ends with a blocked adomain",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", ADomain: []string{"notblocked.com"}}, bidType: openrtb_ext.BidTypeVideo},
+		},
+		{
+			description: "Blocked cat",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", Cat: []string{"IAB25-3"}}, bidType: openrtb_ext.BidTypeVideo},
+			reason:      pbsmetrics.RejectReasonBlockedCategory,
+		},
+		{
+			description: "Subcategory of a blocked cat",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", Cat: []string{"IAB7-39"}}, bidType: openrtb_ext.BidTypeVideo},
+			reason:      pbsmetrics.RejectReasonBlockedCategory,
+		},
+		{
+			description: "Allowed cat",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "video", Cat: []string{"IAB25-1", "IAB70"}}, bidType: openrtb_ext.BidTypeVideo},
+		},
+		{
+			description: "Bid for an unknown imp",
+			bid:         &pbsOrtbBid{bid: &openrtb.Bid{ID: "b", ImpID: "unknown", W: 1, H: 1}, bidType: openrtb_ext.BidTypeBanner},
+		},
+	}
+
+	for _, test := range testCases {
+		for _, mode := range []config.BidValidationMode{config.BidValidationSkip, config.BidValidationWarn, config.BidValidationEnforce} {
+			seatBid := &pbsOrtbSeatBid{bids: []*pbsOrtbBid{test.bid}}
+			warnings := validateBidsAgainstRequest(request, seatBid, mode)
+
+			if test.reason == "" || mode == config.BidValidationSkip {
+				assert.Empty(t, warnings, "%s (%s): Unexpected warnings", test.description, mode)
+				assert.Len(t, seatBid.bids, 1, "%s (%s): The bid should be kept", test.description, mode)
+				assert.Empty(t, seatBid.rejectedBids, "%s (%s): Unexpected rejected bids", test.description, mode)
+				continue
+			}
+
+			if assert.Len(t, warnings, 1, "%s (%s): Expected a warning", test.description, mode) {
+				assert.Equal(t, errortypes.InvalidBidWarningCode, errortypes.DecodeError(warnings[0]), "%s (%s): Wrong warning type", test.description, mode)
+			}
+			if mode == config.BidValidationWarn {
+				assert.Len(t, seatBid.bids, 1, "%s (%s): The bid should be kept", test.description, mode)
+				assert.Empty(t, seatBid.rejectedBids, "%s (%s): Unexpected rejected bids", test.description, mode)
+			} else {
+				assert.Empty(t, seatBid.bids, "%s (%s): The bid should be removed", test.description, mode)
+				if assert.Len(t, seatBid.rejectedBids, 1, "%s (%s): Expected a rejected bid", test.description, mode) {
+					assert.Equal(t, string(test.reason), seatBid.rejectedBids[0].Reason, "%s (%s): Wrong reject reason", test.description, mode)
+				}
+			}
+		}
+	}
+}
+
 type mockAdaptedBidder struct {
 	bidResponse   *pbsOrtbSeatBid
 	errorResponse []error
 }
 
-func (b *mockAdaptedBidder) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo) (*pbsOrtbSeatBid, []error) {
+func (b *mockAdaptedBidder) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error) {
 	return b.bidResponse, b.errorResponse
 }
@@ -0,0 +1,86 @@
+package exchange
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// The stages of the auction which are timed in response.ext.debug.stagetimemillis.
+const (
+	stageBidderRequests = "bidderrequests"
+	stageBidders        = "bidders"
+	stageAuction        = "auction"
+	stageCache          = "cache"
+	stageTargeting      = "targeting"
+)
+
+// IsDebug returns true if the request asked for debug info, through request.test or ext.prebid.debug,
+// and the account is allowed to see it. The endpoints use it too, so that they agree with the exchange.
+func IsDebug(bidRequest *openrtb.BidRequest, allowed bool) bool {
+	if !allowed {
+		return false
+	}
+	if bidRequest.Test == 1 {
+		return true
+	}
+	debug, err := jsonparser.GetBoolean(bidRequest.Ext, "prebid", "debug")
+	return err == nil && debug
+}
+
+// debugInfo holds the data for response.ext.debug which isn't tracked per bidder.
+//
+// All functions on this struct are nil-safe. A nil debugInfo means that debug is disabled.
+type debugInfo struct {
+	// resolvedRequest is a snapshot of the request after Stored Requests were merged in.
+	resolvedRequest json.RawMessage
+	stageTimes      map[string]int
+	// trafficShaping explains why the bidders under the traffic shaping threshold were sent or skipped.
+	trafficShaping map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping
+}
+
+// newDebugInfo returns nil if debug is disabled.
+func newDebugInfo(bidRequest *openrtb.BidRequest, debug bool) (*debugInfo, error) {
+	if !debug {
+		return nil, nil
+	}
+	resolvedRequest, err := json.Marshal(bidRequest)
+	return &debugInfo{resolvedRequest: resolvedRequest}, err
+}
+
+func (d *debugInfo) setStageTimes(timer *stageTimer) {
+	if d == nil {
+		return
+	}
+	d.stageTimes = timer.times
+}
+
+func (d *debugInfo) setTrafficShaping(decisions map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping) {
+	if d == nil {
+		return
+	}
+	d.trafficShaping = decisions
+}
+
+// stageTimer measures how long each stage of the auction takes.
+type stageTimer struct {
+	last  time.Time
+	times map[string]int
+}
+
+func newStageTimer() *stageTimer {
+	return &stageTimer{
+		last:  time.Now(),
+		times: make(map[string]int, 5),
+	}
+}
+
+// record saves the time since the last stage ended as the time taken by this one.
+func (t *stageTimer) record(stage string) {
+	now := time.Now()
+	t.times[stage] = int(now.Sub(t.last) / time.Millisecond)
+	t.last = now
+}
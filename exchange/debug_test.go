@@ -0,0 +1,90 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDebug(t *testing.T) {
+	testCases := []struct {
+		description string
+		request     *openrtb.BidRequest
+		allowed     bool
+		expected    bool
+	}{
+		{"Not requested", &openrtb.BidRequest{}, true, false},
+		{"Requested by test", &openrtb.BidRequest{Test: 1}, true, true},
+		{"Requested by ext", &openrtb.BidRequest{Ext: json.RawMessage(`{"prebid":{"debug":true}}`)}, true, true},
+		{"Ext turned off", &openrtb.BidRequest{Ext: json.RawMessage(`{"prebid":{"debug":false}}`)}, true, false},
+		{"Not allowed for the account", &openrtb.BidRequest{Test: 1, Ext: json.RawMessage(`{"prebid":{"debug":true}}`)}, false, false},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, IsDebug(test.request, test.allowed), test.description)
+	}
+}
+
+func TestNewDebugInfo(t *testing.T) {
+	request := &openrtb.BidRequest{ID: "some-request-id", Test: 1}
+
+	info, err := newDebugInfo(request, false)
+	assert.NoError(t, err)
+	assert.Nil(t, info, "There should be no debug info if debug is off")
+	info.setStageTimes(newStageTimer())
+
+	info, err = newDebugInfo(request, true)
+	if assert.NoError(t, err) && assert.NotNil(t, info) {
+		assert.JSONEq(t, `{"id":"some-request-id","imp":null,"test":1}`, string(info.resolvedRequest))
+	}
+}
+
+func TestStageTimer(t *testing.T) {
+	timer := newStageTimer()
+	timer.record(stageBidders)
+	timer.record(stageAuction)
+
+	assert.Len(t, timer.times, 2)
+	assert.Contains(t, timer.times, stageBidders)
+	assert.Contains(t, timer.times, stageAuction)
+}
+
+func TestDebugExt(t *testing.T) {
+	bidderRequest := &openrtb.BidRequest{ID: "bidder-request-id"}
+	adapterBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		openrtb_ext.BidderAppnexus: {
+			httpCalls: []*openrtb_ext.ExtHttpCall{{Uri: "http://appnexus.com", Status: 200}},
+		},
+	}
+	adapterExtra := map[openrtb_ext.BidderName]*seatResponseExtra{
+		openrtb_ext.BidderAppnexus: {
+			BidderRequest: bidderRequest,
+			RejectedBids:  []openrtb_ext.ExtRejectedBid{{BidID: "bad-bid", Reason: "invalid_bid", Message: "bad bid"}},
+		},
+	}
+	info := &debugInfo{
+		resolvedRequest: json.RawMessage(`{"id":"some-request-id"}`),
+		stageTimes:      map[string]int{stageBidders: 5},
+	}
+	info.setTrafficShaping(map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping{
+		openrtb_ext.BidderRubicon: {Inventory: "site:example.com", Skipped: true},
+	})
+
+	e := &exchange{}
+	ext := e.makeExtBidResponse(adapterBids, adapterExtra, &openrtb.BidRequest{}, info, nil)
+
+	if assert.NotNil(t, ext.Debug) {
+		assert.Len(t, ext.Debug.HttpCalls[openrtb_ext.BidderAppnexus], 1)
+		assert.Equal(t, bidderRequest, ext.Debug.BidderRequests[openrtb_ext.BidderAppnexus])
+		assert.Equal(t, "bad bid", ext.Debug.RejectedBids[openrtb_ext.BidderAppnexus][0].Message)
+		assert.Equal(t, map[string]int{stageBidders: 5}, ext.Debug.StageTimeMillis)
+		assert.Equal(t, "some-request-id", ext.Debug.ResolvedRequest.ID)
+		assert.True(t, ext.Debug.TrafficShaping[openrtb_ext.BidderRubicon].Skipped)
+	}
+
+	ext = e.makeExtBidResponse(adapterBids, adapterExtra, &openrtb.BidRequest{Test: 1}, nil, nil)
+	assert.Nil(t, ext.Debug, "Debug info should be left out if the exchange didn't turn debug on")
+}
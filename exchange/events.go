@@ -0,0 +1,57 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/analytics"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// eventTracking builds the URLs which tell the /event endpoint that a bid won or was rendered.
+//
+// All functions on this struct are nil-safe. A nil eventTracking means that events are disabled for the account.
+type eventTracking struct {
+	accountID   string
+	externalURL string
+	// auctionTimestampMs is the time that the auction started, in milliseconds since the epoch.
+	auctionTimestampMs int64
+}
+
+// newEventTracking returns nil if the account doesn't have events enabled.
+func newEventTracking(account *config.Account, externalURL string, auctionStart time.Time) *eventTracking {
+	if !account.Events.Enabled {
+		return nil
+	}
+	return &eventTracking{
+		accountID:          account.ID,
+		externalURL:        externalURL,
+		auctionTimestampMs: auctionStart.UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// makeBidExtEvents returns the event URLs for response.seatbid[i].bid[j].ext.prebid.events.
+func (ev *eventTracking) makeBidExtEvents(bid *openrtb.Bid, bidder openrtb_ext.BidderName) *openrtb_ext.ExtBidPrebidEvents {
+	if ev == nil {
+		return nil
+	}
+	return &openrtb_ext.ExtBidPrebidEvents{
+		Win: ev.makeEventURL(analytics.Win, bid, bidder),
+		Imp: ev.makeEventURL(analytics.Imp, bid, bidder),
+	}
+}
+
+// makeEventURL returns the URL for the given event type, or an empty string if events are disabled.
+func (ev *eventTracking) makeEventURL(eventType analytics.EventType, bid *openrtb.Bid, bidder openrtb_ext.BidderName) string {
+	if ev == nil {
+		return ""
+	}
+	return analytics.EventURL(ev.externalURL, &analytics.EventRequest{
+		Type:      eventType,
+		BidID:     bid.ID,
+		AccountID: ev.accountID,
+		Bidder:    string(bidder),
+		Timestamp: ev.auctionTimestampMs,
+	})
+}
@@ -0,0 +1,52 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTrackingDisabled(t *testing.T) {
+	events := newEventTracking(&config.Account{ID: "acct"}, "http://prebid-server.com", time.Now())
+	assert.Nil(t, events)
+	assert.Nil(t, events.makeBidExtEvents(&openrtb.Bid{ID: "bid"}, "appnexus"))
+	assert.Empty(t, events.makeEventURL("imp", &openrtb.Bid{ID: "bid"}, "appnexus"))
+}
+
+func TestMakeBidExtEvents(t *testing.T) {
+	account := &config.Account{ID: "acct", Events: config.AccountEvents{Enabled: true}}
+	events := newEventTracking(account, "http://prebid-server.com", time.Unix(1, 500*int64(time.Millisecond)))
+
+	extEvents := events.makeBidExtEvents(&openrtb.Bid{ID: "bid"}, "appnexus")
+
+	assert.Equal(t, &openrtb_ext.ExtBidPrebidEvents{
+		Win: "http://prebid-server.com/event?a=acct&b=bid&bidder=appnexus&t=win&ts=1500",
+		Imp: "http://prebid-server.com/event?a=acct&b=bid&bidder=appnexus&t=imp&ts=1500",
+	}, extEvents)
+}
+
+func TestMakeBidEvents(t *testing.T) {
+	e := new(exchange)
+	account := &config.Account{ID: "acct", Events: config.AccountEvents{Enabled: true}}
+	events := newEventTracking(account, "http://prebid-server.com", time.Unix(1, 0))
+	bids := []*pbsOrtbBid{{bid: &openrtb.Bid{ID: "bid"}, bidType: openrtb_ext.BidTypeBanner}}
+
+	ortbBids, errs := e.makeBid(bids, "appnexus", nil, events)
+
+	assert.Empty(t, errs)
+	if assert.Len(t, ortbBids, 1) {
+		var bidExt openrtb_ext.ExtBid
+		assert.NoError(t, json.Unmarshal(ortbBids[0].Ext, &bidExt))
+		if assert.NotNil(t, bidExt.Prebid.Events) {
+			assert.Equal(t, "http://prebid-server.com/event?a=acct&b=bid&bidder=appnexus&t=win&ts=1000", bidExt.Prebid.Events.Win)
+		}
+	}
+
+	ortbBids, _ = e.makeBid(bids, "appnexus", nil, nil)
+	assert.NotContains(t, string(ortbBids[0].Ext), "events", "Events shouldn't be added if the account doesn't enable them")
+}
@@ -9,17 +9,21 @@ import (
 	"net/http"
 	"runtime/debug"
 	"sort"
+	"text/template"
 	"time"
 
 	"github.com/prebid/prebid-server/stored_requests"
 
+	"github.com/buger/jsonparser"
 	"github.com/golang/glog"
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/currencies"
 	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/floors"
 	"github.com/prebid/prebid-server/gdpr"
+	"github.com/prebid/prebid-server/modules"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/prebid/prebid-server/prebid_cache_client"
@@ -28,7 +32,8 @@ import (
 // Exchange runs Auctions. Implementations must be threadsafe, and will be shared across many goroutines.
 type Exchange interface {
 	// HoldAuction executes an OpenRTB v2.5 Auction.
-	HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, usersyncs IdFetcher, labels pbsmetrics.Labels, categoriesFetcher *stored_requests.CategoryFetcher) (*openrtb.BidResponse, error)
+	// The hookExecutor runs the modules for the bidder stages of the auction. It may be nil.
+	HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, usersyncs IdFetcher, labels pbsmetrics.Labels, account *config.Account, categoriesFetcher *stored_requests.CategoryFetcher, hookExecutor *modules.Executor) (*openrtb.BidResponse, error)
 }
 
 // IdFetcher can find the user's ID for a specific Bidder.
@@ -47,12 +52,26 @@ type exchange struct {
 	UsersyncIfAmbiguous bool
 	defaultTTLs         config.DefaultTTLs
 	enforceCCPA         bool
+	floors              *floors.Rules
+	storedRespFetcher   stored_requests.ResponseFetcher
+	debugAllowed        bool
+	externalURL         string
+	vastTrackerTemplate *template.Template
+	bidValidationMode   config.BidValidationMode
+	throttle            *bidderThrottle
+	shaper              *trafficShaper
 }
 
 // Container to pass out response ext data from the GetAllBids goroutines back into the main thread
 type seatResponseExtra struct {
 	ResponseTimeMillis int
 	Errors             []openrtb_ext.ExtBidderError
+	Warnings           []openrtb_ext.ExtBidderError
+	// RejectedBids are the bids which the exchange removed from the auction. They're only reported in debug mode.
+	RejectedBids []openrtb_ext.ExtRejectedBid
+	// BidderRequest is the request which was sent to the bidder, after privacy enforcement and hooks.
+	// It's only set in debug mode.
+	BidderRequest *openrtb.BidRequest
 }
 
 type bidResponseWrapper struct {
@@ -61,10 +80,10 @@ type bidResponseWrapper struct {
 	bidder       openrtb_ext.BidderName
 }
 
-func NewExchange(client *http.Client, cache prebid_cache_client.Client, cfg *config.Configuration, metricsEngine pbsmetrics.MetricsEngine, infos adapters.BidderInfos, gDPR gdpr.Permissions, currencyConverter *currencies.RateConverter) Exchange {
+func NewExchange(client *http.Client, cache prebid_cache_client.Client, cfg *config.Configuration, metricsEngine pbsmetrics.MetricsEngine, infos adapters.BidderInfos, gDPR gdpr.Permissions, currencyConverter *currencies.RateConverter, floorRules *floors.Rules, storedRespFetcher stored_requests.ResponseFetcher) Exchange {
 	e := new(exchange)
 
-	e.adapterMap = newAdapterMap(client, cfg, infos)
+	e.adapterMap = newAdapterMap(client, cfg, infos, metricsEngine)
 	e.cache = cache
 	e.cacheTime = time.Duration(cfg.CacheURL.ExpectedTimeMillis) * time.Millisecond
 	e.me = metricsEngine
@@ -73,15 +92,32 @@ func NewExchange(client *http.Client, cache prebid_cache_client.Client, cfg *con
 	e.UsersyncIfAmbiguous = cfg.GDPR.UsersyncIfAmbiguous
 	e.defaultTTLs = cfg.CacheURL.DefaultTTLs
 	e.enforceCCPA = cfg.CCPA.Enforce
+	e.floors = floorRules
+	e.storedRespFetcher = storedRespFetcher
+	e.debugAllowed = cfg.Debug.Allowed
+	e.externalURL = cfg.ExternalURL
+	e.bidValidationMode = cfg.BidValidation.Mode
+	e.throttle = newBidderThrottle(cfg.Adapters, openrtb_ext.BidderList())
+	e.shaper = newTrafficShaper(cfg.TrafficShaping)
+	if cfg.VASTTracking.ImpressionURL != "" {
+		// The template was checked when the config was validated
+		e.vastTrackerTemplate = template.Must(template.New("vastTrackerTemplate").Parse(cfg.VASTTracking.ImpressionURL))
+	}
 	return e
 }
 
-func (e *exchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, usersyncs IdFetcher, labels pbsmetrics.Labels, categoriesFetcher *stored_requests.CategoryFetcher) (*openrtb.BidResponse, error) {
-	// Snapshot of resolved bid request for debug if test request
-	resolvedRequest, err := buildResolvedRequest(bidRequest)
+func (e *exchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidRequest, usersyncs IdFetcher, labels pbsmetrics.Labels, account *config.Account, categoriesFetcher *stored_requests.CategoryFetcher, hookExecutor *modules.Executor) (*openrtb.BidResponse, error) {
+	timer := newStageTimer()
+
+	// Snapshot of resolved bid request for debug if debug is enabled
+	debug := IsDebug(bidRequest, account.Debug.AllowedOrDefault(e.debugAllowed))
+	debugInfo, err := newDebugInfo(bidRequest, debug)
 	if err != nil {
 		glog.Errorf("Error marshalling bid request for debug: %v", err)
 	}
+	auctionStart := time.Now()
+	events := newEventTracking(account, e.externalURL, auctionStart)
+	vastTracker := newVASTImpressionTracker(e.vastTrackerTemplate, account, auctionStart)
 
 	for _, impInRequest := range bidRequest.Imp {
 		var impLabels pbsmetrics.ImpLabels = pbsmetrics.ImpLabels{
@@ -93,18 +129,22 @@ func (e *exchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidReque
 		e.me.RecordImps(impLabels)
 	}
 
+	// Imps with Stored Auction Responses don't go to the bidders at all
+	stored, errs := e.fetchStoredResponses(ctx, bidRequest)
+	liveRequest := removeStoredAuctionImps(bidRequest, stored.auction)
+
 	// Slice of BidRequests, each a copy of the original cleaned to only contain bidder data for the named bidder
 	blabels := make(map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels)
-	cleanRequests, aliases, errs := cleanOpenRTBRequests(ctx, bidRequest, usersyncs, blabels, labels, e.gDPR, e.UsersyncIfAmbiguous, e.enforceCCPA)
-
-	// List of bidders we have requests for.
-	liveAdapters := listBiddersWithRequests(cleanRequests)
+	cleanRequests, aliases, cleanErrs := cleanOpenRTBRequests(ctx, liveRequest, usersyncs, blabels, labels, e.me, e.gDPR, e.UsersyncIfAmbiguous, account.CCPA.EnforceOrDefault(e.enforceCCPA), account)
+	errs = append(errs, cleanErrs...)
+	errs = append(errs, validateStoredBidResponses(stored.bid, cleanRequests)...)
 
 	// Process the request to check for targeting parameters.
 	var targData *targetData
 	shouldCacheBids := false
 	shouldCacheVAST := false
 	var bidAdjustmentFactors map[string]float64
+	var multiBid map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid
 	var requestExt openrtb_ext.ExtRequest
 	if len(bidRequest.Ext) > 0 {
 		err := json.Unmarshal(bidRequest.Ext, &requestExt)
@@ -112,32 +152,76 @@ func (e *exchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidReque
 			return nil, fmt.Errorf("Error decoding Request.ext : %s", err.Error())
 		}
 		bidAdjustmentFactors = requestExt.Prebid.BidAdjustmentFactors
+		multiBid = getMultiBid(requestExt.Prebid.MultiBid)
 		if requestExt.Prebid.Cache != nil {
 			shouldCacheBids = requestExt.Prebid.Cache.Bids != nil
 			shouldCacheVAST = requestExt.Prebid.Cache.VastXML != nil
 		}
 
 		if requestExt.Prebid.Targeting != nil {
+			// Accounts may define their own price granularity, which applies if the request doesn't set one
+			if account.PriceGranularity != nil {
+				if _, _, _, err := jsonparser.Get(bidRequest.Ext, "prebid", "targeting", "pricegranularity"); err == jsonparser.KeyPathNotFoundError {
+					requestExt.Prebid.Targeting.PriceGranularity = *account.PriceGranularity
+				}
+			}
 			targData = &targetData{
 				priceGranularity:  requestExt.Prebid.Targeting.PriceGranularity,
 				includeWinners:    requestExt.Prebid.Targeting.IncludeWinners,
 				includeBidderKeys: requestExt.Prebid.Targeting.IncludeBidderKeys,
 				includeCacheBids:  shouldCacheBids,
 				includeCacheVast:  shouldCacheVAST,
+				multiBid:          multiBid,
 			}
 			targData.cacheHost, targData.cachePath = e.cache.GetExtCacheData()
 		}
 	}
 
+	// Get currency rates conversions for the auction
+	conversions := getAuctionCurrencyRates(e.currencyConverter.Rates(), requestExt.Prebid.CurrencyConversions)
+
+	// Resolve the price floors and tell the bidders about them
+	var impFloors map[string]float64
+	if e.floors != nil {
+		var floorErrs []error
+		impFloors, floorErrs = resolveFloors(bidRequest, e.floors, conversions)
+		errs = append(errs, floorErrs...)
+		applyFloors(cleanRequests, impFloors, e.floors.Currency)
+	}
+
+	// Skip the bidders which rarely bid on this inventory
+	debugInfo.setTrafficShaping(e.shaper.shape(cleanRequests, aliases, stored.bid, e.me))
+
+	// List of bidders we have requests for.
+	liveAdapters := listBiddersWithRequests(cleanRequests)
+	timer.record(stageBidderRequests)
+
 	// If we need to cache bids, then it will take some time to call prebid cache.
 	// We should reduce the amount of time the bidders have, to compensate.
 	auctionCtx, cancel := e.makeAuctionContext(ctx, shouldCacheBids) //Why no context for `shouldCacheVast`?
 	defer cancel()
 
-	// Get currency rates conversions for the auction
-	conversions := e.currencyConverter.Rates()
+	adapterBids, adapterExtra, anyBidsReturned := e.getAllBids(auctionCtx, cleanRequests, aliases, bidAdjustmentFactors, blabels, conversions, stored.bid, account.BidValidation.ModeOrDefault(e.bidValidationMode), account.ID, hookExecutor, debug)
 
-	adapterBids, adapterExtra, anyBidsReturned := e.getAllBids(auctionCtx, cleanRequests, aliases, bidAdjustmentFactors, blabels, conversions)
+	if len(stored.auction) > 0 {
+		var storedBidsFound bool
+		var storedErrs []error
+		liveAdapters, storedBidsFound, storedErrs = addStoredAuctionBids(bidRequest, stored.auction, liveAdapters, adapterBids, adapterExtra, conversions)
+		errs = append(errs, storedErrs...)
+		anyBidsReturned = anyBidsReturned || storedBidsFound
+	}
+	timer.record(stageBidders)
+
+	// Drop the bids under the floor before they can win
+	if anyBidsReturned && len(impFloors) > 0 {
+		var floorErrs []error
+		anyBidsReturned, floorErrs = e.enforceFloors(adapterBids, adapterExtra, impFloors, e.floors.Currency, conversions, aliases, blabels)
+		errs = append(errs, floorErrs...)
+	}
+
+	if anyBidsReturned {
+		anyBidsReturned = executeAllProcessedBidResponsesStage(hookExecutor, adapterBids)
+	}
 
 	var auc *auction = nil
 	if anyBidsReturned {
@@ -152,20 +236,37 @@ func (e *exchange) HoldAuction(ctx context.Context, bidRequest *openrtb.BidReque
 			}
 		}
 
-		auc = newAuction(adapterBids, len(bidRequest.Imp))
+		auc = newAuction(adapterBids, len(bidRequest.Imp), multiBid)
 
 		if targData != nil {
 			auc.setRoundedPrices(targData.priceGranularity)
-			cacheErrs := auc.doCache(ctx, e.cache, targData, bidRequest, 60, &e.defaultTTLs, bidCategory)
+			timer.record(stageAuction)
+			cacheErrs := auc.doCache(ctx, e.cache, targData, bidRequest, 60, &e.defaultTTLs, bidCategory, events, vastTracker)
 			if len(cacheErrs) > 0 {
 				errs = append(errs, cacheErrs...)
 			}
+			timer.record(stageCache)
 			targData.setTargeting(auc, bidRequest.App != nil, bidCategory)
 		}
 	}
+	timer.record(stageTargeting)
+	debugInfo.setStageTimes(timer)
 
 	// Build the response
-	return e.buildBidResponse(ctx, liveAdapters, adapterBids, bidRequest, resolvedRequest, adapterExtra, auc, errs)
+	return e.buildBidResponse(ctx, liveAdapters, adapterBids, bidRequest, debugInfo, adapterExtra, auc, events, errs)
+}
+
+// getAuctionCurrencyRates returns the rates to use for the auction. Custom rates from ext.prebid.currency take
+// priority over the server's rates, and replace them altogether if usepbsrates is false.
+func getAuctionCurrencyRates(pbsRates currencies.Conversions, customRates *openrtb_ext.ExtRequestCurrency) currencies.Conversions {
+	if customRates == nil || len(customRates.ConversionRates) == 0 {
+		return pbsRates
+	}
+	requestRates := currencies.NewRates(time.Time{}, customRates.ConversionRates)
+	if customRates.UsePBSRates != nil && !*customRates.UsePBSRates {
+		return requestRates
+	}
+	return currencies.NewAggregateConversions(requestRates, pbsRates)
 }
 
 func (e *exchange) makeAuctionContext(ctx context.Context, needsCache bool) (auctionCtx context.Context, cancel context.CancelFunc) {
@@ -180,7 +281,7 @@ func (e *exchange) makeAuctionContext(ctx context.Context, needsCache bool) (auc
 }
 
 // This piece sends all the requests to the bidder adapters and gathers the results.
-func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest, aliases map[string]string, bidAdjustments map[string]float64, blabels map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels, conversions currencies.Conversions) (map[openrtb_ext.BidderName]*pbsOrtbSeatBid, map[openrtb_ext.BidderName]*seatResponseExtra, bool) {
+func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest, aliases map[string]string, bidAdjustments map[string]float64, blabels map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels, conversions currencies.Conversions, storedBidResponses map[openrtb_ext.BidderName]map[string]json.RawMessage, bidValidation config.BidValidationMode, accountID string, hookExecutor *modules.Executor, debug bool) (map[openrtb_ext.BidderName]*pbsOrtbSeatBid, map[openrtb_ext.BidderName]*seatResponseExtra, bool) {
 	// Set up pointers to the bid results
 	adapterBids := make(map[openrtb_ext.BidderName]*pbsOrtbSeatBid, len(cleanRequests))
 	adapterExtra := make(map[openrtb_ext.BidderName]*seatResponseExtra, len(cleanRequests))
@@ -198,6 +299,22 @@ func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext
 			}
 			brw := new(bidResponseWrapper)
 			brw.bidder = aName
+			// The modules run first, so that a bidder they reject doesn't use up the throttle's tokens.
+			request, rejectErr := hookExecutor.ExecuteBidderRequestStage(aName, request)
+			if rejectErr != nil {
+				bidlabels.AdapterErrors = errorsToMetric([]error{rejectErr})
+				e.me.RecordAdapterRequest(*bidlabels)
+				brw.adapterExtra = &seatResponseExtra{Errors: errsToBidderErrors([]error{rejectErr})}
+				chBids <- brw
+				return
+			}
+			if throttleErr := e.throttle.allow(coreBidder, accountID); throttleErr != nil {
+				bidlabels.AdapterErrors = errorsToMetric([]error{throttleErr})
+				e.me.RecordAdapterRequest(*bidlabels)
+				brw.adapterExtra = &seatResponseExtra{Errors: errsToBidderErrors([]error{throttleErr})}
+				chBids <- brw
+				return
+			}
 			// Defer basic metrics to insure we capture them after all the values have been set
 			defer func() {
 				e.me.RecordAdapterRequest(*bidlabels)
@@ -210,7 +327,14 @@ func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext
 			}
 			var reqInfo adapters.ExtraRequestInfo
 			reqInfo.PbsEntryPoint = bidlabels.RType
-			bids, err := e.adapterMap[coreBidder].requestBid(ctx, request, aName, adjustmentFactor, conversions, &reqInfo)
+			bids, err := e.adapterMap[coreBidder].requestBid(ctx, request, aName, adjustmentFactor, conversions, &reqInfo, storedBidResponses[aName], debug)
+			if len(storedBidResponses[aName]) == 0 {
+				e.shaper.record(aName, request, bids != nil && len(bids.bids) > 0)
+			}
+			if rejectErr := executeRawBidderResponseStage(hookExecutor, aName, bids); rejectErr != nil {
+				err = append(err, rejectErr)
+			}
+			warnings := validateBidsAgainstRequest(request, bids, bidValidation)
 
 			// Add in time reporting
 			elapsed := time.Since(start)
@@ -218,6 +342,15 @@ func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext
 			// Structure to record extra tracking data generated during bidding
 			ae := new(seatResponseExtra)
 			ae.ResponseTimeMillis = int(elapsed / time.Millisecond)
+			if debug {
+				ae.BidderRequest = request
+			}
+			if bids != nil && len(bids.rejectedBids) > 0 {
+				ae.RejectedBids = bids.rejectedBids
+				for reason, count := range countRejectedBids(bids.rejectedBids) {
+					e.me.RecordAdapterBidsRejected(*bidlabels, reason, count)
+				}
+			}
 			// Timing statistics
 			e.me.RecordAdapterTime(*bidlabels, time.Since(start))
 			serr := errsToBidderErrors(err)
@@ -225,6 +358,9 @@ func (e *exchange) getAllBids(ctx context.Context, cleanRequests map[openrtb_ext
 			bidlabels.AdapterErrors = errorsToMetric(err)
 			// Append any bid validation errors to the error list
 			ae.Errors = serr
+			if len(warnings) > 0 {
+				ae.Warnings = errsToBidderErrors(warnings)
+			}
 			brw.adapterExtra = ae
 			if bids != nil {
 				for _, bid := range bids.bids {
@@ -267,6 +403,15 @@ func (e *exchange) recoverSafely(inner func(openrtb_ext.BidderName, openrtb_ext.
 	}
 }
 
+// countRejectedBids returns the number of bids which were rejected for each reason.
+func countRejectedBids(rejectedBids []openrtb_ext.ExtRejectedBid) map[pbsmetrics.RejectReason]int {
+	counts := make(map[pbsmetrics.RejectReason]int)
+	for _, rejected := range rejectedBids {
+		counts[pbsmetrics.RejectReason(rejected.Reason)]++
+	}
+	return counts
+}
+
 func bidsToMetric(bids *pbsOrtbSeatBid) pbsmetrics.AdapterBid {
 	if bids == nil || len(bids.bids) == 0 {
 		return pbsmetrics.AdapterBidNone
@@ -290,6 +435,10 @@ func errorsToMetric(errs []error) map[pbsmetrics.AdapterError]struct{} {
 			ret[pbsmetrics.AdapterErrorBadServerResponse] = s
 		case errortypes.FailedToRequestBidsCode:
 			ret[pbsmetrics.AdapterErrorFailedToRequestBids] = s
+		case errortypes.BidderThrottledCode:
+			ret[pbsmetrics.AdapterErrorThrottled] = s
+		case errortypes.ModuleRejectedCode:
+			ret[pbsmetrics.AdapterErrorModuleRejected] = s
 		default:
 			ret[pbsmetrics.AdapterErrorUnknown] = s
 		}
@@ -307,7 +456,7 @@ func errsToBidderErrors(errs []error) []openrtb_ext.ExtBidderError {
 }
 
 // This piece takes all the bids supplied by the adapters and crafts an openRTB response to send back to the requester
-func (e *exchange) buildBidResponse(ctx context.Context, liveAdapters []openrtb_ext.BidderName, adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, bidRequest *openrtb.BidRequest, resolvedRequest json.RawMessage, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, auc *auction, errList []error) (*openrtb.BidResponse, error) {
+func (e *exchange) buildBidResponse(ctx context.Context, liveAdapters []openrtb_ext.BidderName, adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, bidRequest *openrtb.BidRequest, debugInfo *debugInfo, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, auc *auction, events *eventTracking, errList []error) (*openrtb.BidResponse, error) {
 	bidResponse := new(openrtb.BidResponse)
 
 	bidResponse.ID = bidRequest.ID
@@ -322,7 +471,7 @@ func (e *exchange) buildBidResponse(ctx context.Context, liveAdapters []openrtb_
 	for _, a := range liveAdapters {
 		//while processing every single bib, do we need to handle categories here?
 		if adapterBids[a] != nil && len(adapterBids[a].bids) > 0 {
-			sb := e.makeSeatBid(adapterBids[a], a, adapterExtra, auc)
+			sb := e.makeSeatBid(adapterBids[a], a, adapterExtra, auc, events)
 			seatBids = append(seatBids, *sb)
 			bidResponse.Cur = adapterBids[a].currency
 		}
@@ -330,7 +479,7 @@ func (e *exchange) buildBidResponse(ctx context.Context, liveAdapters []openrtb_
 
 	bidResponse.SeatBid = seatBids
 
-	bidResponseExt := e.makeExtBidResponse(adapterBids, adapterExtra, bidRequest, resolvedRequest, errList)
+	bidResponseExt := e.makeExtBidResponse(adapterBids, adapterExtra, bidRequest, debugInfo, errList)
 	buffer := &bytes.Buffer{}
 	enc := json.NewEncoder(buffer)
 	enc.SetEscapeHTML(false)
@@ -510,30 +659,52 @@ func getPrimaryAdServer(adServerId int) (string, error) {
 }
 
 // Extract all the data from the SeatBids and build the ExtBidResponse
-func (e *exchange) makeExtBidResponse(adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, req *openrtb.BidRequest, resolvedRequest json.RawMessage, errList []error) *openrtb_ext.ExtBidResponse {
+func (e *exchange) makeExtBidResponse(adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, req *openrtb.BidRequest, debugInfo *debugInfo, errList []error) *openrtb_ext.ExtBidResponse {
 	bidResponseExt := &openrtb_ext.ExtBidResponse{
 		Errors:               make(map[openrtb_ext.BidderName][]openrtb_ext.ExtBidderError, len(adapterBids)),
 		ResponseTimeMillis:   make(map[openrtb_ext.BidderName]int, len(adapterBids)),
 		RequestTimeoutMillis: req.TMax,
 	}
-	if req.Test == 1 {
+	if debugInfo != nil {
 		bidResponseExt.Debug = &openrtb_ext.ExtResponseDebug{
-			HttpCalls: make(map[openrtb_ext.BidderName][]*openrtb_ext.ExtHttpCall),
+			HttpCalls:       make(map[openrtb_ext.BidderName][]*openrtb_ext.ExtHttpCall),
+			StageTimeMillis: debugInfo.stageTimes,
+			TrafficShaping:  debugInfo.trafficShaping,
 		}
-		if err := json.Unmarshal(resolvedRequest, &bidResponseExt.Debug.ResolvedRequest); err != nil {
+		if err := json.Unmarshal(debugInfo.resolvedRequest, &bidResponseExt.Debug.ResolvedRequest); err != nil {
 			glog.Errorf("Error unmarshalling bid request snapshot: %v", err)
 		}
 	}
 
 	for a, b := range adapterBids {
-		if b != nil && req.Test == 1 {
+		if debugInfo != nil {
 			// Fill debug info
-			bidResponseExt.Debug.HttpCalls[a] = b.httpCalls
+			if b != nil {
+				bidResponseExt.Debug.HttpCalls[a] = b.httpCalls
+			}
+			if len(adapterExtra[a].RejectedBids) > 0 {
+				if bidResponseExt.Debug.RejectedBids == nil {
+					bidResponseExt.Debug.RejectedBids = make(map[openrtb_ext.BidderName][]openrtb_ext.ExtRejectedBid)
+				}
+				bidResponseExt.Debug.RejectedBids[a] = adapterExtra[a].RejectedBids
+			}
+			if adapterExtra[a].BidderRequest != nil {
+				if bidResponseExt.Debug.BidderRequests == nil {
+					bidResponseExt.Debug.BidderRequests = make(map[openrtb_ext.BidderName]*openrtb.BidRequest)
+				}
+				bidResponseExt.Debug.BidderRequests[a] = adapterExtra[a].BidderRequest
+			}
 		}
 		// Only make an entry for bidder errors if the bidder reported any.
 		if len(adapterExtra[a].Errors) > 0 {
 			bidResponseExt.Errors[a] = adapterExtra[a].Errors
 		}
+		if len(adapterExtra[a].Warnings) > 0 {
+			if bidResponseExt.Warnings == nil {
+				bidResponseExt.Warnings = make(map[openrtb_ext.BidderName][]openrtb_ext.ExtBidderError)
+			}
+			bidResponseExt.Warnings[a] = adapterExtra[a].Warnings
+		}
 		if len(errList) > 0 {
 			bidResponseExt.Errors[openrtb_ext.PrebidExtKey] = errsToBidderErrors(errList)
 		}
@@ -546,7 +717,7 @@ func (e *exchange) makeExtBidResponse(adapterBids map[openrtb_ext.BidderName]*pb
 
 // Return an openrtb seatBid for a bidder
 // BuildBidResponse is responsible for ensuring nil bid seatbids are not included
-func (e *exchange) makeSeatBid(adapterBid *pbsOrtbSeatBid, adapter openrtb_ext.BidderName, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, auc *auction) *openrtb.SeatBid {
+func (e *exchange) makeSeatBid(adapterBid *pbsOrtbSeatBid, adapter openrtb_ext.BidderName, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, auc *auction, events *eventTracking) *openrtb.SeatBid {
 	seatBid := new(openrtb.SeatBid)
 	seatBid.Seat = adapter.String()
 	// Prebid cannot support roadblocking
@@ -569,7 +740,7 @@ func (e *exchange) makeSeatBid(adapterBid *pbsOrtbSeatBid, adapter openrtb_ext.B
 	}
 
 	var errList []error
-	seatBid.Bid, errList = e.makeBid(adapterBid.bids, adapter, auc)
+	seatBid.Bid, errList = e.makeBid(adapterBid.bids, adapter, auc, events)
 	if len(errList) > 0 {
 		adapterExtra[adapter].Errors = append(adapterExtra[adapter].Errors, errsToBidderErrors(errList)...)
 	}
@@ -578,7 +749,7 @@ func (e *exchange) makeSeatBid(adapterBid *pbsOrtbSeatBid, adapter openrtb_ext.B
 }
 
 // Create the Bid array inside of SeatBid
-func (e *exchange) makeBid(Bids []*pbsOrtbBid, adapter openrtb_ext.BidderName, auc *auction) ([]openrtb.Bid, []error) {
+func (e *exchange) makeBid(Bids []*pbsOrtbBid, adapter openrtb_ext.BidderName, auc *auction, events *eventTracking) ([]openrtb.Bid, []error) {
 	bids := make([]openrtb.Bid, 0, len(Bids))
 	errList := make([]error, 0, 1)
 	for _, thisBid := range Bids {
@@ -588,6 +759,7 @@ func (e *exchange) makeBid(Bids []*pbsOrtbBid, adapter openrtb_ext.BidderName, a
 				Targeting: thisBid.bidTargets,
 				Type:      thisBid.bidType,
 				Video:     thisBid.bidVideo,
+				Events:    events.makeBidExtEvents(thisBid.bid, adapter),
 			},
 		}
 		if cacheInfo, found := e.getBidCacheInfo(thisBid, auc); found {
@@ -606,7 +778,7 @@ func (e *exchange) makeBid(Bids []*pbsOrtbBid, adapter openrtb_ext.BidderName, a
 	return bids, errList
 }
 
-// If bid got cached inside `(a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client, targData *targetData, bidRequest *openrtb.BidRequest, ttlBuffer int64, defaultTTLs *config.DefaultTTLs, bidCategory map[string]string)`,
+// If bid got cached inside `(a *auction) doCache(ctx context.Context, cache prebid_cache_client.Client, targData *targetData, bidRequest *openrtb.BidRequest, ttlBuffer int64, defaultTTLs *config.DefaultTTLs, bidCategory map[string]string, events *eventTracking, vastTracker *vastImpressionTracker)`,
 // a UUID should be found inside `a.cacheIds` or `a.vastCacheIds`. This function returns the UUID along with the internal cache URL
 func (e *exchange) getBidCacheInfo(bid *pbsOrtbBid, auc *auction) (openrtb_ext.ExtBidPrebidCacheBids, bool) {
 	var cacheInfo openrtb_ext.ExtBidPrebidCacheBids
@@ -628,14 +800,6 @@ func (e *exchange) getBidCacheInfo(bid *pbsOrtbBid, auc *auction) (openrtb_ext.E
 	return cacheInfo, found
 }
 
-// Returns a snapshot of resolved bid request for debug if test field is set in the incomming request
-func buildResolvedRequest(bidRequest *openrtb.BidRequest) (json.RawMessage, error) {
-	if bidRequest.Test == 1 {
-		return json.Marshal(bidRequest)
-	}
-	return nil, nil
-}
-
 func listBiddersWithRequests(cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest) []openrtb_ext.BidderName {
 	liveAdapters := make([]openrtb_ext.BidderName, len(cleanRequests))
 	i := 0
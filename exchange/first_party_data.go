@@ -0,0 +1,161 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// firstPartyData decides which first party data each bidder gets.
+//
+// All functions on this struct are nil-safe. A nil firstPartyData means that every bidder gets the request as it is.
+type firstPartyData struct {
+	// allowedBidders are the bidders which may see site.ext.data, app.ext.data and user.ext.data.
+	// It's nil if every bidder may see them.
+	allowedBidders map[string]struct{}
+	// bidderConfigs are the ortb2 fragments from ext.prebid.bidderconfig, indexed by the bidders they apply to.
+	bidderConfigs map[string]*openrtb_ext.ExtBidderConfigORTB2
+}
+
+// parseFirstPartyData reads ext.prebid.data.bidders and ext.prebid.bidderconfig from the BidRequest.
+// It returns nil if the request doesn't limit its first party data.
+func parseFirstPartyData(orig *openrtb.BidRequest) (*firstPartyData, error) {
+	var fpd firstPartyData
+	hasRules := false
+
+	value, dataType, _, err := jsonparser.Get(orig.Ext, openrtb_ext.PrebidExtKey, "data", "bidders")
+	if dataType != jsonparser.NotExist && err != jsonparser.KeyPathNotFoundError {
+		if err != nil {
+			return nil, err
+		}
+		var bidders []string
+		if err := json.Unmarshal(value, &bidders); err != nil {
+			return nil, err
+		}
+		fpd.allowedBidders = make(map[string]struct{}, len(bidders))
+		for _, bidder := range bidders {
+			fpd.allowedBidders[bidder] = struct{}{}
+		}
+		hasRules = true
+	}
+
+	value, dataType, _, err = jsonparser.Get(orig.Ext, openrtb_ext.PrebidExtKey, "bidderconfig")
+	if dataType != jsonparser.NotExist && err != jsonparser.KeyPathNotFoundError {
+		if err != nil {
+			return nil, err
+		}
+		var bidderConfigs []openrtb_ext.ExtBidderConfig
+		if err := json.Unmarshal(value, &bidderConfigs); err != nil {
+			return nil, err
+		}
+		fpd.bidderConfigs = make(map[string]*openrtb_ext.ExtBidderConfigORTB2)
+		for _, bidderConfig := range bidderConfigs {
+			if bidderConfig.Config == nil || bidderConfig.Config.ORTB2 == nil {
+				continue
+			}
+			for _, bidder := range bidderConfig.Bidders {
+				if _, ok := fpd.bidderConfigs[bidder]; ok {
+					return nil, fmt.Errorf("request.ext.prebid.bidderconfig contains multiple configs for bidder %s; it must contain no more than one per bidder.", bidder)
+				}
+				fpd.bidderConfigs[bidder] = bidderConfig.Config.ORTB2
+			}
+		}
+		hasRules = true
+	}
+
+	if !hasRules {
+		return nil, nil
+	}
+	return &fpd, nil
+}
+
+// prepareRequest gives the bidder's request the first party data which that bidder should see.
+//
+// If the bidder isn't in ext.prebid.data.bidders, then site.ext.data, app.ext.data and user.ext.data are removed.
+// After that, the bidder's config from ext.prebid.bidderconfig is merged in. This is a JSON Merge Patch (RFC 7386),
+// so objects are merged recursively, any other value (including arrays) replaces the original, and null removes it.
+//
+// This *will* mutate the request, but will *not* mutate any objects nested inside it.
+func (fpd *firstPartyData) prepareRequest(req *openrtb.BidRequest, givenBidder string) error {
+	if fpd == nil {
+		return nil
+	}
+
+	if fpd.allowedBidders != nil {
+		if _, ok := fpd.allowedBidders[givenBidder]; !ok {
+			if req.Site != nil && hasExtData(req.Site.Ext) {
+				site := *req.Site
+				site.Ext = removeExtData(site.Ext)
+				req.Site = &site
+			}
+			if req.App != nil && hasExtData(req.App.Ext) {
+				app := *req.App
+				app.Ext = removeExtData(app.Ext)
+				req.App = &app
+			}
+			if req.User != nil && hasExtData(req.User.Ext) {
+				user := *req.User
+				user.Ext = removeExtData(user.Ext)
+				req.User = &user
+			}
+		}
+	}
+
+	config, ok := fpd.bidderConfigs[givenBidder]
+	if !ok {
+		return nil
+	}
+	if len(config.Site) > 0 && req.Site != nil {
+		site := new(openrtb.Site)
+		if err := mergeORTB2(req.Site, config.Site, site); err != nil {
+			return fmt.Errorf("site: %v", err)
+		}
+		req.Site = site
+	}
+	if len(config.App) > 0 && req.App != nil {
+		app := new(openrtb.App)
+		if err := mergeORTB2(req.App, config.App, app); err != nil {
+			return fmt.Errorf("app: %v", err)
+		}
+		req.App = app
+	}
+	if len(config.User) > 0 {
+		user := new(openrtb.User)
+		var original interface{} = req.User
+		if req.User == nil {
+			original = struct{}{}
+		}
+		if err := mergeORTB2(original, config.User, user); err != nil {
+			return fmt.Errorf("user: %v", err)
+		}
+		req.User = user
+	}
+	return nil
+}
+
+// mergeORTB2 merges the fragment into the original object, and unmarshals the result into merged.
+func mergeORTB2(original interface{}, fragment json.RawMessage, merged interface{}) error {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	mergedJSON, err := jsonpatch.MergePatch(originalJSON, fragment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(mergedJSON, merged)
+}
+
+func hasExtData(ext json.RawMessage) bool {
+	_, dataType, _, err := jsonparser.Get(ext, "data")
+	return err == nil && dataType != jsonparser.NotExist
+}
+
+// removeExtData returns a copy of the ext without its "data".
+func removeExtData(ext json.RawMessage) json.RawMessage {
+	return jsonparser.Delete(append([]byte(nil), ext...), "data")
+}
@@ -0,0 +1,123 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFirstPartyDataNoRules(t *testing.T) {
+	fpd, err := parseFirstPartyData(&openrtb.BidRequest{Ext: json.RawMessage(`{"prebid":{"data":{"eidpermissions":[]}}}`)})
+
+	assert.NoError(t, err)
+	assert.Nil(t, fpd)
+
+	req := newFirstPartyDataRequest()
+	assert.NoError(t, fpd.prepareRequest(req, "appnexus"))
+	assert.Equal(t, newFirstPartyDataRequest(), req, "A nil firstPartyData shouldn't change the request")
+}
+
+func TestPrepareRequestFirstPartyData(t *testing.T) {
+	testCases := []struct {
+		description  string
+		requestExt   string
+		bidder       string
+		expectedSite string
+		expectedUser string
+	}{
+		{
+			description:  "Allowed bidders see the global data",
+			requestExt:   `{"prebid":{"data":{"bidders":["appnexus"]}}}`,
+			bidder:       "appnexus",
+			expectedSite: `{"page":"test.com","keywords":"global","ext":{"data":{"section":"news"},"amp":0}}`,
+			expectedUser: `{"id":"user-id","ext":{"data":{"interests":["cars"]},"consent":"abc"}}`,
+		},
+		{
+			description:  "Other bidders don't see the global data",
+			requestExt:   `{"prebid":{"data":{"bidders":["appnexus"]}}}`,
+			bidder:       "rubicon",
+			expectedSite: `{"page":"test.com","keywords":"global","ext":{"amp":0}}`,
+			expectedUser: `{"id":"user-id","ext":{"consent":"abc"}}`,
+		},
+		{
+			description:  "Bidder config is merged in, even for bidders which can't see the global data",
+			requestExt:   `{"prebid":{"data":{"bidders":["appnexus"]},"bidderconfig":[{"bidders":["rubicon","openx"],"config":{"ortb2":{"site":{"keywords":"rubicon","ext":{"data":{"section":"sports"}}},"user":{"ext":{"data":{"interests":["boats"]}}}}}}]}}`,
+			bidder:       "rubicon",
+			expectedSite: `{"page":"test.com","keywords":"rubicon","ext":{"data":{"section":"sports"},"amp":0}}`,
+			expectedUser: `{"id":"user-id","ext":{"data":{"interests":["boats"]},"consent":"abc"}}`,
+		},
+		{
+			description:  "Bidder config replaces arrays and removes nulls",
+			requestExt:   `{"prebid":{"bidderconfig":[{"bidders":["rubicon"],"config":{"ortb2":{"site":{"keywords":null},"user":{"ext":{"data":{"interests":["boats","planes"]}}}}}}]}}`,
+			bidder:       "rubicon",
+			expectedSite: `{"page":"test.com","ext":{"data":{"section":"news"},"amp":0}}`,
+			expectedUser: `{"id":"user-id","ext":{"data":{"interests":["boats","planes"]},"consent":"abc"}}`,
+		},
+		{
+			description:  "Bidders without a config are left alone",
+			requestExt:   `{"prebid":{"bidderconfig":[{"bidders":["rubicon"],"config":{"ortb2":{"site":{"keywords":"rubicon"}}}}]}}`,
+			bidder:       "appnexus",
+			expectedSite: `{"page":"test.com","keywords":"global","ext":{"data":{"section":"news"},"amp":0}}`,
+			expectedUser: `{"id":"user-id","ext":{"data":{"interests":["cars"]},"consent":"abc"}}`,
+		},
+	}
+
+	for _, test := range testCases {
+		orig := newFirstPartyDataRequest()
+		orig.Ext = json.RawMessage(test.requestExt)
+		fpd, err := parseFirstPartyData(orig)
+		if !assert.NoError(t, err, test.description) {
+			continue
+		}
+
+		req := *orig
+		err = fpd.prepareRequest(&req, test.bidder)
+
+		assert.NoError(t, err, test.description)
+		siteJSON, _ := json.Marshal(req.Site)
+		assert.JSONEq(t, test.expectedSite, string(siteJSON), test.description)
+		userJSON, _ := json.Marshal(req.User)
+		assert.JSONEq(t, test.expectedUser, string(userJSON), test.description)
+
+		original := newFirstPartyDataRequest()
+		assert.Equal(t, original.Site, orig.Site, "%s: the original site shouldn't change", test.description)
+		assert.Equal(t, original.User, orig.User, "%s: the original user shouldn't change", test.description)
+	}
+}
+
+func TestPrepareRequestFirstPartyDataApp(t *testing.T) {
+	orig := &openrtb.BidRequest{
+		App: &openrtb.App{ID: "app-id", Ext: json.RawMessage(`{"data":{"genre":"puzzle"}}`)},
+		Ext: json.RawMessage(`{"prebid":{"data":{"bidders":["appnexus"]},"bidderconfig":[{"bidders":["rubicon"],"config":{"ortb2":{"app":{"name":"My App"},"user":{"yob":1980}}}}]}}`),
+	}
+	fpd, err := parseFirstPartyData(orig)
+	assert.NoError(t, err)
+
+	req := *orig
+	assert.NoError(t, fpd.prepareRequest(&req, "rubicon"))
+
+	assert.Equal(t, "My App", req.App.Name)
+	assert.Equal(t, "app-id", req.App.ID)
+	assert.Equal(t, `{}`, string(req.App.Ext), "rubicon isn't allowed to see the app's global data")
+	if assert.NotNil(t, req.User, "The user should be created if the request didn't have one") {
+		assert.Equal(t, int64(1980), req.User.Yob)
+	}
+	assert.Nil(t, orig.User)
+	assert.Equal(t, `{"data":{"genre":"puzzle"}}`, string(orig.App.Ext))
+}
+
+func newFirstPartyDataRequest() *openrtb.BidRequest {
+	return &openrtb.BidRequest{
+		Site: &openrtb.Site{
+			Page:     "test.com",
+			Keywords: "global",
+			Ext:      json.RawMessage(`{"data":{"section":"news"},"amp":0}`),
+		},
+		User: &openrtb.User{
+			ID:  "user-id",
+			Ext: json.RawMessage(`{"data":{"interests":["cars"]},"consent":"abc"}`),
+		},
+	}
+}
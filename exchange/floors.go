@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/floors"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+)
+
+// resolveFloors finds the price floor for each Imp in the request, in the rules currency.
+// If the Imp already has a higher bidfloor of its own, that one is kept.
+func resolveFloors(req *openrtb.BidRequest, rules *floors.Rules, conversions currencies.Conversions) (map[string]float64, []error) {
+	var errs []error
+	impFloors := make(map[string]float64, len(req.Imp))
+
+	for i := range req.Imp {
+		imp := &req.Imp[i]
+		floor, hasFloor := rules.Floor(req, imp)
+
+		if imp.BidFloor > 0 {
+			impCurrency := imp.BidFloorCur
+			if impCurrency == "" {
+				impCurrency = "USD"
+			}
+			rate, err := conversions.GetRate(impCurrency, rules.Currency)
+			if err != nil {
+				errs = append(errs, &errortypes.Warning{
+					Message: fmt.Sprintf("Unable to convert the bidfloor of imp %s from %s to %s: %v", imp.ID, impCurrency, rules.Currency, err),
+				})
+			} else if impFloor := imp.BidFloor * rate; impFloor > floor {
+				floor = impFloor
+				hasFloor = true
+			}
+		}
+
+		if hasFloor {
+			impFloors[imp.ID] = floor
+		}
+	}
+
+	return impFloors, errs
+}
+
+// applyFloors sets the resolved floors on every Imp sent to the bidders.
+func applyFloors(cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest, impFloors map[string]float64, currency string) {
+	for _, req := range cleanRequests {
+		for i := range req.Imp {
+			if floor, ok := impFloors[req.Imp[i].ID]; ok {
+				req.Imp[i].BidFloor = floor
+				req.Imp[i].BidFloorCur = currency
+			}
+		}
+	}
+}
+
+// enforceFloors removes the bids which are priced under their Imp's floor. The floors are converted to the
+// currency of each seat, and rejected bids are recorded in the seat's extra data and in the metrics.
+func (e *exchange) enforceFloors(adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, impFloors map[string]float64, currency string, conversions currencies.Conversions, aliases map[string]string, blabels map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels) (bool, []error) {
+	var errs []error
+	bidsFound := false
+
+	for bidderName, seatBid := range adapterBids {
+		if seatBid == nil || len(seatBid.bids) == 0 {
+			continue
+		}
+
+		rate := 1.0
+		if seatBid.currency != currency {
+			var err error
+			if rate, err = conversions.GetRate(currency, seatBid.currency); err != nil {
+				errs = append(errs, &errortypes.Warning{
+					Message: fmt.Sprintf("Unable to enforce price floors for bidder %s: %v", bidderName, err),
+				})
+				bidsFound = true
+				continue
+			}
+		}
+
+		validBids := make([]*pbsOrtbBid, 0, len(seatBid.bids))
+		for _, bid := range seatBid.bids {
+			floor, ok := impFloors[bid.bid.ImpID]
+			if !ok || bid.bid.Price >= floor*rate {
+				validBids = append(validBids, bid)
+				continue
+			}
+			if extra, ok := adapterExtra[bidderName]; ok && extra != nil {
+				extra.RejectedBids = append(extra.RejectedBids, openrtb_ext.ExtRejectedBid{
+					ImpID:    bid.bid.ImpID,
+					BidID:    bid.bid.ID,
+					Price:    bid.bid.Price,
+					Floor:    floor * rate,
+					Currency: seatBid.currency,
+					Reason:   string(pbsmetrics.RejectReasonBelowFloor),
+				})
+			}
+		}
+
+		if rejected := len(seatBid.bids) - len(validBids); rejected > 0 {
+			if labels, ok := blabels[resolveBidder(string(bidderName), aliases)]; ok {
+				e.me.RecordAdapterBidsRejected(*labels, pbsmetrics.RejectReasonBelowFloor, rejected)
+			}
+		}
+		seatBid.bids = validBids
+		if len(validBids) > 0 {
+			bidsFound = true
+		}
+	}
+
+	return bidsFound, errs
+}
@@ -0,0 +1,143 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/floors"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestFloorRules(t *testing.T) *floors.Rules {
+	rules, err := floors.ParseRules([]byte(`{
+		"currency": "USD",
+		"schema": { "fields": ["mediaType"] },
+		"values": { "banner": 1, "video": 5 }
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to parse test floor rules: %v", err)
+	}
+	return rules
+}
+
+func newTestConversions() currencies.Conversions {
+	return currencies.NewRates(time.Now(), map[string]map[string]float64{
+		"USD": {"EUR": 0.5},
+	})
+}
+
+func TestResolveFloors(t *testing.T) {
+	req := &openrtb.BidRequest{
+		Imp: []openrtb.Imp{
+			{ID: "banner-imp", Banner: &openrtb.Banner{}},
+			{ID: "banner-imp-high-floor", Banner: &openrtb.Banner{}, BidFloor: 2},
+			{ID: "video-imp-eur-floor", Video: &openrtb.Video{}, BidFloor: 4, BidFloorCur: "EUR"},
+			{ID: "native-imp", Native: &openrtb.Native{}},
+		},
+	}
+
+	impFloors, errs := resolveFloors(req, newTestFloorRules(t), newTestConversions())
+
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]float64{
+		"banner-imp":            1,
+		"banner-imp-high-floor": 2,
+		"video-imp-eur-floor":   8,
+	}, impFloors)
+}
+
+func TestResolveFloorsUnknownCurrency(t *testing.T) {
+	req := &openrtb.BidRequest{
+		Imp: []openrtb.Imp{{ID: "banner-imp", Banner: &openrtb.Banner{}, BidFloor: 10, BidFloorCur: "JPY"}},
+	}
+
+	impFloors, errs := resolveFloors(req, newTestFloorRules(t), newTestConversions())
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, map[string]float64{"banner-imp": 1}, impFloors, "The rules floor should be used if the imp floor can't be converted")
+}
+
+func TestApplyFloors(t *testing.T) {
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		"appnexus": {Imp: []openrtb.Imp{{ID: "imp-1"}, {ID: "imp-2"}}},
+	}
+
+	applyFloors(cleanRequests, map[string]float64{"imp-1": 1.5}, "USD")
+
+	assert.Equal(t, 1.5, cleanRequests["appnexus"].Imp[0].BidFloor)
+	assert.Equal(t, "USD", cleanRequests["appnexus"].Imp[0].BidFloorCur)
+	assert.Equal(t, 0.0, cleanRequests["appnexus"].Imp[1].BidFloor)
+	assert.Equal(t, "", cleanRequests["appnexus"].Imp[1].BidFloorCur)
+}
+
+func TestEnforceFloors(t *testing.T) {
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterBidsRejected", mock.Anything, pbsmetrics.RejectReasonBelowFloor, mock.Anything).Return()
+	e := &exchange{me: metricsMock}
+
+	adapterBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		"appnexus": {
+			currency: "USD",
+			bids: []*pbsOrtbBid{
+				{bid: &openrtb.Bid{ID: "under", ImpID: "imp-1", Price: 0.9}},
+				{bid: &openrtb.Bid{ID: "at", ImpID: "imp-1", Price: 1}},
+				{bid: &openrtb.Bid{ID: "no-floor", ImpID: "imp-2", Price: 0.1}},
+			},
+		},
+		"rubicon": {
+			currency: "EUR",
+			bids: []*pbsOrtbBid{
+				{bid: &openrtb.Bid{ID: "under-eur", ImpID: "imp-1", Price: 0.4}},
+			},
+		},
+	}
+	adapterExtra := map[openrtb_ext.BidderName]*seatResponseExtra{
+		"appnexus": {},
+		"rubicon":  {},
+	}
+	blabels := map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{
+		"appnexus": {Adapter: "appnexus"},
+		"rubicon":  {Adapter: "rubicon"},
+	}
+
+	bidsFound, errs := e.enforceFloors(adapterBids, adapterExtra, map[string]float64{"imp-1": 1}, "USD", newTestConversions(), map[string]string{}, blabels)
+
+	assert.True(t, bidsFound)
+	assert.Empty(t, errs)
+	if assert.Len(t, adapterBids["appnexus"].bids, 2) {
+		assert.Equal(t, "at", adapterBids["appnexus"].bids[0].bid.ID)
+		assert.Equal(t, "no-floor", adapterBids["appnexus"].bids[1].bid.ID)
+	}
+	assert.Empty(t, adapterBids["rubicon"].bids)
+	assert.Equal(t, []openrtb_ext.ExtRejectedBid{
+		{ImpID: "imp-1", BidID: "under", Price: 0.9, Floor: 1, Currency: "USD", Reason: "below_floor"},
+	}, adapterExtra["appnexus"].RejectedBids)
+	assert.Equal(t, []openrtb_ext.ExtRejectedBid{
+		{ImpID: "imp-1", BidID: "under-eur", Price: 0.4, Floor: 0.5, Currency: "EUR", Reason: "below_floor"},
+	}, adapterExtra["rubicon"].RejectedBids)
+	metricsMock.AssertCalled(t, "RecordAdapterBidsRejected", pbsmetrics.AdapterLabels{Adapter: "appnexus"}, pbsmetrics.RejectReasonBelowFloor, 1)
+	metricsMock.AssertCalled(t, "RecordAdapterBidsRejected", pbsmetrics.AdapterLabels{Adapter: "rubicon"}, pbsmetrics.RejectReasonBelowFloor, 1)
+}
+
+func TestEnforceFloorsUnknownCurrency(t *testing.T) {
+	e := &exchange{me: &pbsmetrics.MetricsEngineMock{}}
+
+	adapterBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		"appnexus": {
+			currency: "JPY",
+			bids:     []*pbsOrtbBid{{bid: &openrtb.Bid{ID: "bid", ImpID: "imp-1", Price: 0.1}}},
+		},
+	}
+	adapterExtra := map[openrtb_ext.BidderName]*seatResponseExtra{"appnexus": {}}
+
+	bidsFound, errs := e.enforceFloors(adapterBids, adapterExtra, map[string]float64{"imp-1": 1}, "USD", newTestConversions(), map[string]string{}, nil)
+
+	assert.True(t, bidsFound, "Bids should be kept if the floor can't be converted")
+	assert.Len(t, errs, 1)
+	assert.Len(t, adapterBids["appnexus"].bids, 1)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/buger/jsonparser"
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
 	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbs"
 	"github.com/prebid/prebid-server/usersync"
@@ -33,11 +35,15 @@ type adaptedAdapter struct {
 //
 // This is not ideal. OpenRTB provides a superset of the legacy data structures.
 // For requests which use those features, the best we can do is respond with "no bid".
-func (bidder *adaptedAdapter) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo) (*pbsOrtbSeatBid, []error) {
+func (bidder *adaptedAdapter) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error) {
 	legacyRequest, legacyBidder, errs := bidder.toLegacyAdapterInputs(request, name)
 	if legacyRequest == nil || legacyBidder == nil {
 		return nil, errs
 	}
+	if len(storedResponses) > 0 {
+		errs = append(errs, &errortypes.Warning{Message: fmt.Sprintf("Bidder %s doesn't support Stored Bid Responses. It was called as usual.", name)})
+	}
+	legacyRequest.IsDebug = debug
 
 	legacyBids, err := bidder.adapter.Call(ctx, legacyRequest, legacyBidder)
 	if err != nil {
@@ -88,11 +94,6 @@ func (bidder *adaptedAdapter) toLegacyRequest(req *openrtb.BidRequest) (*pbs.PBS
 		return nil, err
 	}
 
-	isDebug := false
-	if req.Test == 1 {
-		isDebug = true
-	}
-
 	url := ""
 	domain := ""
 	if req.Site != nil {
@@ -122,9 +123,9 @@ func (bidder *adaptedAdapter) toLegacyRequest(req *openrtb.BidRequest) (*pbs.PBS
 		Secure:        isSecure,
 		TimeoutMillis: req.TMax,
 		// AdUnits is excluded because no legacy adapters read from it
-		IsDebug: isDebug,
-		App:     req.App,
-		Device:  req.Device,
+		// IsDebug is set by requestBid, because it depends on more than the request
+		App:    req.App,
+		Device: req.Device,
 		// PBSUser is excluded because rubicon is the only adapter which reads from it, and they're supporting OpenRTB directly
 		// SDK is excluded because that information doesn't exist in OpenRTB.
 		// Bidders is excluded because no legacy adapters read from it
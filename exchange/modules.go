@@ -0,0 +1,75 @@
+package exchange
+
+import (
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/modules"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// executeRawBidderResponseStage runs the raw_bidder_response hooks on a bidder's bids, and replaces them
+// with the bids the modules returned. If a module rejects the bidder, all of its bids are dropped.
+func executeRawBidderResponseStage(hookExecutor *modules.Executor, bidder openrtb_ext.BidderName, seatBid *pbsOrtbSeatBid) *modules.RejectError {
+	if hookExecutor == nil || seatBid == nil {
+		return nil
+	}
+	bids, rejectErr := hookExecutor.ExecuteRawBidderResponseStage(bidder, toTypedBids(seatBid.bids))
+	if rejectErr != nil {
+		seatBid.bids = nil
+		return rejectErr
+	}
+	seatBid.bids = fromTypedBids(bids)
+	return nil
+}
+
+// executeAllProcessedBidResponsesStage runs the all_processed_bid_responses hooks on every bidder's bids,
+// and replaces them with the bids the modules returned. It returns true if any bids are left.
+func executeAllProcessedBidResponsesStage(hookExecutor *modules.Executor, adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid) bool {
+	if hookExecutor == nil {
+		return true
+	}
+	typedBids := make(map[openrtb_ext.BidderName][]*adapters.TypedBid, len(adapterBids))
+	for bidder, seatBid := range adapterBids {
+		if seatBid != nil {
+			typedBids[bidder] = toTypedBids(seatBid.bids)
+		}
+	}
+
+	typedBids = hookExecutor.ExecuteAllProcessedBidResponsesStage(typedBids)
+
+	bidsFound := false
+	for bidder, seatBid := range adapterBids {
+		if seatBid == nil {
+			continue
+		}
+		seatBid.bids = fromTypedBids(typedBids[bidder])
+		bidsFound = bidsFound || len(seatBid.bids) > 0
+	}
+	return bidsFound
+}
+
+func toTypedBids(bids []*pbsOrtbBid) []*adapters.TypedBid {
+	typedBids := make([]*adapters.TypedBid, 0, len(bids))
+	for _, bid := range bids {
+		typedBids = append(typedBids, &adapters.TypedBid{
+			Bid:      bid.bid,
+			BidType:  bid.bidType,
+			BidVideo: bid.bidVideo,
+		})
+	}
+	return typedBids
+}
+
+func fromTypedBids(typedBids []*adapters.TypedBid) []*pbsOrtbBid {
+	bids := make([]*pbsOrtbBid, 0, len(typedBids))
+	for _, typedBid := range typedBids {
+		if typedBid == nil || typedBid.Bid == nil {
+			continue
+		}
+		bids = append(bids, &pbsOrtbBid{
+			bid:      typedBid.Bid,
+			bidType:  typedBid.BidType,
+			bidVideo: typedBid.BidVideo,
+		})
+	}
+	return bids
+}
@@ -0,0 +1,241 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// storedResponses holds the Stored Responses which the imps in a request asked for.
+type storedResponses struct {
+	// auction maps an imp ID to the Stored Auction Response which replaces the whole auction for that imp.
+	auction map[string]storedAuctionResponse
+	// bid maps a bidder to the HTTP response bodies which replace its calls for each imp ID.
+	bid map[openrtb_ext.BidderName]map[string]json.RawMessage
+}
+
+// storedAuctionResponse holds the SeatBids from a Stored Auction Response. The stored data is either the seatbid
+// array on its own, or an object with the "seatbid" array and the "cur" which its bids are in.
+type storedAuctionResponse struct {
+	Cur     string            `json:"cur"`
+	SeatBid []openrtb.SeatBid `json:"seatbid"`
+}
+
+func parseStoredAuctionResponse(data json.RawMessage) (storedAuctionResponse, error) {
+	var response storedAuctionResponse
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return response, json.Unmarshal(data, &response.SeatBid)
+	}
+	return response, json.Unmarshal(data, &response)
+}
+
+// fetchStoredResponses loads the Stored Auction Responses and Stored Bid Responses referenced by
+// imp.ext.prebid.storedauctionresponse and imp.ext.prebid.storedbidresponse.
+func (e *exchange) fetchStoredResponses(ctx context.Context, bidRequest *openrtb.BidRequest) (storedResponses, []error) {
+	var responses storedResponses
+	if e.storedRespFetcher == nil {
+		return responses, nil
+	}
+
+	auctionIDs := make(map[string]string)
+	bidIDs := make(map[string][]openrtb_ext.ExtStoredBidResponse)
+	var ids []string
+	for _, imp := range bidRequest.Imp {
+		prebidExt, err := parseImpPrebidExt(imp.Ext)
+		if err != nil || prebidExt == nil {
+			continue
+		}
+		if prebidExt.StoredAuctionResponse != nil {
+			auctionIDs[imp.ID] = prebidExt.StoredAuctionResponse.ID
+			ids = append(ids, prebidExt.StoredAuctionResponse.ID)
+		}
+		for _, storedBidResponse := range prebidExt.StoredBidResponse {
+			bidIDs[imp.ID] = append(bidIDs[imp.ID], storedBidResponse)
+			ids = append(ids, storedBidResponse.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return responses, nil
+	}
+
+	data, errs := e.storedRespFetcher.FetchResponses(ctx, ids)
+
+	responses.auction = make(map[string]storedAuctionResponse, len(auctionIDs))
+	for impID, id := range auctionIDs {
+		storedData, ok := data[id]
+		if !ok {
+			continue
+		}
+		response, err := parseStoredAuctionResponse(storedData)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Stored Auction Response %s for imp %s is malformed: %v", id, impID, err))
+			continue
+		}
+		responses.auction[impID] = response
+	}
+
+	responses.bid = make(map[openrtb_ext.BidderName]map[string]json.RawMessage)
+	for impID, storedBidResponses := range bidIDs {
+		for _, storedBidResponse := range storedBidResponses {
+			storedData, ok := data[storedBidResponse.ID]
+			if !ok {
+				continue
+			}
+			bidder := openrtb_ext.BidderName(storedBidResponse.Bidder)
+			if _, ok := responses.bid[bidder]; !ok {
+				responses.bid[bidder] = make(map[string]json.RawMessage)
+			}
+			responses.bid[bidder][impID] = storedData
+		}
+	}
+
+	return responses, errs
+}
+
+func parseImpPrebidExt(impExt json.RawMessage) (*openrtb_ext.ExtImpPrebid, error) {
+	rawPrebidExt, _, _, err := jsonparser.Get(impExt, openrtb_ext.PrebidExtKey)
+	if err != nil {
+		return nil, err
+	}
+	var prebidExt openrtb_ext.ExtImpPrebid
+	if err := json.Unmarshal(rawPrebidExt, &prebidExt); err != nil {
+		return nil, err
+	}
+	return &prebidExt, nil
+}
+
+// removeStoredAuctionImps returns a copy of the request without the imps whose auctions were replaced
+// by Stored Auction Responses. The original request is left as-is.
+func removeStoredAuctionImps(bidRequest *openrtb.BidRequest, auctionResponses map[string]storedAuctionResponse) *openrtb.BidRequest {
+	if len(auctionResponses) == 0 {
+		return bidRequest
+	}
+	liveRequest := *bidRequest
+	liveRequest.Imp = make([]openrtb.Imp, 0, len(bidRequest.Imp))
+	for _, imp := range bidRequest.Imp {
+		if _, ok := auctionResponses[imp.ID]; !ok {
+			liveRequest.Imp = append(liveRequest.Imp, imp)
+		}
+	}
+	return &liveRequest
+}
+
+// validateStoredBidResponses drops the Stored Bid Responses for bidders which won't be called for the imp,
+// and warns about them.
+func validateStoredBidResponses(bidResponses map[openrtb_ext.BidderName]map[string]json.RawMessage, cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest) []error {
+	var errs []error
+	for bidder, impResponses := range bidResponses {
+		for impID := range impResponses {
+			if !requestHasImp(cleanRequests[bidder], impID) {
+				delete(impResponses, impID)
+				errs = append(errs, &errortypes.Warning{
+					Message: fmt.Sprintf("Stored Bid Response for bidder %s on imp %s was ignored because the bidder isn't part of the auction for that imp", bidder, impID),
+				})
+			}
+		}
+	}
+	return errs
+}
+
+func requestHasImp(request *openrtb.BidRequest, impID string) bool {
+	if request == nil {
+		return false
+	}
+	for _, imp := range request.Imp {
+		if imp.ID == impID {
+			return true
+		}
+	}
+	return false
+}
+
+// addStoredAuctionBids adds the bids from the Stored Auction Responses to the bids returned by the live bidders.
+// The list of bidders in the auction is returned, including any seats which only came from the stored data,
+// along with whether any stored bids were added.
+//
+// Like the live bids, the stored bids are converted to the seat's currency. Seats which only came from the stored
+// data use the first currency in the request which the bids can be converted to.
+func addStoredAuctionBids(bidRequest *openrtb.BidRequest, auctionResponses map[string]storedAuctionResponse, liveAdapters []openrtb_ext.BidderName, adapterBids map[openrtb_ext.BidderName]*pbsOrtbSeatBid, adapterExtra map[openrtb_ext.BidderName]*seatResponseExtra, conversions currencies.Conversions) ([]openrtb_ext.BidderName, bool, []error) {
+	var errs []error
+	bidsFound := false
+	for _, imp := range bidRequest.Imp {
+		response, ok := auctionResponses[imp.ID]
+		if !ok {
+			continue
+		}
+		// The OpenRTB default currency is USD.
+		storedCur := response.Cur
+		if storedCur == "" {
+			storedCur = "USD"
+		}
+		for _, seatBid := range response.SeatBid {
+			bidder := openrtb_ext.BidderName(seatBid.Seat)
+			if _, ok := adapterBids[bidder]; !ok {
+				liveAdapters = append(liveAdapters, bidder)
+			}
+			if adapterBids[bidder] == nil {
+				adapterBids[bidder] = &pbsOrtbSeatBid{currency: storedSeatCurrency(bidRequest.Cur, storedCur, conversions)}
+			}
+			if adapterExtra[bidder] == nil {
+				adapterExtra[bidder] = &seatResponseExtra{}
+			}
+			rate, err := conversions.GetRate(storedCur, adapterBids[bidder].currency)
+			if err != nil {
+				errs = append(errs, &errortypes.Warning{
+					Message: fmt.Sprintf("Stored Auction Response bids from seat %s on imp %s were dropped because they can't be converted from %s to %s: %v", bidder, imp.ID, storedCur, adapterBids[bidder].currency, err),
+				})
+				continue
+			}
+			for i := range seatBid.Bid {
+				bid := seatBid.Bid[i]
+				bid.ImpID = imp.ID
+				bid.Price = bid.Price * rate
+				adapterBids[bidder].bids = append(adapterBids[bidder].bids, &pbsOrtbBid{
+					bid:     &bid,
+					bidType: storedBidType(&bid, &imp),
+				})
+				bidsFound = true
+			}
+		}
+	}
+	return liveAdapters, bidsFound, errs
+}
+
+// storedSeatCurrency returns the first of the request's currencies which the stored bids can be converted to.
+func storedSeatCurrency(requestCur []string, storedCur string, conversions currencies.Conversions) string {
+	if len(requestCur) == 0 {
+		return "USD"
+	}
+	for _, cur := range requestCur {
+		if _, err := conversions.GetRate(storedCur, cur); err == nil {
+			return cur
+		}
+	}
+	return requestCur[0]
+}
+
+// storedBidType uses bid.ext.prebid.type if the stored bid has one. Otherwise, it guesses from the imp.
+func storedBidType(bid *openrtb.Bid, imp *openrtb.Imp) openrtb_ext.BidType {
+	if bidType, err := jsonparser.GetString(bid.Ext, openrtb_ext.PrebidExtKey, "type"); err == nil {
+		if parsed, err := openrtb_ext.ParseBidType(bidType); err == nil {
+			return parsed
+		}
+	}
+	switch {
+	case imp.Banner != nil:
+		return openrtb_ext.BidTypeBanner
+	case imp.Video != nil:
+		return openrtb_ext.BidTypeVideo
+	case imp.Native != nil:
+		return openrtb_ext.BidTypeNative
+	default:
+		return openrtb_ext.BidTypeAudio
+	}
+}
@@ -0,0 +1,287 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/currencies"
+	"github.com/prebid/prebid-server/gdpr"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoredBidResponses(t *testing.T) {
+	serverCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverCalls++
+		w.Write([]byte("1"))
+	}))
+	defer server.Close()
+
+	bidder := adaptBidder(&priceBidder{endpoint: server.URL}, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
+	request := &openrtb.BidRequest{
+		Imp: []openrtb.Imp{{ID: "live-imp"}, {ID: "stored-imp"}},
+	}
+
+	seatBid, errs := bidder.requestBid(context.Background(), request, "test", 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, map[string]json.RawMessage{
+		"stored-imp": json.RawMessage("5"),
+	}, false)
+
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, serverCalls, "Only the live imp should be sent to the bidder's server")
+	if assert.Len(t, seatBid.bids, 2) {
+		prices := map[string]float64{}
+		for _, bid := range seatBid.bids {
+			prices[bid.bid.ImpID] = bid.bid.Price
+		}
+		assert.Equal(t, map[string]float64{"live-imp": 1, "stored-imp": 5}, prices)
+	}
+}
+
+func TestStoredBidResponsesOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("The bidder's server shouldn't be called when every imp has a stored response")
+	}))
+	defer server.Close()
+
+	bidder := adaptBidder(&priceBidder{endpoint: server.URL}, server.Client(), "test", &metricsConf.DummyMetricsEngine{}, config.Adapter{})
+	request := &openrtb.BidRequest{
+		Test: 1,
+		Imp:  []openrtb.Imp{{ID: "stored-imp"}},
+	}
+
+	seatBid, errs := bidder.requestBid(context.Background(), request, "test", 1.0, currencies.NewConstantRates(), &adapters.ExtraRequestInfo{}, map[string]json.RawMessage{
+		"stored-imp": json.RawMessage("5"),
+	}, true)
+
+	assert.Empty(t, errs)
+	if assert.Len(t, seatBid.bids, 1) {
+		assert.Equal(t, 5.0, seatBid.bids[0].bid.Price)
+	}
+	if assert.Len(t, seatBid.httpCalls, 1, "Stored responses should show up in the debug output") {
+		assert.Equal(t, "5", seatBid.httpCalls[0].ResponseBody)
+	}
+}
+
+func TestHoldAuctionStoredAuctionResponse(t *testing.T) {
+	cfg := &config.Configuration{}
+	e := NewExchange(&http.Client{}, &mockCache{}, cfg, pbsmetrics.NewMetrics(metrics.NewRegistry(), openrtb_ext.BidderList(), config.DisabledMetrics{}), adapters.BidderInfos{}, gdpr.AlwaysAllow{}, currencies.NewRateConverterDefault(), nil, mockResponseFetcher{
+		"auction-response": json.RawMessage(`[{"seat": "appnexus", "bid": [{"id": "stored-bid", "impid": "anything", "price": 2.5, "adm": "<div>stored</div>"}]}]`),
+	}).(*exchange)
+	liveBidder := &recordingBidder{}
+	e.adapterMap = map[openrtb_ext.BidderName]adaptedBidder{openrtb_ext.BidderRubicon: liveBidder}
+
+	request := &openrtb.BidRequest{
+		ID:   "request-id",
+		Site: &openrtb.Site{Page: "www.some.domain.com"},
+		Imp: []openrtb.Imp{
+			{ID: "stored-imp", Banner: &openrtb.Banner{}, Ext: json.RawMessage(`{"prebid": {"storedauctionresponse": {"id": "auction-response"}}}`)},
+			{ID: "live-imp", Banner: &openrtb.Banner{}, Ext: json.RawMessage(`{"rubicon": {}}`)},
+		},
+	}
+
+	response, err := e.HoldAuction(context.Background(), request, &emptyUsersync{}, pbsmetrics.Labels{}, &config.Account{}, nil, nil)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, liveBidder.imps, 1, "Imps with stored auction responses shouldn't go to the bidders") {
+		assert.Equal(t, "live-imp", liveBidder.imps[0].ID)
+	}
+	if assert.Len(t, response.SeatBid, 1) && assert.Len(t, response.SeatBid[0].Bid, 1) {
+		assert.Equal(t, "appnexus", response.SeatBid[0].Seat)
+		assert.Equal(t, "stored-bid", response.SeatBid[0].Bid[0].ID)
+		assert.Equal(t, "stored-imp", response.SeatBid[0].Bid[0].ImpID)
+		assert.Equal(t, 2.5, response.SeatBid[0].Bid[0].Price)
+	}
+	assert.Len(t, request.Imp, 2, "The original request shouldn't be modified")
+}
+
+func TestFetchStoredResponsesNotFound(t *testing.T) {
+	e := &exchange{storedRespFetcher: mockResponseFetcher{}}
+	request := &openrtb.BidRequest{
+		Imp: []openrtb.Imp{
+			{ID: "imp", Ext: json.RawMessage(`{"prebid": {"storedbidresponse": [{"bidder": "appnexus", "id": "missing"}]}, "appnexus": {}}`)},
+		},
+	}
+
+	stored, errs := e.fetchStoredResponses(context.Background(), request)
+
+	assert.Len(t, errs, 1)
+	assert.Empty(t, stored.auction)
+	assert.Empty(t, stored.bid)
+}
+
+func TestValidateStoredBidResponses(t *testing.T) {
+	bidResponses := map[openrtb_ext.BidderName]map[string]json.RawMessage{
+		"appnexus": {"imp-1": json.RawMessage("{}"), "imp-2": json.RawMessage("{}")},
+		"rubicon":  {"imp-1": json.RawMessage("{}")},
+	}
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		"appnexus": {Imp: []openrtb.Imp{{ID: "imp-1"}}},
+	}
+
+	errs := validateStoredBidResponses(bidResponses, cleanRequests)
+
+	assert.Len(t, errs, 2)
+	assert.Equal(t, map[openrtb_ext.BidderName]map[string]json.RawMessage{
+		"appnexus": {"imp-1": json.RawMessage("{}")},
+		"rubicon":  {},
+	}, bidResponses)
+}
+
+func TestParseStoredAuctionResponse(t *testing.T) {
+	response, err := parseStoredAuctionResponse(json.RawMessage(` [{"seat": "appnexus", "bid": [{"id": "bid"}]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, storedAuctionResponse{SeatBid: []openrtb.SeatBid{{Seat: "appnexus", Bid: []openrtb.Bid{{ID: "bid"}}}}}, response, "Just the seatbid array")
+
+	response, err = parseStoredAuctionResponse(json.RawMessage(`{"cur": "EUR", "seatbid": [{"seat": "appnexus", "bid": [{"id": "bid"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, storedAuctionResponse{Cur: "EUR", SeatBid: []openrtb.SeatBid{{Seat: "appnexus", Bid: []openrtb.Bid{{ID: "bid"}}}}}, response, "An object with the currency")
+
+	_, err = parseStoredAuctionResponse(json.RawMessage(`"bad"`))
+	assert.Error(t, err)
+}
+
+func TestAddStoredAuctionBidsCurrency(t *testing.T) {
+	rates := currencies.NewRates(time.Now(), map[string]map[string]float64{
+		"EUR": {"USD": 1.2},
+	})
+	testCases := []struct {
+		description      string
+		storedCur        string
+		requestCur       []string
+		liveCur          string
+		expectedCur      string
+		expectedPrice    float64
+		expectedWarnings int
+	}{
+		{
+			description:   "No currencies defaults to USD",
+			expectedCur:   "USD",
+			expectedPrice: 2,
+		},
+		{
+			description:   "Stored currency is converted to the request's",
+			storedCur:     "EUR",
+			requestCur:    []string{"USD"},
+			expectedCur:   "USD",
+			expectedPrice: 2.4,
+		},
+		{
+			description:   "First request currency which can be converted to",
+			storedCur:     "EUR",
+			requestCur:    []string{"JPY", "EUR"},
+			expectedCur:   "EUR",
+			expectedPrice: 2,
+		},
+		{
+			description:   "Converted to the live bids' currency",
+			storedCur:     "EUR",
+			requestCur:    []string{"EUR", "USD"},
+			liveCur:       "USD",
+			expectedCur:   "USD",
+			expectedPrice: 2.4,
+		},
+		{
+			description:      "No rate",
+			storedCur:        "EUR",
+			requestCur:       []string{"JPY"},
+			expectedCur:      "JPY",
+			expectedWarnings: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		request := &openrtb.BidRequest{Cur: test.requestCur, Imp: []openrtb.Imp{{ID: "imp", Banner: &openrtb.Banner{}}}}
+		auctionResponses := map[string]storedAuctionResponse{
+			"imp": {Cur: test.storedCur, SeatBid: []openrtb.SeatBid{{Seat: "appnexus", Bid: []openrtb.Bid{{ID: "bid", Price: 2}}}}},
+		}
+		adapterBids := map[openrtb_ext.BidderName]*pbsOrtbSeatBid{}
+		if test.liveCur != "" {
+			adapterBids["appnexus"] = &pbsOrtbSeatBid{currency: test.liveCur}
+		}
+
+		_, found, errs := addStoredAuctionBids(request, auctionResponses, nil, adapterBids, map[openrtb_ext.BidderName]*seatResponseExtra{}, rates)
+
+		assert.Len(t, errs, test.expectedWarnings, test.description)
+		assert.Equal(t, test.expectedCur, adapterBids["appnexus"].currency, test.description)
+		if test.expectedWarnings > 0 {
+			assert.False(t, found, test.description)
+			assert.Empty(t, adapterBids["appnexus"].bids, test.description)
+		} else if assert.Len(t, adapterBids["appnexus"].bids, 1, test.description) {
+			assert.InDelta(t, test.expectedPrice, adapterBids["appnexus"].bids[0].bid.Price, 0.0001, test.description)
+		}
+	}
+}
+
+func TestStoredBidType(t *testing.T) {
+	videoImp := &openrtb.Imp{Video: &openrtb.Video{}}
+	assert.Equal(t, openrtb_ext.BidType("video"), storedBidType(&openrtb.Bid{}, videoImp))
+	assert.Equal(t, openrtb_ext.BidType("banner"), storedBidType(&openrtb.Bid{Ext: json.RawMessage(`{"prebid": {"type": "banner"}}`)}, videoImp))
+	assert.Equal(t, openrtb_ext.BidType("video"), storedBidType(&openrtb.Bid{Ext: json.RawMessage(`{"prebid": {"type": "bad"}}`)}, videoImp))
+}
+
+type mockResponseFetcher map[string]json.RawMessage
+
+func (f mockResponseFetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	var errs []error
+	for _, id := range ids {
+		if _, ok := f[id]; !ok {
+			errs = append(errs, stored_requests.NotFoundError{ID: id, DataType: "Response"})
+		}
+	}
+	return f, errs
+}
+
+// priceBidder sends one request per imp, and bids the price in the response body.
+type priceBidder struct {
+	endpoint string
+}
+
+func (bidder *priceBidder) MakeRequests(request *openrtb.BidRequest, reqInfo *adapters.ExtraRequestInfo) ([]*adapters.RequestData, []error) {
+	reqData := make([]*adapters.RequestData, 0, len(request.Imp))
+	for _, imp := range request.Imp {
+		reqData = append(reqData, &adapters.RequestData{
+			Method: "POST",
+			Uri:    bidder.endpoint,
+			Body:   []byte(imp.ID),
+		})
+	}
+	return reqData, nil
+}
+
+func (bidder *priceBidder) MakeBids(internalRequest *openrtb.BidRequest, externalRequest *adapters.RequestData, response *adapters.ResponseData) (*adapters.BidderResponse, []error) {
+	price, err := strconv.ParseFloat(string(response.Body), 64)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return &adapters.BidderResponse{
+		Bids: []*adapters.TypedBid{{
+			Bid:     &openrtb.Bid{ID: "bid", ImpID: string(externalRequest.Body), Price: price},
+			BidType: openrtb_ext.BidTypeBanner,
+		}},
+	}, nil
+}
+
+// recordingBidder remembers the imps it was asked to bid on, and never bids.
+type recordingBidder struct {
+	imps []openrtb.Imp
+}
+
+func (b *recordingBidder) requestBid(ctx context.Context, request *openrtb.BidRequest, name openrtb_ext.BidderName, bidAdjustment float64, conversions currencies.Conversions, reqInfo *adapters.ExtraRequestInfo, storedResponses map[string]json.RawMessage, debug bool) (*pbsOrtbSeatBid, []error) {
+	b.imps = append(b.imps, request.Imp...)
+	return &pbsOrtbSeatBid{}, nil
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/prebid/prebid-server/openrtb_ext"
 )
 
-const maxKeyLength = 20
+const maxKeyLength = openrtb_ext.MaxTargetingKeyLength
 
 // targetData tracks information about the winning Bid in each Imp.
 //
@@ -25,6 +25,8 @@ type targetData struct {
 	// cacheHost and cachePath exist to supply cache host and path as targeting parameters
 	cacheHost string
 	cachePath string
+	// multiBid holds the ext.prebid.multibid config for each bidder which has one.
+	multiBid map[openrtb_ext.BidderName]*openrtb_ext.ExtRequestPrebidMultiBid
 }
 
 // setTargeting writes all the targeting params into the bids.
@@ -36,45 +38,73 @@ type targetData struct {
 func (targData *targetData) setTargeting(auc *auction, isApp bool, categoryMapping map[string]string) {
 	for impId, topBidsPerImp := range auc.winningBidsByBidder {
 		overallWinner := auc.winningBids[impId]
-		for bidderName, topBidPerBidder := range topBidsPerImp {
-			isOverallWinner := overallWinner == topBidPerBidder
-
-			targets := make(map[string]string, 10)
-			if cpm, ok := auc.roundedPrices[topBidPerBidder]; ok {
-				targData.addKeys(targets, openrtb_ext.HbpbConstantKey, cpm, bidderName, isOverallWinner)
-			}
-			targData.addKeys(targets, openrtb_ext.HbBidderConstantKey, string(bidderName), bidderName, isOverallWinner)
-			if hbSize := makeHbSize(topBidPerBidder.bid); hbSize != "" {
-				targData.addKeys(targets, openrtb_ext.HbSizeConstantKey, hbSize, bidderName, isOverallWinner)
-			}
-			if cacheID, ok := auc.cacheIds[topBidPerBidder.bid]; ok {
-				targData.addKeys(targets, openrtb_ext.HbCacheKey, cacheID, bidderName, isOverallWinner)
-			}
-			if vastID, ok := auc.vastCacheIds[topBidPerBidder.bid]; ok {
-				targData.addKeys(targets, openrtb_ext.HbVastCacheKey, vastID, bidderName, isOverallWinner)
+		for bidderName, topBidsPerBidder := range topBidsPerImp {
+			for index, topBid := range topBidsPerBidder {
+				targetBidder, ok := targData.targetBidder(bidderName, index)
+				if !ok {
+					continue
+				}
+				topBid.bidTargets = targData.makeTargets(auc, topBid, targetBidder, overallWinner == topBid, isApp, categoryMapping)
 			}
+		}
+	}
+}
 
-			if targData.cacheHost != "" {
-				targData.addKeys(targets, openrtb_ext.HbConstantCacheHostKey, targData.cacheHost, bidderName, isOverallWinner)
-			}
-			if targData.cachePath != "" {
-				targData.addKeys(targets, openrtb_ext.HbConstantCachePathKey, targData.cachePath, bidderName, isOverallWinner)
-			}
+func (targData *targetData) makeTargets(auc *auction, topBid *pbsOrtbBid, bidderName openrtb_ext.BidderName, isOverallWinner bool, isApp bool, categoryMapping map[string]string) map[string]string {
+	targets := make(map[string]string, 10)
+	if cpm, ok := auc.roundedPrices[topBid]; ok {
+		targData.addKeys(targets, openrtb_ext.HbpbConstantKey, cpm, bidderName, isOverallWinner)
+	}
+	targData.addKeys(targets, openrtb_ext.HbBidderConstantKey, string(bidderName), bidderName, isOverallWinner)
+	if hbSize := makeHbSize(topBid.bid); hbSize != "" {
+		targData.addKeys(targets, openrtb_ext.HbSizeConstantKey, hbSize, bidderName, isOverallWinner)
+	}
+	if cacheID, ok := auc.cacheIds[topBid.bid]; ok {
+		targData.addKeys(targets, openrtb_ext.HbCacheKey, cacheID, bidderName, isOverallWinner)
+	}
+	if vastID, ok := auc.vastCacheIds[topBid.bid]; ok {
+		targData.addKeys(targets, openrtb_ext.HbVastCacheKey, vastID, bidderName, isOverallWinner)
+	}
 
-			if deal := topBidPerBidder.bid.DealID; len(deal) > 0 {
-				targData.addKeys(targets, openrtb_ext.HbDealIDConstantKey, deal, bidderName, isOverallWinner)
-			}
+	if targData.cacheHost != "" {
+		targData.addKeys(targets, openrtb_ext.HbConstantCacheHostKey, targData.cacheHost, bidderName, isOverallWinner)
+	}
+	if targData.cachePath != "" {
+		targData.addKeys(targets, openrtb_ext.HbConstantCachePathKey, targData.cachePath, bidderName, isOverallWinner)
+	}
 
-			if isApp {
-				targData.addKeys(targets, openrtb_ext.HbEnvKey, openrtb_ext.HbEnvKeyApp, bidderName, isOverallWinner)
-			}
-			if len(categoryMapping) > 0 {
-				targData.addKeys(targets, openrtb_ext.HbCategoryDurationKey, categoryMapping[topBidPerBidder.bid.ID], bidderName, isOverallWinner)
-			}
+	if deal := topBid.bid.DealID; len(deal) > 0 {
+		targData.addKeys(targets, openrtb_ext.HbDealIDConstantKey, deal, bidderName, isOverallWinner)
+	}
 
-			topBidPerBidder.bidTargets = targets
-		}
+	if isApp {
+		targData.addKeys(targets, openrtb_ext.HbEnvKey, openrtb_ext.HbEnvKeyApp, bidderName, isOverallWinner)
+	}
+	if len(categoryMapping) > 0 {
+		targData.addKeys(targets, openrtb_ext.HbCategoryDurationKey, categoryMapping[topBid.bid.ID], bidderName, isOverallWinner)
+	}
+	return targets
+}
+
+// targetBidder returns the bidder code which the bidder's bid at the index gets its targeting keys under.
+// Extra bids from ext.prebid.multibid only get targeting if they have a bidder code prefix, so it returns
+// false for the ones which don't.
+func (targData *targetData) targetBidder(bidderName openrtb_ext.BidderName, index int) (openrtb_ext.BidderName, bool) {
+	if index == 0 {
+		return bidderName, true
 	}
+	prefix := targData.multiBidPrefix(bidderName)
+	if prefix == "" {
+		return "", false
+	}
+	return openrtb_ext.BidderName(prefix + strconv.Itoa(index+1)), true
+}
+
+func (targData *targetData) multiBidPrefix(bidderName openrtb_ext.BidderName) string {
+	if thisMultiBid, ok := targData.multiBid[bidderName]; ok {
+		return thisMultiBid.TargetBidderCodePrefix
+	}
+	return ""
 }
 
 func (targData *targetData) addKeys(keys map[string]string, key openrtb_ext.TargetingKey, value string, bidderName openrtb_ext.BidderName, overallWinner bool) {
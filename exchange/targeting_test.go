@@ -17,6 +17,7 @@ import (
 
 	"github.com/mxmCherry/openrtb"
 	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/stretchr/testify/assert"
 )
@@ -66,6 +67,52 @@ func TestTargetingCache(t *testing.T) {
 
 }
 
+func TestTargetingMultiBid(t *testing.T) {
+	bids := []*pbsOrtbBid{
+		{bid: &openrtb.Bid{ID: "apn-1", ImpID: "some-imp", Price: 3, W: 300, H: 250}},
+		{bid: &openrtb.Bid{ID: "apn-2", ImpID: "some-imp", Price: 2, DealID: "some-deal"}},
+		{bid: &openrtb.Bid{ID: "apn-3", ImpID: "some-imp", Price: 1}},
+	}
+	rubiconBids := []*pbsOrtbBid{
+		{bid: &openrtb.Bid{ID: "rubicon-1", ImpID: "some-imp", Price: 2.5}},
+		{bid: &openrtb.Bid{ID: "rubicon-2", ImpID: "some-imp", Price: 1.5}},
+	}
+	multiBid := getMultiBid([]*openrtb_ext.ExtRequestPrebidMultiBid{
+		{Bidder: "appnexus", MaxBids: 2, TargetBidderCodePrefix: "apn"},
+		{Bidder: "rubicon", MaxBids: 2},
+	})
+	auc := newAuction(map[openrtb_ext.BidderName]*pbsOrtbSeatBid{
+		openrtb_ext.BidderAppnexus: {bids: bids},
+		openrtb_ext.BidderRubicon:  {bids: rubiconBids},
+	}, 1, multiBid)
+	targData := &targetData{
+		priceGranularity:  openrtb_ext.PriceGranularity{Precision: 2, Ranges: []openrtb_ext.GranularityRange{{Min: 0, Max: 20, Increment: 0.1}}},
+		includeWinners:    true,
+		includeBidderKeys: true,
+		multiBid:          multiBid,
+	}
+	auc.setRoundedPrices(targData.priceGranularity)
+
+	targData.setTargeting(auc, false, nil)
+
+	assert.Equal(t, map[string]string{
+		"hb_pb":              "3.00",
+		"hb_bidder":          "appnexus",
+		"hb_size":            "300x250",
+		"hb_pb_appnexus":     "3.00",
+		"hb_bidder_appnexus": "appnexus",
+		"hb_size_appnexus":   "300x250",
+	}, bids[0].bidTargets)
+	assert.Equal(t, map[string]string{
+		"hb_pb_apn2":     "2.00",
+		"hb_bidder_apn2": "apn2",
+		"hb_deal_apn2":   "some-deal",
+	}, bids[1].bidTargets, "The second bid should use the bidder code prefix")
+	assert.Nil(t, bids[2].bidTargets, "Bids over maxbids shouldn't get targeting")
+	assert.Equal(t, "2.50", rubiconBids[0].bidTargets["hb_pb_rubicon"])
+	assert.Nil(t, rubiconBids[1].bidTargets, "Extra bids without a bidder code prefix shouldn't get targeting")
+}
+
 func assertKeyExists(t *testing.T, bid *openrtb.Bid, key string, expected bool) {
 	t.Helper()
 	targets := parseTargets(t, bid)
@@ -106,7 +153,7 @@ func runTargetingAuction(t *testing.T, mockBids map[openrtb_ext.BidderName][]*op
 	if error != nil {
 		t.Errorf("Failed to create a category Fetcher: %v", error)
 	}
-	bidResp, err := ex.HoldAuction(context.Background(), req, &mockFetcher{}, pbsmetrics.Labels{}, &categoriesFetcher)
+	bidResp, err := ex.HoldAuction(context.Background(), req, &mockFetcher{}, pbsmetrics.Labels{}, &config.Account{}, &categoriesFetcher, nil)
 
 	if err != nil {
 		t.Fatalf("Unexpected errors running auction: %v", err)
@@ -132,7 +179,7 @@ func buildAdapterMap(bids map[openrtb_ext.BidderName][]*openrtb.Bid, mockServerU
 		adapterMap[bidder] = adaptBidder(&mockTargetingBidder{
 			mockServerURL: mockServerURL,
 			bids:          bids,
-		}, client)
+		}, client, bidder, &metricsConf.DummyMetricsEngine{}, config.Adapter{})
 	}
 	return adapterMap
 }
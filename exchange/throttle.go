@@ -0,0 +1,177 @@
+package exchange
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// maxAccountBuckets is the number of per-account token buckets which are kept. Once there are this many, the bucket
+// which was used least recently is dropped to make room for a new one.
+const maxAccountBuckets = 10000
+
+// bidderThrottle caps the rate of requests which are sent to each bidder, using the limits in adapters.{bidder}.throttle.
+//
+// All functions on this struct are nil-safe. A nil bidderThrottle means that no bidder has a limit.
+type bidderThrottle struct {
+	bidders map[openrtb_ext.BidderName]*tokenBucket
+	// accountLimits are the limits for each account's requests to a bidder. The buckets for them are made as needed.
+	accountLimits map[openrtb_ext.BidderName]config.AdapterThrottle
+
+	accountsLock sync.Mutex
+	accounts     map[accountBidder]*list.Element
+	// accountsLRU holds the accountBuckets, most recently used first.
+	accountsLRU *list.List
+	maxAccounts int
+
+	now func() time.Time
+}
+
+type accountBidder struct {
+	accountID string
+	bidder    openrtb_ext.BidderName
+}
+
+type accountBucket struct {
+	key    accountBidder
+	bucket *tokenBucket
+}
+
+// newBidderThrottle returns nil if none of the bidders have a limit.
+func newBidderThrottle(adapters map[string]config.Adapter, bidders []openrtb_ext.BidderName) *bidderThrottle {
+	throttle := &bidderThrottle{
+		bidders:       make(map[openrtb_ext.BidderName]*tokenBucket),
+		accountLimits: make(map[openrtb_ext.BidderName]config.AdapterThrottle),
+		accounts:      make(map[accountBidder]*list.Element),
+		accountsLRU:   list.New(),
+		maxAccounts:   maxAccountBuckets,
+		now:           time.Now,
+	}
+	for _, bidder := range bidders {
+		limits := adapters[strings.ToLower(string(bidder))].Throttle
+		if limits.QPS > 0 {
+			throttle.bidders[bidder] = newTokenBucket(limits.QPS, limits.Burst, throttle.now())
+		}
+		if limits.AccountQPS > 0 {
+			throttle.accountLimits[bidder] = limits
+		}
+	}
+	if len(throttle.bidders) == 0 && len(throttle.accountLimits) == 0 {
+		return nil
+	}
+	return throttle
+}
+
+// allow returns a BidderThrottled error if the request from the account can't be sent to the bidder right now.
+//
+// The account's limit is checked first, so that an account which is over its own limit doesn't use up the
+// requests which the other accounts could send. If the bidder's limit then turns the request away, the account's
+// token is given back, since the request was never sent.
+func (t *bidderThrottle) allow(bidder openrtb_ext.BidderName, accountID string) error {
+	if t == nil {
+		return nil
+	}
+	now := t.now()
+	accountBucket, ok := t.allowAccount(bidder, accountID, now)
+	if !ok {
+		return &errortypes.BidderThrottled{
+			Message: fmt.Sprintf("Bidder %s was skipped because account %s is over its limit of %g requests per second to it.", bidder, accountID, t.accountLimits[bidder].AccountQPS),
+		}
+	}
+	if bucket, ok := t.bidders[bidder]; ok && !bucket.take(now) {
+		if accountBucket != nil {
+			accountBucket.giveBack()
+		}
+		return &errortypes.BidderThrottled{
+			Message: fmt.Sprintf("Bidder %s was skipped because it's over its limit of %g requests per second.", bidder, bucket.rate),
+		}
+	}
+	return nil
+}
+
+// allowAccount takes a token from the account's bucket for the bidder. It returns a nil bucket if the bidder has
+// no per-account limit.
+func (t *bidderThrottle) allowAccount(bidder openrtb_ext.BidderName, accountID string, now time.Time) (*tokenBucket, bool) {
+	limits, ok := t.accountLimits[bidder]
+	if !ok {
+		return nil, true
+	}
+	bucket := t.accountBucket(accountBidder{accountID: accountID, bidder: bidder}, limits, now)
+	return bucket, bucket.take(now)
+}
+
+// accountBucket finds or makes the bucket for the key, and marks it as the most recently used one.
+func (t *bidderThrottle) accountBucket(key accountBidder, limits config.AdapterThrottle, now time.Time) *tokenBucket {
+	t.accountsLock.Lock()
+	defer t.accountsLock.Unlock()
+
+	if elem, ok := t.accounts[key]; ok {
+		t.accountsLRU.MoveToFront(elem)
+		return elem.Value.(*accountBucket).bucket
+	}
+	for t.accountsLRU.Len() >= t.maxAccounts {
+		oldest := t.accountsLRU.Back()
+		t.accountsLRU.Remove(oldest)
+		delete(t.accounts, oldest.Value.(*accountBucket).key)
+	}
+	bucket := newTokenBucket(limits.AccountQPS, limits.AccountBurst, now)
+	t.accounts[key] = t.accountsLRU.PushFront(&accountBucket{key: key, bucket: bucket})
+	return bucket
+}
+
+// tokenBucket allows requests at a steady rate, with bursts of up to its capacity.
+type tokenBucket struct {
+	lock     sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket which refills at qps tokens per second. If burst isn't positive, the bucket
+// holds one second's worth of tokens.
+func newTokenBucket(qps float64, burst int, now time.Time) *tokenBucket {
+	capacity := float64(burst)
+	if burst <= 0 {
+		capacity = math.Max(1, math.Ceil(qps))
+	}
+	return &tokenBucket{
+		rate:     qps,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     now,
+	}
+}
+
+// take removes a token from the bucket, and returns false if there wasn't one.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// giveBack returns a token which was taken for a request that wasn't sent after all.
+func (b *tokenBucket) giveBack() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens = math.Min(b.capacity, b.tokens+1)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
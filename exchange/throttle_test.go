@@ -0,0 +1,232 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/modules"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNewBidderThrottle(t *testing.T) {
+	bidders := []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus, openrtb_ext.BidderRubicon}
+
+	assert.Nil(t, newBidderThrottle(map[string]config.Adapter{"appnexus": {}}, bidders), "No limits")
+
+	throttle := newBidderThrottle(map[string]config.Adapter{
+		"appnexus": {Throttle: config.AdapterThrottle{QPS: 10}},
+		"rubicon":  {Throttle: config.AdapterThrottle{AccountQPS: 5}},
+	}, bidders)
+	if assert.NotNil(t, throttle, "Limits") {
+		assert.Contains(t, throttle.bidders, openrtb_ext.BidderAppnexus)
+		assert.NotContains(t, throttle.bidders, openrtb_ext.BidderRubicon)
+		assert.NotContains(t, throttle.accountLimits, openrtb_ext.BidderAppnexus)
+		assert.Contains(t, throttle.accountLimits, openrtb_ext.BidderRubicon)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bucket := newTokenBucket(2, 3, start)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.take(start), "Burst request %d", i)
+	}
+	assert.False(t, bucket.take(start), "Over the burst")
+	assert.False(t, bucket.take(start.Add(400*time.Millisecond)), "Not refilled yet")
+	assert.True(t, bucket.take(start.Add(500*time.Millisecond)), "Refilled one token")
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.take(start.Add(10*time.Second)), "Refills up to the burst, request %d", i)
+	}
+	assert.False(t, bucket.take(start.Add(10*time.Second)), "But no further")
+}
+
+func TestTokenBucketGiveBack(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bucket := newTokenBucket(1, 1, start)
+
+	assert.True(t, bucket.take(start))
+	bucket.giveBack()
+	assert.True(t, bucket.take(start), "The token was given back")
+	bucket.giveBack()
+	bucket.giveBack()
+	assert.Equal(t, float64(1), bucket.tokens, "Never more than the burst")
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	start := time.Unix(1000, 0)
+	assert.Equal(t, float64(3), newTokenBucket(2.5, 0, start).capacity, "One second's worth of requests")
+	assert.Equal(t, float64(1), newTokenBucket(0.1, 0, start).capacity, "At least one request")
+}
+
+func TestBidderThrottleAllow(t *testing.T) {
+	throttle := newBidderThrottle(map[string]config.Adapter{
+		"appnexus": {Throttle: config.AdapterThrottle{QPS: 1, Burst: 3, AccountQPS: 1, AccountBurst: 2}},
+	}, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus, openrtb_ext.BidderRubicon})
+	// The buckets were filled when the throttle was made, so the clock has to start after that.
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"))
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"))
+	err := throttle.allow(openrtb_ext.BidderAppnexus, "acct-1")
+	assert.IsType(t, &errortypes.BidderThrottled{}, err, "Over the account's limit")
+	assert.EqualError(t, err, "Bidder appnexus was skipped because account acct-1 is over its limit of 1 requests per second to it.")
+
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-2"))
+	err = throttle.allow(openrtb_ext.BidderAppnexus, "acct-3")
+	assert.IsType(t, &errortypes.BidderThrottled{}, err, "Over the bidder's limit")
+	assert.EqualError(t, err, "Bidder appnexus was skipped because it's over its limit of 1 requests per second.")
+
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderRubicon, "acct-1"), "Bidders without limits")
+
+	now = now.Add(time.Second)
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"), "Refilled")
+}
+
+func TestBidderThrottleNil(t *testing.T) {
+	var throttle *bidderThrottle
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"))
+}
+
+func TestBidderThrottleRefundsAccount(t *testing.T) {
+	throttle := newBidderThrottle(map[string]config.Adapter{
+		"appnexus": {Throttle: config.AdapterThrottle{QPS: 1, Burst: 1, AccountQPS: 1, AccountBurst: 1}},
+	}, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus})
+	// The buckets were filled when the throttle was made, so the clock has to start after that.
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"))
+	err := throttle.allow(openrtb_ext.BidderAppnexus, "acct-2")
+	assert.EqualError(t, err, "Bidder appnexus was skipped because it's over its limit of 1 requests per second.")
+
+	acct2 := throttle.accounts[accountBidder{accountID: "acct-2", bidder: openrtb_ext.BidderAppnexus}].Value.(*accountBucket).bucket
+	assert.Equal(t, float64(1), acct2.tokens, "acct-2 never sent a request, so it keeps its token")
+}
+
+func TestBidderThrottleEvictsLeastRecentlyUsed(t *testing.T) {
+	throttle := newBidderThrottle(map[string]config.Adapter{
+		"appnexus": {Throttle: config.AdapterThrottle{AccountQPS: 1}},
+	}, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus})
+	throttle.maxAccounts = 2
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"))
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-2"))
+	assert.Error(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"), "acct-1 is now the most recently used")
+	assert.NoError(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-3"))
+
+	assert.Len(t, throttle.accounts, 2)
+	assert.Equal(t, 2, throttle.accountsLRU.Len())
+	assert.NotContains(t, throttle.accounts, accountBidder{accountID: "acct-2", bidder: openrtb_ext.BidderAppnexus})
+	assert.Error(t, throttle.allow(openrtb_ext.BidderAppnexus, "acct-1"), "acct-1 kept its bucket")
+}
+
+func TestGetAllBidsThrottled(t *testing.T) {
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterRequest", pbsmetrics.AdapterLabels{
+		Adapter:       openrtb_ext.BidderAppnexus,
+		AdapterErrors: map[pbsmetrics.AdapterError]struct{}{pbsmetrics.AdapterErrorThrottled: {}},
+	}).Once()
+
+	e := &exchange{
+		adapterMap: map[openrtb_ext.BidderName]adaptedBidder{
+			openrtb_ext.BidderAppnexus: &mockAdaptedBidder{},
+		},
+		me: metricsMock,
+		throttle: &bidderThrottle{
+			bidders: map[openrtb_ext.BidderName]*tokenBucket{
+				openrtb_ext.BidderAppnexus: newTokenBucket(1, 1, time.Now().Add(time.Hour)),
+			},
+			now: time.Now,
+		},
+	}
+	e.throttle.bidders[openrtb_ext.BidderAppnexus].tokens = 0
+
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		openrtb_ext.BidderAppnexus: {ID: "request"},
+	}
+	blabels := map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{
+		openrtb_ext.BidderAppnexus: {Adapter: openrtb_ext.BidderAppnexus},
+	}
+	adapterBids, adapterExtra, bidsFound := e.getAllBids(context.Background(), cleanRequests, nil, nil, blabels, nil, nil, config.BidValidationSkip, "acct-1", nil, false)
+
+	assert.False(t, bidsFound)
+	assert.Nil(t, adapterBids[openrtb_ext.BidderAppnexus])
+	if assert.Len(t, adapterExtra[openrtb_ext.BidderAppnexus].Errors, 1) {
+		assert.Equal(t, errortypes.BidderThrottledCode, adapterExtra[openrtb_ext.BidderAppnexus].Errors[0].Code)
+	}
+	metricsMock.AssertExpectations(t)
+	metricsMock.AssertNotCalled(t, "RecordAdapterTime", mock.Anything, mock.Anything)
+}
+
+func TestGetAllBidsModuleRejectedKeepsToken(t *testing.T) {
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterRequest", pbsmetrics.AdapterLabels{
+		Adapter:       openrtb_ext.BidderAppnexus,
+		AdapterErrors: map[pbsmetrics.AdapterError]struct{}{pbsmetrics.AdapterErrorModuleRejected: {}},
+	}).Once()
+
+	registry, err := modules.NewRegistry(config.Hooks{
+		Enabled:          true,
+		DefaultTimeoutMS: 20,
+		Modules:          map[string]map[string]interface{}{"acme_reject": {}},
+		ExecutionPlan: config.HookExecutionPlan{
+			Endpoints: map[string]config.HookEndpointPlan{
+				modules.EndpointAuction: {Stages: map[string][]config.HookInvocation{
+					string(modules.StageBidderRequest): {{Module: "acme_reject"}},
+				}},
+			},
+		},
+	}, map[string]modules.ModuleBuilder{
+		"acme_reject": func(cfg json.RawMessage) (interface{}, error) { return rejectBidderModule{}, nil },
+	})
+	if !assert.NoError(t, err, "Registry") {
+		return
+	}
+
+	e := &exchange{
+		adapterMap: map[openrtb_ext.BidderName]adaptedBidder{
+			openrtb_ext.BidderAppnexus: &mockAdaptedBidder{},
+		},
+		me: metricsMock,
+		throttle: &bidderThrottle{
+			bidders: map[openrtb_ext.BidderName]*tokenBucket{
+				openrtb_ext.BidderAppnexus: newTokenBucket(1, 1, time.Now().Add(time.Hour)),
+			},
+			now: time.Now,
+		},
+	}
+
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		openrtb_ext.BidderAppnexus: {ID: "request"},
+	}
+	blabels := map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{
+		openrtb_ext.BidderAppnexus: {Adapter: openrtb_ext.BidderAppnexus},
+	}
+	_, adapterExtra, bidsFound := e.getAllBids(context.Background(), cleanRequests, nil, nil, blabels, nil, nil, config.BidValidationSkip, "acct-1", registry.NewExecutor(modules.EndpointAuction), false)
+
+	assert.False(t, bidsFound)
+	if assert.Len(t, adapterExtra[openrtb_ext.BidderAppnexus].Errors, 1) {
+		assert.Equal(t, errortypes.ModuleRejectedCode, adapterExtra[openrtb_ext.BidderAppnexus].Errors[0].Code)
+	}
+	assert.Equal(t, 1.0, e.throttle.bidders[openrtb_ext.BidderAppnexus].tokens, "The rejected bidder shouldn't use up a token")
+	metricsMock.AssertExpectations(t)
+}
+
+// rejectBidderModule rejects every bidder.
+type rejectBidderModule struct{}
+
+func (m rejectBidderModule) HandleBidderRequestHook(ctx context.Context, invocation modules.InvocationContext, payload modules.BidderRequestPayload) (modules.BidderRequestPayload, modules.HookResult, error) {
+	return payload, modules.HookResult{Reject: true, Message: "not today"}, nil
+}
@@ -0,0 +1,193 @@
+package exchange
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+)
+
+// maxShapingKeys is the number of bid histories which the trafficShaper keeps. Once it's full, requests for
+// inventory without a history are always sent.
+const maxShapingKeys = 100000
+
+// trafficShaper skips the bidders which rarely bid on the request's inventory, using the settings in traffic_shaping.
+//
+// All functions on this struct are nil-safe. A nil trafficShaper means that traffic shaping is disabled.
+type trafficShaper struct {
+	minBidRate     float64
+	exploreRate    float64
+	minRequests    int
+	windowRequests int
+
+	lock    sync.Mutex
+	history map[shapingKey]*bidHistory
+
+	// random returns a number in [0, 1). It decides which of the requests under the threshold are sent.
+	random func() float64
+}
+
+// shapingKey identifies the inventory which a bidder's bid rate is tracked for.
+type shapingKey struct {
+	bidder    openrtb_ext.BidderName
+	inventory string
+	mediaType string
+	country   string
+}
+
+type bidHistory struct {
+	requests int
+	bids     int
+}
+
+// newTrafficShaper returns nil if traffic shaping is disabled.
+func newTrafficShaper(cfg config.TrafficShaping) *trafficShaper {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &trafficShaper{
+		minBidRate:     cfg.MinBidRate,
+		exploreRate:    cfg.ExplorePercent / 100,
+		minRequests:    cfg.MinRequests,
+		windowRequests: cfg.WindowRequests,
+		history:        make(map[shapingKey]*bidHistory),
+		random:         rand.Float64,
+	}
+}
+
+// shape removes the requests which aren't worth sending from cleanRequests. A bidder whose bid rate for the
+// inventory is under the threshold gets the request with a chance in proportion to its bid rate, but never
+// less than the exploration rate. Bidders with stored bid responses are left alone, since they don't cost a request.
+//
+// It returns the decisions for the bidders which were under the threshold, for response.ext.debug.trafficshaping.
+func (s *trafficShaper) shape(cleanRequests map[openrtb_ext.BidderName]*openrtb.BidRequest, aliases map[string]string, storedBidResponses map[openrtb_ext.BidderName]map[string]json.RawMessage, me pbsmetrics.MetricsEngine) map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping {
+	if s == nil {
+		return nil
+	}
+	var decisions map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping
+	for bidder, req := range cleanRequests {
+		if len(storedBidResponses[bidder]) > 0 {
+			continue
+		}
+		key, ok := newShapingKey(bidder, req)
+		if !ok {
+			continue
+		}
+		requests, bidRate, ok := s.bidRate(key)
+		if !ok || bidRate >= s.minBidRate {
+			continue
+		}
+		decision := openrtb_ext.ExtTrafficShaping{
+			Inventory: key.inventory,
+			MediaType: key.mediaType,
+			Country:   key.country,
+			Requests:  requests,
+			BidRate:   bidRate,
+			SendRate:  math.Max(s.exploreRate, bidRate/s.minBidRate),
+		}
+		if s.random() >= decision.SendRate {
+			decision.Skipped = true
+			delete(cleanRequests, bidder)
+			me.RecordAdapterRequestShaped(resolveBidder(string(bidder), aliases))
+		}
+		if decisions == nil {
+			decisions = make(map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping)
+		}
+		decisions[bidder] = decision
+	}
+	return decisions
+}
+
+// bidRate returns the bidder's history for the inventory. It returns false if there isn't enough history to trust.
+func (s *trafficShaper) bidRate(key shapingKey) (int, float64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	history, ok := s.history[key]
+	if !ok || history.requests == 0 || history.requests < s.minRequests {
+		return 0, 0, false
+	}
+	return history.requests, float64(history.bids) / float64(history.requests), true
+}
+
+// record adds a request which was sent to the bidder to its history, along with whether the bidder bid on it.
+func (s *trafficShaper) record(bidder openrtb_ext.BidderName, req *openrtb.BidRequest, gotBids bool) {
+	if s == nil {
+		return
+	}
+	key, ok := newShapingKey(bidder, req)
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	history, ok := s.history[key]
+	if !ok {
+		if len(s.history) >= maxShapingKeys {
+			return
+		}
+		history = new(bidHistory)
+		s.history[key] = history
+	}
+	history.requests++
+	if gotBids {
+		history.bids++
+	}
+	if s.windowRequests > 0 && history.requests >= s.windowRequests {
+		history.requests /= 2
+		history.bids /= 2
+	}
+}
+
+// newShapingKey returns false if the request doesn't have a site domain or an app bundle to track.
+func newShapingKey(bidder openrtb_ext.BidderName, req *openrtb.BidRequest) (shapingKey, bool) {
+	key := shapingKey{
+		bidder:    bidder,
+		mediaType: requestMediaTypes(req.Imp),
+	}
+	switch {
+	case req.Site != nil && req.Site.Domain != "":
+		key.inventory = "site:" + req.Site.Domain
+	case req.App != nil && req.App.Bundle != "":
+		key.inventory = "app:" + req.App.Bundle
+	default:
+		return key, false
+	}
+	if req.Device != nil && req.Device.Geo != nil && req.Device.Geo.Country != "" {
+		key.country = req.Device.Geo.Country
+	} else if req.User != nil && req.User.Geo != nil {
+		key.country = req.User.Geo.Country
+	}
+	return key, true
+}
+
+// requestMediaTypes returns the media types which the imps ask for, like "banner" or "banner+video".
+func requestMediaTypes(imps []openrtb.Imp) string {
+	var banner, video, audio, native bool
+	for _, imp := range imps {
+		banner = banner || imp.Banner != nil
+		video = video || imp.Video != nil
+		audio = audio || imp.Audio != nil
+		native = native || imp.Native != nil
+	}
+	types := make([]string, 0, 4)
+	if banner {
+		types = append(types, string(openrtb_ext.BidTypeBanner))
+	}
+	if video {
+		types = append(types, string(openrtb_ext.BidTypeVideo))
+	}
+	if audio {
+		types = append(types, string(openrtb_ext.BidTypeAudio))
+	}
+	if native {
+		types = append(types, string(openrtb_ext.BidTypeNative))
+	}
+	return strings.Join(types, "+")
+}
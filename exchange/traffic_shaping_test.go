@@ -0,0 +1,200 @@
+package exchange
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTrafficShaper(t *testing.T) {
+	assert.Nil(t, newTrafficShaper(config.TrafficShaping{MinBidRate: 0.1}), "Disabled")
+
+	shaper := newTrafficShaper(config.TrafficShaping{Enabled: true, MinBidRate: 0.1, ExplorePercent: 5, MinRequests: 10, WindowRequests: 100})
+	if assert.NotNil(t, shaper, "Enabled") {
+		assert.Equal(t, 0.1, shaper.minBidRate)
+		assert.Equal(t, 0.05, shaper.exploreRate)
+		assert.Equal(t, 10, shaper.minRequests)
+		assert.Equal(t, 100, shaper.windowRequests)
+	}
+}
+
+func TestTrafficShaperNil(t *testing.T) {
+	var shaper *trafficShaper
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		openrtb_ext.BidderAppnexus: newShapingRequest(),
+	}
+	shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), false)
+	assert.Nil(t, shaper.shape(cleanRequests, nil, nil, &pbsmetrics.MetricsEngineMock{}))
+	assert.Len(t, cleanRequests, 1)
+}
+
+func TestTrafficShaping(t *testing.T) {
+	testCases := []struct {
+		description string
+		requests    int
+		bids        int
+		random      float64
+		expected    *openrtb_ext.ExtTrafficShaping
+	}{
+		{
+			description: "Not enough history",
+			requests:    9,
+		},
+		{
+			description: "Bid rate at the threshold",
+			requests:    10,
+			bids:        1,
+		},
+		{
+			description: "Sent with the chance of the bid rate over the threshold",
+			requests:    20,
+			bids:        1,
+			random:      0.49,
+			expected:    &openrtb_ext.ExtTrafficShaping{Requests: 20, BidRate: 0.05, SendRate: 0.5},
+		},
+		{
+			description: "Skipped with the chance of the bid rate over the threshold",
+			requests:    20,
+			bids:        1,
+			random:      0.5,
+			expected:    &openrtb_ext.ExtTrafficShaping{Requests: 20, BidRate: 0.05, SendRate: 0.5, Skipped: true},
+		},
+		{
+			description: "Explored when the bidder never bids",
+			requests:    50,
+			random:      0.01,
+			expected:    &openrtb_ext.ExtTrafficShaping{Requests: 50, SendRate: 0.02},
+		},
+		{
+			description: "Skipped when the bidder never bids",
+			requests:    50,
+			random:      0.02,
+			expected:    &openrtb_ext.ExtTrafficShaping{Requests: 50, SendRate: 0.02, Skipped: true},
+		},
+	}
+
+	for _, test := range testCases {
+		shaper := newTrafficShaper(config.TrafficShaping{Enabled: true, MinBidRate: 0.1, ExplorePercent: 2, MinRequests: 10})
+		random := test.random
+		shaper.random = func() float64 { return random }
+		for i := 0; i < test.requests; i++ {
+			shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), i < test.bids)
+		}
+
+		metricsMock := &pbsmetrics.MetricsEngineMock{}
+		metricsMock.On("RecordAdapterRequestShaped", openrtb_ext.BidderAppnexus).Once()
+		cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+			openrtb_ext.BidderAppnexus: newShapingRequest(),
+		}
+		decisions := shaper.shape(cleanRequests, nil, nil, metricsMock)
+
+		if test.expected == nil {
+			assert.Empty(t, decisions, test.description)
+			assert.Len(t, cleanRequests, 1, test.description)
+			continue
+		}
+		test.expected.Inventory = "site:example.com"
+		test.expected.MediaType = "banner+video"
+		test.expected.Country = "USA"
+		assert.Equal(t, map[openrtb_ext.BidderName]openrtb_ext.ExtTrafficShaping{openrtb_ext.BidderAppnexus: *test.expected}, decisions, test.description)
+		if test.expected.Skipped {
+			assert.Empty(t, cleanRequests, test.description)
+			metricsMock.AssertExpectations(t)
+		} else {
+			assert.Len(t, cleanRequests, 1, test.description)
+			metricsMock.AssertNotCalled(t, "RecordAdapterRequestShaped", openrtb_ext.BidderAppnexus)
+		}
+	}
+}
+
+func TestTrafficShapingAliasesAndStoredResponses(t *testing.T) {
+	shaper := newTrafficShaper(config.TrafficShaping{Enabled: true, MinBidRate: 0.1, MinRequests: 1})
+	shaper.random = func() float64 { return 0.5 }
+	shaper.record("districtm", newShapingRequest(), false)
+	shaper.record(openrtb_ext.BidderRubicon, newShapingRequest(), false)
+
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterRequestShaped", openrtb_ext.BidderAppnexus).Once()
+	cleanRequests := map[openrtb_ext.BidderName]*openrtb.BidRequest{
+		"districtm":               newShapingRequest(),
+		openrtb_ext.BidderRubicon: newShapingRequest(),
+	}
+	storedBidResponses := map[openrtb_ext.BidderName]map[string]json.RawMessage{
+		openrtb_ext.BidderRubicon: {"imp-1": json.RawMessage(`[]`)},
+	}
+	decisions := shaper.shape(cleanRequests, map[string]string{"districtm": "appnexus"}, storedBidResponses, metricsMock)
+
+	assert.Contains(t, decisions, openrtb_ext.BidderName("districtm"))
+	assert.NotContains(t, cleanRequests, openrtb_ext.BidderName("districtm"), "Aliases are shaped by their own history")
+	assert.Contains(t, cleanRequests, openrtb_ext.BidderRubicon, "Bidders with stored responses shouldn't be shaped")
+	metricsMock.AssertExpectations(t)
+}
+
+func TestTrafficShapingWindow(t *testing.T) {
+	shaper := newTrafficShaper(config.TrafficShaping{Enabled: true, MinBidRate: 0.1, MinRequests: 2, WindowRequests: 4})
+	key, _ := newShapingKey(openrtb_ext.BidderAppnexus, newShapingRequest())
+
+	shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), true)
+	shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), true)
+	shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), false)
+	assert.Equal(t, &bidHistory{requests: 3, bids: 2}, shaper.history[key])
+
+	shaper.record(openrtb_ext.BidderAppnexus, newShapingRequest(), false)
+	assert.Equal(t, &bidHistory{requests: 2, bids: 1}, shaper.history[key], "The history should be halved at the window size")
+}
+
+func TestNewShapingKey(t *testing.T) {
+	testCases := []struct {
+		description string
+		request     *openrtb.BidRequest
+		expected    shapingKey
+		expectedOK  bool
+	}{
+		{
+			description: "Site with the device country",
+			request:     newShapingRequest(),
+			expected:    shapingKey{bidder: openrtb_ext.BidderAppnexus, inventory: "site:example.com", mediaType: "banner+video", country: "USA"},
+			expectedOK:  true,
+		},
+		{
+			description: "App with the user country",
+			request: &openrtb.BidRequest{
+				App:  &openrtb.App{Bundle: "com.example.app"},
+				User: &openrtb.User{Geo: &openrtb.Geo{Country: "CAN"}},
+				Imp:  []openrtb.Imp{{Native: &openrtb.Native{}}},
+			},
+			expected:   shapingKey{bidder: openrtb_ext.BidderAppnexus, inventory: "app:com.example.app", mediaType: "native", country: "CAN"},
+			expectedOK: true,
+		},
+		{
+			description: "No domain or bundle",
+			request: &openrtb.BidRequest{
+				Site: &openrtb.Site{Page: "http://example.com/page"},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		key, ok := newShapingKey(openrtb_ext.BidderAppnexus, test.request)
+		assert.Equal(t, test.expectedOK, ok, test.description)
+		if test.expectedOK {
+			assert.Equal(t, test.expected, key, test.description)
+		}
+	}
+}
+
+func newShapingRequest() *openrtb.BidRequest {
+	return &openrtb.BidRequest{
+		Site:   &openrtb.Site{Domain: "example.com"},
+		Device: &openrtb.Device{Geo: &openrtb.Geo{Country: "USA"}},
+		Imp: []openrtb.Imp{
+			{ID: "imp-1", Video: &openrtb.Video{}},
+			{ID: "imp-2", Banner: &openrtb.Banner{}},
+		},
+	}
+}
@@ -1,6 +1,7 @@
 package exchange
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/buger/jsonparser"
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
 	"github.com/prebid/prebid-server/gdpr"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
@@ -17,17 +20,26 @@ import (
 
 // cleanOpenRTBRequests splits the input request into requests which are sanitized for each bidder. Intended behavior is:
 //
-//   1. BidRequest.Imp[].Ext will only contain the "prebid" field and a "bidder" field which has the params for the intended Bidder.
+//   1. BidRequest.Imp[].Ext will only contain the "prebid" and "context" fields, and a "bidder" field which has the params for the intended Bidder.
 //   2. Every BidRequest.Imp[] requested Bids from the Bidder who keys it.
 //   3. BidRequest.User.BuyerUID will be set to that Bidder's ID.
+//   4. BidRequest.Source.Ext.SChain will be set to the schain from ext.prebid.schains which applies to that Bidder.
+//   5. BidRequest.User.Ext.Eids will only contain the eids which ext.prebid.data.eidpermissions allows that Bidder to see.
+//   6. Bidders which aren't allowed by the Account will not get a request.
+//   7. Site, App and User will only contain the first party data which that Bidder is allowed to see, merged
+//      with its ext.prebid.bidderconfig.
+//   8. Personal info will be removed if GDPR, CCPA or COPPA require it. The policies which applied are
+//      recorded in the privacy metrics.
 func cleanOpenRTBRequests(ctx context.Context,
 	orig *openrtb.BidRequest,
 	usersyncs IdFetcher,
 	blables map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels,
 	labels pbsmetrics.Labels,
+	me pbsmetrics.MetricsEngine,
 	gDPR gdpr.Permissions,
 	usersyncIfAmbiguous,
-	enforceCCPA bool) (requestsByBidder map[openrtb_ext.BidderName]*openrtb.BidRequest, aliases map[string]string, errs []error) {
+	enforceCCPA bool,
+	account *config.Account) (requestsByBidder map[openrtb_ext.BidderName]*openrtb.BidRequest, aliases map[string]string, errs []error) {
 
 	impsByBidder, errs := splitImps(orig.Imp)
 	if len(errs) > 0 {
@@ -41,24 +53,53 @@ func cleanOpenRTBRequests(ctx context.Context,
 
 	requestsByBidder, errs = splitBidRequest(orig, impsByBidder, aliases, usersyncs, blables, labels)
 
+	for bidder := range requestsByBidder {
+		if !account.BidderAllowed(bidder.String()) && !account.BidderAllowed(string(resolveBidder(bidder.String(), aliases))) {
+			delete(requestsByBidder, bidder)
+			delete(blables, bidder)
+			errs = append(errs, &errortypes.Warning{
+				Message: fmt.Sprintf("Bidder %s is not allowed for account %s and was dropped from the auction", bidder, account.ID),
+			})
+		}
+	}
+
+	fpd, err := parseFirstPartyData(orig)
+	if err != nil {
+		return nil, aliases, append(errs, err)
+	}
+	for bidder, bidReq := range requestsByBidder {
+		if err := fpd.prepareRequest(bidReq, bidder.String()); err != nil {
+			delete(requestsByBidder, bidder)
+			delete(blables, bidder)
+			errs = append(errs, fmt.Errorf("Bidder %s was dropped from the auction because its first party data couldn't be merged: %v", bidder, err))
+		}
+	}
+
 	gdpr := extractGDPR(orig, usersyncIfAmbiguous)
+	gdprEnforced := gdpr == 1 && account.GDPR.EnabledOrDefault(true)
 	consent := extractConsent(orig)
 	isAMP := labels.RType == pbsmetrics.ReqTypeAMP
 
+	ccpaPolicy, _ := ccpa.ReadPolicy(orig)
+
 	privacyEnforcement := privacy.Enforcement{
+		CCPA:  enforceCCPA && ccpaPolicy.ShouldEnforce(),
 		COPPA: orig.Regs != nil && orig.Regs.COPPA == 1,
 	}
 
-	if enforceCCPA {
-		ccpaPolicy, _ := ccpa.ReadPolicy(orig)
-		privacyEnforcement.CCPA = ccpaPolicy.ShouldEnforce()
-	}
+	me.RecordRequestPrivacy(pbsmetrics.PrivacyLabels{
+		CCPAProvided:   ccpaPolicy.Value != "",
+		CCPAEnforced:   privacyEnforcement.CCPA,
+		COPPAEnforced:  privacyEnforcement.COPPA,
+		GDPREnforced:   gdprEnforced,
+		GDPRTCFVersion: gdprTCFVersion(gdprEnforced, consent),
+		LMT:            orig.Device != nil && orig.Device.Lmt != nil && *orig.Device.Lmt == 1,
+	})
 
 	for bidder, bidReq := range requestsByBidder {
+		coreBidder := resolveBidder(bidder.String(), aliases)
 
-		if gdpr == 1 {
-			coreBidder := resolveBidder(bidder.String(), aliases)
-
+		if gdprEnforced {
 			var publisherID = labels.PubID
 			ok, err := gDPR.PersonalInfoAllowed(ctx, coreBidder, publisherID, consent)
 			privacyEnforcement.GDPR = !ok && err == nil
@@ -66,18 +107,45 @@ func cleanOpenRTBRequests(ctx context.Context,
 			privacyEnforcement.GDPR = false
 		}
 
-		privacyEnforcement.Apply(bidReq, isAMP)
+		privacyEnforcement.Apply(bidReq, isAMP, coreBidder, me)
 	}
 
 	return
 }
 
+// gdprTCFVersion returns the TCF version of the consent string for the privacy metrics. It's empty if GDPR
+// isn't being enforced or the request didn't have a consent string.
+func gdprTCFVersion(gdprEnforced bool, consent string) pbsmetrics.TCFVersionValue {
+	if !gdprEnforced || consent == "" {
+		return ""
+	}
+	version, err := gdpr.ParseConsentVersion(consent)
+	if err != nil {
+		return pbsmetrics.TCFVersionErr
+	}
+	return pbsmetrics.TCFVersionToValue(version)
+}
+
 func splitBidRequest(req *openrtb.BidRequest, impsByBidder map[string][]openrtb.Imp, aliases map[string]string, usersyncs IdFetcher, blabels map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels, labels pbsmetrics.Labels) (map[openrtb_ext.BidderName]*openrtb.BidRequest, []error) {
 	requestsByBidder := make(map[openrtb_ext.BidderName]*openrtb.BidRequest, len(impsByBidder))
 	explicitBuyerUIDs, err := extractBuyerUIDs(req.User)
 	if err != nil {
 		return nil, []error{err}
 	}
+	sChainsByBidder, err := parseSChains(req)
+	if err != nil {
+		return nil, []error{err}
+	}
+	eidPermissions, err := parseEidPermissions(req)
+	if err != nil {
+		return nil, []error{err}
+	}
+	bidderExt := req.Ext
+	for _, path := range hiddenRequestExtPaths {
+		if bidderExt, err = removeRequestExtPath(bidderExt, path...); err != nil {
+			return nil, []error{err}
+		}
+	}
 	for bidder, imps := range impsByBidder {
 		reqCopy := *req
 		coreBidder := resolveBidder(bidder, aliases)
@@ -96,6 +164,13 @@ func splitBidRequest(req *openrtb.BidRequest, impsByBidder map[string][]openrtb.
 		} else {
 			blabels[coreBidder].CookieFlag = pbsmetrics.CookieFlagYes
 		}
+		if err := prepareUserEids(&reqCopy, bidder, eidPermissions); err != nil {
+			return nil, []error{err}
+		}
+		if err := prepareSource(&reqCopy, bidder, sChainsByBidder); err != nil {
+			return nil, []error{err}
+		}
+		reqCopy.Ext = bidderExt
 		reqCopy.Imp = imps
 		requestsByBidder[openrtb_ext.BidderName(bidder)] = &reqCopy
 	}
@@ -123,15 +198,17 @@ func extractBuyerUIDs(user *openrtb.User) (map[string]string, error) {
 	// The API guarantees that user.ext.prebid.buyeruids exists and has at least one ID defined,
 	// as long as user.ext.prebid exists.
 	buyerUIDs := userExt.Prebid.BuyerUIDs
-	userExt.Prebid = nil
-	if userExt.Consent != "" || userExt.DigiTrust != nil {
-		if newUserExtBytes, err := json.Marshal(userExt); err != nil {
-			return nil, err
-		} else {
-			user.Ext = newUserExtBytes
-		}
-	} else {
+	// Only remove the prebid key. The rest of user.ext (like the first party data and eids) isn't in ExtUser,
+	// so it would be lost if the ext was marshaled again. Delete works in place, so the ext is copied first.
+	newUserExt := jsonparser.Delete(append([]byte(nil), user.Ext...), "prebid")
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, newUserExt); err != nil {
+		return nil, err
+	}
+	if compacted.String() == "{}" {
 		user.Ext = nil
+	} else {
+		user.Ext = newUserExt
 	}
 	return buyerUIDs, nil
 }
@@ -158,12 +235,13 @@ func splitImps(imps []openrtb.Imp) (map[string][]openrtb.Imp, []error) {
 		impExt := impExts[i]
 
 		rawPrebidExt, ok := impExt[openrtb_ext.PrebidExtKey]
+		rawContextExt := impExt[openrtb_ext.ContextExtKey]
 
 		if ok {
 			var prebidExt openrtb_ext.ExtImpPrebid
 
 			if err := json.Unmarshal(rawPrebidExt, &prebidExt); err == nil && prebidExt.Bidder != nil {
-				if errs := sanitizedImpCopy(&imp, prebidExt.Bidder, rawPrebidExt, &splitImps); errs != nil {
+				if errs := sanitizedImpCopy(&imp, prebidExt.Bidder, rawPrebidExt, rawContextExt, &splitImps); errs != nil {
 					errList = append(errList, errs...)
 				}
 
@@ -171,7 +249,7 @@ func splitImps(imps []openrtb.Imp) (map[string][]openrtb.Imp, []error) {
 			}
 		}
 
-		if errs := sanitizedImpCopy(&imp, impExt, rawPrebidExt, &splitImps); errs != nil {
+		if errs := sanitizedImpCopy(&imp, impExt, rawPrebidExt, rawContextExt, &splitImps); errs != nil {
 			errList = append(errList, errs...)
 		}
 	}
@@ -179,12 +257,13 @@ func splitImps(imps []openrtb.Imp) (map[string][]openrtb.Imp, []error) {
 	return splitImps, nil
 }
 
-// sanitizedImpCopy returns a copy of imp with its ext filtered so that only "prebid" and bidder params exist.
+// sanitizedImpCopy returns a copy of imp with its ext filtered so that only "prebid", "context" and bidder params exist.
 // It will not mutate the input imp.
 // This function will write the new imps to the output map passed in
 func sanitizedImpCopy(imp *openrtb.Imp,
 	bidderExts map[string]json.RawMessage,
 	rawPrebidExt json.RawMessage,
+	rawContextExt json.RawMessage,
 	out *map[string][]openrtb.Imp) []error {
 
 	var prebidExt map[string]json.RawMessage
@@ -202,18 +281,21 @@ func sanitizedImpCopy(imp *openrtb.Imp,
 	}
 
 	for bidder, ext := range bidderExts {
-		if bidder == openrtb_ext.PrebidExtKey {
+		if bidder == openrtb_ext.PrebidExtKey || bidder == openrtb_ext.ContextExtKey {
 			continue
 		}
 
 		impCopy := *imp
-		newExt := make(map[string]json.RawMessage, 2)
+		newExt := make(map[string]json.RawMessage, 3)
 
 		newExt["bidder"] = ext
 
 		if rawPrebidExt != nil {
 			newExt[openrtb_ext.PrebidExtKey] = rawPrebidExt
 		}
+		if rawContextExt != nil {
+			newExt[openrtb_ext.ContextExtKey] = rawContextExt
+		}
 
 		rawExt, err := json.Marshal(newExt)
 		if err != nil {
@@ -251,6 +333,98 @@ func prepareUser(req *openrtb.BidRequest, givenBidder string, coreBidder openrtb
 	return hadCookie
 }
 
+// prepareUserEids removes the user.ext.eids which the given bidder isn't allowed to see.
+// Eids from sources which don't have a rule in eidPermissions are sent to every bidder.
+// This *will* mutate the request, but will *not* mutate any objects nested inside it.
+func prepareUserEids(req *openrtb.BidRequest, givenBidder string, eidPermissions map[string][]string) error {
+	if len(eidPermissions) == 0 || req.User == nil || len(req.User.Ext) == 0 {
+		return nil
+	}
+	eidsJSON, dataType, _, err := jsonparser.Get(req.User.Ext, "eids")
+	if dataType == jsonparser.NotExist || err == jsonparser.KeyPathNotFoundError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var eids []json.RawMessage
+	if err := json.Unmarshal(eidsJSON, &eids); err != nil {
+		return err
+	}
+	allowedEids := make([]json.RawMessage, 0, len(eids))
+	for _, eid := range eids {
+		source, _ := jsonparser.GetString(eid, "source")
+		if eidAllowed(eidPermissions, source, givenBidder) {
+			allowedEids = append(allowedEids, eid)
+		}
+	}
+	if len(allowedEids) == len(eids) {
+		return nil
+	}
+
+	user := *req.User
+	// jsonparser may write into the slice it was given, so work on a copy.
+	if len(allowedEids) == 0 {
+		user.Ext = jsonparser.Delete(append([]byte(nil), user.Ext...), "eids")
+	} else {
+		allowedEidsJSON, err := json.Marshal(allowedEids)
+		if err != nil {
+			return err
+		}
+		if user.Ext, err = jsonparser.Set(append([]byte(nil), user.Ext...), allowedEidsJSON, "eids"); err != nil {
+			return err
+		}
+	}
+	req.User = &user
+	return nil
+}
+
+// eidAllowed returns true if the bidder may see the eids from the given source.
+func eidAllowed(eidPermissions map[string][]string, source string, givenBidder string) bool {
+	allowedBidders, ok := eidPermissions[source]
+	if !ok {
+		return true
+	}
+	for _, bidder := range allowedBidders {
+		if bidder == givenBidder || bidder == openrtb_ext.EidPermissionsWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareSource sets req.Source.Ext.SChain to the schain which applies to the given bidder, if there is one.
+// A bidder listed by name takes precedence over the "*" wildcard.
+// This *will* mutate the request, but will *not* mutate any objects nested inside it.
+func prepareSource(req *openrtb.BidRequest, givenBidder string, sChainsByBidder map[string]*openrtb_ext.ExtRequestPrebidSChainSChain) error {
+	sChain, ok := sChainsByBidder[givenBidder]
+	if !ok {
+		if sChain, ok = sChainsByBidder[openrtb_ext.SChainWildcard]; !ok {
+			return nil
+		}
+	}
+
+	var source openrtb.Source
+	if req.Source != nil {
+		source = *req.Source
+	}
+	sChainJSON, err := json.Marshal(sChain)
+	if err != nil {
+		return err
+	}
+	if len(source.Ext) == 0 {
+		source.Ext, err = json.Marshal(openrtb_ext.ExtSource{SChain: *sChain})
+	} else {
+		// jsonparser.Set may write into the slice it was given, so work on a copy.
+		source.Ext, err = jsonparser.Set(append([]byte(nil), source.Ext...), sChainJSON, "schain")
+	}
+	if err != nil {
+		return err
+	}
+	req.Source = &source
+	return nil
+}
+
 // copyWithBuyerUID either overwrites the BuyerUID property on user with the argument, or returns
 // a new (empty) User with the BuyerUID already set.
 func copyWithBuyerUID(user *openrtb.User, buyerUID string) *openrtb.User {
@@ -303,6 +477,75 @@ func parseAliases(orig *openrtb.BidRequest) (map[string]string, []error) {
 	return aliases, nil
 }
 
+// parseSChains parses ext.prebid.schains from the BidRequest, and indexes the schains by the bidders they apply to.
+func parseSChains(orig *openrtb.BidRequest) (map[string]*openrtb_ext.ExtRequestPrebidSChainSChain, error) {
+	value, dataType, _, err := jsonparser.Get(orig.Ext, openrtb_ext.PrebidExtKey, "schains")
+	if dataType == jsonparser.NotExist || err == jsonparser.KeyPathNotFoundError {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sChains []*openrtb_ext.ExtRequestPrebidSChain
+	if err := json.Unmarshal(value, &sChains); err != nil {
+		return nil, err
+	}
+	sChainsByBidder := make(map[string]*openrtb_ext.ExtRequestPrebidSChainSChain)
+	for _, sChain := range sChains {
+		if sChain == nil {
+			continue
+		}
+		for _, bidder := range sChain.Bidders {
+			if _, ok := sChainsByBidder[bidder]; ok {
+				return nil, fmt.Errorf("request.ext.prebid.schains contains multiple schains for bidder %s; it must contain no more than one per bidder.", bidder)
+			}
+			sChainsByBidder[bidder] = &sChain.SChain
+		}
+	}
+	return sChainsByBidder, nil
+}
+
+// parseEidPermissions parses ext.prebid.data.eidpermissions from the BidRequest, and indexes the bidders
+// which are allowed to see each eid source.
+func parseEidPermissions(orig *openrtb.BidRequest) (map[string][]string, error) {
+	value, dataType, _, err := jsonparser.Get(orig.Ext, openrtb_ext.PrebidExtKey, "data", "eidpermissions")
+	if dataType == jsonparser.NotExist || err == jsonparser.KeyPathNotFoundError {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var eidPermissions []openrtb_ext.ExtRequestPrebidDataEidPermission
+	if err := json.Unmarshal(value, &eidPermissions); err != nil {
+		return nil, err
+	}
+	biddersBySource := make(map[string][]string, len(eidPermissions))
+	for _, permission := range eidPermissions {
+		biddersBySource[permission.Source] = permission.Bidders
+	}
+	return biddersBySource, nil
+}
+
+// hiddenRequestExtPaths are the parts of the request ext which would tell a bidder how the other bidders are treated.
+// Bidders only see the results, in their own copy of the request. For example, each bidder only sees the schain
+// meant for it, in source.ext.
+var hiddenRequestExtPaths = [][]string{
+	{openrtb_ext.PrebidExtKey, "schains"},
+	{openrtb_ext.PrebidExtKey, "data", "eidpermissions"},
+	{openrtb_ext.PrebidExtKey, "data", "bidders"},
+	{openrtb_ext.PrebidExtKey, "bidderconfig"},
+}
+
+// removeRequestExtPath returns a copy of the request ext without the value at the given path.
+func removeRequestExtPath(requestExt json.RawMessage, path ...string) (json.RawMessage, error) {
+	if _, dataType, _, err := jsonparser.Get(requestExt, path...); dataType == jsonparser.NotExist || err == jsonparser.KeyPathNotFoundError {
+		return requestExt, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return jsonparser.Delete(append([]byte(nil), requestExt...), path...), nil
+}
+
 // Quick little randomizer for a list of strings. Stuffing it in utils to keep other files clean
 func randomizeList(list []openrtb_ext.BidderName) {
 	l := len(list)
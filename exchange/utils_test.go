@@ -6,8 +6,10 @@ import (
 	"testing"
 
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
 	"github.com/prebid/prebid-server/pbsmetrics"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,7 +68,7 @@ func TestCleanOpenRTBRequests(t *testing.T) {
 	}
 
 	for _, test := range testCases {
-		reqByBidders, _, err := cleanOpenRTBRequests(context.Background(), test.req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &permissionsMock{}, true, true)
+		reqByBidders, _, err := cleanOpenRTBRequests(context.Background(), test.req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, &config.Account{})
 		if test.hasError {
 			assert.NotNil(t, err, "Error shouldn't be nil")
 		} else {
@@ -97,7 +99,7 @@ func TestCleanOpenRTBRequestsCCPA(t *testing.T) {
 	for _, test := range testCases {
 		req := newCCPABidRequest(t)
 
-		results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &permissionsMock{}, true, test.enforceCCPA)
+		results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, test.enforceCCPA, &config.Account{})
 		result := results["appnexus"]
 
 		assert.Nil(t, errs)
@@ -112,6 +114,281 @@ func TestCleanOpenRTBRequestsCCPA(t *testing.T) {
 	}
 }
 
+func TestCleanOpenRTBRequestsLMT(t *testing.T) {
+	lmt := int8(1)
+	req := newCCPABidRequest(t)
+	req.Regs = nil
+	req.Device.Lmt = &lmt
+
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordRequestPrivacy", pbsmetrics.PrivacyLabels{LMT: true}).Once()
+	results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, metricsMock, &permissionsMock{}, true, false, &config.Account{})
+	result := results["appnexus"]
+
+	assert.Nil(t, errs)
+	assert.NotEqual(t, result.User.BuyerUID, "", "Limit Ad Tracking shouldn't remove the User.BuyerUID")
+	assert.NotEqual(t, result.Device.IFA, "", "Limit Ad Tracking shouldn't remove the Device.IFA")
+	metricsMock.AssertExpectations(t)
+}
+
+func TestCleanOpenRTBRequestsPrivacyMetrics(t *testing.T) {
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordRequestPrivacy", pbsmetrics.PrivacyLabels{
+		CCPAProvided: true,
+		CCPAEnforced: true,
+	}).Once()
+	metricsMock.On("RecordAdapterPrivacyEnforced", openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyCCPA).Once()
+
+	_, _, errs := cleanOpenRTBRequests(context.Background(), newCCPABidRequest(t), &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, metricsMock, &permissionsMock{}, true, true, &config.Account{})
+
+	assert.Nil(t, errs)
+	metricsMock.AssertExpectations(t)
+}
+
+func TestGDPRTCFVersion(t *testing.T) {
+	assert.Equal(t, pbsmetrics.TCFVersionValue(""), gdprTCFVersion(false, "BON3PCUON3PCUABABBAAABoAAAAAMw"), "GDPR not enforced")
+	assert.Equal(t, pbsmetrics.TCFVersionValue(""), gdprTCFVersion(true, ""), "No consent")
+	assert.Equal(t, pbsmetrics.TCFVersionV1, gdprTCFVersion(true, "BON3PCUON3PCUABABBAAABoAAAAAMw"), "TCF v1")
+	assert.Equal(t, pbsmetrics.TCFVersionErr, gdprTCFVersion(true, "BON3P"), "Malformed consent")
+}
+
+func TestCleanOpenRTBRequestsAccountBidders(t *testing.T) {
+	testCases := []struct {
+		description     string
+		bidders         []string
+		expectedBidders []openrtb_ext.BidderName
+		expectedErrs    int
+	}{
+		{
+			description:     "No bidder restrictions",
+			bidders:         nil,
+			expectedBidders: []openrtb_ext.BidderName{"appnexus", "brightroll"},
+			expectedErrs:    0,
+		},
+		{
+			description:     "Alias allowed through its core bidder",
+			bidders:         []string{"appnexus"},
+			expectedBidders: []openrtb_ext.BidderName{"appnexus", "brightroll"},
+			expectedErrs:    0,
+		},
+		{
+			description:     "Only the alias allowed",
+			bidders:         []string{"brightroll"},
+			expectedBidders: []openrtb_ext.BidderName{"brightroll"},
+			expectedErrs:    1,
+		},
+		{
+			description:     "No requested bidders allowed",
+			bidders:         []string{"rubicon"},
+			expectedBidders: []openrtb_ext.BidderName{},
+			expectedErrs:    2,
+		},
+	}
+
+	for _, test := range testCases {
+		account := &config.Account{ID: "some-publisher-id", Bidders: test.bidders}
+		results, _, errs := cleanOpenRTBRequests(context.Background(), newAdapterAliasBidRequest(t), &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, account)
+
+		assert.Len(t, errs, test.expectedErrs, test.description)
+		assert.Len(t, results, len(test.expectedBidders), test.description)
+		for _, bidder := range test.expectedBidders {
+			assert.Contains(t, results, bidder, test.description)
+		}
+	}
+}
+
+func TestCleanOpenRTBRequestsSChain(t *testing.T) {
+	testCases := []struct {
+		description     string
+		requestExt      string
+		sourceExt       string
+		expectedSChains map[openrtb_ext.BidderName]string
+	}{
+		{
+			description: "No schains",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"}}}`,
+			expectedSChains: map[openrtb_ext.BidderName]string{
+				"appnexus":   "",
+				"brightroll": "",
+			},
+		},
+		{
+			description: "Wildcard schain",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"schains":[{"bidders":["*"],"schain":{"complete":1,"nodes":[{"asi":"any.com","sid":"1","hp":1}],"ver":"1.0"}}]}}`,
+			expectedSChains: map[openrtb_ext.BidderName]string{
+				"appnexus":   "any.com",
+				"brightroll": "any.com",
+			},
+		},
+		{
+			description: "Bidder schain takes precedence over the wildcard",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"schains":[{"bidders":["*"],"schain":{"complete":1,"nodes":[{"asi":"any.com","sid":"1","hp":1}],"ver":"1.0"}},{"bidders":["brightroll"],"schain":{"complete":1,"nodes":[{"asi":"brightroll.com","sid":"2","hp":1}],"ver":"1.0"}}]}}`,
+			expectedSChains: map[openrtb_ext.BidderName]string{
+				"appnexus":   "any.com",
+				"brightroll": "brightroll.com",
+			},
+		},
+		{
+			description: "Only the listed bidder gets an schain",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"schains":[{"bidders":["appnexus"],"schain":{"complete":1,"nodes":[{"asi":"appnexus.com","sid":"3","hp":1}],"ver":"1.0"}}]}}`,
+			sourceExt:   `{"other":true}`,
+			expectedSChains: map[openrtb_ext.BidderName]string{
+				"appnexus":   "appnexus.com",
+				"brightroll": "",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		req := newAdapterAliasBidRequest(t)
+		req.Ext = json.RawMessage(test.requestExt)
+		if test.sourceExt != "" {
+			req.Source.Ext = json.RawMessage(test.sourceExt)
+		}
+
+		results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, &config.Account{})
+
+		assert.Empty(t, errs, test.description)
+		for bidder, expectedASI := range test.expectedSChains {
+			if !assert.Contains(t, results, bidder, test.description) {
+				continue
+			}
+			bidderReq := results[bidder]
+			assert.Equal(t, "61018dc9-fa61-4c41-b7dc-f90b9ae80e87", bidderReq.Source.TID, test.description)
+			var sourceExt openrtb_ext.ExtSource
+			if expectedASI == "" {
+				assert.Equal(t, string(req.Source.Ext), string(bidderReq.Source.Ext), "%s: source.ext shouldn't change for %s", test.description, bidder)
+			} else if assert.NoError(t, json.Unmarshal(bidderReq.Source.Ext, &sourceExt), test.description) && assert.Len(t, sourceExt.SChain.Nodes, 1, test.description) {
+				assert.Equal(t, expectedASI, sourceExt.SChain.Nodes[0].ASI, "%s: wrong schain for %s", test.description, bidder)
+			}
+			if test.sourceExt != "" && expectedASI != "" {
+				assert.Contains(t, string(bidderReq.Source.Ext), `"other":true`, test.description)
+			}
+			assert.NotContains(t, string(bidderReq.Ext), "schains", "%s: bidders shouldn't see the other schains", test.description)
+		}
+		assert.Equal(t, test.requestExt, string(req.Ext), "%s: the original request shouldn't be modified", test.description)
+	}
+}
+
+func TestCleanOpenRTBRequestsSChainDuplicateBidder(t *testing.T) {
+	req := newAdapterAliasBidRequest(t)
+	req.Ext = json.RawMessage(`{"prebid":{"schains":[{"bidders":["appnexus"],"schain":{"complete":1,"nodes":[],"ver":"1.0"}},{"bidders":["appnexus"],"schain":{"complete":1,"nodes":[],"ver":"1.0"}}]}}`)
+
+	_, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, &config.Account{})
+
+	assert.Len(t, errs, 1)
+}
+
+func TestCleanOpenRTBRequestsEidPermissions(t *testing.T) {
+	const userExt = `{"consent":"BONciguONcjGKADACHENAOLS1rAHDAFAAEAASABQAMwAeACEAFw","eids":[{"source":"liveramp.com","uids":[{"id":"ramp-id"}]},{"source":"adserver.org","uids":[{"id":"tdid"}]}]}`
+	testCases := []struct {
+		description  string
+		requestExt   string
+		expectedEids map[openrtb_ext.BidderName][]string
+	}{
+		{
+			description: "No permissions",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"}}}`,
+			expectedEids: map[openrtb_ext.BidderName][]string{
+				"appnexus":   {"liveramp.com", "adserver.org"},
+				"brightroll": {"liveramp.com", "adserver.org"},
+			},
+		},
+		{
+			description: "Source limited to one bidder",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"data":{"eidpermissions":[{"source":"liveramp.com","bidders":["brightroll"]}]}}}`,
+			expectedEids: map[openrtb_ext.BidderName][]string{
+				"appnexus":   {"adserver.org"},
+				"brightroll": {"liveramp.com", "adserver.org"},
+			},
+		},
+		{
+			description: "Wildcard allows every bidder",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"data":{"eidpermissions":[{"source":"liveramp.com","bidders":["*"]},{"source":"adserver.org","bidders":["rubicon"]}]}}}`,
+			expectedEids: map[openrtb_ext.BidderName][]string{
+				"appnexus":   {"liveramp.com"},
+				"brightroll": {"liveramp.com"},
+			},
+		},
+		{
+			description: "Every source removed",
+			requestExt:  `{"prebid":{"aliases":{"brightroll":"appnexus"},"data":{"eidpermissions":[{"source":"liveramp.com","bidders":["brightroll"]},{"source":"adserver.org","bidders":["brightroll"]}]}}}`,
+			expectedEids: map[openrtb_ext.BidderName][]string{
+				"appnexus":   nil,
+				"brightroll": {"liveramp.com", "adserver.org"},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		req := newAdapterAliasBidRequest(t)
+		req.Ext = json.RawMessage(test.requestExt)
+		req.Regs = nil
+		req.User.Ext = json.RawMessage(userExt)
+
+		results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, &config.Account{})
+
+		assert.Empty(t, errs, test.description)
+		for bidder, expectedSources := range test.expectedEids {
+			if !assert.Contains(t, results, bidder, test.description) {
+				continue
+			}
+			var bidderUserExt openrtb_ext.ExtUser
+			if !assert.NoError(t, json.Unmarshal(results[bidder].User.Ext, &bidderUserExt), test.description) {
+				continue
+			}
+			var sources []string
+			for _, eid := range bidderUserExt.Eids {
+				sources = append(sources, eid.Source)
+			}
+			assert.Equal(t, expectedSources, sources, "%s: wrong eids for %s", test.description, bidder)
+			assert.Equal(t, "BONciguONcjGKADACHENAOLS1rAHDAFAAEAASABQAMwAeACEAFw", bidderUserExt.Consent, "%s: the rest of user.ext should be kept", test.description)
+			assert.NotContains(t, string(results[bidder].Ext), "eidpermissions", "%s: bidders shouldn't see the eid permissions", test.description)
+		}
+		assert.Equal(t, userExt, string(req.User.Ext), "%s: the original request shouldn't be modified", test.description)
+		assert.Equal(t, test.requestExt, string(req.Ext), "%s: the original request shouldn't be modified", test.description)
+	}
+}
+
+func TestCleanOpenRTBRequestsFirstPartyData(t *testing.T) {
+	req := newAdapterAliasBidRequest(t)
+	req.Regs = nil
+	req.Site.Ext = json.RawMessage(`{"data":{"section":"news"}}`)
+	req.Imp[0].Ext = json.RawMessage(`{"appnexus":{"placementId":1},"brightroll":{"placementId":105},"context":{"data":{"adslot":"top"}}}`)
+	req.Ext = json.RawMessage(`{"prebid":{"aliases":{"brightroll":"appnexus"},"data":{"bidders":["appnexus"]},"bidderconfig":[{"bidders":["brightroll"],"config":{"ortb2":{"site":{"keywords":"brightroll"}}}}]}}`)
+
+	results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, true, &config.Account{})
+
+	assert.Empty(t, errs)
+	if assert.Len(t, results, 2) {
+		assert.JSONEq(t, `{"data":{"section":"news"}}`, string(results["appnexus"].Site.Ext))
+		assert.Empty(t, results["appnexus"].Site.Keywords)
+		assert.JSONEq(t, `{}`, string(results["brightroll"].Site.Ext), "brightroll isn't allowed to see the global data")
+		assert.Equal(t, "brightroll", results["brightroll"].Site.Keywords)
+		for bidder, bidderReq := range results {
+			assert.Contains(t, string(bidderReq.Imp[0].Ext), `"context":{"data":{"adslot":"top"}}`, "%s should get the imp's first party data", bidder)
+			assert.NotContains(t, string(bidderReq.Ext), "bidderconfig", "%s shouldn't see the other bidders' config", bidder)
+			assert.NotContains(t, string(bidderReq.Ext), `"bidders"`, "%s shouldn't see the allowed bidders", bidder)
+		}
+	}
+	assert.Equal(t, `{"data":{"section":"news"}}`, string(req.Site.Ext), "The original request shouldn't be modified")
+}
+
+func TestCleanOpenRTBRequestsBuyerUIDs(t *testing.T) {
+	req := newAdapterAliasBidRequest(t)
+	req.User.BuyerUID = ""
+	req.User.Ext = json.RawMessage(`{"consent":"BONciguONcjGKADACHENAOLS1rAHDAFAAEAASABQAMwAeACEAFw","prebid":{"buyeruids":{"appnexus":"explicit-appnexus"}},"data":{"interests":["cars"]},"eids":[{"source":"src","uids":[{"id":"user-id"}]}]}`)
+
+	results, _, errs := cleanOpenRTBRequests(context.Background(), req, &emptyUsersync{}, map[openrtb_ext.BidderName]*pbsmetrics.AdapterLabels{}, pbsmetrics.Labels{}, &metricsConf.DummyMetricsEngine{}, &permissionsMock{}, true, false, &config.Account{})
+
+	assert.Empty(t, errs)
+	if assert.Contains(t, results, openrtb_ext.BidderName("appnexus")) {
+		user := results["appnexus"].User
+		assert.Equal(t, "explicit-appnexus", user.BuyerUID)
+		assert.JSONEq(t, `{"consent":"BONciguONcjGKADACHENAOLS1rAHDAFAAEAASABQAMwAeACEAFw","data":{"interests":["cars"]},"eids":[{"source":"src","uids":[{"id":"user-id"}]}]}`, string(user.Ext), "Only the buyeruids should be removed")
+	}
+}
+
 // newAdapterAliasBidRequest builds a BidRequest with aliases
 func newAdapterAliasBidRequest(t *testing.T) *openrtb.BidRequest {
 	dnt := int8(1)
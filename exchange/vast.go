@@ -0,0 +1,138 @@
+package exchange
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/macros"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// vastImpressionTracker adds the host's <Impression> tracker to the VAST of video bids before it gets cached,
+// so that video impressions can be counted independently of the bidders' reporting.
+//
+// All functions on this struct are nil-safe. A nil vastImpressionTracker means that the host didn't configure a tracker.
+type vastImpressionTracker struct {
+	urlTemplate *template.Template
+	accountID   string
+	// timestamp is the time that the auction started, in milliseconds since the epoch.
+	timestamp int64
+}
+
+// newVASTImpressionTracker returns nil if urlTemplate is nil.
+func newVASTImpressionTracker(urlTemplate *template.Template, account *config.Account, auctionStart time.Time) *vastImpressionTracker {
+	if urlTemplate == nil {
+		return nil
+	}
+	return &vastImpressionTracker{
+		urlTemplate: urlTemplate,
+		accountID:   account.ID,
+		timestamp:   auctionStart.UnixNano() / int64(time.Millisecond),
+	}
+}
+
+// inject returns the vast with the tracker added to every InLine and Wrapper ad.
+// If the vast can't be modified, it's returned unchanged along with an error explaining why.
+func (t *vastImpressionTracker) inject(vast string, bid *openrtb.Bid, bidder openrtb_ext.BidderName) (string, error) {
+	if t == nil {
+		return vast, nil
+	}
+	trackerURL, err := macros.ResolveMacros(*t.urlTemplate, macros.VASTTrackerTemplateParams{
+		Bidder:    url.QueryEscape(string(bidder)),
+		BidID:     url.QueryEscape(bid.ID),
+		AccountID: url.QueryEscape(t.accountID),
+		Timestamp: strconv.FormatInt(t.timestamp, 10),
+	})
+	if err != nil {
+		return vast, fmt.Errorf("Failed to resolve the VAST impression tracker for bid %s: %v", bid.ID, err)
+	}
+	injected, err := injectImpressionTracker(vast, trackerURL)
+	if err != nil {
+		return vast, fmt.Errorf("Failed to add the VAST impression tracker to bid %s from %s: %v", bid.ID, bidder, err)
+	}
+	return injected, nil
+}
+
+// injectImpressionTracker adds an <Impression> element with the trackerURL to every InLine and Wrapper ad in the vast.
+//
+// The new element goes before the ad's first <Impression>, or before its <Creatives> if it doesn't have one.
+// Failing that, it goes at the end of the ad. The rest of the document is left byte-for-byte as it was.
+func injectImpressionTracker(vast string, trackerURL string) (string, error) {
+	if strings.Contains(trackerURL, "]]>") {
+		return vast, errors.New("the tracker URL can't be put in a CDATA section")
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(vast))
+	// Only the element names are needed, and those are ASCII in every charset which VAST uses.
+	// Reading the bytes as they are also keeps the decoder's offsets in line with the vast string.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	var insertAt []int64
+	depth := 0
+	// adDepth is the depth of the InLine or Wrapper element being read, or 0 if we're not in one.
+	adDepth := 0
+	found := false
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return vast, fmt.Errorf("malformed VAST: %v", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case adDepth == 0 && isVASTAd(element.Name.Local):
+				// Self-closing ads are empty, so there's nothing to track.
+				if end := decoder.InputOffset(); !strings.HasSuffix(vast[:end], "/>") {
+					adDepth = depth
+					found = false
+				}
+			case adDepth != 0 && depth == adDepth+1 && !found && (element.Name.Local == "Impression" || element.Name.Local == "Creatives"):
+				insertAt = append(insertAt, offset)
+				found = true
+			}
+		case xml.EndElement:
+			if depth == adDepth {
+				if !found {
+					insertAt = append(insertAt, offset)
+				}
+				adDepth = 0
+			}
+			depth--
+		}
+	}
+	if len(insertAt) == 0 {
+		return vast, errors.New("no InLine or Wrapper ads were found")
+	}
+
+	impression := "<Impression><![CDATA[" + trackerURL + "]]></Impression>"
+	var injected strings.Builder
+	injected.Grow(len(vast) + len(insertAt)*len(impression))
+	var last int64
+	for _, offset := range insertAt {
+		injected.WriteString(vast[last:offset])
+		injected.WriteString(impression)
+		last = offset
+	}
+	injected.WriteString(vast[last:])
+	return injected.String(), nil
+}
+
+func isVASTAd(name string) bool {
+	return name == "InLine" || name == "Wrapper"
+}
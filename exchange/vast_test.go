@@ -0,0 +1,134 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTracker = `<Impression><![CDATA[http://tracker.com/imp]]></Impression>`
+
+func TestInjectImpressionTracker(t *testing.T) {
+	testCases := []struct {
+		description string
+		vast        string
+		expected    string
+	}{
+		{
+			description: "Inline ads get the tracker before their first impression",
+			vast:        `<VAST version="3.0"><Ad id="1"><InLine><AdSystem>x</AdSystem><Impression><![CDATA[http://bidder.com/imp]]></Impression><Creatives></Creatives></InLine></Ad></VAST>`,
+			expected:    `<VAST version="3.0"><Ad id="1"><InLine><AdSystem>x</AdSystem>` + testTracker + `<Impression><![CDATA[http://bidder.com/imp]]></Impression><Creatives></Creatives></InLine></Ad></VAST>`,
+		},
+		{
+			description: "Wrapper ads get the tracker too",
+			vast:        `<VAST version="3.0"><Ad><Wrapper><AdSystem>x</AdSystem><VASTAdTagURI><![CDATA[http://bidder.com/vast]]></VASTAdTagURI><Impression/></Wrapper></Ad></VAST>`,
+			expected:    `<VAST version="3.0"><Ad><Wrapper><AdSystem>x</AdSystem><VASTAdTagURI><![CDATA[http://bidder.com/vast]]></VASTAdTagURI>` + testTracker + `<Impression/></Wrapper></Ad></VAST>`,
+		},
+		{
+			description: "Ads without impressions get the tracker before their creatives",
+			vast:        `<VAST version="3.0"><Ad><InLine><AdSystem>x</AdSystem><Creatives><Creative></Creative></Creatives></InLine></Ad></VAST>`,
+			expected:    `<VAST version="3.0"><Ad><InLine><AdSystem>x</AdSystem>` + testTracker + `<Creatives><Creative></Creative></Creatives></InLine></Ad></VAST>`,
+		},
+		{
+			description: "Ads without impressions or creatives get the tracker at the end",
+			vast:        `<VAST version="3.0"><Ad><InLine><AdSystem>x</AdSystem></InLine></Ad></VAST>`,
+			expected:    `<VAST version="3.0"><Ad><InLine><AdSystem>x</AdSystem>` + testTracker + `</InLine></Ad></VAST>`,
+		},
+		{
+			description: "Every ad in a pod gets the tracker, and nested impressions are ignored",
+			vast:        "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<VAST version=\"3.0\">\n  <Ad sequence=\"1\"><InLine><Creatives><Creative><Linear><Impression/></Linear></Creative></Creatives></InLine></Ad>\n  <Ad sequence=\"2\"><Wrapper><Impression/></Wrapper></Ad>\n</VAST>",
+			expected:    "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<VAST version=\"3.0\">\n  <Ad sequence=\"1\"><InLine>" + testTracker + "<Creatives><Creative><Linear><Impression/></Linear></Creative></Creatives></InLine></Ad>\n  <Ad sequence=\"2\"><Wrapper>" + testTracker + "<Impression/></Wrapper></Ad>\n</VAST>",
+		},
+		{
+			description: "Documents in other charsets are read as they are",
+			vast:        `<?xml version="1.0" encoding="ISO-8859-1"?><VAST><Ad><InLine></InLine></Ad></VAST>`,
+			expected:    `<?xml version="1.0" encoding="ISO-8859-1"?><VAST><Ad><InLine>` + testTracker + `</InLine></Ad></VAST>`,
+		},
+	}
+
+	for _, test := range testCases {
+		injected, err := injectImpressionTracker(test.vast, "http://tracker.com/imp")
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.expected, injected, test.description)
+	}
+}
+
+func TestInjectImpressionTrackerErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		vast        string
+		trackerURL  string
+	}{
+		{"Malformed XML", `<VAST><Ad><InLine></Ad></VAST>`, "http://tracker.com/imp"},
+		{"Truncated XML", `<VAST><Ad><InLine>`, "http://tracker.com/imp"},
+		{"Not XML", `http://bidder.com/vast.xml`, "http://tracker.com/imp"},
+		{"No ads", `<VAST version="3.0"></VAST>`, "http://tracker.com/imp"},
+		{"Only empty ads", `<VAST version="3.0"><Ad><InLine/></Ad></VAST>`, "http://tracker.com/imp"},
+		{"Tracker breaks CDATA", `<VAST><Ad><InLine></InLine></Ad></VAST>`, "http://tracker.com/]]>"},
+	}
+
+	for _, test := range testCases {
+		injected, err := injectImpressionTracker(test.vast, test.trackerURL)
+		assert.Error(t, err, test.description)
+		assert.Equal(t, test.vast, injected, "%s: the VAST should be unchanged", test.description)
+	}
+}
+
+func TestVASTImpressionTrackerMacros(t *testing.T) {
+	urlTemplate := template.Must(template.New("test").Parse("http://tracker.com/imp?bidder={{.Bidder}}&bid={{.BidID}}&acct={{.AccountID}}&ts={{.Timestamp}}"))
+	tracker := newVASTImpressionTracker(urlTemplate, &config.Account{ID: "acct 1"}, time.Unix(1, 500*int64(time.Millisecond)))
+
+	injected, err := tracker.inject(`<VAST><Ad><InLine></InLine></Ad></VAST>`, &openrtb.Bid{ID: "bid&1"}, "appnexus")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `<VAST><Ad><InLine><Impression><![CDATA[http://tracker.com/imp?bidder=appnexus&bid=bid%261&acct=acct+1&ts=1500]]></Impression></InLine></Ad></VAST>`, injected)
+}
+
+func TestVASTImpressionTrackerDisabled(t *testing.T) {
+	tracker := newVASTImpressionTracker(nil, &config.Account{ID: "acct"}, time.Now())
+	assert.Nil(t, tracker)
+
+	injected, err := tracker.inject("not VAST", &openrtb.Bid{ID: "bid"}, "appnexus")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "not VAST", injected)
+}
+
+func TestDoCacheInjectsVASTTracker(t *testing.T) {
+	urlTemplate := template.Must(template.New("test").Parse("http://tracker.com/imp?bid={{.BidID}}"))
+	tracker := newVASTImpressionTracker(urlTemplate, &config.Account{ID: "acct"}, time.Now())
+	inlineBid := &pbsOrtbBid{bid: &openrtb.Bid{ID: "bid-1", ImpID: "imp-1", Price: 2, AdM: `<VAST><Ad><InLine></InLine></Ad></VAST>`}, bidType: openrtb_ext.BidTypeVideo}
+	malformedBid := &pbsOrtbBid{bid: &openrtb.Bid{ID: "bid-2", ImpID: "imp-2", Price: 1, AdM: `<VAST><Ad>`}, bidType: openrtb_ext.BidTypeVideo}
+	testAuction := &auction{
+		winningBids: map[string]*pbsOrtbBid{"imp-1": inlineBid, "imp-2": malformedBid},
+		winningBidsByBidder: map[string]map[openrtb_ext.BidderName][]*pbsOrtbBid{
+			"imp-1": {"appnexus": {inlineBid}},
+			"imp-2": {"rubicon": {malformedBid}},
+		},
+		roundedPrices: map[*pbsOrtbBid]string{inlineBid: "2.00", malformedBid: "1.00"},
+	}
+	targData := &targetData{includeWinners: true, includeCacheVast: true}
+	cache := &mockCache{}
+	bidRequest := &openrtb.BidRequest{Imp: []openrtb.Imp{{ID: "imp-1"}, {ID: "imp-2"}}}
+
+	errs := testAuction.doCache(context.Background(), cache, targData, bidRequest, 60, &config.DefaultTTLs{}, nil, nil, tracker)
+
+	assert.Len(t, errs, 1, "The malformed VAST should be reported")
+	cached := make([]string, 0, len(cache.items))
+	for _, item := range cache.items {
+		var vast string
+		assert.NoError(t, json.Unmarshal(item.Data, &vast))
+		cached = append(cached, vast)
+	}
+	assert.ElementsMatch(t, []string{
+		`<VAST><Ad><InLine><Impression><![CDATA[http://tracker.com/imp?bid=bid-1]]></Impression></InLine></Ad></VAST>`,
+		`<VAST><Ad>`,
+	}, cached, "Bids should still be cached if the tracker can't be added")
+}
@@ -0,0 +1,221 @@
+package floors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/mxmCherry/openrtb"
+)
+
+// Field is a property of an Imp which floor rules can be keyed on.
+type Field string
+
+// The fields which may be used in a rules file schema.
+const (
+	FieldMediaType  Field = "mediaType"
+	FieldSize       Field = "size"
+	FieldDomain     Field = "domain"
+	FieldAdUnitCode Field = "adUnitCode"
+)
+
+// Wildcard matches any value for a field.
+const Wildcard = "*"
+
+const defaultDelimiter = "|"
+const defaultCurrency = "USD"
+
+// Rules resolves price floors for Imps.
+//
+// Rules are loaded from a JSON file like:
+//
+//   {
+//     "currency": "USD",
+//     "schema": { "fields": ["mediaType", "size", "domain"], "delimiter": "|" },
+//     "values": {
+//       "banner|300x250|www.example.com": 1.5,
+//       "banner|*|*": 0.5
+//     },
+//     "default": 0.1
+//   }
+//
+// Each key in "values" holds one value per schema field, in order. The most specific key which
+// matches the Imp wins. If two keys are equally specific, the one which matches more of the
+// leading fields wins.
+type Rules struct {
+	// Currency is the currency of every floor in the file. Defaults to USD.
+	Currency string             `json:"currency"`
+	Schema   Schema             `json:"schema"`
+	Values   map[string]float64 `json:"values"`
+	// Default is used for Imps which don't match any of the Values.
+	Default float64 `json:"default"`
+}
+
+// Schema defines how the keys of Rules.Values should be interpreted.
+type Schema struct {
+	Fields    []Field `json:"fields"`
+	Delimiter string  `json:"delimiter"`
+}
+
+// LoadRules reads and validates a rules file.
+func LoadRules(filename string) (*Rules, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read price floors rules file %s: %v", filename, err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules parses and validates the contents of a rules file.
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("Failed to parse price floors rules: %v", err)
+	}
+	if err := rules.normalize(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// normalize validates the rules, fills in defaults and makes every key lowercase so that
+// lookups can be case insensitive.
+func (r *Rules) normalize() error {
+	if r.Currency == "" {
+		r.Currency = defaultCurrency
+	}
+	if r.Schema.Delimiter == "" {
+		r.Schema.Delimiter = defaultDelimiter
+	}
+	if len(r.Schema.Fields) == 0 {
+		return fmt.Errorf("Price floors rules must define at least one schema field")
+	}
+	for _, field := range r.Schema.Fields {
+		switch field {
+		case FieldMediaType, FieldSize, FieldDomain, FieldAdUnitCode:
+		default:
+			return fmt.Errorf("Price floors rules schema field %q is not supported", field)
+		}
+	}
+	if r.Default < 0 {
+		return fmt.Errorf("Price floors rules default must be non-negative. Got %f", r.Default)
+	}
+
+	values := make(map[string]float64, len(r.Values))
+	for key, floor := range r.Values {
+		if len(strings.Split(key, r.Schema.Delimiter)) != len(r.Schema.Fields) {
+			return fmt.Errorf("Price floors rule %q must have %d fields", key, len(r.Schema.Fields))
+		}
+		if floor < 0 {
+			return fmt.Errorf("Price floors rule %q must be non-negative. Got %f", key, floor)
+		}
+		values[strings.ToLower(key)] = floor
+	}
+	r.Values = values
+	return nil
+}
+
+// Floor returns the floor for the Imp, in the Rules currency. The bool will be false if
+// no rule matched the Imp and the Rules have no default.
+func (r *Rules) Floor(req *openrtb.BidRequest, imp *openrtb.Imp) (float64, bool) {
+	impValues := make([]string, len(r.Schema.Fields))
+	for i, field := range r.Schema.Fields {
+		impValues[i] = strings.ToLower(fieldValue(field, req, imp))
+	}
+
+	// Try every combination of wildcards, from most to least specific. Setting bit i of the mask
+	// replaces the value of field len(fields)-1-i with a wildcard, so lower masks with the same
+	// number of wildcards keep more of the leading fields.
+	fieldCount := uint(len(impValues))
+	key := make([]string, fieldCount)
+	for wildcards := uint(0); wildcards <= fieldCount; wildcards++ {
+		for mask := uint(0); mask < 1<<fieldCount; mask++ {
+			if bitCount(mask) != wildcards {
+				continue
+			}
+			for i := uint(0); i < fieldCount; i++ {
+				if mask&(1<<(fieldCount-1-i)) != 0 || impValues[i] == "" {
+					key[i] = Wildcard
+				} else {
+					key[i] = impValues[i]
+				}
+			}
+			if floor, ok := r.Values[strings.Join(key, r.Schema.Delimiter)]; ok {
+				return floor, true
+			}
+		}
+	}
+
+	return r.Default, r.Default > 0
+}
+
+func fieldValue(field Field, req *openrtb.BidRequest, imp *openrtb.Imp) string {
+	switch field {
+	case FieldMediaType:
+		return mediaType(imp)
+	case FieldSize:
+		return size(imp)
+	case FieldDomain:
+		if req.Site != nil {
+			return req.Site.Domain
+		}
+		if req.App != nil {
+			return req.App.Domain
+		}
+	case FieldAdUnitCode:
+		return imp.TagID
+	}
+	return ""
+}
+
+// mediaType returns the Imp's only media type. Multi-format Imps only match wildcards.
+func mediaType(imp *openrtb.Imp) string {
+	var types []string
+	if imp.Banner != nil {
+		types = append(types, "banner")
+	}
+	if imp.Video != nil {
+		types = append(types, "video")
+	}
+	if imp.Audio != nil {
+		types = append(types, "audio")
+	}
+	if imp.Native != nil {
+		types = append(types, "native")
+	}
+	if len(types) != 1 {
+		return ""
+	}
+	return types[0]
+}
+
+// size returns the Imp's only size, formatted as WxH. Imps with several sizes only match wildcards.
+func size(imp *openrtb.Imp) string {
+	if imp.Banner != nil {
+		if len(imp.Banner.Format) == 1 {
+			return formatSize(imp.Banner.Format[0].W, imp.Banner.Format[0].H)
+		}
+		if len(imp.Banner.Format) == 0 && imp.Banner.W != nil && imp.Banner.H != nil {
+			return formatSize(*imp.Banner.W, *imp.Banner.H)
+		}
+		return ""
+	}
+	if imp.Video != nil && imp.Video.W > 0 && imp.Video.H > 0 {
+		return formatSize(imp.Video.W, imp.Video.H)
+	}
+	return ""
+}
+
+func formatSize(w uint64, h uint64) string {
+	return strconv.FormatUint(w, 10) + "x" + strconv.FormatUint(h, 10)
+}
+
+func bitCount(n uint) uint {
+	count := uint(0)
+	for ; n > 0; n &= n - 1 {
+		count++
+	}
+	return count
+}
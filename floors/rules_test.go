@@ -0,0 +1,150 @@
+package floors
+
+import (
+	"testing"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRules = `{
+	"currency": "EUR",
+	"schema": { "fields": ["mediaType", "size", "domain", "adUnitCode"] },
+	"values": {
+		"banner|300x250|www.example.com|top": 3,
+		"banner|300x250|www.example.com|*": 2,
+		"banner|*|www.example.com|*": 1.5,
+		"*|*|www.example.com|*": 1,
+		"video|640x480|*|*": 4
+	},
+	"default": 0.1
+}`
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"schema": {"fields": ["mediaType"]}, "values": {"BANNER": 1}}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", rules.Currency, "Currency should default to USD")
+	assert.Equal(t, "|", rules.Schema.Delimiter, "Delimiter should default to |")
+	assert.Equal(t, map[string]float64{"banner": 1}, rules.Values, "Keys should be lowercase")
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		rules       string
+	}{
+		{"Malformed JSON", `{`},
+		{"No schema fields", `{"values": {"banner": 1}}`},
+		{"Unknown schema field", `{"schema": {"fields": ["country"]}}`},
+		{"Wrong number of key fields", `{"schema": {"fields": ["mediaType", "size"]}, "values": {"banner": 1}}`},
+		{"Negative floor", `{"schema": {"fields": ["mediaType"]}, "values": {"banner": -1}}`},
+		{"Negative default", `{"schema": {"fields": ["mediaType"]}, "default": -1}`},
+	}
+
+	for _, test := range testCases {
+		_, err := ParseRules([]byte(test.rules))
+		assert.Error(t, err, test.description)
+	}
+}
+
+func TestLoadRulesMissingFile(t *testing.T) {
+	_, err := LoadRules("does-not-exist.json")
+	assert.Error(t, err)
+}
+
+func TestFloor(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	testCases := []struct {
+		description   string
+		req           *openrtb.BidRequest
+		imp           *openrtb.Imp
+		expectedFloor float64
+		expectedOK    bool
+	}{
+		{
+			description:   "Exact match",
+			req:           siteRequest("www.example.com"),
+			imp:           &openrtb.Imp{TagID: "top", Banner: bannerWithFormat(300, 250)},
+			expectedFloor: 3,
+			expectedOK:    true,
+		},
+		{
+			description:   "Case insensitive match",
+			req:           siteRequest("WWW.Example.com"),
+			imp:           &openrtb.Imp{TagID: "TOP", Banner: bannerWithFormat(300, 250)},
+			expectedFloor: 3,
+			expectedOK:    true,
+		},
+		{
+			description:   "Ad unit wildcard",
+			req:           siteRequest("www.example.com"),
+			imp:           &openrtb.Imp{TagID: "bottom", Banner: bannerWithFormat(300, 250)},
+			expectedFloor: 2,
+			expectedOK:    true,
+		},
+		{
+			description:   "Size and ad unit wildcards",
+			req:           siteRequest("www.example.com"),
+			imp:           &openrtb.Imp{Banner: bannerWithFormat(728, 90)},
+			expectedFloor: 1.5,
+			expectedOK:    true,
+		},
+		{
+			description:   "Multiple formats only match size wildcards",
+			req:           siteRequest("www.example.com"),
+			imp:           &openrtb.Imp{TagID: "top", Banner: &openrtb.Banner{Format: []openrtb.Format{{W: 300, H: 250}, {W: 300, H: 600}}}},
+			expectedFloor: 1.5,
+			expectedOK:    true,
+		},
+		{
+			description:   "Multi-format imps only match media type wildcards",
+			req:           siteRequest("www.example.com"),
+			imp:           &openrtb.Imp{Banner: bannerWithFormat(300, 250), Video: &openrtb.Video{W: 640, H: 480}},
+			expectedFloor: 1,
+			expectedOK:    true,
+		},
+		{
+			description:   "Video size",
+			req:           &openrtb.BidRequest{App: &openrtb.App{Domain: "app.example.com"}},
+			imp:           &openrtb.Imp{Video: &openrtb.Video{W: 640, H: 480}},
+			expectedFloor: 4,
+			expectedOK:    true,
+		},
+		{
+			description:   "Default",
+			req:           siteRequest("other.example.com"),
+			imp:           &openrtb.Imp{Banner: bannerWithFormat(300, 250)},
+			expectedFloor: 0.1,
+			expectedOK:    true,
+		},
+	}
+
+	for _, test := range testCases {
+		floor, ok := rules.Floor(test.req, test.imp)
+		assert.Equal(t, test.expectedOK, ok, test.description)
+		assert.Equal(t, test.expectedFloor, floor, test.description)
+	}
+}
+
+func TestFloorNoDefault(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"schema": {"fields": ["mediaType"]}, "values": {"video": 1}}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, ok := rules.Floor(siteRequest("www.example.com"), &openrtb.Imp{Banner: bannerWithFormat(300, 250)})
+	assert.False(t, ok)
+}
+
+func siteRequest(domain string) *openrtb.BidRequest {
+	return &openrtb.BidRequest{Site: &openrtb.Site{Domain: domain}}
+}
+
+func bannerWithFormat(w uint64, h uint64) *openrtb.Banner {
+	return &openrtb.Banner{Format: []openrtb.Format{{W: w, H: h}}}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/prebid/go-gdpr/vendorconsent"
+	"github.com/prebid/go-gdpr/vendorlist"
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
 )
@@ -33,12 +35,36 @@ func NewPermissions(ctx context.Context, cfg config.GDPR, vendorIDs map[openrtb_
 	}
 
 	return &permissionsImpl{
-		cfg:             cfg,
-		vendorIDs:       vendorIDs,
-		fetchVendorList: newVendorListFetcher(ctx, cfg, client, vendorListURLMaker),
+		cfg:               cfg,
+		vendorIDs:         vendorIDs,
+		fetchVendorList:   newVendorListFetcher(ctx, cfg, client, vendorListURLMaker, vendorlist.ParseEagerly),
+		fetchVendorListV2: newVendorListFetcher(ctx, cfg, client, vendorListURLMakerV2, parseVendorListV2),
 	}
 }
 
+// ParseConsentVersion returns the TCF version (1 or 2) of the consent string.
+//
+// If the consent string can't be parsed, the returned error will be an ErrorMalformedConsent.
+func ParseConsentVersion(consent string) (int, error) {
+	if consentVersion(consent) == 2 {
+		if _, err := parseTCF2(consent); err != nil {
+			return 0, &ErrorMalformedConsent{
+				consent: consent,
+				cause:   err,
+			}
+		}
+		return 2, nil
+	}
+
+	if _, err := vendorconsent.ParseString(consent); err != nil {
+		return 0, &ErrorMalformedConsent{
+			consent: consent,
+			cause:   err,
+		}
+	}
+	return 1, nil
+}
+
 // An ErrorMalformedConsent will be returned by the Permissions interface if
 // the consent string argument was the reason for the failure.
 type ErrorMalformedConsent struct {
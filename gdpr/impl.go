@@ -19,6 +19,8 @@ type permissionsImpl struct {
 	cfg             config.GDPR
 	vendorIDs       map[openrtb_ext.BidderName]uint16
 	fetchVendorList func(ctx context.Context, id uint16) (vendorlist.VendorList, error)
+	// fetchVendorListV2 loads the v2 Global Vendor List, which is needed for TCF v2.0 consent strings.
+	fetchVendorListV2 func(ctx context.Context, id uint16) (vendorlist.VendorList, error)
 }
 
 func (p *permissionsImpl) HostCookiesAllowed(ctx context.Context, consent string) (bool, error) {
@@ -62,6 +64,15 @@ func (p *permissionsImpl) allowSync(ctx context.Context, vendorID uint16, consen
 		return p.cfg.UsersyncIfAmbiguous, nil
 	}
 
+	if consentVersion(consent) == 2 {
+		parsedConsent, vendor, err := p.parseVendorV2(ctx, vendorID, consent)
+		if err != nil || vendor == nil {
+			return false, err
+		}
+		// Storage access (purpose 1) can't be based on legitimate interest
+		return allowedByTCF2(parsedConsent, vendor, vendorID, consentconstants.InfoStorageAccess, false), nil
+	}
+
 	parsedConsent, vendor, err := p.parseVendor(ctx, vendorID, consent)
 	if err != nil {
 		return false, err
@@ -84,6 +95,15 @@ func (p *permissionsImpl) allowPI(ctx context.Context, vendorID uint16, consent
 		return p.cfg.UsersyncIfAmbiguous, nil
 	}
 
+	if consentVersion(consent) == 2 {
+		parsedConsent, vendor, err := p.parseVendorV2(ctx, vendorID, consent)
+		if err != nil || vendor == nil {
+			return false, err
+		}
+		// In TCF v2.0, "select basic ads" (purpose 2) covers using personal info to pick the ad
+		return allowedByTCF2(parsedConsent, vendor, vendorID, tcf2PurposeBasicAds, true), nil
+	}
+
 	parsedConsent, vendor, err := p.parseVendor(ctx, vendorID, consent)
 	if err != nil {
 		return false, err
@@ -119,6 +139,56 @@ func (p *permissionsImpl) parseVendor(ctx context.Context, vendorID uint16, cons
 	return
 }
 
+func (p *permissionsImpl) parseVendorV2(ctx context.Context, vendorID uint16, consent string) (parsedConsent *tcf2Consent, vendor *vendorV2, err error) {
+	parsedConsent, err = parseTCF2(consent)
+	if err != nil {
+		err = &ErrorMalformedConsent{
+			consent: consent,
+			cause:   err,
+		}
+		return
+	}
+
+	vendorList, err := p.fetchVendorListV2(ctx, parsedConsent.VendorListVersion())
+	if err != nil {
+		return
+	}
+
+	if v2, ok := vendorList.Vendor(vendorID).(*vendorV2); ok {
+		vendor = v2
+	}
+	return
+}
+
+// allowedByTCF2 decides whether a vendor may use data for a purpose under TCF v2.0. The vendor needs a legal basis
+// which it declared in the vendor list, and which the user granted: either consent, or (if allowLI is true) legitimate
+// interest. Publisher restrictions may forbid the purpose, or switch the legal basis of a flexible purpose.
+func allowedByTCF2(consent *tcf2Consent, vendor *vendorV2, vendorID uint16, purpose consentconstants.Purpose, allowLI bool) bool {
+	useConsent := vendor.Purpose(purpose)
+	useLI := allowLI && vendor.LegitimateInterest(purpose)
+
+	if restriction, ok := consent.PublisherRestriction(purpose, vendorID); ok {
+		switch {
+		case restriction == pubRestrictionNotAllowed:
+			return false
+		case restriction == pubRestrictionRequireConsent && vendor.flexiblePurpose(purpose):
+			useConsent = useConsent || useLI
+			useLI = false
+		case restriction == pubRestrictionRequireLegitimateInterest && vendor.flexiblePurpose(purpose):
+			useLI = allowLI && (useConsent || useLI)
+			useConsent = false
+		}
+	}
+
+	if useConsent && consent.PurposeAllowed(purpose) && consent.VendorConsent(vendorID) {
+		return true
+	}
+	if useLI && consent.PurposeLITransparency(purpose) && consent.VendorLegitimateInterest(vendorID) {
+		return true
+	}
+	return false
+}
+
 // Exporting to allow for easy test setups
 type AlwaysAllow struct{}
 
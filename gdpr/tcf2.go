@@ -0,0 +1,250 @@
+package gdpr
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prebid/go-gdpr/consentconstants"
+)
+
+// This file parses IAB TCF v2.0 consent strings.
+// For the format, see https://github.com/InteractiveAdvertisingBureau/GDPR-Transparency-and-Consent-Framework/blob/master/TCFv2/IAB%20Tech%20Lab%20-%20Consent%20string%20and%20vendor%20list%20formats%20v2.md
+//
+// Nothing in this file is exported. Public APIs can be found in gdpr.go
+
+// tcf2PurposeBasicAds is purpose 2 in TCF v2.0, "Select basic ads".
+const tcf2PurposeBasicAds consentconstants.Purpose = 2
+
+// pubRestrictionType is the restriction a publisher places on a vendor's use of a purpose.
+type pubRestrictionType uint8
+
+const (
+	// pubRestrictionNotAllowed means the vendor may not use the purpose at all.
+	pubRestrictionNotAllowed pubRestrictionType = 0
+	// pubRestrictionRequireConsent means the vendor must have consent, even if it declared a legitimate interest.
+	pubRestrictionRequireConsent pubRestrictionType = 1
+	// pubRestrictionRequireLegitimateInterest means the vendor must rely on legitimate interest instead of consent.
+	pubRestrictionRequireLegitimateInterest pubRestrictionType = 2
+)
+
+// tcf2Consent holds the data from the core segment of a TCF v2.0 consent string.
+type tcf2Consent struct {
+	vendorListVersion     uint16
+	purposesConsent       uint32
+	purposesLI            uint32
+	vendorConsents        vendorSet
+	vendorLIs             vendorSet
+	publisherRestrictions map[consentconstants.Purpose]map[uint16]pubRestrictionType
+}
+
+// vendorSet holds the vendor IDs which were set in a consent string section.
+type vendorSet map[uint16]struct{}
+
+func (s vendorSet) contains(vendorID uint16) bool {
+	_, ok := s[vendorID]
+	return ok
+}
+
+// consentVersion returns the TCF version of the consent string. The version is stored in the first six bits,
+// so it's the value of the first base64 character.
+func consentVersion(consent string) uint8 {
+	if consent == "" {
+		return 0
+	}
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	index := strings.IndexByte(alphabet, consent[0])
+	if index < 0 {
+		return 0
+	}
+	return uint8(index)
+}
+
+// parseTCF2 parses the core segment of a TCF v2.0 consent string. Any other segments are validated, but ignored.
+func parseTCF2(consent string) (*tcf2Consent, error) {
+	segments := strings.Split(consent, ".")
+	for _, segment := range segments[1:] {
+		if _, err := decodeSegment(segment); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := decodeSegment(segments[0])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &bitReader{data: data}
+	if version := r.readInt(6); version != 2 {
+		return nil, fmt.Errorf("the consent string encoded a Version of %d, but this parser only supports version 2", version)
+	}
+	// Created, LastUpdated, CmpId, CmpVersion, ConsentScreen and ConsentLanguage
+	r.skip(36 + 36 + 12 + 12 + 6 + 12)
+
+	parsed := &tcf2Consent{}
+	parsed.vendorListVersion = uint16(r.readInt(12))
+	// TcfPolicyVersion, IsServiceSpecific, UseNonStandardStacks and SpecialFeatureOptIns
+	r.skip(6 + 1 + 1 + 12)
+	parsed.purposesConsent = uint32(r.readInt(24))
+	parsed.purposesLI = uint32(r.readInt(24))
+	// PurposeOneTreatment and PublisherCC
+	r.skip(1 + 12)
+
+	parsed.vendorConsents = r.readVendorSection()
+	parsed.vendorLIs = r.readVendorSection()
+	parsed.publisherRestrictions = r.readPublisherRestrictions()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if parsed.vendorListVersion == 0 {
+		return nil, errors.New("the consent string encoded a VendorListVersion of 0, but this value must be greater than or equal to 1")
+	}
+	return parsed, nil
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+// VendorListVersion returns the version of the v2 Global Vendor List needed to interpret this consent.
+func (c *tcf2Consent) VendorListVersion() uint16 {
+	return c.vendorListVersion
+}
+
+// PurposeAllowed returns true if the user consented to the purpose.
+func (c *tcf2Consent) PurposeAllowed(purpose consentconstants.Purpose) bool {
+	return purposeBitSet(c.purposesConsent, purpose)
+}
+
+// PurposeLITransparency returns true if the user was told about, and didn't object to, legitimate interest for the purpose.
+func (c *tcf2Consent) PurposeLITransparency(purpose consentconstants.Purpose) bool {
+	return purposeBitSet(c.purposesLI, purpose)
+}
+
+// VendorConsent returns true if the user consented to the vendor.
+func (c *tcf2Consent) VendorConsent(vendorID uint16) bool {
+	return c.vendorConsents.contains(vendorID)
+}
+
+// VendorLegitimateInterest returns true if the vendor may rely on legitimate interest.
+func (c *tcf2Consent) VendorLegitimateInterest(vendorID uint16) bool {
+	return c.vendorLIs.contains(vendorID)
+}
+
+// PublisherRestriction returns the restriction the publisher placed on the vendor's use of the purpose, if any.
+func (c *tcf2Consent) PublisherRestriction(purpose consentconstants.Purpose, vendorID uint16) (pubRestrictionType, bool) {
+	restriction, ok := c.publisherRestrictions[purpose][vendorID]
+	return restriction, ok
+}
+
+// purposeBitSet checks a 24 bit purposes field, where purpose 1 is the leftmost bit.
+func purposeBitSet(field uint32, purpose consentconstants.Purpose) bool {
+	if purpose < 1 || purpose > 24 {
+		return false
+	}
+	return field&(1<<(24-uint(purpose))) != 0
+}
+
+// bitReader reads big-endian values from a byte array, one bit field at a time.
+// Once a read goes past the end of the data, err is set and every later read returns 0.
+type bitReader struct {
+	data   []byte
+	offset uint
+	err    error
+}
+
+func (r *bitReader) readInt(bits uint) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.offset+bits > uint(len(r.data))*8 {
+		r.err = fmt.Errorf("the consent string is too short. Tried to read %d bits at offset %d, but it only has %d", bits, r.offset, len(r.data)*8)
+		return 0
+	}
+	var value uint64
+	for i := uint(0); i < bits; i++ {
+		bit := r.offset + i
+		value <<= 1
+		if r.data[bit/8]&(0x80>>(bit%8)) != 0 {
+			value |= 1
+		}
+	}
+	r.offset += bits
+	return value
+}
+
+func (r *bitReader) readBool() bool {
+	return r.readInt(1) == 1
+}
+
+func (r *bitReader) skip(bits uint) {
+	if r.err != nil {
+		return
+	}
+	if r.offset+bits > uint(len(r.data))*8 {
+		r.err = fmt.Errorf("the consent string is too short. Tried to skip %d bits at offset %d, but it only has %d", bits, r.offset, len(r.data)*8)
+		return
+	}
+	r.offset += bits
+}
+
+// readVendorSection reads a vendor consent or vendor legitimate interest section, which may be
+// encoded as either a bitfield or a list of ranges.
+func (r *bitReader) readVendorSection() vendorSet {
+	maxVendorID := uint16(r.readInt(16))
+	vendors := make(vendorSet)
+	if isRangeEncoding := r.readBool(); isRangeEncoding {
+		r.readRanges(func(vendorID uint16) {
+			vendors[vendorID] = struct{}{}
+		})
+		return vendors
+	}
+	for id := uint32(1); id <= uint32(maxVendorID) && r.err == nil; id++ {
+		if r.readBool() {
+			vendors[uint16(id)] = struct{}{}
+		}
+	}
+	return vendors
+}
+
+// readPublisherRestrictions reads the publisher restrictions section, keyed by purpose and then vendor ID.
+func (r *bitReader) readPublisherRestrictions() map[consentconstants.Purpose]map[uint16]pubRestrictionType {
+	restrictions := make(map[consentconstants.Purpose]map[uint16]pubRestrictionType)
+	numRestrictions := r.readInt(12)
+	for i := uint64(0); i < numRestrictions && r.err == nil; i++ {
+		purpose := consentconstants.Purpose(r.readInt(6))
+		restriction := pubRestrictionType(r.readInt(2))
+		if _, ok := restrictions[purpose]; !ok {
+			restrictions[purpose] = make(map[uint16]pubRestrictionType)
+		}
+		r.readRanges(func(vendorID uint16) {
+			restrictions[purpose][vendorID] = restriction
+		})
+	}
+	return restrictions
+}
+
+// readRanges reads a NumEntries field followed by that many single IDs or ID ranges, and calls add for every ID.
+func (r *bitReader) readRanges(add func(vendorID uint16)) {
+	numEntries := r.readInt(12)
+	for i := uint64(0); i < numEntries && r.err == nil; i++ {
+		isRange := r.readBool()
+		start := uint16(r.readInt(16))
+		end := start
+		if isRange {
+			end = uint16(r.readInt(16))
+		}
+		if r.err != nil {
+			return
+		}
+		if end < start {
+			r.err = fmt.Errorf("the consent string encoded a vendor range from %d to %d, which is invalid", start, end)
+			return
+		}
+		for id := uint32(start); id <= uint32(end); id++ {
+			add(uint16(id))
+		}
+	}
+}
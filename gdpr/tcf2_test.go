@@ -0,0 +1,396 @@
+package gdpr
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/prebid/go-gdpr/vendorlist"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsentVersion(t *testing.T) {
+	assert.Equal(t, uint8(0), consentVersion(""))
+	assert.Equal(t, uint8(0), consentVersion("!"))
+	assert.Equal(t, uint8(1), consentVersion("BON3PCUON3PCUABABBAAABoAAAAAMw"))
+	assert.Equal(t, uint8(2), consentVersion(buildTCF2(tcf2Spec{vendorListVersion: 1})))
+}
+
+func TestParseConsentVersion(t *testing.T) {
+	version, err := ParseConsentVersion("BON3PCUON3PCUABABBAAABoAAAAAMw")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	version, err = ParseConsentVersion(buildTCF2(tcf2Spec{vendorListVersion: 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	for _, consent := range []string{"", "!", "BON3P", "CON3P"} {
+		_, err = ParseConsentVersion(consent)
+		_, isBadConsent := err.(*ErrorMalformedConsent)
+		assert.True(t, isBadConsent, "consent %q should be malformed", consent)
+	}
+}
+
+func TestParseTCF2(t *testing.T) {
+	for _, rangeEncoding := range []bool{false, true} {
+		consent := buildTCF2(tcf2Spec{
+			vendorListVersion: 15,
+			purposesConsent:   []uint8{1, 2, 24},
+			purposesLI:        []uint8{2},
+			vendorConsents:    []uint16{2, 3, 4},
+			vendorLIs:         []uint16{5},
+			rangeEncoding:     rangeEncoding,
+			restrictions: []tcf2Restriction{
+				{purpose: 2, restriction: pubRestrictionRequireConsent, vendors: []uint16{3, 4}},
+			},
+		})
+
+		parsed, err := parseTCF2(consent)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, uint16(15), parsed.VendorListVersion())
+		assert.True(t, parsed.PurposeAllowed(1))
+		assert.True(t, parsed.PurposeAllowed(2))
+		assert.False(t, parsed.PurposeAllowed(3))
+		assert.True(t, parsed.PurposeAllowed(24))
+		assert.False(t, parsed.PurposeAllowed(25))
+		assert.True(t, parsed.PurposeLITransparency(2))
+		assert.False(t, parsed.PurposeLITransparency(1))
+		assert.False(t, parsed.VendorConsent(1))
+		assert.True(t, parsed.VendorConsent(3))
+		assert.True(t, parsed.VendorConsent(4))
+		assert.False(t, parsed.VendorConsent(5))
+		assert.True(t, parsed.VendorLegitimateInterest(5))
+		assert.False(t, parsed.VendorLegitimateInterest(2))
+
+		restriction, ok := parsed.PublisherRestriction(2, 4)
+		assert.True(t, ok)
+		assert.Equal(t, pubRestrictionRequireConsent, restriction)
+		_, ok = parsed.PublisherRestriction(2, 5)
+		assert.False(t, ok)
+	}
+}
+
+func TestParseTCF2WithOtherSegments(t *testing.T) {
+	consent := buildTCF2(tcf2Spec{vendorListVersion: 3, vendorConsents: []uint16{1}}) + ".YAAAAAAAAAAA"
+
+	parsed, err := parseTCF2(consent)
+	assert.NoError(t, err)
+	assert.True(t, parsed.VendorConsent(1))
+}
+
+func TestParseTCF2Malformed(t *testing.T) {
+	valid := buildTCF2(tcf2Spec{vendorListVersion: 3, vendorConsents: []uint16{1}})
+
+	testCases := []struct {
+		description string
+		consent     string
+	}{
+		{"Not base64", "C!!!"},
+		{"Too short", valid[:20]},
+		{"Version 1", "BON3PCUON3PCUABABBAAABoAAAAAMw"},
+		{"No vendor list version", buildTCF2(tcf2Spec{vendorListVersion: 0})},
+		{"Bad extra segment", valid + ".!!!"},
+	}
+
+	for _, test := range testCases {
+		_, err := parseTCF2(test.consent)
+		assert.Error(t, err, test.description)
+	}
+}
+
+func TestAllowedSyncsTCF2(t *testing.T) {
+	perms := permissionsImpl{
+		cfg: config.GDPR{
+			HostVendorID: 2,
+		},
+		vendorIDs: map[openrtb_ext.BidderName]uint16{
+			openrtb_ext.BidderAppnexus: 2,
+			openrtb_ext.BidderPubmatic: 3,
+			openrtb_ext.BidderRubicon:  4,
+		},
+		fetchVendorList: failedListFetcher,
+		fetchVendorListV2: listFetcher(map[uint16]vendorlist.VendorList{
+			7: parseVendorListV2Data(t, `{
+				"vendorListVersion": 7,
+				"vendors": {
+					"2": {"id": 2, "purposes": [1]},
+					"3": {"id": 3, "purposes": [1]},
+					"4": {"id": 4, "legIntPurposes": [1]}
+				}
+			}`),
+		}),
+	}
+
+	consent := buildTCF2(tcf2Spec{
+		vendorListVersion: 7,
+		purposesConsent:   []uint8{1},
+		purposesLI:        []uint8{1},
+		vendorConsents:    []uint16{2, 4},
+		vendorLIs:         []uint16{4},
+	})
+
+	allowSync, err := perms.HostCookiesAllowed(context.Background(), consent)
+	assert.NoError(t, err)
+	assert.True(t, allowSync, "Host has purpose 1 consent")
+
+	allowSync, err = perms.BidderSyncAllowed(context.Background(), openrtb_ext.BidderPubmatic, consent)
+	assert.NoError(t, err)
+	assert.False(t, allowSync, "Vendor 3 has no vendor consent")
+
+	allowSync, err = perms.BidderSyncAllowed(context.Background(), openrtb_ext.BidderRubicon, consent)
+	assert.NoError(t, err)
+	assert.False(t, allowSync, "Purpose 1 can't be based on legitimate interest")
+}
+
+func TestAllowPersonalInfoTCF2(t *testing.T) {
+	vendorList := parseVendorListV2Data(t, `{
+		"vendorListVersion": 7,
+		"vendors": {
+			"2": {"id": 2, "purposes": [2]},
+			"3": {"id": 3, "legIntPurposes": [2]},
+			"4": {"id": 4, "legIntPurposes": [2], "flexiblePurposes": [2]},
+			"5": {"id": 5, "purposes": [2]}
+		}
+	}`)
+	perms := permissionsImpl{
+		cfg: config.GDPR{
+			HostVendorID: 2,
+		},
+		vendorIDs: map[openrtb_ext.BidderName]uint16{
+			openrtb_ext.BidderAppnexus: 2,
+			openrtb_ext.BidderPubmatic: 3,
+			openrtb_ext.BidderRubicon:  4,
+			openrtb_ext.BidderOpenx:    5,
+			openrtb_ext.BidderSovrn:    6,
+		},
+		fetchVendorList:   failedListFetcher,
+		fetchVendorListV2: listFetcher(map[uint16]vendorlist.VendorList{7: vendorList}),
+	}
+
+	testCases := []struct {
+		description string
+		bidder      openrtb_ext.BidderName
+		consent     tcf2Spec
+		allowed     bool
+	}{
+		{
+			description: "Consent basis",
+			bidder:      openrtb_ext.BidderAppnexus,
+			consent:     tcf2Spec{vendorListVersion: 7, purposesConsent: []uint8{2}, vendorConsents: []uint16{2}},
+			allowed:     true,
+		},
+		{
+			description: "Consent basis without purpose consent",
+			bidder:      openrtb_ext.BidderAppnexus,
+			consent:     tcf2Spec{vendorListVersion: 7, purposesLI: []uint8{2}, vendorConsents: []uint16{2}, vendorLIs: []uint16{2}},
+			allowed:     false,
+		},
+		{
+			description: "Legitimate interest basis",
+			bidder:      openrtb_ext.BidderPubmatic,
+			consent:     tcf2Spec{vendorListVersion: 7, purposesLI: []uint8{2}, vendorLIs: []uint16{3}},
+			allowed:     true,
+		},
+		{
+			description: "Legitimate interest basis without vendor legitimate interest",
+			bidder:      openrtb_ext.BidderPubmatic,
+			consent:     tcf2Spec{vendorListVersion: 7, purposesLI: []uint8{2}, purposesConsent: []uint8{2}, vendorConsents: []uint16{3}},
+			allowed:     false,
+		},
+		{
+			description: "Publisher requires consent for a flexible purpose",
+			bidder:      openrtb_ext.BidderRubicon,
+			consent: tcf2Spec{vendorListVersion: 7, purposesConsent: []uint8{2}, vendorConsents: []uint16{4},
+				restrictions: []tcf2Restriction{{purpose: 2, restriction: pubRestrictionRequireConsent, vendors: []uint16{4}}}},
+			allowed: true,
+		},
+		{
+			description: "Publisher requires consent, but only legitimate interest was granted",
+			bidder:      openrtb_ext.BidderRubicon,
+			consent: tcf2Spec{vendorListVersion: 7, purposesLI: []uint8{2}, vendorLIs: []uint16{4},
+				restrictions: []tcf2Restriction{{purpose: 2, restriction: pubRestrictionRequireConsent, vendors: []uint16{4}}}},
+			allowed: false,
+		},
+		{
+			description: "Publisher disallows the purpose",
+			bidder:      openrtb_ext.BidderOpenx,
+			consent: tcf2Spec{vendorListVersion: 7, purposesConsent: []uint8{2}, vendorConsents: []uint16{5},
+				restrictions: []tcf2Restriction{{purpose: 2, restriction: pubRestrictionNotAllowed, vendors: []uint16{5}}}},
+			allowed: false,
+		},
+		{
+			description: "Vendor missing from the vendor list",
+			bidder:      openrtb_ext.BidderSovrn,
+			consent:     tcf2Spec{vendorListVersion: 7, purposesConsent: []uint8{2}, vendorConsents: []uint16{6}},
+			allowed:     false,
+		},
+	}
+
+	for _, test := range testCases {
+		allowPI, err := perms.PersonalInfoAllowed(context.Background(), test.bidder, "", buildTCF2(test.consent))
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.allowed, allowPI, test.description)
+	}
+}
+
+func TestMalformedConsentTCF2(t *testing.T) {
+	perms := permissionsImpl{
+		cfg: config.GDPR{
+			HostVendorID: 2,
+		},
+		fetchVendorListV2: listFetcher(nil),
+	}
+
+	sync, err := perms.HostCookiesAllowed(context.Background(), "CPP")
+	assertErr(t, err, true)
+	assertBoolsEqual(t, false, sync)
+}
+
+func TestUnknownVendorListTCF2(t *testing.T) {
+	perms := permissionsImpl{
+		cfg: config.GDPR{
+			HostVendorID: 2,
+		},
+		fetchVendorListV2: failedListFetcher,
+	}
+
+	sync, err := perms.HostCookiesAllowed(context.Background(), buildTCF2(tcf2Spec{vendorListVersion: 7}))
+	assertErr(t, err, false)
+	assertBoolsEqual(t, false, sync)
+}
+
+func parseVendorListV2Data(t *testing.T, data string) vendorlist.VendorList {
+	t.Helper()
+	list, err := parseVendorListV2([]byte(data))
+	if err != nil {
+		t.Fatalf("Failed to parse vendor list data. %v", err)
+	}
+	return list
+}
+
+type tcf2Spec struct {
+	vendorListVersion uint16
+	purposesConsent   []uint8
+	purposesLI        []uint8
+	vendorConsents    []uint16
+	vendorLIs         []uint16
+	rangeEncoding     bool
+	restrictions      []tcf2Restriction
+}
+
+type tcf2Restriction struct {
+	purpose     uint8
+	restriction pubRestrictionType
+	vendors     []uint16
+}
+
+// buildTCF2 encodes the core segment of a TCF v2.0 consent string.
+func buildTCF2(spec tcf2Spec) string {
+	w := &bitWriter{}
+	w.write(2, 6)
+	w.write(15100000000, 36) // Created
+	w.write(15100000000, 36) // LastUpdated
+	w.write(7, 12)           // CmpId
+	w.write(1, 12)           // CmpVersion
+	w.write(1, 6)            // ConsentScreen
+	w.write(4*64+13, 12)     // ConsentLanguage "EN"
+	w.write(uint64(spec.vendorListVersion), 12)
+	w.write(2, 6) // TcfPolicyVersion
+	w.write(0, 1) // IsServiceSpecific
+	w.write(0, 1) // UseNonStandardStacks
+	w.write(0, 12)
+	w.writePurposes(spec.purposesConsent)
+	w.writePurposes(spec.purposesLI)
+	w.write(0, 1)        // PurposeOneTreatment
+	w.write(4*64+13, 12) // PublisherCC
+	w.writeVendors(spec.vendorConsents, spec.rangeEncoding)
+	w.writeVendors(spec.vendorLIs, spec.rangeEncoding)
+	w.write(uint64(len(spec.restrictions)), 12)
+	for _, restriction := range spec.restrictions {
+		w.write(uint64(restriction.purpose), 6)
+		w.write(uint64(restriction.restriction), 2)
+		w.writeRanges(restriction.vendors)
+	}
+	return w.encode()
+}
+
+type bitWriter struct {
+	bits []bool
+}
+
+func (w *bitWriter) write(value uint64, bits uint) {
+	for i := bits; i > 0; i-- {
+		w.bits = append(w.bits, value&(1<<(i-1)) != 0)
+	}
+}
+
+func (w *bitWriter) writePurposes(purposes []uint8) {
+	var field uint64
+	for _, purpose := range purposes {
+		field |= 1 << (24 - uint(purpose))
+	}
+	w.write(field, 24)
+}
+
+func (w *bitWriter) writeVendors(vendors []uint16, rangeEncoding bool) {
+	var maxVendorID uint16
+	for _, vendor := range vendors {
+		if vendor > maxVendorID {
+			maxVendorID = vendor
+		}
+	}
+	w.write(uint64(maxVendorID), 16)
+	if rangeEncoding {
+		w.write(1, 1)
+		w.writeRanges(vendors)
+		return
+	}
+	w.write(0, 1)
+	for id := uint16(1); id <= maxVendorID; id++ {
+		set := false
+		for _, vendor := range vendors {
+			set = set || vendor == id
+		}
+		if set {
+			w.write(1, 1)
+		} else {
+			w.write(0, 1)
+		}
+	}
+}
+
+// writeRanges writes every vendor as a single ID entry, except for the last two which are written as a range.
+func (w *bitWriter) writeRanges(vendors []uint16) {
+	if len(vendors) < 2 {
+		w.write(uint64(len(vendors)), 12)
+		for _, vendor := range vendors {
+			w.write(0, 1)
+			w.write(uint64(vendor), 16)
+		}
+		return
+	}
+	last := len(vendors) - 2
+	w.write(uint64(last+1), 12)
+	for _, vendor := range vendors[:last] {
+		w.write(0, 1)
+		w.write(uint64(vendor), 16)
+	}
+	w.write(1, 1)
+	w.write(uint64(vendors[last]), 16)
+	w.write(uint64(vendors[last+1]), 16)
+}
+
+func (w *bitWriter) encode() string {
+	data := make([]byte, (len(w.bits)+7)/8)
+	for i, bit := range w.bits {
+		if bit {
+			data[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
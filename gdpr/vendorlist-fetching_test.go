@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prebid/go-gdpr/vendorlist"
 	"github.com/prebid/prebid-server/config"
 )
 
@@ -29,7 +30,7 @@ func TestVendorFetch(t *testing.T) {
 	})))
 	defer server.Close()
 
-	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	list, err := fetcher(context.Background(), 1)
 	assertNilErr(t, err)
 	vendor := list.Vendor(32)
@@ -61,7 +62,7 @@ func TestLazyFetch(t *testing.T) {
 	})))
 	defer server.Close()
 
-	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	list, err := fetcher(context.Background(), 2)
 	assertNilErr(t, err)
 
@@ -83,7 +84,7 @@ func TestInitialTimeout(t *testing.T) {
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Time{})
 	defer cancel()
-	fetcher := newVendorListFetcher(ctx, testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(ctx, testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	_, err := fetcher(context.Background(), 1) // This should do a lazy fetch, even though the initial call failed
 	assertNilErr(t, err)
 }
@@ -106,7 +107,7 @@ func TestFetchThrottling(t *testing.T) {
 	})))
 	defer server.Close()
 
-	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	_, err := fetcher(context.Background(), 2)
 	assertNilErr(t, err)
 	_, err = fetcher(context.Background(), 3)
@@ -117,7 +118,7 @@ func TestMalformedVendorlistFetch(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(mockServer(1, map[int]string{1: "{}"})))
 	defer server.Close()
 
-	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	_, err := fetcher(context.Background(), 1)
 	assertErr(t, err, false)
 }
@@ -126,7 +127,7 @@ func TestMissingVendorlistFetch(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(mockServer(1, map[int]string{1: "{}"})))
 	defer server.Close()
 
-	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server))
+	fetcher := newVendorListFetcher(context.Background(), testConfig(), server.Client(), testURLMaker(server), vendorlist.ParseEagerly)
 	_, err := fetcher(context.Background(), 2)
 	assertErr(t, err, false)
 }
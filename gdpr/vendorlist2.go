@@ -0,0 +1,109 @@
+package gdpr
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/prebid/go-gdpr/consentconstants"
+	"github.com/prebid/go-gdpr/vendorlist"
+)
+
+// This file parses version 2 of the IAB Global Vendor List, which is used to interpret TCF v2.0 consent strings.
+// For the format, see https://github.com/InteractiveAdvertisingBureau/GDPR-Transparency-and-Consent-Framework/blob/master/TCFv2/IAB%20Tech%20Lab%20-%20Consent%20string%20and%20vendor%20list%20formats%20v2.md#the-global-vendor-list
+//
+// Nothing in this file is exported. Public APIs can be found in gdpr.go
+
+// Make a URL which can be used to fetch a given version of the v2 Global Vendor List. If the version is 0,
+// this will fetch the latest version.
+func vendorListURLMakerV2(version uint16) string {
+	if version == 0 {
+		return "https://vendor-list.consensu.org/v2/vendor-list.json"
+	}
+	return "https://vendor-list.consensu.org/v2/archives/vendor-list-v" + strconv.Itoa(int(version)) + ".json"
+}
+
+type vendorListV2Contract struct {
+	Version uint16                      `json:"vendorListVersion"`
+	Vendors map[string]vendorV2Contract `json:"vendors"`
+}
+
+type vendorV2Contract struct {
+	ID               uint16  `json:"id"`
+	Purposes         []uint8 `json:"purposes"`
+	LegIntPurposes   []uint8 `json:"legIntPurposes"`
+	FlexiblePurposes []uint8 `json:"flexiblePurposes"`
+}
+
+// parseVendorListV2 parses a v2 Global Vendor List into the same interface as the v1 lists.
+func parseVendorListV2(data []byte) (vendorlist.VendorList, error) {
+	var contract vendorListV2Contract
+	if err := json.Unmarshal(data, &contract); err != nil {
+		return nil, err
+	}
+	if contract.Version == 0 {
+		return nil, errors.New("data.vendorListVersion was 0 or undefined. Versions should start at 1")
+	}
+	if len(contract.Vendors) == 0 {
+		return nil, errors.New("data.vendors was undefined or had no elements")
+	}
+
+	list := &vendorListV2{
+		version: contract.Version,
+		vendors: make(map[uint16]*vendorV2, len(contract.Vendors)),
+	}
+	for _, vendor := range contract.Vendors {
+		list.vendors[vendor.ID] = &vendorV2{
+			purposes:         purposeSet(vendor.Purposes),
+			legIntPurposes:   purposeSet(vendor.LegIntPurposes),
+			flexiblePurposes: purposeSet(vendor.FlexiblePurposes),
+		}
+	}
+	return list, nil
+}
+
+func purposeSet(purposes []uint8) map[consentconstants.Purpose]struct{} {
+	set := make(map[consentconstants.Purpose]struct{}, len(purposes))
+	for _, purpose := range purposes {
+		set[consentconstants.Purpose(purpose)] = struct{}{}
+	}
+	return set
+}
+
+type vendorListV2 struct {
+	version uint16
+	vendors map[uint16]*vendorV2
+}
+
+func (l *vendorListV2) Version() uint16 {
+	return l.version
+}
+
+func (l *vendorListV2) Vendor(vendorID uint16) vendorlist.Vendor {
+	if vendor, ok := l.vendors[vendorID]; ok {
+		return vendor
+	}
+	return nil
+}
+
+type vendorV2 struct {
+	purposes         map[consentconstants.Purpose]struct{}
+	legIntPurposes   map[consentconstants.Purpose]struct{}
+	flexiblePurposes map[consentconstants.Purpose]struct{}
+}
+
+func (v *vendorV2) Purpose(purposeID consentconstants.Purpose) bool {
+	_, ok := v.purposes[purposeID]
+	return ok
+}
+
+func (v *vendorV2) LegitimateInterest(purposeID consentconstants.Purpose) bool {
+	_, ok := v.legIntPurposes[purposeID]
+	return ok
+}
+
+// flexiblePurpose returns true if publisher restrictions may switch the legal basis the vendor uses for the purpose.
+func (v *vendorV2) flexiblePurpose(purposeID consentconstants.Purpose) bool {
+	_, ok := v.flexiblePurposes[purposeID]
+	return ok
+}
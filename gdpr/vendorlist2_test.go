@@ -0,0 +1,53 @@
+package gdpr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVendorListMakerV2(t *testing.T) {
+	assertStringsEqual(t, "https://vendor-list.consensu.org/v2/vendor-list.json", vendorListURLMakerV2(0))
+	assertStringsEqual(t, "https://vendor-list.consensu.org/v2/archives/vendor-list-v2.json", vendorListURLMakerV2(2))
+	assertStringsEqual(t, "https://vendor-list.consensu.org/v2/archives/vendor-list-v12.json", vendorListURLMakerV2(12))
+}
+
+func TestParseVendorListV2(t *testing.T) {
+	list, err := parseVendorListV2([]byte(`{
+		"vendorListVersion": 12,
+		"vendors": {
+			"8": {"id": 8, "purposes": [1, 2], "legIntPurposes": [7], "flexiblePurposes": [2, 7]}
+		}
+	}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, uint16(12), list.Version())
+	assert.Nil(t, list.Vendor(9))
+
+	vendor := list.Vendor(8).(*vendorV2)
+	assert.True(t, vendor.Purpose(1))
+	assert.True(t, vendor.Purpose(2))
+	assert.False(t, vendor.Purpose(7))
+	assert.True(t, vendor.LegitimateInterest(7))
+	assert.False(t, vendor.LegitimateInterest(1))
+	assert.True(t, vendor.flexiblePurpose(2))
+	assert.False(t, vendor.flexiblePurpose(1))
+}
+
+func TestParseVendorListV2Errors(t *testing.T) {
+	testCases := []struct {
+		description string
+		data        string
+	}{
+		{"Malformed JSON", `{`},
+		{"No version", `{"vendors": {"8": {"id": 8}}}`},
+		{"No vendors", `{"vendorListVersion": 12}`},
+	}
+
+	for _, test := range testCases {
+		_, err := parseVendorListV2([]byte(test.data))
+		assert.Error(t, err, test.description)
+	}
+}
@@ -20,6 +20,14 @@ type UserSyncTemplateParams struct {
 	USPrivacy   string
 }
 
+// VASTTrackerTemplateParams specifies params for the impression tracker URL template which is added to cached VAST
+type VASTTrackerTemplateParams struct {
+	Bidder    string
+	BidID     string
+	AccountID string
+	Timestamp string
+}
+
 // ResolveMacros resolves macros in the given template with the provided params
 func ResolveMacros(aTemplate template.Template, params interface{}) (string, error) {
 	strBuf := bytes.Buffer{}
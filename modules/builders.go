@@ -0,0 +1,10 @@
+package modules
+
+// Builders returns the builders for every module which can be enabled through the hooks config, keyed by
+// module name. Module names are lower-case, since the config keys are, and they can't contain dots, since viper
+// splits the keys on them. Use underscores instead, like "vendor_module".
+//
+// Modules should live in their own package under modules/, and be added here.
+func Builders() map[string]ModuleBuilder {
+	return map[string]ModuleBuilder{}
+}
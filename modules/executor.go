@@ -0,0 +1,388 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/golang/glog"
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/errortypes"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// The values of ExtModuleTrace.Status
+const (
+	statusSuccess          = "success"
+	statusRejected         = "rejected"
+	statusTimeout          = "timeout"
+	statusExecutionFailure = "execution_failure"
+)
+
+// RejectError is returned by the Executor when a module rejects the request, or a bidder.
+type RejectError struct {
+	Module string
+	Stage  Stage
+	// Bidder is only set for rejections at the bidder stages.
+	Bidder  openrtb_ext.BidderName
+	NbrCode int
+	Message string
+}
+
+func (err *RejectError) Error() string {
+	if err.Bidder != "" {
+		return fmt.Sprintf("Module %s rejected bidder %s at the %s stage: %s", err.Module, err.Bidder, err.Stage, err.Message)
+	}
+	return fmt.Sprintf("Module %s rejected the request at the %s stage: %s", err.Module, err.Stage, err.Message)
+}
+
+// Code returns the error code, so that rejected bidders are counted in the adapter error metrics.
+func (err *RejectError) Code() int {
+	return errortypes.ModuleRejectedCode
+}
+
+// FindRejectError returns the first RejectError in the list, or nil if there isn't one.
+func FindRejectError(errs []error) *RejectError {
+	for _, err := range errs {
+		if rejectErr, ok := err.(*RejectError); ok {
+			return rejectErr
+		}
+	}
+	return nil
+}
+
+var errNilPayload = errors.New("hook returned an empty payload")
+
+// Executor runs the modules for a single request, and collects their outcomes for ext.prebid.modules.
+//
+// A nil Executor is valid, and passes every payload through untouched. The bidder stages may run
+// from several goroutines at once.
+type Executor struct {
+	registry *Registry
+	endpoint string
+
+	// account is nil until SetAccount is called, so only the host plan runs before then.
+	account        *config.Account
+	accountConfigs map[string]json.RawMessage
+
+	lock     sync.Mutex
+	errors   map[string]map[string][]string
+	warnings map[string]map[string][]string
+	trace    []openrtb_ext.ExtModuleTrace
+}
+
+// SetAccount makes the executor run the account's execution plan after the host one, and pass the
+// account's module config to the hooks. It should be called as soon as the account is known.
+func (e *Executor) SetAccount(account *config.Account) {
+	if e == nil || account == nil {
+		return
+	}
+	e.account = account
+	e.accountConfigs = make(map[string]json.RawMessage, len(account.Hooks.Modules))
+	for name, moduleCfg := range account.Hooks.Modules {
+		cfgJSON, err := json.Marshal(moduleCfg)
+		if err != nil {
+			e.addMessages(&e.errors, name, "account_config", "", []string{fmt.Sprintf("Account config for module %s could not be converted to JSON: %v", name, err)})
+			continue
+		}
+		e.accountConfigs[name] = cfgJSON
+	}
+}
+
+// ExecuteEntrypointStage runs the entrypoint hooks, and returns the request body which should be used from now on.
+func (e *Executor) ExecuteEntrypointStage(req *http.Request, body []byte) ([]byte, *RejectError) {
+	if e == nil {
+		return body, nil
+	}
+	payload, rejectErr := e.executeStage(StageEntrypoint, "", EntrypointPayload{Request: req, Body: body}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		return module.(EntrypointHook).HandleEntrypointHook(ctx, invocation, payload.(EntrypointPayload))
+	})
+	return payload.(EntrypointPayload).Body, rejectErr
+}
+
+// ExecuteRawAuctionRequestStage runs the raw_auction_request hooks, and returns the request JSON which should be used from now on.
+func (e *Executor) ExecuteRawAuctionRequestStage(body []byte) ([]byte, *RejectError) {
+	if e == nil {
+		return body, nil
+	}
+	payload, rejectErr := e.executeStage(StageRawAuctionRequest, "", RawAuctionRequestPayload{Body: body}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		return module.(RawAuctionRequestHook).HandleRawAuctionRequestHook(ctx, invocation, payload.(RawAuctionRequestPayload))
+	})
+	return payload.(RawAuctionRequestPayload).Body, rejectErr
+}
+
+// ExecuteProcessedAuctionRequestStage runs the processed_auction_request hooks, and returns the request which should be auctioned.
+func (e *Executor) ExecuteProcessedAuctionRequestStage(req *openrtb.BidRequest) (*openrtb.BidRequest, *RejectError) {
+	if e == nil {
+		return req, nil
+	}
+	payload, rejectErr := e.executeStage(StageProcessedAuctionRequest, "", ProcessedAuctionRequestPayload{Request: req}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		newPayload, result, err := module.(ProcessedAuctionRequestHook).HandleProcessedAuctionRequestHook(ctx, invocation, payload.(ProcessedAuctionRequestPayload))
+		if err == nil && newPayload.Request == nil {
+			err = errNilPayload
+		}
+		return newPayload, result, err
+	})
+	return payload.(ProcessedAuctionRequestPayload).Request, rejectErr
+}
+
+// ExecuteBidderRequestStage runs the bidder_request hooks, and returns the request which should be sent to the bidder.
+// If a module rejects, the bidder shouldn't be called at all.
+func (e *Executor) ExecuteBidderRequestStage(bidder openrtb_ext.BidderName, req *openrtb.BidRequest) (*openrtb.BidRequest, *RejectError) {
+	if e == nil {
+		return req, nil
+	}
+	payload, rejectErr := e.executeStage(StageBidderRequest, bidder, BidderRequestPayload{Bidder: bidder, Request: req}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		newPayload, result, err := module.(BidderRequestHook).HandleBidderRequestHook(ctx, invocation, payload.(BidderRequestPayload))
+		if err == nil && newPayload.Request == nil {
+			err = errNilPayload
+		}
+		return newPayload, result, err
+	})
+	return payload.(BidderRequestPayload).Request, rejectErr
+}
+
+// ExecuteRawBidderResponseStage runs the raw_bidder_response hooks, and returns the bids which should stay in the auction.
+// If a module rejects, none of the bidder's bids should be used.
+func (e *Executor) ExecuteRawBidderResponseStage(bidder openrtb_ext.BidderName, bids []*adapters.TypedBid) ([]*adapters.TypedBid, *RejectError) {
+	if e == nil {
+		return bids, nil
+	}
+	payload, rejectErr := e.executeStage(StageRawBidderResponse, bidder, RawBidderResponsePayload{Bidder: bidder, Bids: bids}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		return module.(RawBidderResponseHook).HandleRawBidderResponseHook(ctx, invocation, payload.(RawBidderResponsePayload))
+	})
+	return payload.(RawBidderResponsePayload).Bids, rejectErr
+}
+
+// ExecuteAllProcessedBidResponsesStage runs the all_processed_bid_responses hooks, and returns the bids which should stay in the auction.
+func (e *Executor) ExecuteAllProcessedBidResponsesStage(bids map[openrtb_ext.BidderName][]*adapters.TypedBid) map[openrtb_ext.BidderName][]*adapters.TypedBid {
+	if e == nil {
+		return bids
+	}
+	payload, _ := e.executeStage(StageAllProcessedBidResponses, "", AllProcessedBidResponsesPayload{Bids: bids}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		newPayload, result, err := module.(AllProcessedBidResponsesHook).HandleAllProcessedBidResponsesHook(ctx, invocation, payload.(AllProcessedBidResponsesPayload))
+		if err == nil && newPayload.Bids == nil {
+			err = errNilPayload
+		}
+		return newPayload, result, err
+	})
+	return payload.(AllProcessedBidResponsesPayload).Bids
+}
+
+// ExecuteAuctionResponseStage runs the auction_response hooks, and returns the response which should be sent.
+func (e *Executor) ExecuteAuctionResponseStage(resp *openrtb.BidResponse) *openrtb.BidResponse {
+	if e == nil {
+		return resp
+	}
+	payload, _ := e.executeStage(StageAuctionResponse, "", AuctionResponsePayload{Response: resp}, func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error) {
+		newPayload, result, err := module.(AuctionResponseHook).HandleAuctionResponseHook(ctx, invocation, payload.(AuctionResponsePayload))
+		if err == nil && newPayload.Response == nil {
+			err = errNilPayload
+		}
+		return newPayload, result, err
+	})
+	return payload.(AuctionResponsePayload).Response
+}
+
+// hookCall calls the stage's hook on the module. The module is guaranteed to implement it.
+type hookCall func(ctx context.Context, module interface{}, invocation InvocationContext, payload interface{}) (interface{}, HookResult, error)
+
+type hookResponse struct {
+	payload interface{}
+	result  HookResult
+	err     error
+}
+
+// executeStage runs every module in the execution plan for the stage, one after another. Each module
+// gets the payload returned by the one before it.
+func (e *Executor) executeStage(stage Stage, bidder openrtb_ext.BidderName, payload interface{}, call hookCall) (interface{}, *RejectError) {
+	for _, invocation := range e.invocations(stage) {
+		module := e.registry.modules[invocation.Module]
+		timeout := e.registry.defaultTimeout
+		if invocation.TimeoutMS > 0 {
+			timeout = time.Duration(invocation.TimeoutMS) * time.Millisecond
+		}
+
+		start := time.Now()
+		response, timedOut := e.invoke(stage, invocation.Module, module, payload, call, timeout)
+		trace := openrtb_ext.ExtModuleTrace{
+			Stage:               string(stage),
+			Module:              invocation.Module,
+			Bidder:              bidder,
+			ExecutionTimeMillis: int(time.Since(start) / time.Millisecond),
+			Message:             response.result.Message,
+			DebugMessages:       response.result.DebugMessages,
+		}
+
+		var rejectErr *RejectError
+		switch {
+		case timedOut:
+			trace.Status = statusTimeout
+			e.addMessages(&e.errors, invocation.Module, string(stage), bidder, []string{fmt.Sprintf("Hook timed out after %d ms", timeout/time.Millisecond)})
+		case response.err != nil:
+			trace.Status = statusExecutionFailure
+			e.addMessages(&e.errors, invocation.Module, string(stage), bidder, []string{response.err.Error()})
+		case response.result.Reject && !stage.canReject():
+			trace.Status = statusExecutionFailure
+			e.addMessages(&e.errors, invocation.Module, string(stage), bidder, []string{fmt.Sprintf("Rejection is not supported at the %s stage", stage)})
+		case response.result.Reject:
+			trace.Status = statusRejected
+			rejectErr = &RejectError{
+				Module:  invocation.Module,
+				Stage:   stage,
+				Bidder:  bidder,
+				NbrCode: response.result.NbrCode,
+				Message: response.result.Message,
+			}
+		default:
+			trace.Status = statusSuccess
+			payload = response.payload
+		}
+		if !timedOut {
+			e.addMessages(&e.errors, invocation.Module, string(stage), bidder, response.result.Errors)
+			e.addMessages(&e.warnings, invocation.Module, string(stage), bidder, response.result.Warnings)
+		}
+		e.addTrace(trace)
+
+		if rejectErr != nil {
+			return payload, rejectErr
+		}
+	}
+	return payload, nil
+}
+
+// invoke calls a single hook within its time budget. If the hook doesn't finish in time, it's left
+// running in the background and its result is thrown away.
+func (e *Executor) invoke(stage Stage, name string, module interface{}, payload interface{}, call hookCall, timeout time.Duration) (hookResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	invocation := InvocationContext{
+		Endpoint:      e.endpoint,
+		Stage:         stage,
+		AccountConfig: e.accountConfigs[name],
+	}
+	if e.account != nil {
+		invocation.AccountID = e.account.ID
+	}
+
+	done := make(chan hookResponse, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				glog.Errorf("Module %s panicked at the %s stage: %v", name, stage, r)
+				done <- hookResponse{err: fmt.Errorf("Hook panicked: %v", r)}
+			}
+		}()
+		newPayload, result, err := call(ctx, module, invocation, payload)
+		done <- hookResponse{newPayload, result, err}
+	}()
+
+	select {
+	case response := <-done:
+		return response, false
+	case <-ctx.Done():
+		return hookResponse{}, true
+	}
+}
+
+// invocations returns the host execution plan for the stage, followed by the account's. Account
+// invocations which can't run are reported as errors and skipped.
+func (e *Executor) invocations(stage Stage) []config.HookInvocation {
+	invocations := e.registry.plan.Endpoints[e.endpoint].Stages[string(stage)]
+	if e.account == nil {
+		return invocations
+	}
+	accountInvocations := e.account.Hooks.ExecutionPlan.Endpoints[e.endpoint].Stages[string(stage)]
+	if len(accountInvocations) == 0 {
+		return invocations
+	}
+
+	merged := make([]config.HookInvocation, len(invocations), len(invocations)+len(accountInvocations))
+	copy(merged, invocations)
+	for _, invocation := range accountInvocations {
+		if err := e.registry.validateInvocation(stage, invocation); err != nil {
+			e.addMessages(&e.errors, invocation.Module, string(stage), "", []string{fmt.Sprintf("Account execution plan for %s is invalid: %v", e.endpoint, err)})
+			continue
+		}
+		merged = append(merged, invocation)
+	}
+	return merged
+}
+
+// addMessages adds messages from a module to the errors or warnings. Messages from the bidder stages
+// are prefixed with the bidder, since every bidder runs the same hooks.
+func (e *Executor) addMessages(messages *map[string]map[string][]string, module string, key string, bidder openrtb_ext.BidderName, newMessages []string) {
+	if len(newMessages) == 0 {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if *messages == nil {
+		*messages = make(map[string]map[string][]string)
+	}
+	if (*messages)[module] == nil {
+		(*messages)[module] = make(map[string][]string)
+	}
+	for _, message := range newMessages {
+		if bidder != "" {
+			message = fmt.Sprintf("%s: %s", bidder, message)
+		}
+		(*messages)[module][key] = append((*messages)[module][key], message)
+	}
+}
+
+func (e *Executor) addTrace(trace openrtb_ext.ExtModuleTrace) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.trace = append(e.trace, trace)
+}
+
+// ModulesExt returns the outcomes of every hook which ran, in the form of bidresponse.ext.prebid.modules.
+// The trace is only included if debug is true. It returns nil if there's nothing to report.
+func (e *Executor) ModulesExt(debug bool) *openrtb_ext.ExtModules {
+	if e == nil {
+		return nil
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	modulesExt := &openrtb_ext.ExtModules{
+		Errors:   e.errors,
+		Warnings: e.warnings,
+	}
+	if debug {
+		modulesExt.Trace = e.trace
+	}
+	if len(modulesExt.Errors) == 0 && len(modulesExt.Warnings) == 0 && len(modulesExt.Trace) == 0 {
+		return nil
+	}
+	return modulesExt
+}
+
+// WriteModulesExt sets ext.prebid.modules on the given response ext, if there's anything to report.
+// The given ext is not modified.
+func (e *Executor) WriteModulesExt(ext json.RawMessage, debug bool) (json.RawMessage, error) {
+	modulesExt := e.ModulesExt(debug)
+	if modulesExt == nil {
+		return ext, nil
+	}
+	if len(ext) == 0 {
+		return json.Marshal(openrtb_ext.ExtBidResponse{
+			Prebid: &openrtb_ext.ExtResponsePrebid{Modules: modulesExt},
+		})
+	}
+	modulesJSON, err := json.Marshal(modulesExt)
+	if err != nil {
+		return nil, err
+	}
+	return jsonparser.Set(append([]byte(nil), ext...), modulesJSON, "prebid", "modules")
+}
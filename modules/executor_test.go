@@ -0,0 +1,268 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNilExecutor(t *testing.T) {
+	var executor *Executor
+	request := &openrtb.BidRequest{ID: "request"}
+	response := &openrtb.BidResponse{ID: "response"}
+	bids := []*adapters.TypedBid{{Bid: &openrtb.Bid{ID: "bid"}}}
+
+	executor.SetAccount(&config.Account{})
+	body, rejectErr := executor.ExecuteEntrypointStage(httptest.NewRequest("POST", "/openrtb2/auction", nil), []byte("body"))
+	assert.Equal(t, "body", string(body))
+	assert.Nil(t, rejectErr)
+	body, rejectErr = executor.ExecuteRawAuctionRequestStage([]byte("raw"))
+	assert.Equal(t, "raw", string(body))
+	assert.Nil(t, rejectErr)
+	newRequest, rejectErr := executor.ExecuteProcessedAuctionRequestStage(request)
+	assert.Equal(t, request, newRequest)
+	assert.Nil(t, rejectErr)
+	newRequest, rejectErr = executor.ExecuteBidderRequestStage("appnexus", request)
+	assert.Equal(t, request, newRequest)
+	assert.Nil(t, rejectErr)
+	newBids, rejectErr := executor.ExecuteRawBidderResponseStage("appnexus", bids)
+	assert.Equal(t, bids, newBids)
+	assert.Nil(t, rejectErr)
+	assert.Equal(t, map[openrtb_ext.BidderName][]*adapters.TypedBid{"appnexus": bids}, executor.ExecuteAllProcessedBidResponsesStage(map[openrtb_ext.BidderName][]*adapters.TypedBid{"appnexus": bids}))
+	assert.Equal(t, response, executor.ExecuteAuctionResponseStage(response))
+	assert.Nil(t, executor.ModulesExt(true))
+	ext, err := executor.WriteModulesExt(json.RawMessage(`{"tmaxrequest":10}`), true)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"tmaxrequest":10}`, string(ext))
+}
+
+func TestExecuteStageRunsModulesInOrder(t *testing.T) {
+	registry := newTestRegistry(t, map[string]interface{}{
+		"acme_first":  tmaxModule{tmax: 100},
+		"acme_second": tmaxModule{tmax: 200},
+	}, newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_first", "acme_second"))
+	executor := registry.NewExecutor(EndpointAuction)
+	request := &openrtb.BidRequest{ID: "request", TMax: 50}
+
+	newRequest, rejectErr := executor.ExecuteProcessedAuctionRequestStage(request)
+
+	assert.Nil(t, rejectErr)
+	assert.Equal(t, int64(200), newRequest.TMax)
+	assert.Equal(t, int64(50), request.TMax, "The original request shouldn't be modified")
+	modulesExt := executor.ModulesExt(true)
+	if assert.NotNil(t, modulesExt) && assert.Len(t, modulesExt.Trace, 2) {
+		assert.Equal(t, "acme_first", modulesExt.Trace[0].Module)
+		assert.Equal(t, "acme_second", modulesExt.Trace[1].Module)
+		assert.Equal(t, "success", modulesExt.Trace[1].Status)
+	}
+	assert.Equal(t, map[string]map[string][]string{
+		"acme_first":  {"processed_auction_request": {"tmax changed"}},
+		"acme_second": {"processed_auction_request": {"tmax changed"}},
+	}, modulesExt.Warnings)
+	assert.Nil(t, executor.ModulesExt(false).Trace, "The trace should only be returned in debug mode")
+	assert.Nil(t, executor.ExecuteAuctionResponseStage(nil), "Stages without modules shouldn't run anything")
+}
+
+func TestExecuteStageReject(t *testing.T) {
+	registry := newTestRegistry(t, map[string]interface{}{
+		"acme_reject": rejectModule{},
+		"acme_tmax":   tmaxModule{tmax: 100},
+	}, config.HookExecutionPlan{
+		Endpoints: map[string]config.HookEndpointPlan{
+			EndpointAuction: {Stages: map[string][]config.HookInvocation{
+				string(StageEntrypoint):      {{Module: "acme_reject"}},
+				string(StageAuctionResponse): {{Module: "acme_reject"}},
+			}},
+		},
+	})
+	executor := registry.NewExecutor(EndpointAuction)
+
+	body, rejectErr := executor.ExecuteEntrypointStage(httptest.NewRequest("POST", EndpointAuction, nil), []byte("body"))
+
+	assert.Equal(t, "body", string(body))
+	if assert.NotNil(t, rejectErr) {
+		assert.Equal(t, "acme_reject", rejectErr.Module)
+		assert.Equal(t, StageEntrypoint, rejectErr.Stage)
+		assert.Equal(t, 123, rejectErr.NbrCode)
+		assert.Equal(t, rejectErr, FindRejectError([]error{errors.New("other"), rejectErr}))
+	}
+
+	response := &openrtb.BidResponse{ID: "response"}
+	assert.Equal(t, response, executor.ExecuteAuctionResponseStage(response), "Rejections aren't allowed at the auction_response stage")
+	modulesExt := executor.ModulesExt(true)
+	assert.Equal(t, []string{"Rejection is not supported at the auction_response stage"}, modulesExt.Errors["acme_reject"]["auction_response"])
+	if assert.Len(t, modulesExt.Trace, 2) {
+		assert.Equal(t, "rejected", modulesExt.Trace[0].Status)
+		assert.Equal(t, "execution_failure", modulesExt.Trace[1].Status)
+	}
+}
+
+func TestExecuteStageFailures(t *testing.T) {
+	testCases := []struct {
+		description   string
+		module        interface{}
+		expectedError string
+		expectedTrace string
+	}{
+		{"Timeout", slowModule{}, "Hook timed out after 20 ms", "timeout"},
+		{"Panic", panicModule{}, "Hook panicked: oops", "execution_failure"},
+		{"Error", errorModule{}, "module failed", "execution_failure"},
+		{"Empty payload", emptyModule{}, "hook returned an empty payload", "execution_failure"},
+	}
+
+	for _, test := range testCases {
+		registry := newTestRegistry(t, map[string]interface{}{"acme_test": test.module}, newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_test"))
+		executor := registry.NewExecutor(EndpointAuction)
+		request := &openrtb.BidRequest{ID: "request"}
+
+		newRequest, rejectErr := executor.ExecuteProcessedAuctionRequestStage(request)
+
+		assert.Nil(t, rejectErr, test.description)
+		assert.Equal(t, request, newRequest, "%s: the payload should be thrown away", test.description)
+		modulesExt := executor.ModulesExt(true)
+		assert.Equal(t, []string{test.expectedError}, modulesExt.Errors["acme_test"]["processed_auction_request"], test.description)
+		if assert.Len(t, modulesExt.Trace, 1, test.description) {
+			assert.Equal(t, test.expectedTrace, modulesExt.Trace[0].Status, test.description)
+		}
+	}
+}
+
+func TestExecutorAccountPlan(t *testing.T) {
+	registry := newTestRegistry(t, map[string]interface{}{
+		"acme_host":    tmaxModule{tmax: 100},
+		"acme_account": tmaxModule{tmax: 200},
+		"acme_reject":  rejectModule{},
+	}, newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_host"))
+	accountPlan := newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_account", "acme_reject", "acme_unknown")
+	executor := registry.NewExecutor(EndpointAuction)
+	executor.SetAccount(&config.Account{
+		ID: "some-account",
+		Hooks: config.AccountHooks{
+			Modules:       map[string]map[string]interface{}{"acme_account": {"enabled": true}},
+			ExecutionPlan: accountPlan,
+		},
+	})
+
+	newRequest, rejectErr := executor.ExecuteProcessedAuctionRequestStage(&openrtb.BidRequest{ID: "request"})
+
+	assert.Nil(t, rejectErr)
+	assert.Equal(t, int64(200), newRequest.TMax, "The account plan should run after the host plan")
+	modulesExt := executor.ModulesExt(true)
+	if assert.Len(t, modulesExt.Trace, 2) {
+		assert.Equal(t, []string{""}, modulesExt.Trace[0].DebugMessages)
+		assert.Equal(t, []string{`{"enabled":true}`}, modulesExt.Trace[1].DebugMessages)
+	}
+	assert.Len(t, modulesExt.Errors["acme_reject"]["processed_auction_request"], 1, "Modules without a hook for the stage should be skipped")
+	assert.Len(t, modulesExt.Errors["acme_unknown"]["processed_auction_request"], 1, "Unknown modules should be skipped")
+}
+
+func TestExecuteBidderStages(t *testing.T) {
+	registry := newTestRegistry(t, map[string]interface{}{
+		"acme_bidders": bidderModule{},
+	}, config.HookExecutionPlan{
+		Endpoints: map[string]config.HookEndpointPlan{
+			EndpointAuction: {Stages: map[string][]config.HookInvocation{
+				string(StageBidderRequest):     {{Module: "acme_bidders"}},
+				string(StageRawBidderResponse): {{Module: "acme_bidders"}},
+			}},
+		},
+	})
+	executor := registry.NewExecutor(EndpointAuction)
+	request := &openrtb.BidRequest{ID: "request"}
+
+	_, rejectErr := executor.ExecuteBidderRequestStage("appnexus", request)
+	assert.Nil(t, rejectErr)
+	_, rejectErr = executor.ExecuteBidderRequestStage("rubicon", request)
+	if assert.NotNil(t, rejectErr) {
+		assert.Equal(t, openrtb_ext.BidderName("rubicon"), rejectErr.Bidder)
+	}
+
+	bids, rejectErr := executor.ExecuteRawBidderResponseStage("appnexus", []*adapters.TypedBid{
+		{Bid: &openrtb.Bid{ID: "cheap", Price: 0.1}},
+		{Bid: &openrtb.Bid{ID: "expensive", Price: 2}},
+	})
+	assert.Nil(t, rejectErr)
+	if assert.Len(t, bids, 1) {
+		assert.Equal(t, "expensive", bids[0].Bid.ID)
+	}
+	assert.Equal(t, []string{"appnexus: dropped 1 bids"}, executor.ModulesExt(false).Warnings["acme_bidders"]["raw_bidder_response"])
+}
+
+func TestWriteModulesExt(t *testing.T) {
+	registry := newTestRegistry(t, map[string]interface{}{"acme_tmax": tmaxModule{}}, newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_tmax"))
+	executor := registry.NewExecutor(EndpointAuction)
+	executor.ExecuteProcessedAuctionRequestStage(&openrtb.BidRequest{})
+
+	ext, err := executor.WriteModulesExt(nil, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prebid":{"modules":{"warnings":{"acme_tmax":{"processed_auction_request":["tmax changed"]}}}}}`, string(ext))
+
+	original := json.RawMessage(`{"tmaxrequest":10}`)
+	ext, err = executor.WriteModulesExt(original, false)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tmaxrequest":10,"prebid":{"modules":{"warnings":{"acme_tmax":{"processed_auction_request":["tmax changed"]}}}}}`, string(ext))
+	assert.Equal(t, `{"tmaxrequest":10}`, string(original))
+}
+
+type rejectModule struct{}
+
+func (m rejectModule) HandleEntrypointHook(ctx context.Context, invocation InvocationContext, payload EntrypointPayload) (EntrypointPayload, HookResult, error) {
+	return EntrypointPayload{Body: []byte("changed")}, HookResult{Reject: true, NbrCode: 123, Message: "go away"}, nil
+}
+
+func (m rejectModule) HandleAuctionResponseHook(ctx context.Context, invocation InvocationContext, payload AuctionResponsePayload) (AuctionResponsePayload, HookResult, error) {
+	return AuctionResponsePayload{Response: &openrtb.BidResponse{}}, HookResult{Reject: true}, nil
+}
+
+type slowModule struct{}
+
+func (m slowModule) HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error) {
+	<-ctx.Done()
+	time.Sleep(5 * time.Millisecond)
+	return ProcessedAuctionRequestPayload{Request: &openrtb.BidRequest{ID: "slow"}}, HookResult{}, nil
+}
+
+type panicModule struct{}
+
+func (m panicModule) HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error) {
+	panic("oops")
+}
+
+type errorModule struct{}
+
+func (m errorModule) HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error) {
+	return ProcessedAuctionRequestPayload{Request: &openrtb.BidRequest{ID: "error"}}, HookResult{}, errors.New("module failed")
+}
+
+type emptyModule struct{}
+
+func (m emptyModule) HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error) {
+	return ProcessedAuctionRequestPayload{}, HookResult{}, nil
+}
+
+// bidderModule rejects rubicon, and drops bids under $1.
+type bidderModule struct{}
+
+func (m bidderModule) HandleBidderRequestHook(ctx context.Context, invocation InvocationContext, payload BidderRequestPayload) (BidderRequestPayload, HookResult, error) {
+	return payload, HookResult{Reject: payload.Bidder == "rubicon"}, nil
+}
+
+func (m bidderModule) HandleRawBidderResponseHook(ctx context.Context, invocation InvocationContext, payload RawBidderResponsePayload) (RawBidderResponsePayload, HookResult, error) {
+	bids := make([]*adapters.TypedBid, 0, len(payload.Bids))
+	for _, bid := range payload.Bids {
+		if bid.Bid.Price >= 1 {
+			bids = append(bids, bid)
+		}
+	}
+	result := HookResult{Warnings: []string{"dropped 1 bids"}}
+	return RawBidderResponsePayload{Bidder: payload.Bidder, Bids: bids}, result, nil
+}
@@ -0,0 +1,198 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/adapters"
+	"github.com/prebid/prebid-server/openrtb_ext"
+)
+
+// Stage is a point in the auction pipeline where modules can run.
+type Stage string
+
+const (
+	// StageEntrypoint runs as soon as the HTTP request arrives, before anything has been parsed.
+	StageEntrypoint Stage = "entrypoint"
+	// StageRawAuctionRequest runs on the request JSON after Stored Requests have been merged in.
+	StageRawAuctionRequest Stage = "raw_auction_request"
+	// StageProcessedAuctionRequest runs on the validated OpenRTB request, right before the auction.
+	StageProcessedAuctionRequest Stage = "processed_auction_request"
+	// StageBidderRequest runs on each bidder's request, right before the bidder is called.
+	StageBidderRequest Stage = "bidder_request"
+	// StageRawBidderResponse runs on each bidder's bids, as soon as the bidder responds.
+	StageRawBidderResponse Stage = "raw_bidder_response"
+	// StageAllProcessedBidResponses runs on every bidder's bids, once all of them have responded.
+	StageAllProcessedBidResponses Stage = "all_processed_bid_responses"
+	// StageAuctionResponse runs on the OpenRTB response, before the endpoint sends it.
+	StageAuctionResponse Stage = "auction_response"
+)
+
+// Stages lists every Stage in the order they run.
+var Stages = []Stage{
+	StageEntrypoint,
+	StageRawAuctionRequest,
+	StageProcessedAuctionRequest,
+	StageBidderRequest,
+	StageRawBidderResponse,
+	StageAllProcessedBidResponses,
+	StageAuctionResponse,
+}
+
+// canReject returns true if a module may reject the request (or the bidder) at this stage.
+func (s Stage) canReject() bool {
+	switch s {
+	case StageEntrypoint, StageRawAuctionRequest, StageProcessedAuctionRequest, StageBidderRequest, StageRawBidderResponse:
+		return true
+	}
+	return false
+}
+
+// The endpoints which run modules.
+const (
+	EndpointAuction = "/openrtb2/auction"
+	EndpointAmp     = "/openrtb2/amp"
+	EndpointVideo   = "/openrtb2/video"
+)
+
+var endpoints = map[string]bool{
+	EndpointAuction: true,
+	EndpointAmp:     true,
+	EndpointVideo:   true,
+}
+
+// InvocationContext describes the request which a hook is running for.
+type InvocationContext struct {
+	Endpoint string
+	Stage    Stage
+	// AccountID is empty for the stages which run before the account is known.
+	AccountID string
+	// AccountConfig is the account's config for this module, from the account's hooks.modules. It's nil
+	// if the account doesn't configure the module, or if the account isn't known yet.
+	AccountConfig json.RawMessage
+}
+
+// HookResult reports what a hook did.
+type HookResult struct {
+	// Reject stops the request (or, at the bidder stages, just the bidder). It's ignored at stages which
+	// don't support rejection.
+	Reject bool
+	// NbrCode is the OpenRTB No-Bid Reason returned to the caller if the request is rejected.
+	NbrCode int
+	// Message explains the rejection.
+	Message string
+	// Errors and Warnings are returned to the caller in ext.prebid.modules.
+	Errors   []string
+	Warnings []string
+	// DebugMessages are only returned to the caller in the ext.prebid.modules trace of test requests.
+	DebugMessages []string
+}
+
+// Every hook receives a payload and returns the payload which should be passed along. This may be the
+// payload it was given or a modified copy, but hooks must *not* modify the given payload in place.
+// The returned payload is thrown away if the hook times out, fails or rejects.
+//
+// Modules implement one or more of the hook interfaces below.
+
+// EntrypointPayload is the input to an EntrypointHook.
+type EntrypointPayload struct {
+	Request *http.Request
+	// Body is the HTTP request body. It's empty for GET endpoints like /openrtb2/amp.
+	Body []byte
+}
+
+// EntrypointHook runs at StageEntrypoint.
+type EntrypointHook interface {
+	HandleEntrypointHook(ctx context.Context, invocation InvocationContext, payload EntrypointPayload) (EntrypointPayload, HookResult, error)
+}
+
+// RawAuctionRequestPayload is the input to a RawAuctionRequestHook.
+type RawAuctionRequestPayload struct {
+	// Body is the request JSON, with any Stored Requests merged in. For /openrtb2/video this is the
+	// video request, and for /openrtb2/amp it's the Stored Request for the tag_id.
+	Body []byte
+}
+
+// RawAuctionRequestHook runs at StageRawAuctionRequest.
+type RawAuctionRequestHook interface {
+	HandleRawAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload RawAuctionRequestPayload) (RawAuctionRequestPayload, HookResult, error)
+}
+
+// ProcessedAuctionRequestPayload is the input to a ProcessedAuctionRequestHook.
+type ProcessedAuctionRequestPayload struct {
+	Request *openrtb.BidRequest
+}
+
+// ProcessedAuctionRequestHook runs at StageProcessedAuctionRequest.
+type ProcessedAuctionRequestHook interface {
+	HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error)
+}
+
+// BidderRequestPayload is the input to a BidderRequestHook.
+type BidderRequestPayload struct {
+	// Bidder may be an alias.
+	Bidder  openrtb_ext.BidderName
+	Request *openrtb.BidRequest
+}
+
+// BidderRequestHook runs at StageBidderRequest.
+type BidderRequestHook interface {
+	HandleBidderRequestHook(ctx context.Context, invocation InvocationContext, payload BidderRequestPayload) (BidderRequestPayload, HookResult, error)
+}
+
+// RawBidderResponsePayload is the input to a RawBidderResponseHook.
+type RawBidderResponsePayload struct {
+	// Bidder may be an alias.
+	Bidder openrtb_ext.BidderName
+	// Bids have already been converted to the auction currency, and had any bid adjustments applied.
+	Bids []*adapters.TypedBid
+}
+
+// RawBidderResponseHook runs at StageRawBidderResponse.
+type RawBidderResponseHook interface {
+	HandleRawBidderResponseHook(ctx context.Context, invocation InvocationContext, payload RawBidderResponsePayload) (RawBidderResponsePayload, HookResult, error)
+}
+
+// AllProcessedBidResponsesPayload is the input to an AllProcessedBidResponsesHook.
+type AllProcessedBidResponsesPayload struct {
+	Bids map[openrtb_ext.BidderName][]*adapters.TypedBid
+}
+
+// AllProcessedBidResponsesHook runs at StageAllProcessedBidResponses.
+type AllProcessedBidResponsesHook interface {
+	HandleAllProcessedBidResponsesHook(ctx context.Context, invocation InvocationContext, payload AllProcessedBidResponsesPayload) (AllProcessedBidResponsesPayload, HookResult, error)
+}
+
+// AuctionResponsePayload is the input to an AuctionResponseHook.
+type AuctionResponsePayload struct {
+	Response *openrtb.BidResponse
+}
+
+// AuctionResponseHook runs at StageAuctionResponse.
+type AuctionResponseHook interface {
+	HandleAuctionResponseHook(ctx context.Context, invocation InvocationContext, payload AuctionResponsePayload) (AuctionResponsePayload, HookResult, error)
+}
+
+// implementsStage returns true if the module has a hook for the given stage.
+func implementsStage(module interface{}, stage Stage) bool {
+	var ok bool
+	switch stage {
+	case StageEntrypoint:
+		_, ok = module.(EntrypointHook)
+	case StageRawAuctionRequest:
+		_, ok = module.(RawAuctionRequestHook)
+	case StageProcessedAuctionRequest:
+		_, ok = module.(ProcessedAuctionRequestHook)
+	case StageBidderRequest:
+		_, ok = module.(BidderRequestHook)
+	case StageRawBidderResponse:
+		_, ok = module.(RawBidderResponseHook)
+	case StageAllProcessedBidResponses:
+		_, ok = module.(AllProcessedBidResponsesHook)
+	case StageAuctionResponse:
+		_, ok = module.(AuctionResponseHook)
+	}
+	return ok
+}
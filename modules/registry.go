@@ -0,0 +1,101 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prebid/prebid-server/config"
+)
+
+// ModuleBuilder builds a module from its host config, which is the JSON form of hooks.modules.{name}.
+//
+// The module must implement at least one of the hook interfaces in this package.
+type ModuleBuilder func(cfg json.RawMessage) (interface{}, error)
+
+// Registry holds the modules which were built at startup, along with the host execution plan.
+// It's safe to share across goroutines.
+type Registry struct {
+	modules        map[string]interface{}
+	plan           config.HookExecutionPlan
+	defaultTimeout time.Duration
+}
+
+// NewRegistry builds every module which has config in hooks.modules, and makes sure that the host
+// execution plan only uses modules which exist and implement the stages they're listed under.
+//
+// It returns a nil Registry if hooks are disabled. Executors made from a nil Registry don't run anything.
+func NewRegistry(cfg config.Hooks, builders map[string]ModuleBuilder) (*Registry, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	registry := &Registry{
+		modules:        make(map[string]interface{}, len(cfg.Modules)),
+		plan:           cfg.ExecutionPlan,
+		defaultTimeout: time.Duration(cfg.DefaultTimeoutMS) * time.Millisecond,
+	}
+	for name, moduleCfg := range cfg.Modules {
+		builder, ok := builders[name]
+		if !ok {
+			return nil, fmt.Errorf("hooks.modules.%s is not a known module", name)
+		}
+		cfgJSON, err := json.Marshal(moduleCfg)
+		if err != nil {
+			return nil, fmt.Errorf("hooks.modules.%s could not be converted to JSON: %v", name, err)
+		}
+		module, err := builder(cfgJSON)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to build module %s: %v", name, err)
+		}
+		registry.modules[name] = module
+	}
+
+	for endpoint, endpointPlan := range cfg.ExecutionPlan.Endpoints {
+		if !endpoints[endpoint] {
+			return nil, fmt.Errorf("hooks.execution_plan.endpoints.%s is not an endpoint which runs modules", endpoint)
+		}
+		for stage, invocations := range endpointPlan.Stages {
+			for _, invocation := range invocations {
+				if err := registry.validateInvocation(Stage(stage), invocation); err != nil {
+					return nil, fmt.Errorf("hooks.execution_plan.endpoints.%s.stages.%s: %v", endpoint, stage, err)
+				}
+			}
+		}
+	}
+	return registry, nil
+}
+
+func (r *Registry) validateInvocation(stage Stage, invocation config.HookInvocation) error {
+	if !isStage(stage) {
+		return fmt.Errorf("%s is not a known stage", stage)
+	}
+	module, ok := r.modules[invocation.Module]
+	if !ok {
+		return fmt.Errorf("module %s isn't configured in hooks.modules", invocation.Module)
+	}
+	if !implementsStage(module, stage) {
+		return fmt.Errorf("module %s doesn't have a hook for this stage", invocation.Module)
+	}
+	return nil
+}
+
+// NewExecutor returns an Executor which runs the modules for a single request to the given endpoint.
+func (r *Registry) NewExecutor(endpoint string) *Executor {
+	if r == nil {
+		return nil
+	}
+	return &Executor{
+		registry: r,
+		endpoint: endpoint,
+	}
+}
+
+func isStage(stage Stage) bool {
+	for _, known := range Stages {
+		if stage == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/prebid/prebid-server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRegistryDisabled(t *testing.T) {
+	registry, err := NewRegistry(config.Hooks{Enabled: false, Modules: map[string]map[string]interface{}{"unknown": {}}}, nil)
+
+	assert.NoError(t, err)
+	assert.Nil(t, registry)
+	assert.Nil(t, registry.NewExecutor(EndpointAuction), "A nil Registry should make nil Executors")
+}
+
+func TestNewRegistryBuildsModules(t *testing.T) {
+	var builtWith json.RawMessage
+	builders := map[string]ModuleBuilder{
+		"acme_tmax": func(cfg json.RawMessage) (interface{}, error) {
+			builtWith = cfg
+			return tmaxModule{}, nil
+		},
+		"acme_unused": func(cfg json.RawMessage) (interface{}, error) {
+			t.Errorf("Modules without config shouldn't be built")
+			return nil, nil
+		},
+	}
+	hooks := config.Hooks{
+		Enabled:          true,
+		DefaultTimeoutMS: 10,
+		Modules:          map[string]map[string]interface{}{"acme_tmax": {"tmax": 100}},
+		ExecutionPlan:    newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_tmax"),
+	}
+
+	registry, err := NewRegistry(hooks, builders)
+
+	if assert.NoError(t, err) {
+		assert.Len(t, registry.modules, 1)
+		assert.JSONEq(t, `{"tmax": 100}`, string(builtWith))
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	builders := map[string]ModuleBuilder{
+		"acme_tmax":   func(cfg json.RawMessage) (interface{}, error) { return tmaxModule{}, nil },
+		"acme_broken": func(cfg json.RawMessage) (interface{}, error) { return nil, errors.New("bad config") },
+	}
+	testCases := []struct {
+		description string
+		modules     []string
+		plan        config.HookExecutionPlan
+	}{
+		{"Unknown module", []string{"acme_unknown"}, config.HookExecutionPlan{}},
+		{"Builder error", []string{"acme_broken"}, config.HookExecutionPlan{}},
+		{"Unknown endpoint", []string{"acme_tmax"}, newPlan("/openrtb2/unknown", StageProcessedAuctionRequest, "acme_tmax")},
+		{"Unknown stage", []string{"acme_tmax"}, newPlan(EndpointAuction, "unknown", "acme_tmax")},
+		{"Unconfigured module", nil, newPlan(EndpointAuction, StageProcessedAuctionRequest, "acme_tmax")},
+		{"Module without a hook for the stage", []string{"acme_tmax"}, newPlan(EndpointAuction, StageEntrypoint, "acme_tmax")},
+	}
+
+	for _, test := range testCases {
+		hooks := config.Hooks{
+			Enabled:          true,
+			DefaultTimeoutMS: 10,
+			Modules:          make(map[string]map[string]interface{}),
+			ExecutionPlan:    test.plan,
+		}
+		for _, name := range test.modules {
+			hooks.Modules[name] = map[string]interface{}{}
+		}
+
+		registry, err := NewRegistry(hooks, builders)
+
+		assert.Error(t, err, test.description)
+		assert.Nil(t, registry, test.description)
+	}
+}
+
+// newPlan makes an execution plan which runs the modules, in order, at a single stage of one endpoint.
+func newPlan(endpoint string, stage Stage, modules ...string) config.HookExecutionPlan {
+	invocations := make([]config.HookInvocation, 0, len(modules))
+	for _, module := range modules {
+		invocations = append(invocations, config.HookInvocation{Module: module})
+	}
+	return config.HookExecutionPlan{
+		Endpoints: map[string]config.HookEndpointPlan{
+			endpoint: {Stages: map[string][]config.HookInvocation{string(stage): invocations}},
+		},
+	}
+}
+
+// newTestRegistry makes a Registry with already-built modules.
+func newTestRegistry(t *testing.T, modules map[string]interface{}, plan config.HookExecutionPlan) *Registry {
+	hooks := config.Hooks{
+		Enabled:          true,
+		DefaultTimeoutMS: 20,
+		Modules:          make(map[string]map[string]interface{}, len(modules)),
+		ExecutionPlan:    plan,
+	}
+	builders := make(map[string]ModuleBuilder, len(modules))
+	for name, module := range modules {
+		module := module
+		hooks.Modules[name] = map[string]interface{}{}
+		builders[name] = func(cfg json.RawMessage) (interface{}, error) { return module, nil }
+	}
+	registry, err := NewRegistry(hooks, builders)
+	if err != nil {
+		t.Fatalf("Failed to build the test registry: %v", err)
+	}
+	return registry
+}
+
+// tmaxModule sets request.tmax, and reports the account config it was given.
+type tmaxModule struct {
+	tmax int64
+}
+
+func (m tmaxModule) HandleProcessedAuctionRequestHook(ctx context.Context, invocation InvocationContext, payload ProcessedAuctionRequestPayload) (ProcessedAuctionRequestPayload, HookResult, error) {
+	request := *payload.Request
+	request.TMax = m.tmax
+	result := HookResult{
+		Warnings:      []string{"tmax changed"},
+		DebugMessages: []string{string(invocation.AccountConfig)},
+	}
+	return ProcessedAuctionRequestPayload{Request: &request}, result, nil
+}
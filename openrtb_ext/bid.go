@@ -13,10 +13,17 @@ type ExtBid struct {
 
 // ExtBidPrebid defines the contract for bidresponse.seatbid.bid[i].ext.prebid
 type ExtBidPrebid struct {
-	Cache     *ExtBidPrebidCache `json:"cache,omitempty"`
-	Targeting map[string]string  `json:"targeting,omitempty"`
-	Type      BidType            `json:"type"`
-	Video     *ExtBidPrebidVideo `json:"video,omitempty"`
+	Cache     *ExtBidPrebidCache  `json:"cache,omitempty"`
+	Targeting map[string]string   `json:"targeting,omitempty"`
+	Type      BidType             `json:"type"`
+	Video     *ExtBidPrebidVideo  `json:"video,omitempty"`
+	Events    *ExtBidPrebidEvents `json:"events,omitempty"`
+}
+
+// ExtBidPrebidEvents defines the contract for bidresponse.seatbid.bid[i].ext.prebid.events
+type ExtBidPrebidEvents struct {
+	Win string `json:"win,omitempty"`
+	Imp string `json:"imp,omitempty"`
 }
 
 // ExtBidPrebidCache defines the contract for  bidresponse.seatbid.bid[i].ext.prebid.cache
@@ -1,6 +1,8 @@
 package openrtb_ext
 
 import (
+	"encoding/json"
+
 	"github.com/mxmCherry/openrtb"
 )
 
@@ -160,6 +162,31 @@ type PodConfig struct {
 	//   object; required
 	//  Container object for describing the adPod(s) to be requested.
 	Pods []Pod `json:"pods"`
+
+	// Attribute:
+	//   dedupepolicy
+	// Type:
+	//   string, optional
+	//  How to choose between bids in a pod which share a category or an advertiser domain, when
+	//  includebrandcategory is set. "price" keeps the highest price, and "duration" keeps the longest
+	//  ad, to fill the pod. Default is "price".
+	DedupePolicy PodDedupePolicy `json:"dedupepolicy,omitempty"`
+}
+
+// PodDedupePolicy decides which bid is kept when bids in a pod compete with each other.
+type PodDedupePolicy string
+
+const (
+	PodDedupePolicyPrice    PodDedupePolicy = "price"
+	PodDedupePolicyDuration PodDedupePolicy = "duration"
+)
+
+// DedupePolicyOrDefault returns the pod config's dedupe policy, or "price" if it doesn't have one.
+func (pc PodConfig) DedupePolicyOrDefault() PodDedupePolicy {
+	if pc.DedupePolicy == "" {
+		return PodDedupePolicyPrice
+	}
+	return pc.DedupePolicy
 }
 
 type Pod struct {
@@ -183,6 +210,15 @@ type Pod struct {
 	//   string; required
 	//  ID of the stored config that corresponds to a single pod request
 	ConfigId string `json:"configid"`
+
+	// Attribute:
+	//   bidders
+	// Type:
+	//   object; optional
+	//  Bidders for the imps made for this pod, keyed by bidder name, with their params. They replace the
+	//  bidders in the stored imp from configid. Params are merged onto the stored imp's params for the
+	//  same bidder with JSON merge-patch semantics, so {"appnexus": {}} keeps the stored appnexus params.
+	Bidders map[string]json.RawMessage `json:"bidders,omitempty"`
 }
 
 type IncludeBrandCategory struct {
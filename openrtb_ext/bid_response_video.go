@@ -11,6 +11,18 @@ type AdPod struct {
 	PodId     int64            `json:"podid"`
 	Targeting []VideoTargeting `json:"targeting"`
 	Errors    []string         `json:"errors"`
+	// Exclusions are the bids which were left out of the pod, because a better bid had the same category
+	// or advertiser domain.
+	Exclusions []VideoExclusion `json:"exclusions,omitempty"`
+}
+
+// VideoExclusion describes a bid which was left out of its pod. Either Category or ADomain is the value
+// which it shared with the bid that was kept.
+type VideoExclusion struct {
+	BidID      string `json:"bidid"`
+	HbPbCatDur string `json:"hb_pb_cat_dur"`
+	Category   string `json:"category,omitempty"`
+	ADomain    string `json:"adomain,omitempty"`
 }
 
 type VideoTargeting struct {
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 )
 
+// ContextExtKey is the key in bidrequest.imp[i].ext which holds the imp's first party data. It's sent to every bidder.
+const ContextExtKey = "context"
+
 // ExtImp defines the contract for bidrequest.imp[i].ext
 type ExtImp struct {
 	Prebid     *ExtImpPrebid     `json:"prebid"`
@@ -20,6 +23,12 @@ type ExtImp struct {
 type ExtImpPrebid struct {
 	StoredRequest *ExtStoredRequest `json:"storedrequest"`
 
+	// StoredAuctionResponse replaces the whole auction for this imp with a stored list of SeatBids.
+	StoredAuctionResponse *ExtStoredAuctionResponse `json:"storedauctionresponse"`
+
+	// StoredBidResponse replaces the named bidders' HTTP responses for this imp with stored ones.
+	StoredBidResponse []ExtStoredBidResponse `json:"storedbidresponse"`
+
 	// NOTE: This is not part of the official API, we are not expecting clients
 	// migrate from imp[...].ext.${BIDDER} to imp[...].ext.prebid.bidder.${BIDDER}
 	// at this time
@@ -31,3 +40,14 @@ type ExtImpPrebid struct {
 type ExtStoredRequest struct {
 	ID string `json:"id"`
 }
+
+// ExtStoredAuctionResponse defines the contract for bidrequest.imp[i].ext.prebid.storedauctionresponse
+type ExtStoredAuctionResponse struct {
+	ID string `json:"id"`
+}
+
+// ExtStoredBidResponse defines the contract for bidrequest.imp[i].ext.prebid.storedbidresponse
+type ExtStoredBidResponse struct {
+	Bidder string `json:"bidder"`
+	ID     string `json:"id"`
+}
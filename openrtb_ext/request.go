@@ -12,13 +12,123 @@ type ExtRequest struct {
 
 // ExtRequestPrebid defines the contract for bidrequest.ext.prebid
 type ExtRequestPrebid struct {
-	Aliases              map[string]string      `json:"aliases,omitempty"`
-	BidAdjustmentFactors map[string]float64     `json:"bidadjustmentfactors,omitempty"`
-	Cache                *ExtRequestPrebidCache `json:"cache,omitempty"`
-	StoredRequest        *ExtStoredRequest      `json:"storedrequest,omitempty"`
-	Targeting            *ExtRequestTargeting   `json:"targeting,omitempty"`
+	Aliases              map[string]string           `json:"aliases,omitempty"`
+	BidAdjustmentFactors map[string]float64          `json:"bidadjustmentfactors,omitempty"`
+	BidderConfigs        []ExtBidderConfig           `json:"bidderconfig,omitempty"`
+	Cache                *ExtRequestPrebidCache      `json:"cache,omitempty"`
+	CurrencyConversions  *ExtRequestCurrency         `json:"currency,omitempty"`
+	Data                 *ExtRequestPrebidData       `json:"data,omitempty"`
+	Debug                bool                        `json:"debug,omitempty"`
+	MultiBid             []*ExtRequestPrebidMultiBid `json:"multibid,omitempty"`
+	SChains              []*ExtRequestPrebidSChain   `json:"schains,omitempty"`
+	StoredRequest        *ExtStoredRequest           `json:"storedrequest,omitempty"`
+	Targeting            *ExtRequestTargeting        `json:"targeting,omitempty"`
 }
 
+// ExtRequestCurrency defines the contract for bidrequest.ext.prebid.currency
+type ExtRequestCurrency struct {
+	// ConversionRates are custom rates, keyed by the currency to convert from and then the currency to convert to.
+	// They take priority over the rates which the server fetched.
+	ConversionRates map[string]map[string]float64 `json:"rates"`
+	// UsePBSRates says whether the server's rates may be used for conversions which the ConversionRates don't cover.
+	// It defaults to true.
+	UsePBSRates *bool `json:"usepbsrates"`
+}
+
+// ExtRequestPrebidData defines the contract for bidrequest.ext.prebid.data
+type ExtRequestPrebidData struct {
+	// Bidders lists the bidders (or aliases) which may see the site.ext.data, app.ext.data and user.ext.data.
+	// If it's not defined, every bidder sees them.
+	Bidders        []string                            `json:"bidders,omitempty"`
+	EidPermissions []ExtRequestPrebidDataEidPermission `json:"eidpermissions,omitempty"`
+}
+
+// ExtRequestPrebidDataEidPermission defines the contract for bidrequest.ext.prebid.data.eidpermissions[i]
+type ExtRequestPrebidDataEidPermission struct {
+	// Source is the user.ext.eids[j].source which this rule applies to.
+	Source string `json:"source"`
+	// Bidders lists the bidders (or aliases) which are allowed to see the eids from Source. "*" allows every bidder.
+	Bidders []string `json:"bidders"`
+}
+
+// ExtBidderConfig defines the contract for bidrequest.ext.prebid.bidderconfig[i]
+type ExtBidderConfig struct {
+	// Bidders lists the bidders (or aliases) which get the Config.
+	Bidders []string               `json:"bidders"`
+	Config  *ExtBidderConfigConfig `json:"config"`
+}
+
+// ExtBidderConfigConfig defines the contract for bidrequest.ext.prebid.bidderconfig[i].config
+type ExtBidderConfigConfig struct {
+	ORTB2 *ExtBidderConfigORTB2 `json:"ortb2"`
+}
+
+// ExtBidderConfigORTB2 defines the contract for bidrequest.ext.prebid.bidderconfig[i].config.ortb2
+//
+// Each fragment is merged into the bidder's copy of the matching request object as a JSON Merge Patch (RFC 7386).
+type ExtBidderConfigORTB2 struct {
+	Site json.RawMessage `json:"site,omitempty"`
+	App  json.RawMessage `json:"app,omitempty"`
+	User json.RawMessage `json:"user,omitempty"`
+}
+
+// EidPermissionsWildcard is the value of bidrequest.ext.prebid.data.eidpermissions[i].bidders which allows every bidder.
+const EidPermissionsWildcard = "*"
+
+// ExtRequestPrebidSChain defines the contract for bidrequest.ext.prebid.schains[i]
+type ExtRequestPrebidSChain struct {
+	// Bidders lists the bidders (or aliases) which should receive this schain. "*" matches every bidder
+	// which isn't listed explicitly in some other schain.
+	Bidders []string                     `json:"bidders,omitempty"`
+	SChain  ExtRequestPrebidSChainSChain `json:"schain"`
+}
+
+// ExtRequestPrebidSChainSChain defines the contract for bidrequest.ext.prebid.schains[i].schain
+type ExtRequestPrebidSChainSChain struct {
+	Complete int                                 `json:"complete"`
+	Nodes    []*ExtRequestPrebidSChainSChainNode `json:"nodes"`
+	Ver      string                              `json:"ver"`
+	Ext      json.RawMessage                     `json:"ext,omitempty"`
+}
+
+// ExtRequestPrebidSChainSChainNode defines the contract for bidrequest.ext.prebid.schains[i].schain.nodes[j]
+type ExtRequestPrebidSChainSChainNode struct {
+	ASI    string          `json:"asi"`
+	SID    string          `json:"sid"`
+	RID    string          `json:"rid,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Domain string          `json:"domain,omitempty"`
+	HP     int             `json:"hp"`
+	Ext    json.RawMessage `json:"ext,omitempty"`
+}
+
+// SChainWildcard is the value of bidrequest.ext.prebid.schains[i].bidders which matches every bidder.
+const SChainWildcard = "*"
+
+// ExtRequestPrebidMultiBid defines the contract for bidrequest.ext.prebid.multibid[i]
+//
+// It lets a bidder compete with more than one bid per imp. Exactly one of Bidder or Bidders must be
+// defined. The extra bids only get targeting keys if TargetBidderCodePrefix is defined, in which case
+// the Nth bid uses the prefix followed by N as its bidder code. For example, with the prefix "apn", the
+// second bid's price goes in hb_pb_apn2.
+type ExtRequestPrebidMultiBid struct {
+	Bidder                 string   `json:"bidder,omitempty"`
+	Bidders                []string `json:"bidders,omitempty"`
+	MaxBids                int      `json:"maxbids"`
+	TargetBidderCodePrefix string   `json:"targetbiddercodeprefix,omitempty"`
+}
+
+// MaxMultiBids is the highest value allowed in bidrequest.ext.prebid.multibid[i].maxbids.
+const MaxMultiBids = 9
+
+// MaxTargetingKeyLength is the length which the bidder-specific targeting keys are truncated to.
+const MaxTargetingKeyLength = 20
+
+// MaxTargetBidderCodePrefixLength is the longest bidrequest.ext.prebid.multibid[i].targetbiddercodeprefix whose
+// targeting keys fit in MaxTargetingKeyLength. The longest keys, like hb_pb_cat_dur, get an "_", the prefix and
+// the bid's single digit number added to them.
+const MaxTargetBidderCodePrefixLength = MaxTargetingKeyLength - len(HbCategoryDurationKey) - len("_") - len("9")
+
 // ExtRequestPrebidCache defines the contract for bidrequest.ext.prebid.cache
 type ExtRequestPrebidCache struct {
 	Bids    *ExtRequestPrebidCacheBids `json:"bids"`
@@ -9,6 +9,8 @@ type ExtBidResponse struct {
 	Debug *ExtResponseDebug `json:"debug,omitempty"`
 	// Errors defines the contract for bidresponse.ext.errors
 	Errors map[BidderName][]ExtBidderError `json:"errors,omitempty"`
+	// Warnings defines the contract for bidresponse.ext.warnings
+	Warnings map[BidderName][]ExtBidderError `json:"warnings,omitempty"`
 	// ResponseTimeMillis defines the contract for bidresponse.ext.responsetimemillis
 	ResponseTimeMillis map[BidderName]int `json:"responsetimemillis,omitempty"`
 	// RequestTimeoutMillis returns the timeout used in the auction.
@@ -17,6 +19,33 @@ type ExtBidResponse struct {
 	RequestTimeoutMillis int64 `json:"tmaxrequest,omitempty"`
 	// ResponseUserSync defines the contract for bidresponse.ext.usersync
 	Usersync map[BidderName]*ExtResponseSyncData `json:"usersync,omitempty"`
+	Prebid   *ExtResponsePrebid                  `json:"prebid,omitempty"`
+}
+
+// ExtResponsePrebid defines the contract for bidresponse.ext.prebid
+type ExtResponsePrebid struct {
+	Modules *ExtModules `json:"modules,omitempty"`
+}
+
+// ExtModules defines the contract for bidresponse.ext.prebid.modules
+type ExtModules struct {
+	// Errors and Warnings hold the messages reported by each module, keyed by module name and then by stage.
+	Errors   map[string]map[string][]string `json:"errors,omitempty"`
+	Warnings map[string]map[string][]string `json:"warnings,omitempty"`
+	// Trace lists every hook which ran. It's only returned for test requests.
+	Trace []ExtModuleTrace `json:"trace,omitempty"`
+}
+
+// ExtModuleTrace defines the contract for bidresponse.ext.prebid.modules.trace[i]
+type ExtModuleTrace struct {
+	Stage  string     `json:"stage"`
+	Module string     `json:"module"`
+	Bidder BidderName `json:"bidder,omitempty"`
+	// Status is one of "success", "rejected", "timeout" or "execution_failure".
+	Status              string   `json:"status"`
+	ExecutionTimeMillis int      `json:"executiontimemillis"`
+	Message             string   `json:"message,omitempty"`
+	DebugMessages       []string `json:"debugmessages,omitempty"`
 }
 
 // ExtResponseDebug defines the contract for bidresponse.ext.debug
@@ -25,6 +54,44 @@ type ExtResponseDebug struct {
 	HttpCalls map[BidderName][]*ExtHttpCall `json:"httpcalls,omitempty"`
 	// Request after resolution of stored requests and debug overrides
 	ResolvedRequest *openrtb.BidRequest `json:"resolvedrequest,omitempty"`
+	// RejectedBids defines the contract for bidresponse.ext.debug.rejectedbids
+	RejectedBids map[BidderName][]ExtRejectedBid `json:"rejectedbids,omitempty"`
+	// BidderRequests defines the contract for bidresponse.ext.debug.bidderrequests. These are the requests
+	// which were sent to each bidder, after privacy enforcement.
+	BidderRequests map[BidderName]*openrtb.BidRequest `json:"bidderrequests,omitempty"`
+	// StageTimeMillis defines the contract for bidresponse.ext.debug.stagetimemillis. It holds the time
+	// spent in each stage of the auction.
+	StageTimeMillis map[string]int `json:"stagetimemillis,omitempty"`
+	// TrafficShaping defines the contract for bidresponse.ext.debug.trafficshaping. It explains the
+	// traffic shaping decisions for the bidders whose bid rate was under the threshold.
+	TrafficShaping map[BidderName]ExtTrafficShaping `json:"trafficshaping,omitempty"`
+}
+
+// ExtTrafficShaping defines the contract for bidresponse.ext.debug.trafficshaping.{bidder}
+type ExtTrafficShaping struct {
+	// Inventory, MediaType and Country identify the history which the decision was based on.
+	// Inventory is "site:{domain}" or "app:{bundle}".
+	Inventory string `json:"inventory"`
+	MediaType string `json:"mediatype"`
+	Country   string `json:"country,omitempty"`
+	// Requests and BidRate describe the bidder's history for the inventory.
+	Requests int     `json:"requests"`
+	BidRate  float64 `json:"bidrate"`
+	// SendRate is the chance that the request would be sent.
+	SendRate float64 `json:"sendrate"`
+	Skipped  bool    `json:"skipped"`
+}
+
+// ExtRejectedBid defines the contract for bidresponse.ext.debug.rejectedbids.{bidder}[i]
+type ExtRejectedBid struct {
+	ImpID    string  `json:"impid"`
+	BidID    string  `json:"bidid"`
+	Price    float64 `json:"price"`
+	Floor    float64 `json:"floor,omitempty"`
+	Currency string  `json:"cur"`
+	Reason   string  `json:"reason"`
+	// Message has more detail about the reason, if there is any.
+	Message string `json:"message,omitempty"`
 }
 
 // ExtResponseSyncData defines the contract for bidresponse.ext.usersync.{bidder}
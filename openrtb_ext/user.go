@@ -16,6 +16,14 @@ type ExtUser struct {
 	DigiTrust *ExtUserDigiTrust `json:"digitrust,omitempty"`
 
 	Eids []ExtUserEid `json:"eids,omitempty"`
+
+	// ConsentedProvidersSettings holds Google's Additional Consent string. The capitalized key is Google's.
+	ConsentedProvidersSettings *ExtUserConsentedProvidersSettings `json:"ConsentedProvidersSettings,omitempty"`
+}
+
+// ExtUserConsentedProvidersSettings defines the contract for bidrequest.user.ext.ConsentedProvidersSettings
+type ExtUserConsentedProvidersSettings struct {
+	ConsentedProviders string `json:"consented_providers,omitempty"`
 }
 
 // ExtUserPrebid defines the contract for bidrequest.user.ext.prebid
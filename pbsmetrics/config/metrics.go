@@ -37,7 +37,7 @@ func NewMetricsEngine(cfg *config.Configuration, adapterList []openrtb_ext.Bidde
 	}
 	if cfg.Metrics.Prometheus.Port != 0 {
 		// Set up the Prometheus metrics.
-		returnEngine.PrometheusMetrics = prometheusmetrics.NewMetrics(cfg.Metrics.Prometheus)
+		returnEngine.PrometheusMetrics = prometheusmetrics.NewMetrics(cfg.Metrics.Prometheus, cfg.Metrics.Disabled)
 		engineList = append(engineList, returnEngine.PrometheusMetrics)
 	}
 
@@ -132,6 +132,13 @@ func (me *MultiMetricsEngine) RecordAdapterPrice(labels pbsmetrics.AdapterLabels
 	}
 }
 
+// RecordAdapterBidsRejected across all engines
+func (me *MultiMetricsEngine) RecordAdapterBidsRejected(labels pbsmetrics.AdapterLabels, reason pbsmetrics.RejectReason, count int) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterBidsRejected(labels, reason, count)
+	}
+}
+
 // RecordAdapterTime across all engines
 func (me *MultiMetricsEngine) RecordAdapterTime(labels pbsmetrics.AdapterLabels, length time.Duration) {
 	for _, thisME := range *me {
@@ -139,6 +146,41 @@ func (me *MultiMetricsEngine) RecordAdapterTime(labels pbsmetrics.AdapterLabels,
 	}
 }
 
+// RecordAdapterConnections across all engines
+func (me *MultiMetricsEngine) RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterConnections(adapter, connWasReused, connWaitTime)
+	}
+}
+
+// RecordAdapterDNSTime across all engines
+func (me *MultiMetricsEngine) RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterDNSTime(adapter, dnsLookupTime)
+	}
+}
+
+// RecordAdapterConnectTime across all engines
+func (me *MultiMetricsEngine) RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterConnectTime(adapter, connectTime)
+	}
+}
+
+// RecordAdapterTLSHandshakeTime across all engines
+func (me *MultiMetricsEngine) RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterTLSHandshakeTime(adapter, tlsHandshakeTime)
+	}
+}
+
+// RecordAdapterTimeToFirstByte across all engines
+func (me *MultiMetricsEngine) RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterTimeToFirstByte(adapter, timeToFirstByte)
+	}
+}
+
 // RecordCookieSync across all engines
 func (me *MultiMetricsEngine) RecordCookieSync() {
 	for _, thisME := range *me {
@@ -160,6 +202,27 @@ func (me *MultiMetricsEngine) RecordStoredImpCacheResult(cacheResult pbsmetrics.
 	}
 }
 
+// RecordRequestPrivacy across all engines
+func (me *MultiMetricsEngine) RecordRequestPrivacy(privacy pbsmetrics.PrivacyLabels) {
+	for _, thisME := range *me {
+		thisME.RecordRequestPrivacy(privacy)
+	}
+}
+
+// RecordAdapterRequestShaped across all engines
+func (me *MultiMetricsEngine) RecordAdapterRequestShaped(adapter openrtb_ext.BidderName) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterRequestShaped(adapter)
+	}
+}
+
+// RecordAdapterPrivacyEnforced across all engines
+func (me *MultiMetricsEngine) RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy pbsmetrics.PrivacyPolicy) {
+	for _, thisME := range *me {
+		thisME.RecordAdapterPrivacyEnforced(adapter, policy)
+	}
+}
+
 // RecordAdapterCookieSync across all engines
 func (me *MultiMetricsEngine) RecordAdapterCookieSync(adapter openrtb_ext.BidderName, gdprBlocked bool) {
 	for _, thisME := range *me {
@@ -224,10 +287,34 @@ func (me *DummyMetricsEngine) RecordAdapterBidReceived(labels pbsmetrics.Adapter
 func (me *DummyMetricsEngine) RecordAdapterPrice(labels pbsmetrics.AdapterLabels, cpm float64) {
 }
 
+// RecordAdapterBidsRejected as a noop
+func (me *DummyMetricsEngine) RecordAdapterBidsRejected(labels pbsmetrics.AdapterLabels, reason pbsmetrics.RejectReason, count int) {
+}
+
 // RecordAdapterTime as a noop
 func (me *DummyMetricsEngine) RecordAdapterTime(labels pbsmetrics.AdapterLabels, length time.Duration) {
 }
 
+// RecordAdapterConnections as a noop
+func (me *DummyMetricsEngine) RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration) {
+}
+
+// RecordAdapterDNSTime as a noop
+func (me *DummyMetricsEngine) RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration) {
+}
+
+// RecordAdapterConnectTime as a noop
+func (me *DummyMetricsEngine) RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration) {
+}
+
+// RecordAdapterTLSHandshakeTime as a noop
+func (me *DummyMetricsEngine) RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration) {
+}
+
+// RecordAdapterTimeToFirstByte as a noop
+func (me *DummyMetricsEngine) RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration) {
+}
+
 // RecordCookieSync as a noop
 func (me *DummyMetricsEngine) RecordCookieSync() {
 }
@@ -248,6 +335,18 @@ func (me *DummyMetricsEngine) RecordStoredReqCacheResult(cacheResult pbsmetrics.
 func (me *DummyMetricsEngine) RecordStoredImpCacheResult(cacheResult pbsmetrics.CacheResult, inc int) {
 }
 
+// RecordRequestPrivacy as a noop
+func (me *DummyMetricsEngine) RecordRequestPrivacy(privacy pbsmetrics.PrivacyLabels) {
+}
+
+// RecordAdapterRequestShaped as a noop
+func (me *DummyMetricsEngine) RecordAdapterRequestShaped(adapter openrtb_ext.BidderName) {
+}
+
+// RecordAdapterPrivacyEnforced as a noop
+func (me *DummyMetricsEngine) RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy pbsmetrics.PrivacyPolicy) {
+}
+
 // RecordPrebidCacheRequestTime as a noop
 func (me *DummyMetricsEngine) RecordPrebidCacheRequestTime(success bool, length time.Duration) {
 }
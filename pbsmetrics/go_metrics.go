@@ -41,6 +41,13 @@ type Metrics struct {
 	userSyncSet           map[openrtb_ext.BidderName]metrics.Meter
 	userSyncGDPRPrevent   map[openrtb_ext.BidderName]metrics.Meter
 
+	// Privacy policies signaled and enforced on auction requests
+	PrivacyCCPAEnforced      metrics.Meter
+	PrivacyCCPAIgnored       metrics.Meter
+	PrivacyCOPPARequest      metrics.Meter
+	PrivacyLMTRequest        metrics.Meter
+	PrivacyTCFRequestVersion map[TCFVersionValue]metrics.Meter
+
 	// Media types found in the "imp" JSON object
 	ImpsTypeBanner metrics.Meter
 	ImpsTypeVideo  metrics.Meter
@@ -62,6 +69,7 @@ type Metrics struct {
 type AdapterMetrics struct {
 	NoCookieMeter     metrics.Meter
 	ErrorMeters       map[AdapterError]metrics.Meter
+	RejectedBidMeters map[RejectReason]metrics.Meter
 	NoBidMeter        metrics.Meter
 	GotBidsMeter      metrics.Meter
 	RequestTimer      metrics.Timer
@@ -69,6 +77,20 @@ type AdapterMetrics struct {
 	BidsReceivedMeter metrics.Meter
 	PanicMeter        metrics.Meter
 	MarkupMetrics     map[openrtb_ext.BidType]*MarkupDeliveryMetrics
+	// PrivacyEnforcedMeters count the requests which had personal info removed, by policy. They're only
+	// registered for adapters, not accounts.
+	PrivacyEnforcedMeters map[PrivacyPolicy]metrics.Meter
+	// ShapedMeter counts the requests which traffic shaping didn't send. It's only registered for adapters.
+	ShapedMeter metrics.Meter
+	// The connection metrics describe the HTTP connections to the adapter. They're only registered for adapters,
+	// and only if metrics.disabled_metrics.adapter_connection_metrics is false.
+	ConnCreated          metrics.Meter
+	ConnReused           metrics.Meter
+	ConnWaitTime         metrics.Timer
+	DNSLookupTimer       metrics.Timer
+	ConnectTimer         metrics.Timer
+	TLSHandshakeTimer    metrics.Timer
+	TimeToFirstByteTimer metrics.Timer
 }
 
 type MarkupDeliveryMetrics struct {
@@ -124,6 +146,12 @@ func NewBlankMetrics(registry metrics.Registry, exchanges []openrtb_ext.BidderNa
 		userSyncSet:                    make(map[openrtb_ext.BidderName]metrics.Meter),
 		userSyncGDPRPrevent:            make(map[openrtb_ext.BidderName]metrics.Meter),
 
+		PrivacyCCPAEnforced:      blankMeter,
+		PrivacyCCPAIgnored:       blankMeter,
+		PrivacyCOPPARequest:      blankMeter,
+		PrivacyLMTRequest:        blankMeter,
+		PrivacyTCFRequestVersion: make(map[TCFVersionValue]metrics.Meter),
+
 		ImpsTypeBanner: blankMeter,
 		ImpsTypeVideo:  blankMeter,
 		ImpsTypeAudio:  blankMeter,
@@ -139,6 +167,10 @@ func NewBlankMetrics(registry metrics.Registry, exchanges []openrtb_ext.BidderNa
 		newMetrics.AdapterMetrics[a] = makeBlankAdapterMetrics()
 	}
 
+	for _, version := range TCFVersions() {
+		newMetrics.PrivacyTCFRequestVersion[version] = blankMeter
+	}
+
 	for _, t := range RequestTypes() {
 		newMetrics.RequestStatuses[t] = make(map[RequestStatus]metrics.Meter)
 		for _, s := range RequestStatuses() {
@@ -175,6 +207,14 @@ func NewMetrics(registry metrics.Registry, exchanges []openrtb_ext.BidderName, d
 	newMetrics.PrebidCacheRequestTimerSuccess = metrics.GetOrRegisterTimer("prebid_cache_request_time.ok", registry)
 	newMetrics.PrebidCacheRequestTimerError = metrics.GetOrRegisterTimer("prebid_cache_request_time.err", registry)
 
+	newMetrics.PrivacyCCPAEnforced = metrics.GetOrRegisterMeter("privacy.request.ccpa.enforced", registry)
+	newMetrics.PrivacyCCPAIgnored = metrics.GetOrRegisterMeter("privacy.request.ccpa.ignored", registry)
+	newMetrics.PrivacyCOPPARequest = metrics.GetOrRegisterMeter("privacy.request.coppa", registry)
+	newMetrics.PrivacyLMTRequest = metrics.GetOrRegisterMeter("privacy.request.lmt", registry)
+	for version := range newMetrics.PrivacyTCFRequestVersion {
+		newMetrics.PrivacyTCFRequestVersion[version] = metrics.GetOrRegisterMeter(fmt.Sprintf("privacy.request.tcf.%s", string(version)), registry)
+	}
+
 	newMetrics.AmpNoCookieMeter = metrics.GetOrRegisterMeter("amp_no_cookie_requests", registry)
 	newMetrics.CookieSyncMeter = metrics.GetOrRegisterMeter("cookie_sync_requests", registry)
 	newMetrics.userSyncBadRequest = metrics.GetOrRegisterMeter("usersync.bad_requests", registry)
@@ -185,6 +225,9 @@ func NewMetrics(registry metrics.Registry, exchanges []openrtb_ext.BidderName, d
 		newMetrics.userSyncSet[a] = metrics.GetOrRegisterMeter(fmt.Sprintf("usersync.%s.sets", string(a)), registry)
 		newMetrics.userSyncGDPRPrevent[a] = metrics.GetOrRegisterMeter(fmt.Sprintf("usersync.%s.gdpr_prevent", string(a)), registry)
 		registerAdapterMetrics(registry, "adapter", string(a), newMetrics.AdapterMetrics[a])
+		if !disableAccountMetrics.AdapterConnectionMetrics {
+			registerAdapterConnectionMetrics(registry, string(a), newMetrics.AdapterMetrics[a])
+		}
 	}
 	for typ, statusMap := range newMetrics.RequestStatuses {
 		for stat := range statusMap {
@@ -207,6 +250,7 @@ func makeBlankAdapterMetrics() *AdapterMetrics {
 	newAdapter := &AdapterMetrics{
 		NoCookieMeter:     blankMeter,
 		ErrorMeters:       make(map[AdapterError]metrics.Meter),
+		RejectedBidMeters: make(map[RejectReason]metrics.Meter),
 		NoBidMeter:        blankMeter,
 		GotBidsMeter:      blankMeter,
 		RequestTimer:      &metrics.NilTimer{},
@@ -214,10 +258,27 @@ func makeBlankAdapterMetrics() *AdapterMetrics {
 		BidsReceivedMeter: blankMeter,
 		PanicMeter:        blankMeter,
 		MarkupMetrics:     makeBlankBidMarkupMetrics(),
+
+		PrivacyEnforcedMeters: make(map[PrivacyPolicy]metrics.Meter),
+		ShapedMeter:           blankMeter,
+
+		ConnCreated:          blankMeter,
+		ConnReused:           blankMeter,
+		ConnWaitTime:         &metrics.NilTimer{},
+		DNSLookupTimer:       &metrics.NilTimer{},
+		ConnectTimer:         &metrics.NilTimer{},
+		TLSHandshakeTimer:    &metrics.NilTimer{},
+		TimeToFirstByteTimer: &metrics.NilTimer{},
 	}
 	for _, err := range AdapterErrors() {
 		newAdapter.ErrorMeters[err] = blankMeter
 	}
+	for _, policy := range PrivacyPolicies() {
+		newAdapter.PrivacyEnforcedMeters[policy] = blankMeter
+	}
+	for _, reason := range RejectReasons() {
+		newAdapter.RejectedBidMeters[reason] = blankMeter
+	}
 	return newAdapter
 }
 
@@ -252,12 +313,33 @@ func registerAdapterMetrics(registry metrics.Registry, adapterOrAccount string,
 	for err := range am.ErrorMeters {
 		am.ErrorMeters[err] = metrics.GetOrRegisterMeter(fmt.Sprintf("%s.%s.requests.%s", adapterOrAccount, exchange, err), registry)
 	}
+	for reason := range am.RejectedBidMeters {
+		am.RejectedBidMeters[reason] = metrics.GetOrRegisterMeter(fmt.Sprintf("%s.%s.bids_rejected.%s", adapterOrAccount, exchange, reason), registry)
+	}
+	if adapterOrAccount == "adapter" {
+		for policy := range am.PrivacyEnforcedMeters {
+			am.PrivacyEnforcedMeters[policy] = metrics.GetOrRegisterMeter(fmt.Sprintf("%s.%s.privacy.%s", adapterOrAccount, exchange, policy), registry)
+		}
+		am.ShapedMeter = metrics.GetOrRegisterMeter(fmt.Sprintf("%[1]s.%[2]s.requests.shaped", adapterOrAccount, exchange), registry)
+	}
 	if adapterOrAccount != "adapter" {
 		am.BidsReceivedMeter = metrics.GetOrRegisterMeter(fmt.Sprintf("%[1]s.%[2]s.bids_received", adapterOrAccount, exchange), registry)
 	}
 	am.PanicMeter = metrics.GetOrRegisterMeter(fmt.Sprintf("%[1]s.%[2]s.requests.panic", adapterOrAccount, exchange), registry)
 }
 
+// registerAdapterConnectionMetrics registers the metrics for the HTTP connections to an adapter.
+// If they aren't registered, the blank metrics ignore the updates.
+func registerAdapterConnectionMetrics(registry metrics.Registry, exchange string, am *AdapterMetrics) {
+	am.ConnCreated = metrics.GetOrRegisterMeter(fmt.Sprintf("adapter.%s.connections_created", exchange), registry)
+	am.ConnReused = metrics.GetOrRegisterMeter(fmt.Sprintf("adapter.%s.connections_reused", exchange), registry)
+	am.ConnWaitTime = metrics.GetOrRegisterTimer(fmt.Sprintf("adapter.%s.connection_wait_time", exchange), registry)
+	am.DNSLookupTimer = metrics.GetOrRegisterTimer(fmt.Sprintf("adapter.%s.dns_lookup_time", exchange), registry)
+	am.ConnectTimer = metrics.GetOrRegisterTimer(fmt.Sprintf("adapter.%s.connect_time", exchange), registry)
+	am.TLSHandshakeTimer = metrics.GetOrRegisterTimer(fmt.Sprintf("adapter.%s.tls_handshake_time", exchange), registry)
+	am.TimeToFirstByteTimer = metrics.GetOrRegisterTimer(fmt.Sprintf("adapter.%s.time_to_first_byte", exchange), registry)
+}
+
 func makeDeliveryMetrics(registry metrics.Registry, prefix string, bidType openrtb_ext.BidType) *MarkupDeliveryMetrics {
 	return &MarkupDeliveryMetrics{
 		AdmMeter:  metrics.GetOrRegisterMeter(prefix+"."+string(bidType)+".adm_bids_received", registry),
@@ -462,6 +544,25 @@ func (me *Metrics) RecordAdapterPrice(labels AdapterLabels, cpm float64) {
 	}
 }
 
+// RecordAdapterBidsRejected implements a part of the MetricsEngine interface. Counts the bids removed from the auction
+func (me *Metrics) RecordAdapterBidsRejected(labels AdapterLabels, reason RejectReason, count int) {
+	am, ok := me.AdapterMetrics[labels.Adapter]
+	if !ok {
+		glog.Errorf("Trying to run adapter rejected bid metrics on %s: adapter metrics not found", string(labels.Adapter))
+		return
+	}
+	// Adapter metrics
+	if meter, ok := am.RejectedBidMeters[reason]; ok {
+		meter.Mark(int64(count))
+	}
+	// Account-Adapter metrics
+	if aam, ok := me.getAccountMetrics(labels.PubID).adapterMetrics[labels.Adapter]; ok {
+		if meter, ok := aam.RejectedBidMeters[reason]; ok {
+			meter.Mark(int64(count))
+		}
+	}
+}
+
 // RecordAdapterTime implements a part of the MetricsEngine interface. Records the adapter response time
 func (me *Metrics) RecordAdapterTime(labels AdapterLabels, length time.Duration) {
 	am, ok := me.AdapterMetrics[labels.Adapter]
@@ -477,6 +578,50 @@ func (me *Metrics) RecordAdapterTime(labels AdapterLabels, length time.Duration)
 	}
 }
 
+// RecordAdapterConnections implements a part of the MetricsEngine interface. Records whether the request
+// to an adapter reused a connection, and how long it waited for it.
+func (me *Metrics) RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration) {
+	am, ok := me.AdapterMetrics[adapter]
+	if !ok {
+		glog.Errorf("Trying to run adapter connection metrics on %s: adapter metrics not found", string(adapter))
+		return
+	}
+	if connWasReused {
+		am.ConnReused.Mark(1)
+	} else {
+		am.ConnCreated.Mark(1)
+	}
+	am.ConnWaitTime.Update(connWaitTime)
+}
+
+// RecordAdapterDNSTime implements a part of the MetricsEngine interface.
+func (me *Metrics) RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration) {
+	if am, ok := me.AdapterMetrics[adapter]; ok {
+		am.DNSLookupTimer.Update(dnsLookupTime)
+	}
+}
+
+// RecordAdapterConnectTime implements a part of the MetricsEngine interface.
+func (me *Metrics) RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration) {
+	if am, ok := me.AdapterMetrics[adapter]; ok {
+		am.ConnectTimer.Update(connectTime)
+	}
+}
+
+// RecordAdapterTLSHandshakeTime implements a part of the MetricsEngine interface.
+func (me *Metrics) RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration) {
+	if am, ok := me.AdapterMetrics[adapter]; ok {
+		am.TLSHandshakeTimer.Update(tlsHandshakeTime)
+	}
+}
+
+// RecordAdapterTimeToFirstByte implements a part of the MetricsEngine interface.
+func (me *Metrics) RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration) {
+	if am, ok := me.AdapterMetrics[adapter]; ok {
+		am.TimeToFirstByteTimer.Update(timeToFirstByte)
+	}
+}
+
 // RecordCookieSync implements a part of the MetricsEngine interface. Records a cookie sync request
 func (me *Metrics) RecordCookieSync() {
 	me.CookieSyncMeter.Mark(1)
@@ -516,6 +661,53 @@ func (me *Metrics) RecordStoredImpCacheResult(cacheResult CacheResult, inc int)
 	me.StoredImpCacheMeter[cacheResult].Mark(int64(inc))
 }
 
+// RecordRequestPrivacy implements a part of the MetricsEngine interface. Records the privacy
+// policies which applied to an auction request.
+func (me *Metrics) RecordRequestPrivacy(privacy PrivacyLabels) {
+	if privacy.CCPAProvided {
+		if privacy.CCPAEnforced {
+			me.PrivacyCCPAEnforced.Mark(1)
+		} else {
+			me.PrivacyCCPAIgnored.Mark(1)
+		}
+	}
+	if privacy.COPPAEnforced {
+		me.PrivacyCOPPARequest.Mark(1)
+	}
+	if privacy.GDPREnforced && privacy.GDPRTCFVersion != "" {
+		if meter, ok := me.PrivacyTCFRequestVersion[privacy.GDPRTCFVersion]; ok {
+			meter.Mark(1)
+		}
+	}
+	if privacy.LMT {
+		me.PrivacyLMTRequest.Mark(1)
+	}
+}
+
+// RecordAdapterPrivacyEnforced implements a part of the MetricsEngine interface. Records a privacy
+// policy which removed personal info from an adapter's request.
+func (me *Metrics) RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy PrivacyPolicy) {
+	am, ok := me.AdapterMetrics[adapter]
+	if !ok {
+		glog.Errorf("Trying to run adapter privacy metrics on %s: adapter metrics not found", string(adapter))
+		return
+	}
+	if meter, ok := am.PrivacyEnforcedMeters[policy]; ok {
+		meter.Mark(1)
+	}
+}
+
+// RecordAdapterRequestShaped implements a part of the MetricsEngine interface. Records a request
+// which traffic shaping didn't send to an adapter.
+func (me *Metrics) RecordAdapterRequestShaped(adapter openrtb_ext.BidderName) {
+	am, ok := me.AdapterMetrics[adapter]
+	if !ok {
+		glog.Errorf("Trying to run adapter traffic shaping metrics on %s: adapter metrics not found", string(adapter))
+		return
+	}
+	am.ShapedMeter.Mark(1)
+}
+
 // RecordPrebidCacheRequestTime implements a part of the MetricsEngine interface. Records the
 // amount of time taken to store the auction result in Prebid Cache.
 func (me *Metrics) RecordPrebidCacheRequestTime(success bool, length time.Duration) {
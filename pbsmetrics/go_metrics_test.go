@@ -2,6 +2,7 @@ package pbsmetrics
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prebid/prebid-server/config"
 	"github.com/prebid/prebid-server/openrtb_ext"
@@ -69,6 +70,113 @@ func TestRecordBidType(t *testing.T) {
 	VerifyMetrics(t, "Appnexus Video Nurl Bids", m.AdapterMetrics[openrtb_ext.BidderAppnexus].MarkupMetrics[openrtb_ext.BidTypeVideo].NurlMeter.Count(), 1)
 }
 
+func TestRecordAdapterBidsRejected(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
+
+	m.RecordAdapterBidsRejected(AdapterLabels{
+		Adapter: openrtb_ext.BidderAppnexus,
+		PubID:   "acct-1",
+	}, RejectReasonBelowFloor, 2)
+	ensureContains(t, registry, "adapter.appnexus.bids_rejected.below_floor", m.AdapterMetrics[openrtb_ext.BidderAppnexus].RejectedBidMeters[RejectReasonBelowFloor])
+	VerifyMetrics(t, "Appnexus Bids Rejected Below Floor", m.AdapterMetrics[openrtb_ext.BidderAppnexus].RejectedBidMeters[RejectReasonBelowFloor].Count(), 2)
+	VerifyMetrics(t, "Account Appnexus Bids Rejected Below Floor", m.getAccountMetrics("acct-1").adapterMetrics[openrtb_ext.BidderAppnexus].RejectedBidMeters[RejectReasonBelowFloor].Count(), 2)
+}
+
+func TestRecordRequestPrivacy(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
+
+	m.RecordRequestPrivacy(PrivacyLabels{
+		CCPAProvided:   true,
+		CCPAEnforced:   true,
+		COPPAEnforced:  true,
+		GDPREnforced:   true,
+		GDPRTCFVersion: TCFVersionV2,
+		LMT:            true,
+	})
+	m.RecordRequestPrivacy(PrivacyLabels{
+		CCPAProvided:   true,
+		GDPREnforced:   true,
+		GDPRTCFVersion: TCFVersionErr,
+	})
+	m.RecordRequestPrivacy(PrivacyLabels{
+		GDPRTCFVersion: TCFVersionV1,
+	})
+
+	ensureContains(t, registry, "privacy.request.ccpa.enforced", m.PrivacyCCPAEnforced)
+	ensureContains(t, registry, "privacy.request.tcf.v2", m.PrivacyTCFRequestVersion[TCFVersionV2])
+	VerifyMetrics(t, "CCPA Enforced", m.PrivacyCCPAEnforced.Count(), 1)
+	VerifyMetrics(t, "CCPA Ignored", m.PrivacyCCPAIgnored.Count(), 1)
+	VerifyMetrics(t, "COPPA", m.PrivacyCOPPARequest.Count(), 1)
+	VerifyMetrics(t, "LMT", m.PrivacyLMTRequest.Count(), 1)
+	VerifyMetrics(t, "TCF v1", m.PrivacyTCFRequestVersion[TCFVersionV1].Count(), 0)
+	VerifyMetrics(t, "TCF v2", m.PrivacyTCFRequestVersion[TCFVersionV2].Count(), 1)
+	VerifyMetrics(t, "TCF err", m.PrivacyTCFRequestVersion[TCFVersionErr].Count(), 1)
+}
+
+func TestRecordAdapterPrivacyEnforced(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
+
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, PrivacyPolicyGDPR)
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, PrivacyPolicyGDPR)
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, PrivacyPolicyCCPA)
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderRubicon, PrivacyPolicyCCPA)
+
+	ensureContains(t, registry, "adapter.appnexus.privacy.gdpr", m.AdapterMetrics[openrtb_ext.BidderAppnexus].PrivacyEnforcedMeters[PrivacyPolicyGDPR])
+	VerifyMetrics(t, "Appnexus GDPR", m.AdapterMetrics[openrtb_ext.BidderAppnexus].PrivacyEnforcedMeters[PrivacyPolicyGDPR].Count(), 2)
+	VerifyMetrics(t, "Appnexus CCPA", m.AdapterMetrics[openrtb_ext.BidderAppnexus].PrivacyEnforcedMeters[PrivacyPolicyCCPA].Count(), 1)
+	VerifyMetrics(t, "Appnexus COPPA", m.AdapterMetrics[openrtb_ext.BidderAppnexus].PrivacyEnforcedMeters[PrivacyPolicyCOPPA].Count(), 0)
+}
+
+func TestRecordAdapterRequestShaped(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
+
+	m.RecordAdapterRequestShaped(openrtb_ext.BidderAppnexus)
+	m.RecordAdapterRequestShaped(openrtb_ext.BidderAppnexus)
+	m.RecordAdapterRequestShaped(openrtb_ext.BidderRubicon)
+
+	ensureContains(t, registry, "adapter.appnexus.requests.shaped", m.AdapterMetrics[openrtb_ext.BidderAppnexus].ShapedMeter)
+	VerifyMetrics(t, "Appnexus shaped", m.AdapterMetrics[openrtb_ext.BidderAppnexus].ShapedMeter.Count(), 2)
+}
+
+func TestRecordAdapterConnections(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
+
+	m.RecordAdapterConnections(openrtb_ext.BidderAppnexus, true, 2*time.Millisecond)
+	m.RecordAdapterConnections(openrtb_ext.BidderAppnexus, false, 3*time.Millisecond)
+	m.RecordAdapterConnections(openrtb_ext.BidderAppnexus, false, 5*time.Millisecond)
+	m.RecordAdapterDNSTime(openrtb_ext.BidderAppnexus, time.Millisecond)
+	m.RecordAdapterConnectTime(openrtb_ext.BidderAppnexus, time.Millisecond)
+	m.RecordAdapterTLSHandshakeTime(openrtb_ext.BidderAppnexus, time.Millisecond)
+	m.RecordAdapterTimeToFirstByte(openrtb_ext.BidderAppnexus, time.Millisecond)
+
+	am := m.AdapterMetrics[openrtb_ext.BidderAppnexus]
+	ensureContains(t, registry, "adapter.appnexus.connections_reused", am.ConnReused)
+	ensureContains(t, registry, "adapter.appnexus.tls_handshake_time", am.TLSHandshakeTimer)
+	VerifyMetrics(t, "Appnexus Connections Reused", am.ConnReused.Count(), 1)
+	VerifyMetrics(t, "Appnexus Connections Created", am.ConnCreated.Count(), 2)
+	VerifyMetrics(t, "Appnexus Connection Wait Time", am.ConnWaitTime.Count(), 3)
+	VerifyMetrics(t, "Appnexus DNS Lookup Time", am.DNSLookupTimer.Count(), 1)
+	VerifyMetrics(t, "Appnexus Connect Time", am.ConnectTimer.Count(), 1)
+	VerifyMetrics(t, "Appnexus TLS Handshake Time", am.TLSHandshakeTimer.Count(), 1)
+	VerifyMetrics(t, "Appnexus Time To First Byte", am.TimeToFirstByteTimer.Count(), 1)
+}
+
+func TestAdapterConnectionMetricsDisabled(t *testing.T) {
+	registry := metrics.NewRegistry()
+	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{AdapterConnectionMetrics: true})
+
+	m.RecordAdapterConnections(openrtb_ext.BidderAppnexus, false, 3*time.Millisecond)
+	m.RecordAdapterTimeToFirstByte(openrtb_ext.BidderAppnexus, time.Millisecond)
+
+	assert.Nil(t, registry.Get("adapter.appnexus.connections_created"), "The connection metrics shouldn't be registered")
+	assert.Nil(t, registry.Get("adapter.appnexus.time_to_first_byte"), "The connection metrics shouldn't be registered")
+}
+
 func TestRecordGDPRRejection(t *testing.T) {
 	registry := metrics.NewRegistry()
 	m := NewMetrics(registry, []openrtb_ext.BidderName{openrtb_ext.BidderAppnexus}, config.DisabledMetrics{})
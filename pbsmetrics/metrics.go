@@ -67,6 +67,9 @@ type AdapterBid string
 // AdapterError : Errors which may have occurred during the adapter's execution
 type AdapterError string
 
+// RejectReason : Reasons a bid may be removed from the auction after the adapter returned it
+type RejectReason string
+
 // CacheResult : Cache hit/miss
 type CacheResult string
 
@@ -190,6 +193,8 @@ const (
 	AdapterErrorBadServerResponse   AdapterError = "badserverresponse"
 	AdapterErrorTimeout             AdapterError = "timeout"
 	AdapterErrorFailedToRequestBids AdapterError = "failedtorequestbid"
+	AdapterErrorThrottled           AdapterError = "throttled"
+	AdapterErrorModuleRejected      AdapterError = "module_rejected"
 	AdapterErrorUnknown             AdapterError = "unknown_error"
 )
 
@@ -199,10 +204,34 @@ func AdapterErrors() []AdapterError {
 		AdapterErrorBadServerResponse,
 		AdapterErrorTimeout,
 		AdapterErrorFailedToRequestBids,
+		AdapterErrorThrottled,
+		AdapterErrorModuleRejected,
 		AdapterErrorUnknown,
 	}
 }
 
+// Bid rejection reasons
+const (
+	RejectReasonBelowFloor RejectReason = "below_floor"
+	RejectReasonInvalidBid RejectReason = "invalid_bid"
+	// These are only used when bid validation is enforced.
+	RejectReasonInvalidSize       RejectReason = "invalid_size"
+	RejectReasonInvalidMediaType  RejectReason = "invalid_media_type"
+	RejectReasonBlockedAdvertiser RejectReason = "blocked_advertiser"
+	RejectReasonBlockedCategory   RejectReason = "blocked_category"
+)
+
+func RejectReasons() []RejectReason {
+	return []RejectReason{
+		RejectReasonBelowFloor,
+		RejectReasonInvalidBid,
+		RejectReasonInvalidSize,
+		RejectReasonInvalidMediaType,
+		RejectReasonBlockedAdvertiser,
+		RejectReasonBlockedCategory,
+	}
+}
+
 const (
 	// CacheHit represents a cache hit i.e the key was found in cache
 	CacheHit CacheResult = "hit"
@@ -246,6 +275,70 @@ func RequestActions() []RequestAction {
 	}
 }
 
+// PrivacyLabels : Labels for the privacy policies which applied to a request
+type PrivacyLabels struct {
+	// CCPAProvided is true if the request had a us_privacy signal.
+	CCPAProvided bool
+	// CCPAEnforced is true if the user opted out of sale, and the host and account enforce CCPA.
+	CCPAEnforced  bool
+	COPPAEnforced bool
+	GDPREnforced  bool
+	// GDPRTCFVersion is the version of the request's consent string. It's only set if GDPR is enforced
+	// and the request has a consent string.
+	GDPRTCFVersion TCFVersionValue
+	// LMT is true if the device has Limit Ad Tracking enabled. It's only counted, since no personal info is removed for it.
+	LMT bool
+}
+
+// TCFVersionValue : The TCF version of a GDPR consent string
+type TCFVersionValue string
+
+// TCF version labels
+const (
+	TCFVersionErr TCFVersionValue = "err"
+	TCFVersionV1  TCFVersionValue = "v1"
+	TCFVersionV2  TCFVersionValue = "v2"
+)
+
+// TCFVersions returns possible TCF version labels
+func TCFVersions() []TCFVersionValue {
+	return []TCFVersionValue{
+		TCFVersionErr,
+		TCFVersionV1,
+		TCFVersionV2,
+	}
+}
+
+// TCFVersionToValue returns the label for a TCF version number. Unknown versions are treated as errors.
+func TCFVersionToValue(version int) TCFVersionValue {
+	switch version {
+	case 1:
+		return TCFVersionV1
+	case 2:
+		return TCFVersionV2
+	}
+	return TCFVersionErr
+}
+
+// PrivacyPolicy : A privacy policy which can remove personal info from the request sent to an adapter
+type PrivacyPolicy string
+
+// Privacy policy labels
+const (
+	PrivacyPolicyCCPA  PrivacyPolicy = "ccpa"
+	PrivacyPolicyCOPPA PrivacyPolicy = "coppa"
+	PrivacyPolicyGDPR  PrivacyPolicy = "gdpr"
+)
+
+// PrivacyPolicies returns possible privacy policy labels
+func PrivacyPolicies() []PrivacyPolicy {
+	return []PrivacyPolicy{
+		PrivacyPolicyCCPA,
+		PrivacyPolicyCOPPA,
+		PrivacyPolicyGDPR,
+	}
+}
+
 // MetricsEngine is a generic interface to record PBS metrics into the desired backend
 // The first three metrics function fire off once per incoming request, so total metrics
 // will equal the total numer of incoming requests. The remaining 5 fire off per outgoing
@@ -265,11 +358,30 @@ type MetricsEngine interface {
 	// Since the legacy endpoints don't have a bid type, it can only count bids from OpenRTB and AMP.
 	RecordAdapterBidReceived(labels AdapterLabels, bidType openrtb_ext.BidType, hasAdm bool)
 	RecordAdapterPrice(labels AdapterLabels, cpm float64)
+	// RecordAdapterBidsRejected records bids which the exchange removed from the auction after the adapter returned them.
+	RecordAdapterBidsRejected(labels AdapterLabels, reason RejectReason, count int)
 	RecordAdapterTime(labels AdapterLabels, length time.Duration)
+	// RecordAdapterRequestShaped records a request which wasn't sent to an adapter because traffic shaping
+	// predicted that it wouldn't bid.
+	RecordAdapterRequestShaped(adapter openrtb_ext.BidderName)
+	// RecordAdapterConnections records whether the request to an adapter got a new or a reused connection,
+	// and how long it waited for it.
+	RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration)
+	// RecordAdapterDNSTime, RecordAdapterConnectTime and RecordAdapterTLSHandshakeTime record the cost of
+	// opening a new connection to an adapter. They aren't recorded when a connection is reused.
+	RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration)
+	RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration)
+	RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration)
+	// RecordAdapterTimeToFirstByte records the time from getting a connection to reading the first byte of the adapter's response.
+	RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration)
 	RecordCookieSync()
 	RecordAdapterCookieSync(adapter openrtb_ext.BidderName, gdprBlocked bool)
 	RecordUserIDSet(userLabels UserLabels) // Function should verify bidder values
 	RecordStoredReqCacheResult(cacheResult CacheResult, inc int)
+	// RecordRequestPrivacy records the privacy policies which were signaled and enforced for an auction request.
+	RecordRequestPrivacy(privacy PrivacyLabels)
+	// RecordAdapterPrivacyEnforced records a privacy policy which removed personal info from the request sent to an adapter.
+	RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy PrivacyPolicy)
 	RecordStoredImpCacheResult(cacheResult CacheResult, inc int)
 	RecordPrebidCacheRequestTime(success bool, length time.Duration)
 }
@@ -62,11 +62,41 @@ func (me *MetricsEngineMock) RecordAdapterPrice(labels AdapterLabels, cpm float6
 	me.Called(labels, cpm)
 }
 
+// RecordAdapterBidsRejected mock
+func (me *MetricsEngineMock) RecordAdapterBidsRejected(labels AdapterLabels, reason RejectReason, count int) {
+	me.Called(labels, reason, count)
+}
+
 // RecordAdapterTime mock
 func (me *MetricsEngineMock) RecordAdapterTime(labels AdapterLabels, length time.Duration) {
 	me.Called(labels, length)
 }
 
+// RecordAdapterConnections mock
+func (me *MetricsEngineMock) RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration) {
+	me.Called(adapter, connWasReused, connWaitTime)
+}
+
+// RecordAdapterDNSTime mock
+func (me *MetricsEngineMock) RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration) {
+	me.Called(adapter, dnsLookupTime)
+}
+
+// RecordAdapterConnectTime mock
+func (me *MetricsEngineMock) RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration) {
+	me.Called(adapter, connectTime)
+}
+
+// RecordAdapterTLSHandshakeTime mock
+func (me *MetricsEngineMock) RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration) {
+	me.Called(adapter, tlsHandshakeTime)
+}
+
+// RecordAdapterTimeToFirstByte mock
+func (me *MetricsEngineMock) RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration) {
+	me.Called(adapter, timeToFirstByte)
+}
+
 // RecordCookieSync mock
 func (me *MetricsEngineMock) RecordCookieSync() {
 	me.Called()
@@ -96,3 +126,18 @@ func (me *MetricsEngineMock) RecordStoredImpCacheResult(cacheResult CacheResult,
 func (me *MetricsEngineMock) RecordPrebidCacheRequestTime(success bool, length time.Duration) {
 	me.Called(success, length)
 }
+
+// RecordAdapterRequestShaped mock
+func (me *MetricsEngineMock) RecordAdapterRequestShaped(adapter openrtb_ext.BidderName) {
+	me.Called(adapter)
+}
+
+// RecordRequestPrivacy mock
+func (me *MetricsEngineMock) RecordRequestPrivacy(privacy PrivacyLabels) {
+	me.Called(privacy)
+}
+
+// RecordAdapterPrivacyEnforced mock
+func (me *MetricsEngineMock) RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy PrivacyPolicy) {
+	me.Called(adapter, policy)
+}
@@ -14,8 +14,11 @@ func preloadLabelValues(m *Metrics) {
 		cacheResultValues     = cacheResultsAsString()
 		cookieValues          = cookieTypesAsString()
 		connectionErrorValues = []string{connectionAcceptError, connectionCloseError}
+		privacyPolicyValues   = privacyPoliciesAsString()
+		rejectReasonValues    = rejectReasonsAsString()
 		requestStatusValues   = requestStatusesAsString()
 		requestTypeValues     = requestTypesAsString()
+		tcfVersionValues      = tcfVersionsAsString()
 	)
 
 	preloadLabelValuesForCounter(m.connectionsError, map[string][]string{
@@ -54,11 +57,46 @@ func preloadLabelValues(m *Metrics) {
 		cacheResultLabel: cacheResultValues,
 	})
 
+	preloadLabelValuesForCounter(m.privacyCCPA, map[string][]string{
+		enforcedLabel: boolValues,
+	})
+
+	preloadLabelValuesForCounter(m.privacyTCF, map[string][]string{
+		versionLabel: tcfVersionValues,
+	})
+
 	preloadLabelValuesForCounter(m.adapterBids, map[string][]string{
 		adapterLabel:        adapterValues,
 		markupDeliveryLabel: bidTypeValues,
 	})
 
+	if !m.metricsDisabled.AdapterConnectionMetrics {
+		preloadLabelValuesForCounter(m.adapterConnections, map[string][]string{
+			adapterLabel: adapterValues,
+			reusedLabel:  boolValues,
+		})
+
+		preloadLabelValuesForHistogram(m.adapterConnWait, map[string][]string{
+			adapterLabel: adapterValues,
+		})
+
+		preloadLabelValuesForHistogram(m.adapterDNSLookup, map[string][]string{
+			adapterLabel: adapterValues,
+		})
+
+		preloadLabelValuesForHistogram(m.adapterConnect, map[string][]string{
+			adapterLabel: adapterValues,
+		})
+
+		preloadLabelValuesForHistogram(m.adapterTLSHandshake, map[string][]string{
+			adapterLabel: adapterValues,
+		})
+
+		preloadLabelValuesForHistogram(m.adapterFirstByte, map[string][]string{
+			adapterLabel: adapterValues,
+		})
+	}
+
 	preloadLabelValuesForCounter(m.adapterCookieSync, map[string][]string{
 		adapterLabel:        adapterValues,
 		privacyBlockedLabel: boolValues,
@@ -73,6 +111,16 @@ func preloadLabelValues(m *Metrics) {
 		adapterLabel: adapterValues,
 	})
 
+	preloadLabelValuesForCounter(m.adapterPrivacy, map[string][]string{
+		adapterLabel:       adapterValues,
+		privacyPolicyLabel: privacyPolicyValues,
+	})
+
+	preloadLabelValuesForCounter(m.adapterRejectedBids, map[string][]string{
+		adapterLabel:      adapterValues,
+		rejectReasonLabel: rejectReasonValues,
+	})
+
 	preloadLabelValuesForHistogram(m.adapterPrices, map[string][]string{
 		adapterLabel: adapterValues,
 	})
@@ -87,6 +135,10 @@ func preloadLabelValues(m *Metrics) {
 		adapterLabel: adapterValues,
 	})
 
+	preloadLabelValuesForCounter(m.adapterShaped, map[string][]string{
+		adapterLabel: adapterValues,
+	})
+
 	preloadLabelValuesForCounter(m.adapterUserSync, map[string][]string{
 		adapterLabel: adapterValues,
 		actionLabel:  actionValues,
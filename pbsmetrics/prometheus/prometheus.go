@@ -28,18 +28,35 @@ type Metrics struct {
 	storedImpressionsCacheResult *prometheus.CounterVec
 	storedRequestCacheResult     *prometheus.CounterVec
 
+	// Privacy Metrics
+	privacyCCPA  *prometheus.CounterVec
+	privacyCOPPA prometheus.Counter
+	privacyLMT   prometheus.Counter
+	privacyTCF   *prometheus.CounterVec
+
 	// Adapter Metrics
 	adapterBids          *prometheus.CounterVec
+	adapterConnections   *prometheus.CounterVec
+	adapterConnWait      *prometheus.HistogramVec
+	adapterDNSLookup     *prometheus.HistogramVec
+	adapterConnect       *prometheus.HistogramVec
+	adapterTLSHandshake  *prometheus.HistogramVec
+	adapterFirstByte     *prometheus.HistogramVec
 	adapterCookieSync    *prometheus.CounterVec
 	adapterErrors        *prometheus.CounterVec
 	adapterPanics        *prometheus.CounterVec
+	adapterPrivacy       *prometheus.CounterVec
+	adapterRejectedBids  *prometheus.CounterVec
 	adapterPrices        *prometheus.HistogramVec
 	adapterRequests      *prometheus.CounterVec
 	adapterRequestsTimer *prometheus.HistogramVec
+	adapterShaped        *prometheus.CounterVec
 	adapterUserSync      *prometheus.CounterVec
 
 	// Account Metrics
 	accountRequests *prometheus.CounterVec
+
+	metricsDisabled config.DisabledMetrics
 }
 
 const (
@@ -51,6 +68,7 @@ const (
 	cacheResultLabel     = "cache_result"
 	connectionErrorLabel = "connection_error"
 	cookieLabel          = "cookie"
+	enforcedLabel        = "enforced"
 	hasBidsLabel         = "has_bids"
 	isAudioLabel         = "audio"
 	isBannerLabel        = "banner"
@@ -58,9 +76,13 @@ const (
 	isVideoLabel         = "video"
 	markupDeliveryLabel  = "delivery"
 	privacyBlockedLabel  = "privacy_blocked"
+	privacyPolicyLabel   = "policy"
+	rejectReasonLabel    = "reject_reason"
 	requestStatusLabel   = "request_status"
 	requestTypeLabel     = "request_type"
+	reusedLabel          = "reused"
 	successLabel         = "success"
+	versionLabel         = "version"
 )
 
 const (
@@ -74,13 +96,15 @@ const (
 )
 
 // NewMetrics initializes a new Prometheus metrics instance with preloaded label values.
-func NewMetrics(cfg config.PrometheusMetrics) *Metrics {
+func NewMetrics(cfg config.PrometheusMetrics, disabledMetrics config.DisabledMetrics) *Metrics {
 	requestTimeBuckets := []float64{0.05, 0.1, 0.15, 0.20, 0.25, 0.3, 0.4, 0.5, 0.75, 1}
 	cacheWriteTimeBuckts := []float64{0.001, 0.002, 0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 1}
 	priceBuckets := []float64{250, 500, 750, 1000, 1500, 2000, 2500, 3000, 3500, 4000}
+	connectionTimeBuckets := []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.15, 0.2, 0.3, 0.5}
 
 	metrics := Metrics{}
 	metrics.Registry = prometheus.NewRegistry()
+	metrics.metricsDisabled = disabledMetrics
 
 	metrics.connectionsClosed = newCounterWithoutLabels(cfg, metrics.Registry,
 		"connections_closed",
@@ -140,11 +164,66 @@ func NewMetrics(cfg config.PrometheusMetrics) *Metrics {
 		"Count of stored request cache requests attempts by hits or miss.",
 		[]string{cacheResultLabel})
 
+	metrics.privacyCCPA = newCounter(cfg, metrics.Registry,
+		"privacy_ccpa",
+		"Count of auction requests with a CCPA signal labeled by whether the opt-out was enforced.",
+		[]string{enforcedLabel})
+
+	metrics.privacyCOPPA = newCounterWithoutLabels(cfg, metrics.Registry,
+		"privacy_coppa",
+		"Count of auction requests which were subject to COPPA.")
+
+	metrics.privacyLMT = newCounterWithoutLabels(cfg, metrics.Registry,
+		"privacy_lmt",
+		"Count of auction requests where the device enabled Limit Ad Tracking.")
+
+	metrics.privacyTCF = newCounter(cfg, metrics.Registry,
+		"privacy_tcf",
+		"Count of auction requests subject to GDPR labeled by the TCF version of the consent string, or err if it couldn't be parsed.",
+		[]string{versionLabel})
+
 	metrics.adapterBids = newCounter(cfg, metrics.Registry,
 		"adapter_bids",
 		"Count of bids labeled by adapter and markup delivery type (adm or nurl).",
 		[]string{adapterLabel, markupDeliveryLabel})
 
+	if !metrics.metricsDisabled.AdapterConnectionMetrics {
+		metrics.adapterConnections = newCounter(cfg, metrics.Registry,
+			"adapter_connections",
+			"Count of HTTP connections used for requests to adapters labeled by adapter and whether the connection was reused.",
+			[]string{adapterLabel, reusedLabel})
+
+		metrics.adapterConnWait = newHistogram(cfg, metrics.Registry,
+			"adapter_connection_wait_seconds",
+			"Seconds waited for a new or reused HTTP connection to an adapter labeled by adapter.",
+			[]string{adapterLabel},
+			connectionTimeBuckets)
+
+		metrics.adapterDNSLookup = newHistogram(cfg, metrics.Registry,
+			"adapter_dns_lookup_seconds",
+			"Seconds spent on DNS lookups for new connections to an adapter labeled by adapter.",
+			[]string{adapterLabel},
+			connectionTimeBuckets)
+
+		metrics.adapterConnect = newHistogram(cfg, metrics.Registry,
+			"adapter_connect_seconds",
+			"Seconds spent opening new TCP connections to an adapter labeled by adapter.",
+			[]string{adapterLabel},
+			connectionTimeBuckets)
+
+		metrics.adapterTLSHandshake = newHistogram(cfg, metrics.Registry,
+			"adapter_tls_handshake_seconds",
+			"Seconds spent on TLS handshakes for new connections to an adapter labeled by adapter.",
+			[]string{adapterLabel},
+			connectionTimeBuckets)
+
+		metrics.adapterFirstByte = newHistogram(cfg, metrics.Registry,
+			"adapter_time_to_first_byte_seconds",
+			"Seconds from getting a connection to an adapter until the first byte of its response labeled by adapter.",
+			[]string{adapterLabel},
+			requestTimeBuckets)
+	}
+
 	metrics.adapterCookieSync = newCounter(cfg, metrics.Registry,
 		"adapter_cookie_sync",
 		"Count of cookie sync requests received labeled by adapter and if the sync was blocked due to privacy regulation (GDPR, CCPA, etc...).",
@@ -160,6 +239,16 @@ func NewMetrics(cfg config.PrometheusMetrics) *Metrics {
 		"Count of panics labeled by adapter.",
 		[]string{adapterLabel})
 
+	metrics.adapterPrivacy = newCounter(cfg, metrics.Registry,
+		"adapter_privacy_enforced",
+		"Count of requests which had personal info removed before they were sent to the adapter, labeled by adapter and privacy policy.",
+		[]string{adapterLabel, privacyPolicyLabel})
+
+	metrics.adapterRejectedBids = newCounter(cfg, metrics.Registry,
+		"adapter_rejected_bids",
+		"Count of bids removed from the auction after the adapter returned them, labeled by adapter and reason.",
+		[]string{adapterLabel, rejectReasonLabel})
+
 	metrics.adapterPrices = newHistogram(cfg, metrics.Registry,
 		"adapter_prices",
 		"Monetary value of the bids labeled by adapter.",
@@ -177,6 +266,11 @@ func NewMetrics(cfg config.PrometheusMetrics) *Metrics {
 		[]string{adapterLabel},
 		requestTimeBuckets)
 
+	metrics.adapterShaped = newCounter(cfg, metrics.Registry,
+		"adapter_requests_shaped",
+		"Count of requests which traffic shaping didn't send to the adapter because it rarely bids on the inventory, labeled by adapter.",
+		[]string{adapterLabel})
+
 	metrics.adapterUserSync = newCounter(cfg, metrics.Registry,
 		"adapter_user_sync",
 		"Count of user ID sync requests received labeled by adapter and action.",
@@ -328,6 +422,13 @@ func (m *Metrics) RecordAdapterPrice(labels pbsmetrics.AdapterLabels, cpm float6
 	}).Observe(cpm)
 }
 
+func (m *Metrics) RecordAdapterBidsRejected(labels pbsmetrics.AdapterLabels, reason pbsmetrics.RejectReason, count int) {
+	m.adapterRejectedBids.With(prometheus.Labels{
+		adapterLabel:      string(labels.Adapter),
+		rejectReasonLabel: string(reason),
+	}).Add(float64(count))
+}
+
 func (m *Metrics) RecordAdapterTime(labels pbsmetrics.AdapterLabels, length time.Duration) {
 	if len(labels.AdapterErrors) == 0 {
 		m.adapterRequestsTimer.With(prometheus.Labels{
@@ -336,6 +437,61 @@ func (m *Metrics) RecordAdapterTime(labels pbsmetrics.AdapterLabels, length time
 	}
 }
 
+func (m *Metrics) RecordAdapterConnections(adapter openrtb_ext.BidderName, connWasReused bool, connWaitTime time.Duration) {
+	if m.metricsDisabled.AdapterConnectionMetrics {
+		return
+	}
+
+	m.adapterConnections.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+		reusedLabel:  strconv.FormatBool(connWasReused),
+	}).Inc()
+
+	m.adapterConnWait.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Observe(connWaitTime.Seconds())
+}
+
+func (m *Metrics) RecordAdapterDNSTime(adapter openrtb_ext.BidderName, dnsLookupTime time.Duration) {
+	if m.metricsDisabled.AdapterConnectionMetrics {
+		return
+	}
+
+	m.adapterDNSLookup.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Observe(dnsLookupTime.Seconds())
+}
+
+func (m *Metrics) RecordAdapterConnectTime(adapter openrtb_ext.BidderName, connectTime time.Duration) {
+	if m.metricsDisabled.AdapterConnectionMetrics {
+		return
+	}
+
+	m.adapterConnect.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Observe(connectTime.Seconds())
+}
+
+func (m *Metrics) RecordAdapterTLSHandshakeTime(adapter openrtb_ext.BidderName, tlsHandshakeTime time.Duration) {
+	if m.metricsDisabled.AdapterConnectionMetrics {
+		return
+	}
+
+	m.adapterTLSHandshake.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Observe(tlsHandshakeTime.Seconds())
+}
+
+func (m *Metrics) RecordAdapterTimeToFirstByte(adapter openrtb_ext.BidderName, timeToFirstByte time.Duration) {
+	if m.metricsDisabled.AdapterConnectionMetrics {
+		return
+	}
+
+	m.adapterFirstByte.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Observe(timeToFirstByte.Seconds())
+}
+
 func (m *Metrics) RecordCookieSync() {
 	m.cookieSync.Inc()
 }
@@ -369,6 +525,41 @@ func (m *Metrics) RecordStoredImpCacheResult(cacheResult pbsmetrics.CacheResult,
 	}).Add(float64(inc))
 }
 
+func (m *Metrics) RecordRequestPrivacy(privacy pbsmetrics.PrivacyLabels) {
+	if privacy.CCPAProvided {
+		m.privacyCCPA.With(prometheus.Labels{
+			enforcedLabel: strconv.FormatBool(privacy.CCPAEnforced),
+		}).Inc()
+	}
+
+	if privacy.COPPAEnforced {
+		m.privacyCOPPA.Inc()
+	}
+
+	if privacy.GDPREnforced && privacy.GDPRTCFVersion != "" {
+		m.privacyTCF.With(prometheus.Labels{
+			versionLabel: string(privacy.GDPRTCFVersion),
+		}).Inc()
+	}
+
+	if privacy.LMT {
+		m.privacyLMT.Inc()
+	}
+}
+
+func (m *Metrics) RecordAdapterPrivacyEnforced(adapter openrtb_ext.BidderName, policy pbsmetrics.PrivacyPolicy) {
+	m.adapterPrivacy.With(prometheus.Labels{
+		adapterLabel:       string(adapter),
+		privacyPolicyLabel: string(policy),
+	}).Inc()
+}
+
+func (m *Metrics) RecordAdapterRequestShaped(adapter openrtb_ext.BidderName) {
+	m.adapterShaped.With(prometheus.Labels{
+		adapterLabel: string(adapter),
+	}).Inc()
+}
+
 func (m *Metrics) RecordPrebidCacheRequestTime(success bool, length time.Duration) {
 	m.prebidCacheWriteTimer.With(prometheus.Labels{
 		successLabel: strconv.FormatBool(success),
@@ -17,7 +17,7 @@ func createMetricsForTesting() *Metrics {
 		Port:      8080,
 		Namespace: "prebid",
 		Subsystem: "server",
-	})
+	}, config.DisabledMetrics{})
 }
 
 func TestMetricCountGatekeeping(t *testing.T) {
@@ -61,7 +61,7 @@ func TestMetricCountGatekeeping(t *testing.T) {
 	// Verify Per-Adapter Cardinality
 	// - This assertion provides a warning for newly added adapter metrics. Threre are 40+ adapters which makes the
 	//   cost of new per-adapter metrics rather expensive. Thought should be given when adding new per-adapter metrics.
-	assert.True(t, perAdapterCardinalityCount <= 22, "Per-Adapter Cardinality")
+	assert.True(t, perAdapterCardinalityCount <= 41, "Per-Adapter Cardinality")
 }
 
 func TestConnectionMetrics(t *testing.T) {
@@ -802,6 +802,23 @@ func TestAdapterPanicMetric(t *testing.T) {
 		})
 }
 
+func TestRecordAdapterBidsRejectedMetric(t *testing.T) {
+	m := createMetricsForTesting()
+	adapterName := "anyName"
+
+	m.RecordAdapterBidsRejected(pbsmetrics.AdapterLabels{
+		Adapter: openrtb_ext.BidderName(adapterName),
+	}, pbsmetrics.RejectReasonBelowFloor, 3)
+
+	expectedCount := float64(3)
+	assertCounterVecValue(t, "", "adapterRejectedBids", m.adapterRejectedBids,
+		expectedCount,
+		prometheus.Labels{
+			adapterLabel:      adapterName,
+			rejectReasonLabel: string(pbsmetrics.RejectReasonBelowFloor),
+		})
+}
+
 func TestStoredReqCacheResultMetric(t *testing.T) {
 	m := createMetricsForTesting()
 
@@ -842,6 +859,126 @@ func TestStoredImpCacheResultMetric(t *testing.T) {
 		})
 }
 
+func TestRecordRequestPrivacy(t *testing.T) {
+	m := createMetricsForTesting()
+
+	m.RecordRequestPrivacy(pbsmetrics.PrivacyLabels{
+		CCPAProvided:   true,
+		CCPAEnforced:   true,
+		COPPAEnforced:  true,
+		GDPREnforced:   true,
+		GDPRTCFVersion: pbsmetrics.TCFVersionV2,
+		LMT:            true,
+	})
+	m.RecordRequestPrivacy(pbsmetrics.PrivacyLabels{
+		CCPAProvided:   true,
+		GDPREnforced:   true,
+		GDPRTCFVersion: pbsmetrics.TCFVersionErr,
+	})
+	m.RecordRequestPrivacy(pbsmetrics.PrivacyLabels{
+		GDPRTCFVersion: pbsmetrics.TCFVersionV1,
+	})
+
+	assertCounterVecValue(t, "", "privacy_ccpa:enforced", m.privacyCCPA, 1, prometheus.Labels{enforcedLabel: "true"})
+	assertCounterVecValue(t, "", "privacy_ccpa:ignored", m.privacyCCPA, 1, prometheus.Labels{enforcedLabel: "false"})
+	assertCounterValue(t, "", "privacy_coppa", m.privacyCOPPA, 1)
+	assertCounterValue(t, "", "privacy_lmt", m.privacyLMT, 1)
+	assertCounterVecValue(t, "", "privacy_tcf:v1", m.privacyTCF, 0, prometheus.Labels{versionLabel: "v1"})
+	assertCounterVecValue(t, "", "privacy_tcf:v2", m.privacyTCF, 1, prometheus.Labels{versionLabel: "v2"})
+	assertCounterVecValue(t, "", "privacy_tcf:err", m.privacyTCF, 1, prometheus.Labels{versionLabel: "err"})
+}
+
+func TestRecordAdapterPrivacyEnforced(t *testing.T) {
+	m := createMetricsForTesting()
+
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyGDPR)
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyGDPR)
+	m.RecordAdapterPrivacyEnforced(openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyCOPPA)
+
+	assertCounterVecValue(t, "", "adapter_privacy_enforced:gdpr", m.adapterPrivacy, 2, prometheus.Labels{
+		adapterLabel:       string(openrtb_ext.BidderAppnexus),
+		privacyPolicyLabel: string(pbsmetrics.PrivacyPolicyGDPR),
+	})
+	assertCounterVecValue(t, "", "adapter_privacy_enforced:coppa", m.adapterPrivacy, 1, prometheus.Labels{
+		adapterLabel:       string(openrtb_ext.BidderAppnexus),
+		privacyPolicyLabel: string(pbsmetrics.PrivacyPolicyCOPPA),
+	})
+	assertCounterVecValue(t, "", "adapter_privacy_enforced:ccpa", m.adapterPrivacy, 0, prometheus.Labels{
+		adapterLabel:       string(openrtb_ext.BidderAppnexus),
+		privacyPolicyLabel: string(pbsmetrics.PrivacyPolicyCCPA),
+	})
+}
+
+func TestRecordAdapterRequestShaped(t *testing.T) {
+	m := createMetricsForTesting()
+
+	m.RecordAdapterRequestShaped(openrtb_ext.BidderAppnexus)
+	m.RecordAdapterRequestShaped(openrtb_ext.BidderAppnexus)
+
+	assertCounterVecValue(t, "", "adapter_requests_shaped", m.adapterShaped, 2, prometheus.Labels{
+		adapterLabel: string(openrtb_ext.BidderAppnexus),
+	})
+	assertCounterVecValue(t, "", "adapter_requests_shaped:rubicon", m.adapterShaped, 0, prometheus.Labels{
+		adapterLabel: string(openrtb_ext.BidderRubicon),
+	})
+}
+
+func TestRecordAdapterConnections(t *testing.T) {
+	m := createMetricsForTesting()
+	adapterName := "anyName"
+
+	m.RecordAdapterConnections(openrtb_ext.BidderName(adapterName), true, 2*time.Millisecond)
+	m.RecordAdapterConnections(openrtb_ext.BidderName(adapterName), false, 3*time.Millisecond)
+	m.RecordAdapterConnections(openrtb_ext.BidderName(adapterName), false, 5*time.Millisecond)
+
+	assertCounterVecValue(t, "", "adapter_connections:reused", m.adapterConnections, 1, prometheus.Labels{
+		adapterLabel: adapterName,
+		reusedLabel:  "true",
+	})
+	assertCounterVecValue(t, "", "adapter_connections:created", m.adapterConnections, 2, prometheus.Labels{
+		adapterLabel: adapterName,
+		reusedLabel:  "false",
+	})
+	result := getHistogramFromHistogramVec(m.adapterConnWait, adapterLabel, adapterName)
+	assertHistogram(t, "adapterConnWait", result, 3, 0.01)
+}
+
+func TestRecordAdapterConnectionTimes(t *testing.T) {
+	m := createMetricsForTesting()
+	adapterName := "anyName"
+
+	m.RecordAdapterDNSTime(openrtb_ext.BidderName(adapterName), 1*time.Second)
+	m.RecordAdapterConnectTime(openrtb_ext.BidderName(adapterName), 2*time.Second)
+	m.RecordAdapterTLSHandshakeTime(openrtb_ext.BidderName(adapterName), 3*time.Second)
+	m.RecordAdapterTimeToFirstByte(openrtb_ext.BidderName(adapterName), 4*time.Second)
+
+	assertHistogram(t, "adapterDNSLookup", getHistogramFromHistogramVec(m.adapterDNSLookup, adapterLabel, adapterName), 1, 1)
+	assertHistogram(t, "adapterConnect", getHistogramFromHistogramVec(m.adapterConnect, adapterLabel, adapterName), 1, 2)
+	assertHistogram(t, "adapterTLSHandshake", getHistogramFromHistogramVec(m.adapterTLSHandshake, adapterLabel, adapterName), 1, 3)
+	assertHistogram(t, "adapterFirstByte", getHistogramFromHistogramVec(m.adapterFirstByte, adapterLabel, adapterName), 1, 4)
+}
+
+func TestRecordAdapterConnectionsDisabled(t *testing.T) {
+	m := NewMetrics(config.PrometheusMetrics{
+		Port:      8080,
+		Namespace: "prebid",
+		Subsystem: "server",
+	}, config.DisabledMetrics{AdapterConnectionMetrics: true})
+
+	m.RecordAdapterConnections(openrtb_ext.BidderName("anyName"), true, 2*time.Millisecond)
+	m.RecordAdapterDNSTime(openrtb_ext.BidderName("anyName"), time.Second)
+	m.RecordAdapterConnectTime(openrtb_ext.BidderName("anyName"), time.Second)
+	m.RecordAdapterTLSHandshakeTime(openrtb_ext.BidderName("anyName"), time.Second)
+	m.RecordAdapterTimeToFirstByte(openrtb_ext.BidderName("anyName"), time.Second)
+
+	metricFamilies, err := m.Registry.Gather()
+	assert.NoError(t, err, "gather metrics")
+	for _, metricFamily := range metricFamilies {
+		assert.NotContains(t, metricFamily.GetName(), "adapter_connect", "The connection metrics shouldn't be registered")
+		assert.NotContains(t, metricFamily.GetName(), "adapter_time_to_first_byte", "The connection metrics shouldn't be registered")
+	}
+}
+
 func TestCookieMetric(t *testing.T) {
 	m := createMetricsForTesting()
 
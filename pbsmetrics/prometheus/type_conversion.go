@@ -59,6 +59,24 @@ func cacheResultsAsString() []string {
 	return valuesAsString
 }
 
+func privacyPoliciesAsString() []string {
+	values := pbsmetrics.PrivacyPolicies()
+	valuesAsString := make([]string, len(values))
+	for i, v := range values {
+		valuesAsString[i] = string(v)
+	}
+	return valuesAsString
+}
+
+func rejectReasonsAsString() []string {
+	values := pbsmetrics.RejectReasons()
+	valuesAsString := make([]string, len(values))
+	for i, v := range values {
+		valuesAsString[i] = string(v)
+	}
+	return valuesAsString
+}
+
 func requestStatusesAsString() []string {
 	values := pbsmetrics.RequestStatuses()
 	valuesAsString := make([]string, len(values))
@@ -76,3 +94,12 @@ func requestTypesAsString() []string {
 	}
 	return valuesAsString
 }
+
+func tcfVersionsAsString() []string {
+	values := pbsmetrics.TCFVersions()
+	valuesAsString := make([]string, len(values))
+	for i, v := range values {
+		valuesAsString[i] = string(v)
+	}
+	return valuesAsString
+}
@@ -2,6 +2,8 @@ package privacy
 
 import (
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 )
 
 // Enforcement represents the privacy policies to enforce for an OpenRTB bid request.
@@ -16,9 +18,13 @@ func (e Enforcement) Any() bool {
 	return e.CCPA || e.COPPA || e.GDPR
 }
 
-// Apply cleans personally identifiable information from an OpenRTB bid request.
-func (e Enforcement) Apply(bidRequest *openrtb.BidRequest, isAMP bool) {
+// Apply cleans personally identifiable information from an OpenRTB bid request, and records
+// the policies which were enforced for the bidder.
+func (e Enforcement) Apply(bidRequest *openrtb.BidRequest, isAMP bool, bidder openrtb_ext.BidderName, metricsEngine pbsmetrics.MetricsEngine) {
 	e.apply(bidRequest, isAMP, NewScrubber())
+	if bidRequest != nil {
+		e.recordMetrics(bidder, metricsEngine)
+	}
 }
 
 func (e Enforcement) apply(bidRequest *openrtb.BidRequest, isAMP bool, scrubber Scrubber) {
@@ -28,6 +34,18 @@ func (e Enforcement) apply(bidRequest *openrtb.BidRequest, isAMP bool, scrubber
 	}
 }
 
+func (e Enforcement) recordMetrics(bidder openrtb_ext.BidderName, metricsEngine pbsmetrics.MetricsEngine) {
+	if e.CCPA {
+		metricsEngine.RecordAdapterPrivacyEnforced(bidder, pbsmetrics.PrivacyPolicyCCPA)
+	}
+	if e.COPPA {
+		metricsEngine.RecordAdapterPrivacyEnforced(bidder, pbsmetrics.PrivacyPolicyCOPPA)
+	}
+	if e.GDPR {
+		metricsEngine.RecordAdapterPrivacyEnforced(bidder, pbsmetrics.PrivacyPolicyGDPR)
+	}
+}
+
 func (e Enforcement) getDeviceMacAndIFA() bool {
 	return e.COPPA
 }
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/mxmCherry/openrtb"
+	"github.com/prebid/prebid-server/openrtb_ext"
+	"github.com/prebid/prebid-server/pbsmetrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -199,6 +201,26 @@ func TestApplyNoneApplicable(t *testing.T) {
 	assert.Equal(t, user, req.User, "User Set Correctly")
 }
 
+func TestApplyRecordsMetrics(t *testing.T) {
+	enforcement := Enforcement{
+		CCPA:  true,
+		COPPA: true,
+	}
+	req := &openrtb.BidRequest{
+		Device: &openrtb.Device{IFA: "original"},
+	}
+
+	metricsMock := &pbsmetrics.MetricsEngineMock{}
+	metricsMock.On("RecordAdapterPrivacyEnforced", openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyCCPA).Once()
+	metricsMock.On("RecordAdapterPrivacyEnforced", openrtb_ext.BidderAppnexus, pbsmetrics.PrivacyPolicyCOPPA).Once()
+
+	enforcement.Apply(req, false, openrtb_ext.BidderAppnexus, metricsMock)
+
+	metricsMock.AssertExpectations(t)
+	metricsMock.AssertNumberOfCalls(t, "RecordAdapterPrivacyEnforced", 2)
+	assert.Empty(t, req.Device.IFA, "Device IFA Removed")
+}
+
 type mockScrubber struct {
 	mock.Mock
 }
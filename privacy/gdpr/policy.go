@@ -5,30 +5,97 @@ import (
 
 	"github.com/buger/jsonparser"
 	"github.com/mxmCherry/openrtb"
+	tcf "github.com/prebid/prebid-server/gdpr"
 )
 
 // Policy represents the GDPR regulation for an OpenRTB bid request.
 type Policy struct {
 	Signal  string
 	Consent string
+	// AdditionalConsent is Google's Additional Consent string. It lists the consented ad tech providers which
+	// aren't registered with the IAB.
+	AdditionalConsent string
 }
 
 // Write mutates an OpenRTB bid request with the context of the GDPR policy.
 func (p Policy) Write(req *openrtb.BidRequest) error {
+	if err := p.writeSignal(req); err != nil {
+		return err
+	}
+	if err := p.writeConsent(req); err != nil {
+		return err
+	}
+	return p.writeAdditionalConsent(req)
+}
+
+// ConsentVersion returns the TCF version of the consent string. It returns an error if the consent string is malformed.
+func (p Policy) ConsentVersion() (int, error) {
+	return tcf.ParseConsentVersion(p.Consent)
+}
+
+// writeSignal sets regs.ext.gdpr if the Signal is "0" or "1".
+func (p Policy) writeSignal(req *openrtb.BidRequest) error {
+	if p.Signal != "0" && p.Signal != "1" {
+		return nil
+	}
+
+	if req.Regs == nil {
+		req.Regs = &openrtb.Regs{}
+	}
+
+	if req.Regs.Ext == nil {
+		req.Regs.Ext = json.RawMessage(`{"gdpr":` + p.Signal + `}`)
+		return nil
+	}
+
+	var err error
+	req.Regs.Ext, err = jsonparser.Set(req.Regs.Ext, []byte(p.Signal), "gdpr")
+	return err
+}
+
+// writeConsent sets user.ext.consent. The consent string comes straight from the request, so it's escaped
+// before it goes into the JSON.
+func (p Policy) writeConsent(req *openrtb.BidRequest) error {
 	if p.Consent == "" {
 		return nil
 	}
 
+	value, err := json.Marshal(p.Consent)
+	if err != nil {
+		return err
+	}
+
 	if req.User == nil {
 		req.User = &openrtb.User{}
 	}
 
 	if req.User.Ext == nil {
-		req.User.Ext = json.RawMessage(`{"consent":"` + p.Consent + `"}`)
+		req.User.Ext = json.RawMessage(`{}`)
+	}
+
+	req.User.Ext, err = jsonparser.Set(req.User.Ext, value, "consent")
+	return err
+}
+
+// writeAdditionalConsent sets user.ext.ConsentedProvidersSettings.consented_providers, where Google expects it.
+func (p Policy) writeAdditionalConsent(req *openrtb.BidRequest) error {
+	if p.AdditionalConsent == "" {
 		return nil
 	}
 
-	var err error
-	req.User.Ext, err = jsonparser.Set(req.User.Ext, []byte(`"`+p.Consent+`"`), "consent")
+	value, err := json.Marshal(p.AdditionalConsent)
+	if err != nil {
+		return err
+	}
+
+	if req.User == nil {
+		req.User = &openrtb.User{}
+	}
+
+	if req.User.Ext == nil {
+		req.User.Ext = json.RawMessage(`{}`)
+	}
+
+	req.User.Ext, err = jsonparser.Set(req.User.Ext, value, "ConsentedProvidersSettings", "consented_providers")
 	return err
 }
@@ -59,6 +59,49 @@ func TestWrite(t *testing.T) {
 				Ext: json.RawMessage(`malformed`)}},
 			expectedError: true,
 		},
+		{
+			description: "Consent Is Escaped",
+			policy:      Policy{Consent: `any","injected":"1`},
+			request: &openrtb.BidRequest{User: &openrtb.User{
+				Ext: json.RawMessage(`{"existing":"any"}`)}},
+			expected: &openrtb.BidRequest{User: &openrtb.User{
+				Ext: json.RawMessage(`{"existing":"any","consent":"any\",\"injected\":\"1"}`)}},
+		},
+		{
+			description: "Signal With Nil Request Regs Object",
+			policy:      Policy{Signal: "1"},
+			request:     &openrtb.BidRequest{},
+			expected: &openrtb.BidRequest{Regs: &openrtb.Regs{
+				Ext: json.RawMessage(`{"gdpr":1}`)}},
+		},
+		{
+			description: "Signal With Existing Request Regs Ext Object - Overwrites",
+			policy:      Policy{Signal: "0"},
+			request: &openrtb.BidRequest{Regs: &openrtb.Regs{
+				Ext: json.RawMessage(`{"us_privacy":"1---","gdpr":1}`)}},
+			expected: &openrtb.BidRequest{Regs: &openrtb.Regs{
+				Ext: json.RawMessage(`{"us_privacy":"1---","gdpr":0}`)}},
+		},
+		{
+			description: "Unknown Signal",
+			policy:      Policy{Signal: "yes"},
+			request:     &openrtb.BidRequest{},
+			expected:    &openrtb.BidRequest{},
+		},
+		{
+			description: "Additional Consent With Consent",
+			policy:      Policy{Consent: "anyConsent", AdditionalConsent: `1~7.12."35"`},
+			request:     &openrtb.BidRequest{},
+			expected: &openrtb.BidRequest{User: &openrtb.User{
+				Ext: json.RawMessage(`{"consent":"anyConsent","ConsentedProvidersSettings":{"consented_providers":"1~7.12.\"35\""}}`)}},
+		},
+		{
+			description: "Additional Consent With Nil Request User Ext Object",
+			policy:      Policy{AdditionalConsent: "1~7.12.35"},
+			request:     &openrtb.BidRequest{User: &openrtb.User{}},
+			expected: &openrtb.BidRequest{User: &openrtb.User{
+				Ext: json.RawMessage(`{"ConsentedProvidersSettings":{"consented_providers":"1~7.12.35"}}`)}},
+		},
 	}
 
 	for _, test := range testCases {
@@ -72,3 +115,16 @@ func TestWrite(t *testing.T) {
 		}
 	}
 }
+
+func TestConsentVersion(t *testing.T) {
+	version, err := Policy{Consent: "BOa71ZYOa71ZYAbABBENA8-AAAAbN7_______9______9uz_Gv_r_f__33e8_39v_h_7_-___m_-3zV4-_lvR11yPA1OrfIrwFhiAw"}.ConsentVersion()
+	assert.NoError(t, err, "TCF v1")
+	assert.Equal(t, 1, version, "TCF v1")
+
+	version, err = Policy{Consent: "COzTVhaOzTVhaGvAAAENAiCIAP_AAH_AAAAAAEEUACCKAAA"}.ConsentVersion()
+	assert.NoError(t, err, "TCF v2")
+	assert.Equal(t, 2, version, "TCF v2")
+
+	_, err = Policy{Consent: "malformed"}.ConsentVersion()
+	assert.Error(t, err, "Malformed")
+}
@@ -97,6 +97,92 @@ func (fetcher *dbFetcher) FetchCategories(ctx context.Context, primaryAdServer,
 	return "", nil
 }
 
+// FetchAccount expects the query template to select accounts using %REQUEST_ID_LIST%, returning
+// the same (id, data, type) columns as FetchRequests.
+func (fetcher *dbFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	query := fetcher.queryMaker(1, 0)
+	rows, err := fetcher.db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		if err != context.DeadlineExceeded && !isBadInput(err) {
+			glog.Errorf("Error reading Account from Stored Request DB: %s", err.Error())
+			return nil, appendErrors("Account", []string{accountID}, nil, nil)
+		}
+		return nil, []error{err}
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("error closing DB connection: %v", err)
+		}
+	}()
+
+	accountData := make(map[string]json.RawMessage, 1)
+	for rows.Next() {
+		var id string
+		var data []byte
+		var dataType string
+
+		if err := rows.Scan(&id, &data, &dataType); err != nil {
+			return nil, []error{err}
+		}
+		accountData[id] = data
+	}
+
+	if rows.Err() != nil {
+		return nil, []error{rows.Err()}
+	}
+
+	if errs := appendErrors("Account", []string{accountID}, accountData, nil); len(errs) > 0 {
+		return nil, errs
+	}
+	return accountData[accountID], nil
+}
+
+// FetchResponses expects the query template to select responses using %REQUEST_ID_LIST%, returning
+// the same (id, data, type) columns as FetchRequests.
+func (fetcher *dbFetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	if len(ids) < 1 {
+		return nil, nil
+	}
+
+	query := fetcher.queryMaker(len(ids), 0)
+	idInterfaces := make([]interface{}, len(ids))
+	for i := 0; i < len(ids); i++ {
+		idInterfaces[i] = ids[i]
+	}
+
+	rows, err := fetcher.db.QueryContext(ctx, query, idInterfaces...)
+	if err != nil {
+		if err != context.DeadlineExceeded && !isBadInput(err) {
+			glog.Errorf("Error reading Stored Responses from Stored Request DB: %s", err.Error())
+			return nil, appendErrors("Response", ids, nil, nil)
+		}
+		return nil, []error{err}
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			glog.Errorf("error closing DB connection: %v", err)
+		}
+	}()
+
+	responseData := make(map[string]json.RawMessage, len(ids))
+	for rows.Next() {
+		var id string
+		var data []byte
+		var dataType string
+
+		if err := rows.Scan(&id, &data, &dataType); err != nil {
+			return nil, []error{err}
+		}
+		responseData[id] = data
+	}
+
+	if rows.Err() != nil {
+		return nil, []error{rows.Err()}
+	}
+
+	return responseData, appendErrors("Response", ids, responseData, nil)
+}
+
 func appendErrors(dataType string, ids []string, data map[string]json.RawMessage, errs []error) []error {
 	for _, id := range ids {
 		if _, ok := data[id]; !ok {
@@ -173,6 +173,60 @@ func TestRowErrors(t *testing.T) {
 	assertMapLength(t, 0, data)
 }
 
+// TestAccountResponse makes sure we read Account data out of the DB response.
+func TestAccountResponse(t *testing.T) {
+	mockQuery := "SELECT id, config, 'account' AS dataType FROM accounts WHERE id IN (?)"
+	mockReturn := sqlmock.NewRows([]string{"id", "data", "dataType"}).
+		AddRow("account-id", `{"id":"account-id","disabled":true}`, "account")
+
+	mock, fetcher := newFetcher(t, mockReturn, mockQuery, "account-id")
+	defer fetcher.db.Close()
+
+	account, errs := fetcher.FetchAccount(context.Background(), "account-id")
+
+	assertMockExpectations(t, mock)
+	assertErrorCount(t, 0, errs)
+	if string(account) != `{"id":"account-id","disabled":true}` {
+		t.Errorf("Bad account data. Got %s", account)
+	}
+}
+
+// TestAccountMissing makes sure we return a NotFoundError if the DB doesn't have the Account.
+func TestAccountMissing(t *testing.T) {
+	mockQuery := "SELECT id, config, 'account' AS dataType FROM accounts WHERE id IN (?)"
+	mockReturn := sqlmock.NewRows([]string{"id", "data", "dataType"})
+
+	mock, fetcher := newFetcher(t, mockReturn, mockQuery, "account-id")
+	defer fetcher.db.Close()
+
+	account, errs := fetcher.FetchAccount(context.Background(), "account-id")
+
+	assertMockExpectations(t, mock)
+	assertErrorCount(t, 1, errs)
+	if account != nil {
+		t.Errorf("Expected nil account data. Got %s", account)
+	}
+}
+
+// TestResponsesResponse makes sure we read Stored Responses out of the DB response.
+func TestResponsesResponse(t *testing.T) {
+	mockQuery := "SELECT id, data, 'response' AS dataType FROM stored_responses WHERE id IN (?, ?)"
+	mockReturn := sqlmock.NewRows([]string{"id", "data", "dataType"}).
+		AddRow("resp-1", `[{"seat":"appnexus"}]`, "response")
+
+	mock, fetcher := newFetcher(t, mockReturn, mockQuery, "resp-1", "resp-2")
+	defer fetcher.db.Close()
+
+	data, errs := fetcher.FetchResponses(context.Background(), []string{"resp-1", "resp-2"})
+
+	assertMockExpectations(t, mock)
+	assertErrorCount(t, 1, errs)
+	assertMapLength(t, 1, data)
+	if string(data["resp-1"]) != `[{"seat":"appnexus"}]` {
+		t.Errorf("Bad response data. Got %s", data["resp-1"])
+	}
+}
+
 func newFetcher(t *testing.T, rows *sqlmock.Rows, query string, args ...driver.Value) (sqlmock.Sqlmock, *dbFetcher) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -30,3 +30,21 @@ func (fetcher EmptyFetcher) FetchRequests(ctx context.Context, requestIDs []stri
 func (fetcher EmptyFetcher) FetchCategories(ctx context.Context, primaryAdServer, publisherId, iabCategory string) (string, error) {
 	return "", nil
 }
+
+func (fetcher EmptyFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	return nil, []error{stored_requests.NotFoundError{
+		ID:       accountID,
+		DataType: "Account",
+	}}
+}
+
+func (fetcher EmptyFetcher) FetchResponses(ctx context.Context, ids []string) (data map[string]json.RawMessage, errs []error) {
+	errs = make([]error, 0, len(ids))
+	for _, id := range ids {
+		errs = append(errs, stored_requests.NotFoundError{
+			ID:       id,
+			DataType: "Response",
+		})
+	}
+	return
+}
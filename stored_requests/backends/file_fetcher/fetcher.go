@@ -14,7 +14,8 @@ import (
 // These are stored in memory for low-latency reads.
 //
 // This expects each file in the directory to be named "{config_id}.json".
-// For example, when asked to fetch the request with ID == "23", it will return the data from "directory/23.json".
+// For example, when asked to fetch the request with ID == "23", it will return the data from "directory/stored_requests/23.json".
+// Accounts are read from the "accounts" subdirectory, and Stored Responses from the "stored_responses" subdirectory, in the same way.
 func NewFileFetcher(directory string) (stored_requests.AllFetcher, error) {
 	storedData, err := collectStoredData(directory, FileSystem{make(map[string]FileSystem), make(map[string]json.RawMessage)}, nil)
 	return &eagerFetcher{storedData, nil}, err
@@ -76,6 +77,21 @@ func (fetcher *eagerFetcher) FetchCategories(ctx context.Context, primaryAdServe
 
 }
 
+func (fetcher *eagerFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	if account, ok := fetcher.FileSystem.Directories["accounts"].Files[accountID]; ok {
+		return account, nil
+	}
+	return nil, []error{stored_requests.NotFoundError{
+		ID:       accountID,
+		DataType: "Account",
+	}}
+}
+
+func (fetcher *eagerFetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	storedResponses := fetcher.FileSystem.Directories["stored_responses"].Files
+	return storedResponses, appendErrors("Response", ids, storedResponses, nil)
+}
+
 type FileSystem struct {
 	Directories map[string]FileSystem
 	Files       map[string]json.RawMessage
@@ -158,3 +158,27 @@ func TestCategoriesFetcherNoCategoriesFile(t *testing.T) {
 	assert.Equal(t, fmt.Errorf("Unable to find mapping file for adserver: 'test', publisherId: 'not_exists'"),
 		fetchingErr, "Categories were loaded incorrectly")
 }
+
+func TestAccountFetcher(t *testing.T) {
+	fetcher, err := NewFileFetcher("./test")
+	assert.NoError(t, err, "Failed to create test fetcher")
+
+	account, errs := fetcher.FetchAccount(context.Background(), "valid")
+	assertErrorCount(t, 0, errs)
+	assert.JSONEq(t, `{"id": "valid", "disabled": false, "default_timeout_ms": 500}`, string(account))
+
+	_, errs = fetcher.FetchAccount(context.Background(), "nonexistent")
+	assertErrorCount(t, 1, errs)
+	assert.Error(t, errs[0])
+	assert.Equal(t, stored_requests.NotFoundError{ID: "nonexistent", DataType: "Account"}, errs[0])
+}
+
+func TestResponseFetcher(t *testing.T) {
+	fetcher, err := NewFileFetcher("./test")
+	assert.NoError(t, err, "Failed to create test fetcher")
+
+	data, errs := fetcher.FetchResponses(context.Background(), []string{"auction", "nonexistent"})
+	assertErrorCount(t, 1, errs)
+	assert.Equal(t, stored_requests.NotFoundError{ID: "nonexistent", DataType: "Response"}, errs[0])
+	assert.JSONEq(t, `[{"seat": "appnexus", "bid": [{"id": "stored-bid", "impid": "imp-id", "price": 1.5}]}]`, string(data["auction"]))
+}
@@ -35,6 +35,30 @@ import (
 //   }
 // }
 //
+// Accounts are fetched from the same endpoint with:
+//
+// GET {endpoint}?account-ids=["acc1"]
+//
+// This endpoint should return a payload like:
+//
+// {
+//   "accounts": {
+//     "acc1": { ... stored data for acc1 ... }
+//   }
+// }
+//
+// Stored Responses are fetched from the same endpoint with:
+//
+// GET {endpoint}?response-ids=["resp1","resp2"]
+//
+// This endpoint should return a payload like:
+//
+// {
+//   "responses": {
+//     "resp1": { ... stored data for resp1 ... },
+//     "resp2": null // If resp2 is not found
+//   }
+// }
 //
 func NewFetcher(client *http.Client, endpoint string) *HttpFetcher {
 	// Do some work up-front to figure out if the (configurable) endpoint has a query string or not.
@@ -131,6 +155,83 @@ func (fetcher *HttpFetcher) FetchCategories(ctx context.Context, primaryAdServer
 	}
 }
 
+func (fetcher *HttpFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	httpReq, err := http.NewRequest("GET", fetcher.Endpoint+"account-ids=[\""+accountID+"\"]", nil)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	httpResp, err := ctxhttp.Do(ctx, fetcher.client, httpReq)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, []error{fmt.Errorf("Error fetching Account %s via HTTP. Response code was %d", accountID, httpResp.StatusCode)}
+	}
+
+	var responseObj accountsResponseContract
+	if err := json.Unmarshal(respBytes, &responseObj); err != nil {
+		return nil, []error{err}
+	}
+	if errs := convertNullsToErrs(responseObj.Accounts, "Account", nil); len(errs) > 0 {
+		return nil, errs
+	}
+	if account, ok := responseObj.Accounts[accountID]; ok {
+		return account, nil
+	}
+	return nil, []error{stored_requests.NotFoundError{
+		ID:       accountID,
+		DataType: "Account",
+	}}
+}
+
+func (fetcher *HttpFetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	httpReq, err := http.NewRequest("GET", fetcher.Endpoint+"response-ids=[\""+strings.Join(ids, "\",\"")+"\"]", nil)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	httpResp, err := ctxhttp.Do(ctx, fetcher.client, httpReq)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, []error{fmt.Errorf("Error fetching Stored Responses via HTTP. Response code was %d", httpResp.StatusCode)}
+	}
+
+	var responseObj storedResponsesContract
+	if err := json.Unmarshal(respBytes, &responseObj); err != nil {
+		return nil, []error{err}
+	}
+	var errs []error
+	for _, id := range ids {
+		if _, ok := responseObj.Responses[id]; !ok {
+			errs = append(errs, stored_requests.NotFoundError{
+				ID:       id,
+				DataType: "Response",
+			})
+		}
+	}
+	errs = convertNullsToErrs(responseObj.Responses, "Response", errs)
+	return responseObj.Responses, errs
+}
+
 func buildRequest(endpoint string, requestIDs []string, impIDs []string) (*http.Request, error) {
 	if len(requestIDs) > 0 && len(impIDs) > 0 {
 		return http.NewRequest("GET", endpoint+"request-ids=[\""+strings.Join(requestIDs, "\",\"")+"\"]&imp-ids=[\""+strings.Join(impIDs, "\",\"")+"\"]", nil)
@@ -186,3 +287,13 @@ type responseContract struct {
 	Requests map[string]json.RawMessage `json:"requests"`
 	Imps     map[string]json.RawMessage `json:"imps"`
 }
+
+// accountsResponseContract is used to unmarshal Account responses from the endpoint
+type accountsResponseContract struct {
+	Accounts map[string]json.RawMessage `json:"accounts"`
+}
+
+// storedResponsesContract is used to unmarshal Stored Responses from the endpoint
+type storedResponsesContract struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+}
@@ -80,6 +80,60 @@ func TestErrResponse(t *testing.T) {
 	assertErrLength(t, errs, 1)
 }
 
+func TestFetchAccount(t *testing.T) {
+	fetcher, close := newTestAccountFetcher(t, "acc-1", jsonifyID)
+	defer close()
+
+	account, errs := fetcher.FetchAccount(context.Background(), "acc-1")
+	assertErrLength(t, errs, 0)
+	if string(account) != `"acc-1"` {
+		t.Errorf("Bad account data. Got %s", account)
+	}
+}
+
+func TestFetchAccountMissing(t *testing.T) {
+	fetcher, close := newTestAccountFetcher(t, "acc-1", jsonifyToNull)
+	defer close()
+
+	account, errs := fetcher.FetchAccount(context.Background(), "acc-1")
+	assertErrLength(t, errs, 1)
+	if account != nil {
+		t.Errorf("Expected nil account data. Got %s", account)
+	}
+}
+
+func TestFetchAccountErrResponse(t *testing.T) {
+	fetcher, close := newFetcherBrokenBackend()
+	defer close()
+
+	account, errs := fetcher.FetchAccount(context.Background(), "acc-1")
+	assertErrLength(t, errs, 1)
+	if account != nil {
+		t.Errorf("Expected nil account data. Got %s", account)
+	}
+}
+
+func TestFetchResponses(t *testing.T) {
+	fetcher, close := newTestResponsesFetcher(t, []string{"resp-1", "resp-2", "resp-3"}, map[string]json.RawMessage{
+		"resp-1": jsonifyID("resp-1"),
+		"resp-2": jsonifyToNull("resp-2"),
+	})
+	defer close()
+
+	data, errs := fetcher.FetchResponses(context.Background(), []string{"resp-1", "resp-2", "resp-3"})
+	assertErrLength(t, errs, 2)
+	assertSameContents(t, map[string]json.RawMessage{"resp-1": jsonifyID("resp-1")}, data)
+}
+
+func TestFetchResponsesErrResponse(t *testing.T) {
+	fetcher, close := newFetcherBrokenBackend()
+	defer close()
+
+	data, errs := fetcher.FetchResponses(context.Background(), []string{"resp-1"})
+	assertErrLength(t, errs, 1)
+	assertMapKeys(t, data)
+}
+
 func assertSameContents(t *testing.T, expected map[string]json.RawMessage, actual map[string]json.RawMessage) {
 	if len(expected) != len(actual) {
 		t.Errorf("Wrong counts. Expected %d, actual %d", len(expected), len(actual))
@@ -136,6 +190,37 @@ func newTestFetcher(t *testing.T, expectReqIDs []string, expectImpIDs []string)
 	return NewFetcher(server.Client(), server.URL), server.Close
 }
 
+func newTestAccountFetcher(t *testing.T, expectAccountID string, jsonifier func(string) json.RawMessage) (fetcher *HttpFetcher, closer func()) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		assertMatches(t, r.URL.Query().Get("account-ids"), []string{expectAccountID})
+		respObj := accountsResponseContract{
+			Accounts: map[string]json.RawMessage{expectAccountID: jsonifier(expectAccountID)},
+		}
+		if respBytes, err := json.Marshal(respObj); err != nil {
+			t.Errorf("failed to marshal accountsResponseContract in test:  %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.Write(respBytes)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	return NewFetcher(server.Client(), server.URL), server.Close
+}
+
+func newTestResponsesFetcher(t *testing.T, expectIDs []string, responses map[string]json.RawMessage) (fetcher *HttpFetcher, closer func()) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		assertMatches(t, r.URL.Query().Get("response-ids"), expectIDs)
+		if respBytes, err := json.Marshal(storedResponsesContract{Responses: responses}); err != nil {
+			t.Errorf("failed to marshal storedResponsesContract in test:  %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.Write(respBytes)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	return NewFetcher(server.Client(), server.URL), server.Close
+}
+
 func newHandler(t *testing.T, expectReqIDs []string, expectImpIDs []string, jsonifier func(string) json.RawMessage) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query()
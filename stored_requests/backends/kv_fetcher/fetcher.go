@@ -0,0 +1,322 @@
+package kv_fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/prebid/prebid-server/stored_requests/events"
+)
+
+// The data types share the file, so each key starts with its type.
+const (
+	requestPrefix  = "request\x00"
+	impPrefix      = "imp\x00"
+	accountPrefix  = "account\x00"
+	responsePrefix = "response\x00"
+	categoryPrefix = "category\x00"
+)
+
+func categoryKey(primaryAdServer, publisherId, iabCategory string) string {
+	return categoryPrefix + primaryAdServer + "\x00" + publisherId + "\x00" + iabCategory
+}
+
+// Data is a bulk load of stored data.
+type Data struct {
+	Requests  map[string]json.RawMessage `json:"requests"`
+	Imps      map[string]json.RawMessage `json:"imps"`
+	Accounts  map[string]json.RawMessage `json:"accounts"`
+	Responses map[string]json.RawMessage `json:"responses"`
+	// Categories maps each ad server to its publishers, and each publisher to its IAB category mapping.
+	// The mapping for all of the ad server's publishers goes under the empty publisher ID, just like the
+	// "{adserver}.json" file does for the file_fetcher.
+	Categories map[string]map[string]map[string]stored_requests.Category `json:"categories"`
+}
+
+// NewFetcher returns a Fetcher for the stored data in the file at path. Only the keys are kept in memory.
+// The values are read from the file when they're fetched.
+//
+// If the file doesn't exist yet, the Fetcher starts empty, and the file is created by the first Load.
+func NewFetcher(path string) (*Fetcher, error) {
+	s, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Fetcher{path: path, store: s, closed: make(chan struct{})}, nil
+}
+
+// Fetcher fetches stored data from a single file on the local disk. It implements stored_requests.AllFetcher.
+type Fetcher struct {
+	path string
+	// loadLock makes sure that only one Load writes to the file at a time. It also guards loadEvents.
+	loadLock   sync.Mutex
+	loadEvents []*loadEvents
+	lock       sync.RWMutex
+	store      *store
+	// closed stops Loads from waiting on the listeners for their events once the Fetcher is closed.
+	closed chan struct{}
+}
+
+func (fetcher *Fetcher) FetchRequests(ctx context.Context, requestIDs []string, impIDs []string) (map[string]json.RawMessage, map[string]json.RawMessage, []error) {
+	fetcher.lock.RLock()
+	defer fetcher.lock.RUnlock()
+
+	storedRequests, errs := fetcher.fetchAll(requestPrefix, "Request", requestIDs, nil)
+	storedImps, errs := fetcher.fetchAll(impPrefix, "Imp", impIDs, errs)
+	return storedRequests, storedImps, errs
+}
+
+func (fetcher *Fetcher) FetchCategories(ctx context.Context, primaryAdServer, publisherId, iabCategory string) (string, error) {
+	fetcher.lock.RLock()
+	defer fetcher.lock.RUnlock()
+
+	category, ok, err := fetcher.store.get(categoryKey(primaryAdServer, publisherId, iabCategory))
+	if err != nil {
+		return "", err
+	}
+	if !ok || len(category) == 0 {
+		return "", fmt.Errorf("Unable to find category for adserver '%s', publisherId: '%s', iab category: '%s'", primaryAdServer, publisherId, iabCategory)
+	}
+	return string(category), nil
+}
+
+func (fetcher *Fetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	fetcher.lock.RLock()
+	defer fetcher.lock.RUnlock()
+
+	accounts, errs := fetcher.fetchAll(accountPrefix, "Account", []string{accountID}, nil)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return accounts[accountID], nil
+}
+
+func (fetcher *Fetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	fetcher.lock.RLock()
+	defer fetcher.lock.RUnlock()
+
+	return fetcher.fetchAll(responsePrefix, "Response", ids, nil)
+}
+
+// fetchAll must be called with the read lock held.
+func (fetcher *Fetcher) fetchAll(prefix string, dataType string, ids []string, errs []error) (map[string]json.RawMessage, []error) {
+	data := make(map[string]json.RawMessage, len(ids))
+	for _, id := range ids {
+		value, ok, err := fetcher.store.get(prefix + id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to read stored %s %s: %v", dataType, id, err))
+		} else if !ok {
+			errs = append(errs, stored_requests.NotFoundError{
+				ID:       id,
+				DataType: dataType,
+			})
+		} else {
+			data[id] = value
+		}
+	}
+	return data, errs
+}
+
+// Load writes the data to the file. If replace is true, the data replaces everything in the file.
+// Otherwise it's added to the file, replacing any values which have the same IDs.
+//
+// Fetches keep reading the old data until the load is complete, so they never see a partial load.
+// Once it is, the IDs which it changed are sent to the LoadEvents listeners, so that the caches drop them.
+func (fetcher *Fetcher) Load(data Data, replace bool) error {
+	invalidation, listeners, err := fetcher.load(data, replace)
+	if err != nil {
+		return err
+	}
+	if len(invalidation.Requests) == 0 && len(invalidation.Imps) == 0 {
+		return nil
+	}
+	for _, listener := range listeners {
+		select {
+		case listener.invalidations <- invalidation:
+		case <-fetcher.closed:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (fetcher *Fetcher) load(data Data, replace bool) (events.Invalidation, []*loadEvents, error) {
+	fetcher.loadLock.Lock()
+	defer fetcher.loadLock.Unlock()
+
+	// Only Load changes the store, so it can be read without the lock here.
+	oldStore := fetcher.store
+	fill := func(w *segmentWriter) error {
+		return putData(w, data)
+	}
+	var newStore *store
+	var err error
+	if replace || oldStore.file == nil {
+		newStore, err = writeStore(fetcher.path, fill)
+	} else {
+		newStore, err = oldStore.append(fetcher.path, fill)
+		if err == nil && newStore.needsCompaction() {
+			if compacted, compactErr := writeStore(fetcher.path, newStore.copyTo); compactErr != nil {
+				glog.Warningf("Failed to compact the stored data in %s: %v", fetcher.path, compactErr)
+			} else {
+				newStore.close()
+				newStore = compacted
+			}
+		}
+	}
+	if err != nil {
+		return events.Invalidation{}, nil, err
+	}
+
+	fetcher.lock.Lock()
+	fetcher.store = newStore
+	fetcher.lock.Unlock()
+
+	invalidation := loadInvalidation(data)
+	if replace {
+		for key := range oldStore.entries {
+			addInvalidation(&invalidation, key)
+		}
+	}
+	if err := oldStore.close(); err != nil {
+		glog.Errorf("Failed to close the old stored data in %s: %v", fetcher.path, err)
+	}
+	return invalidation, fetcher.loadEvents, nil
+}
+
+func putData(w *segmentWriter, data Data) error {
+	if err := putAll(w, requestPrefix, data.Requests); err != nil {
+		return err
+	}
+	if err := putAll(w, impPrefix, data.Imps); err != nil {
+		return err
+	}
+	if err := putAll(w, accountPrefix, data.Accounts); err != nil {
+		return err
+	}
+	if err := putAll(w, responsePrefix, data.Responses); err != nil {
+		return err
+	}
+	for primaryAdServer, publishers := range data.Categories {
+		for publisherId, categories := range publishers {
+			for iabCategory, category := range categories {
+				if err := w.put(categoryKey(primaryAdServer, publisherId, iabCategory), []byte(category.Id)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func putAll(w *segmentWriter, prefix string, data map[string]json.RawMessage) error {
+	for id, value := range data {
+		if err := w.put(prefix+id, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadInvalidation returns the IDs which the data changes. Accounts and Stored Responses have caches of their own,
+// which keep them with the Stored Requests, so their IDs go in the Requests too.
+func loadInvalidation(data Data) events.Invalidation {
+	var invalidation events.Invalidation
+	for _, values := range []map[string]json.RawMessage{data.Requests, data.Accounts, data.Responses} {
+		for id := range values {
+			invalidation.Requests = append(invalidation.Requests, id)
+		}
+	}
+	for id := range data.Imps {
+		invalidation.Imps = append(invalidation.Imps, id)
+	}
+	return invalidation
+}
+
+// addInvalidation adds the ID from a store key. Categories aren't cached, so they're skipped.
+func addInvalidation(invalidation *events.Invalidation, key string) {
+	switch {
+	case strings.HasPrefix(key, impPrefix):
+		invalidation.Imps = append(invalidation.Imps, strings.TrimPrefix(key, impPrefix))
+	case strings.HasPrefix(key, requestPrefix):
+		invalidation.Requests = append(invalidation.Requests, strings.TrimPrefix(key, requestPrefix))
+	case strings.HasPrefix(key, accountPrefix):
+		invalidation.Requests = append(invalidation.Requests, strings.TrimPrefix(key, accountPrefix))
+	case strings.HasPrefix(key, responsePrefix):
+		invalidation.Requests = append(invalidation.Requests, strings.TrimPrefix(key, responsePrefix))
+	}
+}
+
+// LoadEvents returns an EventProducer which invalidates the data that each Load changes, so that a cache in front
+// of this Fetcher doesn't keep serving the old values. Loads wait for its events to be received, so it must be
+// listened to until the Fetcher is closed.
+func (fetcher *Fetcher) LoadEvents() events.EventProducer {
+	fetcher.loadLock.Lock()
+	defer fetcher.loadLock.Unlock()
+
+	producer := &loadEvents{invalidations: make(chan events.Invalidation)}
+	fetcher.loadEvents = append(fetcher.loadEvents, producer)
+	return producer
+}
+
+type loadEvents struct {
+	invalidations chan events.Invalidation
+}
+
+// Saves is never sent to, since the caches fill themselves from the Fetcher.
+func (e *loadEvents) Saves() <-chan events.Save {
+	return nil
+}
+
+func (e *loadEvents) Invalidations() <-chan events.Invalidation {
+	return e.invalidations
+}
+
+// NewLoadHandler returns an endpoint which Loads the Data in the request body. The data is added to the file,
+// unless the "replace=true" query param is given. Bodies which are larger than maxBytes are rejected.
+//
+// This endpoint should not be exposed on a public network without authentication, since it allows
+// anyone to change the stored data.
+func (fetcher *Fetcher) NewLoadHandler(maxBytes int64) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.ContentLength > maxBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(fmt.Sprintf("The stored data is larger than the limit of %d bytes.\n", maxBytes)))
+			return
+		}
+
+		// The body is decoded as it's read, so that it isn't held in memory twice.
+		var data Data
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes)).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Invalid stored data: %v\n", err)))
+			return
+		}
+
+		if err := fetcher.Load(data, r.URL.Query().Get("replace") == "true"); err != nil {
+			glog.Errorf("Failed to load stored data into %s: %v", fetcher.path, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Failed to load the stored data.\n"))
+		}
+	}
+}
+
+// Close closes the file. The Fetcher can't be used afterwards.
+func (fetcher *Fetcher) Close() error {
+	fetcher.loadLock.Lock()
+	defer fetcher.loadLock.Unlock()
+	fetcher.lock.Lock()
+	defer fetcher.lock.Unlock()
+	select {
+	case <-fetcher.closed:
+	default:
+		close(fetcher.closed)
+	}
+	return fetcher.store.close()
+}
@@ -0,0 +1,328 @@
+package kv_fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetcherMissingFile(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	storedReqs, storedImps, errs := fetcher.FetchRequests(context.Background(), []string{"1"}, []string{"imp-1"})
+	assert.Empty(t, storedReqs)
+	assert.Empty(t, storedImps)
+	assert.Equal(t, []error{
+		stored_requests.NotFoundError{ID: "1", DataType: "Request"},
+		stored_requests.NotFoundError{ID: "imp-1", DataType: "Imp"},
+	}, errs)
+}
+
+func TestFetcherLoad(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	err := fetcher.Load(Data{
+		Requests:  map[string]json.RawMessage{"1": json.RawMessage(`{"id":"req-1"}`)},
+		Imps:      map[string]json.RawMessage{"1": json.RawMessage(`{"id":"imp-1"}`)},
+		Accounts:  map[string]json.RawMessage{"acct-1": json.RawMessage(`{"disabled":false}`)},
+		Responses: map[string]json.RawMessage{"resp-1": json.RawMessage(`{"seatbid":[]}`)},
+		Categories: map[string]map[string]map[string]stored_requests.Category{
+			"freewheel": {
+				"":      {"IAB1-1": {Id: "Sports"}},
+				"pub-1": {"IAB1-1": {Id: "Pub Sports"}},
+			},
+		},
+	}, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	storedReqs, storedImps, errs := fetcher.FetchRequests(context.Background(), []string{"1", "2"}, []string{"1"})
+	assert.Equal(t, map[string]json.RawMessage{"1": json.RawMessage(`{"id":"req-1"}`)}, storedReqs)
+	assert.Equal(t, map[string]json.RawMessage{"1": json.RawMessage(`{"id":"imp-1"}`)}, storedImps, "Imps shouldn't collide with requests which have the same ID")
+	assert.Equal(t, []error{stored_requests.NotFoundError{ID: "2", DataType: "Request"}}, errs)
+
+	account, errs := fetcher.FetchAccount(context.Background(), "acct-1")
+	assert.Empty(t, errs)
+	assert.JSONEq(t, `{"disabled":false}`, string(account))
+	_, errs = fetcher.FetchAccount(context.Background(), "acct-2")
+	assert.Equal(t, []error{stored_requests.NotFoundError{ID: "acct-2", DataType: "Account"}}, errs)
+
+	responses, errs := fetcher.FetchResponses(context.Background(), []string{"resp-1"})
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]json.RawMessage{"resp-1": json.RawMessage(`{"seatbid":[]}`)}, responses)
+
+	category, err := fetcher.FetchCategories(context.Background(), "freewheel", "", "IAB1-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Sports", category)
+	category, err = fetcher.FetchCategories(context.Background(), "freewheel", "pub-1", "IAB1-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Pub Sports", category)
+	_, err = fetcher.FetchCategories(context.Background(), "freewheel", "", "IAB1-2")
+	assert.EqualError(t, err, "Unable to find category for adserver 'freewheel', publisherId: '', iab category: 'IAB1-2'")
+}
+
+func TestFetcherLoadMergeAndReplace(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{
+		"1": json.RawMessage(`{"version":1}`),
+		"2": json.RawMessage(`{"version":1}`),
+	}}, false))
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{
+		"2": json.RawMessage(`{"version":2}`),
+		"3": json.RawMessage(`{"version":2}`),
+	}}, false))
+	storedReqs, _, errs := fetcher.FetchRequests(context.Background(), []string{"1", "2", "3"}, nil)
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]json.RawMessage{
+		"1": json.RawMessage(`{"version":1}`),
+		"2": json.RawMessage(`{"version":2}`),
+		"3": json.RawMessage(`{"version":2}`),
+	}, storedReqs, "A load should add to the old data, and replace the values with the same IDs")
+
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{
+		"3": json.RawMessage(`{"version":3}`),
+	}}, true))
+	storedReqs, _, errs = fetcher.FetchRequests(context.Background(), []string{"1", "3"}, nil)
+	assert.Equal(t, []error{stored_requests.NotFoundError{ID: "1", DataType: "Request"}}, errs, "A replacing load should remove the old data")
+	assert.Equal(t, map[string]json.RawMessage{"3": json.RawMessage(`{"version":3}`)}, storedReqs)
+}
+
+func TestFetcherReopen(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{"1": json.RawMessage(`{}`)}}, false))
+	assert.NoError(t, fetcher.Close())
+
+	reopened, err := NewFetcher(fetcher.path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer reopened.Close()
+	storedReqs, _, errs := reopened.FetchRequests(context.Background(), []string{"1"}, nil)
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]json.RawMessage{"1": json.RawMessage(`{}`)}, storedReqs, "The data should be kept on disk")
+}
+
+func TestFetcherBadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv_fetcher")
+	if err != nil {
+		t.Fatalf("Failed to make a temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stored.db")
+	if err := ioutil.WriteFile(path, []byte(`{"not":"a store"}`), 0644); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+	_, err = NewFetcher(path)
+	assert.Error(t, err, "Files which aren't stores should be rejected")
+
+	fetcher, err := NewFetcher(path + ".good")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{"1": json.RawMessage(`{}`)}}, false))
+	assert.NoError(t, fetcher.Close())
+	data, _ := ioutil.ReadFile(path + ".good")
+	data[len(data)-1]++
+	data[len(storeMagic)+segmentHeaderSize+3]++
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+	_, err = NewFetcher(path)
+	assert.Error(t, err, "Stores with malformed records should be rejected")
+}
+
+func TestFetcherLoadAppends(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{"1": json.RawMessage(`{"version":1}`)}}, false))
+	before, _ := ioutil.ReadFile(fetcher.path)
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{"2": json.RawMessage(`{"version":2}`)}}, false))
+	after, _ := ioutil.ReadFile(fetcher.path)
+	assert.Equal(t, before, after[:len(before)], "The second load should be appended to the file")
+
+	// A crash in the middle of a load leaves a segment without a header. It should be ignored, and the next load
+	// should write over it.
+	if err := ioutil.WriteFile(fetcher.path, append(after, make([]byte, segmentHeaderSize+10)...), 0644); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+	assert.NoError(t, fetcher.Close())
+	reopened, err := NewFetcher(fetcher.path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer reopened.Close()
+	storedReqs, _, errs := reopened.FetchRequests(context.Background(), []string{"1", "2"}, nil)
+	assert.Empty(t, errs)
+	assert.Len(t, storedReqs, 2)
+
+	assert.NoError(t, reopened.Load(Data{Requests: map[string]json.RawMessage{"3": json.RawMessage(`{"version":3}`)}}, false))
+	storedReqs, _, errs = reopened.FetchRequests(context.Background(), []string{"1", "2", "3"}, nil)
+	assert.Empty(t, errs)
+	assert.Len(t, storedReqs, 3)
+	assert.Equal(t, reopened.store.end, fileSize(t, reopened.path), "The unfinished segment should have been dropped")
+}
+
+func TestFetcherLoadCompacts(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+
+	var sizes []int64
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{
+			"1": json.RawMessage(fmt.Sprintf(`{"version":%d}`, i)),
+		}}, false))
+		sizes = append(sizes, fileSize(t, fetcher.path))
+	}
+	assert.True(t, sizes[3] > sizes[0], "The file should grow while most of it is current")
+	assert.Equal(t, sizes[0], sizes[4], "The replaced records should be dropped once they're most of the file")
+	assert.Equal(t, int64(0), fetcher.store.garbage)
+
+	storedReqs, _, errs := fetcher.FetchRequests(context.Background(), []string{"1"}, nil)
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]json.RawMessage{"1": json.RawMessage(`{"version":4}`)}, storedReqs)
+}
+
+func TestFetcherLoadEvents(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+	producer := fetcher.LoadEvents()
+
+	loaded := make(chan error)
+	go func() {
+		loaded <- fetcher.Load(Data{
+			Requests:   map[string]json.RawMessage{"req-1": json.RawMessage(`{}`)},
+			Imps:       map[string]json.RawMessage{"imp-1": json.RawMessage(`{}`)},
+			Accounts:   map[string]json.RawMessage{"acct-1": json.RawMessage(`{}`)},
+			Categories: map[string]map[string]map[string]stored_requests.Category{"freewheel": {"": {"IAB1-1": {Id: "Sports"}}}},
+		}, false)
+	}()
+	invalidation := <-producer.Invalidations()
+	assert.NoError(t, <-loaded)
+	assert.ElementsMatch(t, []string{"req-1", "acct-1"}, invalidation.Requests)
+	assert.Equal(t, []string{"imp-1"}, invalidation.Imps)
+
+	go func() {
+		loaded <- fetcher.Load(Data{Responses: map[string]json.RawMessage{"resp-1": json.RawMessage(`{}`)}}, true)
+	}()
+	invalidation = <-producer.Invalidations()
+	assert.NoError(t, <-loaded)
+	assert.ElementsMatch(t, []string{"resp-1", "req-1", "acct-1"}, invalidation.Requests, "A replacing load should invalidate the old data too")
+	assert.Equal(t, []string{"imp-1"}, invalidation.Imps)
+
+	fetcher.Close()
+	assert.NoError(t, fetcher.Load(Data{Requests: map[string]json.RawMessage{"req-2": json.RawMessage(`{}`)}}, false), "Loads shouldn't wait on the listeners once the Fetcher is closed")
+}
+
+func TestHandleLoad(t *testing.T) {
+	fetcher, done := newTestFetcher(t)
+	defer done()
+	handle := fetcher.NewLoadHandler(200)
+
+	testCases := []struct {
+		description    string
+		url            string
+		body           string
+		expectedStatus int
+		expectedReqs   map[string]json.RawMessage
+		expectedErrs   int
+	}{
+		{
+			description:    "Invalid JSON",
+			url:            "/load",
+			body:           `{"requests":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedErrs:   2,
+		},
+		{
+			description:    "Load",
+			url:            "/load",
+			body:           `{"requests":{"1":{"id":"req-1"}},"categories":{"freewheel":{"":{"IAB1-1":{"id":"Sports","name":"Sports"}}}}}`,
+			expectedStatus: http.StatusOK,
+			expectedReqs:   map[string]json.RawMessage{"1": json.RawMessage(`{"id":"req-1"}`)},
+			expectedErrs:   1,
+		},
+		{
+			description:    "Replace",
+			url:            "/load?replace=true",
+			body:           `{"requests":{"2":{"id":"req-2"}}}`,
+			expectedStatus: http.StatusOK,
+			expectedReqs:   map[string]json.RawMessage{"2": json.RawMessage(`{"id":"req-2"}`)},
+			expectedErrs:   1,
+		},
+	}
+
+	for _, test := range testCases {
+		recorder := httptest.NewRecorder()
+		handle(recorder, httptest.NewRequest("POST", test.url, bytes.NewBufferString(test.body)), nil)
+		assert.Equal(t, test.expectedStatus, recorder.Code, test.description)
+
+		storedReqs, _, errs := fetcher.FetchRequests(context.Background(), []string{"1", "2"}, nil)
+		assert.Len(t, errs, test.expectedErrs, test.description)
+		if test.expectedReqs != nil {
+			assert.Equal(t, test.expectedReqs, storedReqs, test.description)
+		}
+	}
+
+	_, err := fetcher.FetchCategories(context.Background(), "freewheel", "", "IAB1-1")
+	assert.Error(t, err, "The categories should have been replaced")
+
+	tooLarge := `{"requests":{"3":{"id":"` + strings.Repeat("a", 200) + `"}}}`
+	recorder := httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest("POST", "/load", strings.NewReader(tooLarge)), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code, "Bodies over the limit should be rejected")
+
+	request := httptest.NewRequest("POST", "/load", strings.NewReader(tooLarge))
+	request.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	handle(recorder, request, nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "Bodies without a length should stop being read at the limit")
+
+	_, _, errs := fetcher.FetchRequests(context.Background(), []string{"3"}, nil)
+	assert.Len(t, errs, 1, "Bodies over the limit shouldn't be loaded")
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.Size()
+}
+
+func newTestFetcher(t *testing.T) (*Fetcher, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kv_fetcher")
+	if err != nil {
+		t.Fatalf("Failed to make a temp directory: %v", err)
+	}
+	fetcher, err := NewFetcher(filepath.Join(dir, "stored.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Failed to create a Fetcher: %v", err)
+	}
+	return fetcher, func() {
+		fetcher.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,346 @@
+package kv_fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// The store is a single file which starts with the 8 byte storeMagic, followed by segments of key/value records:
+//
+//	segment header: [uint64 number of records][uint64 size of the records in bytes]
+//	records:        [uint32 key length][uint32 value length][key][value], repeated
+//
+// The keys are indexed in memory when the file is opened. The values stay on disk until they're read,
+// so the file can hold much more data than the server would want to keep in RAM.
+//
+// Each load appends a segment, and its records replace the ones in earlier segments which have the same keys.
+// The segment header is written after the records have been synced, so a segment which was cut off by a crash
+// still has an empty header, and it's ignored. Once most of the file is replaced records, the store is compacted
+// into a temporary file, which replaces the old one.
+var storeMagic = []byte("PBSKV\x00\x00\x02")
+
+const (
+	segmentHeaderSize = 16
+	recordHeaderSize  = 8
+)
+
+// entry locates a value in the store file.
+type entry struct {
+	offset int64
+	size   uint32
+}
+
+// store is a read-only view of a store file. It's safe for concurrent use.
+type store struct {
+	file    *os.File
+	entries map[string]entry
+	// end is where the next segment goes. Anything after it is a segment which was never finished.
+	end int64
+	// garbage is the number of bytes in records which later segments replaced.
+	garbage int64
+}
+
+// openStore indexes the store file at path. If the file doesn't exist, the store is empty.
+func openStore(path string) (*store, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &store{entries: make(map[string]entry)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &store{file: file, entries: make(map[string]entry)}
+	if err := s.readIndex(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Failed to read the stored data in %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *store) readIndex() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+	if fileSize < int64(len(storeMagic)) {
+		return errors.New("the file is too short")
+	}
+	header := make([]byte, len(storeMagic))
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if !bytes.Equal(header, storeMagic) {
+		return errors.New("the file isn't a stored data file")
+	}
+
+	s.end = int64(len(storeMagic))
+	segmentHeader := make([]byte, segmentHeaderSize)
+	for s.end+segmentHeaderSize <= fileSize {
+		if _, err := s.file.ReadAt(segmentHeader, s.end); err != nil {
+			return err
+		}
+		count := binary.BigEndian.Uint64(segmentHeader[:8])
+		size := binary.BigEndian.Uint64(segmentHeader[8:])
+		if count == 0 || size > uint64(fileSize-s.end-segmentHeaderSize) {
+			// The rest of the file is a segment which was never finished.
+			break
+		}
+		if err := s.readSegment(s.end+segmentHeaderSize, count, int64(size)); err != nil {
+			return fmt.Errorf("the segment at byte %d is malformed: %v", s.end, err)
+		}
+		s.end += segmentHeaderSize + int64(size)
+	}
+	return nil
+}
+
+func (s *store) readSegment(start int64, count uint64, size int64) error {
+	reader := bufio.NewReader(io.NewSectionReader(s.file, start, size))
+	offset := start
+	recordHeader := make([]byte, recordHeaderSize)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(reader, recordHeader); err != nil {
+			return fmt.Errorf("record %d is malformed: %v", i, err)
+		}
+		keySize := binary.BigEndian.Uint32(recordHeader[:4])
+		valueSize := binary.BigEndian.Uint32(recordHeader[4:])
+		key := make([]byte, keySize)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return fmt.Errorf("record %d is malformed: %v", i, err)
+		}
+		if _, err := reader.Discard(int(valueSize)); err != nil {
+			return fmt.Errorf("record %d is malformed: %v", i, err)
+		}
+		s.put(string(key), entry{
+			offset: offset + recordHeaderSize + int64(keySize),
+			size:   valueSize,
+		})
+		offset += recordHeaderSize + int64(keySize) + int64(valueSize)
+	}
+	if offset != start+size {
+		return fmt.Errorf("it has %d records, but they end at byte %d instead of %d", count, offset, start+size)
+	}
+	return nil
+}
+
+// put indexes a record, and counts the one it replaces as garbage.
+func (s *store) put(key string, location entry) {
+	if old, ok := s.entries[key]; ok {
+		s.garbage += recordHeaderSize + int64(len(key)) + int64(old.size)
+	}
+	s.entries[key] = location
+}
+
+// get returns false if the store doesn't have the key.
+func (s *store) get(key string) ([]byte, bool, error) {
+	location, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	value := make([]byte, location.size)
+	if _, err := s.file.ReadAt(value, location.offset); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// needsCompaction is true once most of the file is replaced records.
+func (s *store) needsCompaction() bool {
+	return s.garbage > s.end/2
+}
+
+// copyTo writes all of the store's current records.
+func (s *store) copyTo(w *segmentWriter) error {
+	for key := range s.entries {
+		value, _, err := s.get(key)
+		if err != nil {
+			return err
+		}
+		if err := w.put(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// writeStore replaces the store file at path with the records which fill writes, and opens it. The new file is
+// only moved into place once it's complete, so readers of the old file never see a partial write.
+func writeStore(path string, fill func(w *segmentWriter) error) (*store, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(storeMagic)
+	if err == nil {
+		err = writeSegment(tmp, int64(len(storeMagic)), fill)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openStore(path)
+}
+
+// append adds a segment with the records which fill writes to the end of the store file at path, and returns
+// a store which includes them. This store can still be used until it's closed, since it doesn't index anything
+// past its end.
+func (s *store) append(path string, fill func(w *segmentWriter) error) (*store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Drop any segment which an earlier append didn't finish.
+	err = file.Truncate(s.end)
+	var w *segmentWriter
+	if err == nil {
+		w, err = newSegmentWriter(file, s.end)
+	}
+	if err == nil {
+		err = fill(w)
+	}
+	if err == nil {
+		err = w.finish()
+	}
+	if err != nil {
+		file.Truncate(s.end)
+		file.Close()
+		return nil, err
+	}
+
+	appended := &store{
+		file:    file,
+		entries: make(map[string]entry, len(s.entries)+len(w.entries)),
+		end:     w.end(),
+		garbage: s.garbage,
+	}
+	for key, location := range s.entries {
+		appended.entries[key] = location
+	}
+	for key, location := range w.entries {
+		appended.put(key, location)
+	}
+	return appended, nil
+}
+
+func writeSegment(file *os.File, start int64, fill func(w *segmentWriter) error) error {
+	w, err := newSegmentWriter(file, start)
+	if err != nil {
+		return err
+	}
+	if err := fill(w); err != nil {
+		return err
+	}
+	return w.finish()
+}
+
+// segmentWriter writes a new segment at the end of a store file.
+type segmentWriter struct {
+	file  *os.File
+	start int64
+	// size is the number of bytes in the records which were written so far.
+	size    int64
+	out     *bufio.Writer
+	entries map[string]entry
+}
+
+// newSegmentWriter leaves room for the segment header at start. It's filled in by finish.
+func newSegmentWriter(file *os.File, start int64) (*segmentWriter, error) {
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w := &segmentWriter{
+		file:    file,
+		start:   start,
+		out:     bufio.NewWriter(file),
+		entries: make(map[string]entry),
+	}
+	if err := w.write(make([]byte, segmentHeaderSize)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// put adds a record. Keys which were already written are ignored, so the first value for a key wins.
+func (w *segmentWriter) put(key string, value []byte) error {
+	if _, ok := w.entries[key]; ok {
+		return nil
+	}
+	if uint64(len(key)) > math.MaxUint32 || uint64(len(value)) > math.MaxUint32 {
+		return fmt.Errorf("the record for key %q is too large", key)
+	}
+
+	recordHeader := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(recordHeader[:4], uint32(len(key)))
+	binary.BigEndian.PutUint32(recordHeader[4:], uint32(len(value)))
+	if err := w.write(recordHeader); err != nil {
+		return err
+	}
+	if err := w.write([]byte(key)); err != nil {
+		return err
+	}
+	if err := w.write(value); err != nil {
+		return err
+	}
+	w.entries[key] = entry{
+		offset: w.start + segmentHeaderSize + w.size + recordHeaderSize + int64(len(key)),
+		size:   uint32(len(value)),
+	}
+	w.size += recordHeaderSize + int64(len(key)) + int64(len(value))
+	return nil
+}
+
+// end is where the segment ends, once it's finished.
+func (w *segmentWriter) end() int64 {
+	if len(w.entries) == 0 {
+		return w.start
+	}
+	return w.start + segmentHeaderSize + w.size
+}
+
+// finish syncs the records, and then writes the segment header which makes them part of the store.
+// Empty segments are dropped, since their header would look like an unfinished segment.
+func (w *segmentWriter) finish() error {
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+	if len(w.entries) == 0 {
+		return w.file.Truncate(w.start)
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	segmentHeader := make([]byte, segmentHeaderSize)
+	binary.BigEndian.PutUint64(segmentHeader[:8], uint64(len(w.entries)))
+	binary.BigEndian.PutUint64(segmentHeader[8:], uint64(w.size))
+	if _, err := w.file.WriteAt(segmentHeader, w.start); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *segmentWriter) write(data []byte) error {
+	_, err := w.out.Write(data)
+	return err
+}
@@ -0,0 +1,174 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/stored_requests"
+)
+
+// NewCache returns a Cache which stores data in Redis, so that it can be shared by every PBS instance.
+//
+// It's meant to sit behind an in-memory cache in a stored_requests.ComposedCache. Redis errors are logged
+// and treated as cache misses, so the Fetcher will still be used if Redis is down. To keep an outage from
+// flooding the logs, at most one error is logged every errorLogInterval.
+func NewCache(cfg *config.RedisCache) *Cache {
+	glog.Infof("Using a Stored Request Redis cache. Address: %s. DB: %d. Key prefix: %s. TTL: %d seconds.", cfg.Address, cfg.DB, cfg.KeyPrefix, cfg.TTL)
+	return &Cache{
+		client:     newClient(cfg.Address, cfg.Password, cfg.DB, time.Duration(cfg.TimeoutMS)*time.Millisecond, cfg.PoolSize),
+		keyPrefix:  cfg.KeyPrefix,
+		ttlSeconds: cfg.TTL,
+		errors:     newErrorLog(errorLogInterval),
+	}
+}
+
+// Cache is a stored_requests.Cache backed by Redis.
+type Cache struct {
+	client     *client
+	keyPrefix  string
+	ttlSeconds int
+	errors     *errorLog
+}
+
+func (c *Cache) Get(ctx context.Context, requestIDs []string, impIDs []string) (requestData map[string]json.RawMessage, impData map[string]json.RawMessage) {
+	requestData = make(map[string]json.RawMessage, len(requestIDs))
+	impData = make(map[string]json.RawMessage, len(impIDs))
+	if len(requestIDs) == 0 && len(impIDs) == 0 {
+		return
+	}
+
+	keys := append(c.keys("request", requestIDs), c.keys("imp", impIDs)...)
+	replies, err := c.client.do(ctx, append(command{"MGET"}, keys...))
+	if err != nil {
+		c.errors.errorf("Failed to get Stored Requests from Redis: %v", err)
+		return
+	}
+	values, ok := replies[0].([]interface{})
+	if !ok || len(values) != len(keys) {
+		c.errors.errorf("Unexpected reply to a Redis MGET: %v", replies[0])
+		return
+	}
+
+	fillData(requestData, requestIDs, values[:len(requestIDs)])
+	fillData(impData, impIDs, values[len(requestIDs):])
+	return
+}
+
+func fillData(data map[string]json.RawMessage, ids []string, values []interface{}) {
+	for i, id := range ids {
+		if value, ok := values[i].([]byte); ok {
+			data[id] = value
+		}
+	}
+}
+
+func (c *Cache) Save(ctx context.Context, storedRequests map[string]json.RawMessage, storedImps map[string]json.RawMessage) {
+	commands := make([]command, 0, len(storedRequests)+len(storedImps))
+	commands = c.appendSets(commands, "request", storedRequests)
+	commands = c.appendSets(commands, "imp", storedImps)
+	if len(commands) == 0 {
+		return
+	}
+
+	replies, err := c.client.do(ctx, commands...)
+	if err == nil {
+		err = firstError(replies)
+	}
+	if err != nil {
+		c.errors.errorf("Failed to save Stored Requests to Redis: %v", err)
+	}
+}
+
+func (c *Cache) appendSets(commands []command, dataType string, values map[string]json.RawMessage) []command {
+	for id, data := range values {
+		cmd := command{"SET", c.key(dataType, id), string(data)}
+		if c.ttlSeconds > 0 {
+			cmd = append(cmd, "EX", strconv.Itoa(c.ttlSeconds))
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func (c *Cache) Invalidate(ctx context.Context, requestIDs []string, impIDs []string) {
+	keys := append(c.keys("request", requestIDs), c.keys("imp", impIDs)...)
+	if len(keys) == 0 {
+		return
+	}
+
+	replies, err := c.client.do(ctx, append(command{"DEL"}, keys...))
+	if err == nil {
+		err = firstError(replies)
+	}
+	if err != nil {
+		c.errors.errorf("Failed to invalidate Stored Requests in Redis: %v", err)
+	}
+}
+
+// Close closes the idle Redis connections.
+func (c *Cache) Close() {
+	c.client.close()
+}
+
+func (c *Cache) key(dataType string, id string) string {
+	return c.keyPrefix + dataType + ":" + id
+}
+
+func (c *Cache) keys(dataType string, ids []string) []string {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, c.key(dataType, id))
+	}
+	return keys
+}
+
+// errorLogInterval is the minimum time between two logged Redis errors.
+const errorLogInterval = time.Minute
+
+// errorLog logs errors, but skips the ones which come less than interval after the last logged error.
+// The next logged error says how many were skipped.
+type errorLog struct {
+	interval time.Duration
+	now      func() time.Time
+	logf     func(format string, args ...interface{})
+
+	mutex   sync.Mutex
+	last    time.Time
+	skipped int
+}
+
+func newErrorLog(interval time.Duration) *errorLog {
+	return &errorLog{
+		interval: interval,
+		now:      time.Now,
+		logf:     glog.Errorf,
+	}
+}
+
+func (l *errorLog) errorf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	now := l.now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval {
+		l.skipped++
+		l.mutex.Unlock()
+		return
+	}
+	skipped := l.skipped
+	l.last = now
+	l.skipped = 0
+	l.mutex.Unlock()
+
+	if skipped > 0 {
+		l.logf("%s (%d more Redis errors weren't logged)", fmt.Sprintf(format, args...), skipped)
+	} else {
+		l.logf(format, args...)
+	}
+}
+
+var _ stored_requests.Cache = (*Cache)(nil)
@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prebid/prebid-server/config"
+	"github.com/prebid/prebid-server/stored_requests"
+	"github.com/prebid/prebid-server/stored_requests/caches/cachestest"
+	"github.com/prebid/prebid-server/stored_requests/caches/redis/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRobustness(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+
+	// Each cache gets its own key prefix, so the tests don't see each other's data.
+	caches := 0
+	cachestest.AssertCacheRobustness(t, func() stored_requests.Cache {
+		caches++
+		return NewCache(newConfig(server, "test"+strconv.Itoa(caches)+":"))
+	})
+}
+
+func TestKeys(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+	cache := NewCache(newConfig(server, "pbs:"))
+
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{"req":1}`)}, map[string]json.RawMessage{"1": json.RawMessage(`{"imp":1}`)})
+
+	value, ok := server.Get(0, "pbs:request:1")
+	assert.True(t, ok)
+	assert.Equal(t, `{"req":1}`, value)
+	value, ok = server.Get(0, "pbs:imp:1")
+	assert.True(t, ok)
+	assert.Equal(t, `{"imp":1}`, value)
+	assert.Equal(t, time.Duration(0), server.TTL(0, "pbs:request:1"), "Keys shouldn't expire without a TTL")
+}
+
+func TestTTL(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+	cfg := newConfig(server, "")
+	cfg.TTL = 60
+	cache := NewCache(cfg)
+
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{}`)}, nil)
+
+	ttl := server.TTL(0, "request:1")
+	assert.True(t, ttl > 59*time.Second && ttl <= 60*time.Second, "Expected a TTL of 60s. Got %v", ttl)
+}
+
+func TestAuthAndSelect(t *testing.T) {
+	server := redistest.NewServer("secret")
+	defer server.Close()
+	cfg := newConfig(server, "")
+	cfg.Password = "secret"
+	cfg.DB = 3
+	cache := NewCache(cfg)
+
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{}`)}, nil)
+	requests, _ := cache.Get(context.Background(), []string{"1"}, nil)
+
+	assert.Len(t, requests, 1)
+	_, ok := server.Get(3, "request:1")
+	assert.True(t, ok, "Data should be saved in the configured DB")
+	assert.Equal(t, []string{"AUTH", "SELECT", "SET", "MGET"}, server.Commands(), "Connections should be authenticated once, then reused")
+}
+
+func TestWrongPassword(t *testing.T) {
+	server := redistest.NewServer("secret")
+	defer server.Close()
+	cfg := newConfig(server, "")
+	cfg.Password = "wrong"
+	cache := NewCache(cfg)
+
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{}`)}, nil)
+	requests, imps := cache.Get(context.Background(), []string{"1"}, []string{"2"})
+
+	assert.Empty(t, requests)
+	assert.Empty(t, imps)
+	assert.Equal(t, []string{"AUTH", "AUTH"}, server.Commands(), "Nothing should be sent on connections which failed to authenticate")
+}
+
+func TestServerDown(t *testing.T) {
+	server := redistest.NewServer("")
+	cache := NewCache(newConfig(server, ""))
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{}`)}, nil)
+	cache.Close()
+	server.Close()
+
+	requests, imps := cache.Get(context.Background(), []string{"1"}, nil)
+
+	assert.NotNil(t, requests, "Redis errors should look like cache misses")
+	assert.Empty(t, requests)
+	assert.NotNil(t, imps)
+	cache.Invalidate(context.Background(), []string{"1"}, nil)
+}
+
+func TestErrorLogSkipsErrorsWithinInterval(t *testing.T) {
+	now := time.Now()
+	var logged []string
+	errors := newErrorLog(time.Minute)
+	errors.now = func() time.Time { return now }
+	errors.logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+
+	errors.errorf("error %d", 1)
+	now = now.Add(30 * time.Second)
+	errors.errorf("error %d", 2)
+	errors.errorf("error %d", 3)
+	now = now.Add(31 * time.Second)
+	errors.errorf("error %d", 4)
+	now = now.Add(time.Minute)
+	errors.errorf("error %d", 5)
+
+	assert.Equal(t, []string{"error 1", "error 4 (2 more Redis errors weren't logged)", "error 5"}, logged)
+}
+
+func TestTimeoutWithLongerContextDeadline(t *testing.T) {
+	// This server accepts connections, but never replies.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	cache := NewCache(&config.RedisCache{
+		Enabled:   true,
+		Address:   listener.Addr().String(),
+		TimeoutMS: 50,
+		PoolSize:  1,
+	})
+	defer cache.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	requests, _ := cache.Get(ctx, []string{"1"}, nil)
+
+	assert.Empty(t, requests)
+	assert.True(t, time.Since(start) < 5*time.Second, "The timeout should apply when the context deadline is later")
+}
+
+func TestInvalidateDeletesKeys(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+	cache := NewCache(newConfig(server, ""))
+
+	cache.Save(context.Background(), map[string]json.RawMessage{"1": json.RawMessage(`{}`), "2": json.RawMessage(`{}`)}, nil)
+	cache.Invalidate(context.Background(), []string{"1"}, nil)
+
+	_, ok := server.Get(0, "request:1")
+	assert.False(t, ok)
+	_, ok = server.Get(0, "request:2")
+	assert.True(t, ok)
+}
+
+func TestNoOps(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+	cache := NewCache(newConfig(server, ""))
+
+	requests, imps := cache.Get(context.Background(), nil, nil)
+	cache.Save(context.Background(), nil, nil)
+	cache.Invalidate(context.Background(), nil, nil)
+
+	assert.Empty(t, requests)
+	assert.Empty(t, imps)
+	assert.Empty(t, server.Commands(), "Nothing should be sent to Redis if there are no IDs")
+}
+
+func newConfig(server *redistest.Server, keyPrefix string) *config.RedisCache {
+	return &config.RedisCache{
+		Enabled:   true,
+		Address:   server.Addr(),
+		TimeoutMS: 500,
+		PoolSize:  2,
+		KeyPrefix: keyPrefix,
+	}
+}
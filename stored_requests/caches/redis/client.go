@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// client is a minimal Redis client. It speaks just enough of the RESP protocol
+// to send commands and read their replies, and keeps a small pool of idle connections.
+type client struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *conn
+}
+
+func newClient(address string, password string, db int, timeout time.Duration, poolSize int) *client {
+	return &client{
+		address:  address,
+		password: password,
+		db:       db,
+		timeout:  timeout,
+		idle:     make(chan *conn, poolSize),
+	}
+}
+
+// command is a single Redis command, like {"GET", "key"}.
+type command []string
+
+// redisError is an error reply from the server. Unlike network errors, these leave the connection usable.
+type redisError string
+
+func (err redisError) Error() string {
+	return "redis: " + string(err)
+}
+
+// errNilReply is returned for null bulk strings, which Redis uses for missing keys.
+var errNilReply = errors.New("redis: nil reply")
+
+// do pipelines the commands on a single connection, and returns one reply per command.
+// A reply is either a []byte, an int64, a string (for simple strings), a []interface{} or an error.
+func (c *client) do(ctx context.Context, commands ...command) ([]interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	cn.setDeadline(ctx, c.timeout)
+
+	replies, err := cn.pipeline(commands)
+	if err != nil {
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+func (c *client) get() (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+		return c.dial()
+	}
+}
+
+func (c *client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (c *client) dial() (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+
+	var setup []command
+	if c.password != "" {
+		setup = append(setup, command{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, command{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		cn.SetDeadline(time.Now().Add(c.timeout))
+		replies, err := cn.pipeline(setup)
+		if err == nil {
+			err = firstError(replies)
+		}
+		if err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// close closes all the idle connections.
+func (c *client) close() {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return
+		}
+	}
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// setDeadline uses the timeout, or the context deadline if it comes sooner.
+func (cn *conn) setDeadline(ctx context.Context, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	cn.SetDeadline(deadline)
+}
+
+func (cn *conn) pipeline(commands []command) ([]interface{}, error) {
+	for _, cmd := range commands {
+		writeCommand(cn.writer, cmd)
+	}
+	if err := cn.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	for i := range commands {
+		reply, err := readReply(cn.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// writeCommand writes the command as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, cmd command) {
+	fmt.Fprintf(w, "*%d\r\n", len(cmd))
+	for _, arg := range cmd {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply reads a single RESP reply. Error replies are returned as a redisError value rather than an error,
+// since they don't break the connection.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return errNilReply, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return errNilReply, nil
+		}
+		elements := make([]interface{}, size)
+		for i := range elements {
+			if elements[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
+
+// firstError returns the first error reply, if any.
+func firstError(replies []interface{}) error {
+	for _, reply := range replies {
+		if err, ok := reply.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
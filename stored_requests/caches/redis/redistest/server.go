@@ -0,0 +1,275 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-process fake Redis server for tests. It supports the handful of commands
+// which the Stored Request cache needs: PING, AUTH, SELECT, GET, MGET, SET (with EX), DEL and FLUSHDB.
+type Server struct {
+	password string
+	listener net.Listener
+	mutex    sync.Mutex
+	dbs      map[int]map[string]entry
+	commands []string
+	open     int
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// NewServer starts a Server on a random local port. Call Close() when the test is done.
+//
+// If the password isn't empty, clients must send it with AUTH before any other command is accepted.
+func NewServer(password string) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen: %v", err))
+	}
+	s := &Server{
+		password: password,
+		listener: listener,
+		dbs:      make(map[int]map[string]entry),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the host:port which the Server is listening on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the Server and waits for it to shut down. Open connections are left for the client to close.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// Get returns the value of a key in the given DB, ignoring expiry.
+func (s *Server) Get(db int, key string) (value string, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.dbs[db][key]
+	return e.value, ok
+}
+
+// TTL returns the time left before the key expires, or 0 if it has no expiry.
+func (s *Server) TTL(db int, key string) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e := s.dbs[db][key]
+	if e.expires.IsZero() {
+		return 0
+	}
+	return time.Until(e.expires)
+}
+
+// Commands returns the names of all the commands which the Server has received, in order.
+func (s *Server) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// OpenConnections returns the number of client connections which haven't been closed yet.
+func (s *Server) OpenConnections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.open
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	s.mutex.Lock()
+	s.open++
+	s.mutex.Unlock()
+	defer func() {
+		conn.Close()
+		s.mutex.Lock()
+		s.open--
+		s.mutex.Unlock()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	session := &session{authed: s.password == ""}
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.execute(session, args, writer)
+		// Only flush once the pipeline has been drained, like a real server would.
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type session struct {
+	authed bool
+	db     int
+}
+
+func (s *Server) execute(sess *session, args []string, w *bufio.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := strings.ToUpper(args[0])
+	s.commands = append(s.commands, name)
+
+	if name == "AUTH" {
+		if len(args) == 2 && args[1] == s.password {
+			sess.authed = true
+			writeSimple(w, "OK")
+		} else {
+			writeError(w, "WRONGPASS invalid password")
+		}
+		return
+	}
+	if !sess.authed {
+		writeError(w, "NOAUTH Authentication required.")
+		return
+	}
+
+	db := s.dbs[sess.db]
+	if db == nil {
+		db = make(map[string]entry)
+		s.dbs[sess.db] = db
+	}
+
+	switch name {
+	case "PING":
+		writeSimple(w, "PONG")
+	case "SELECT":
+		index, err := strconv.Atoi(args[1])
+		if err != nil {
+			writeError(w, "ERR invalid DB index")
+			return
+		}
+		sess.db = index
+		writeSimple(w, "OK")
+	case "GET":
+		writeValue(w, db, args[1])
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, key := range args[1:] {
+			writeValue(w, db, key)
+		}
+	case "SET":
+		e := entry{value: args[2]}
+		if len(args) == 5 && strings.ToUpper(args[3]) == "EX" {
+			seconds, err := strconv.Atoi(args[4])
+			if err != nil || seconds <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			e.expires = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		db[args[1]] = e
+		writeSimple(w, "OK")
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := db[key]; ok {
+				delete(db, key)
+				deleted++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case "FLUSHDB":
+		s.dbs[sess.db] = make(map[string]entry)
+		writeSimple(w, "OK")
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+func writeValue(w *bufio.Writer, db map[string]entry, key string) {
+	e, ok := db[key]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(db, key)
+		ok = false
+	}
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(e.value), e.value)
+}
+
+func writeSimple(w *bufio.Writer, message string) {
+	fmt.Fprintf(w, "+%s\r\n", message)
+}
+
+func writeError(w *bufio.Writer, message string) {
+	fmt.Fprintf(w, "-%s\r\n", message)
+}
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("redistest: expected an array. Got %q", line)
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("redistest: bad array length %q", line)
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("redistest: expected a bulk string. Got %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("redistest: bad bulk string length %q", line)
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -16,8 +16,10 @@ import (
 	"github.com/prebid/prebid-server/stored_requests/backends/empty_fetcher"
 	"github.com/prebid/prebid-server/stored_requests/backends/file_fetcher"
 	"github.com/prebid/prebid-server/stored_requests/backends/http_fetcher"
+	"github.com/prebid/prebid-server/stored_requests/backends/kv_fetcher"
 	"github.com/prebid/prebid-server/stored_requests/caches/memory"
 	"github.com/prebid/prebid-server/stored_requests/caches/nil_cache"
+	"github.com/prebid/prebid-server/stored_requests/caches/redis"
 	"github.com/prebid/prebid-server/stored_requests/events"
 	apiEvents "github.com/prebid/prebid-server/stored_requests/events/api"
 	httpEvents "github.com/prebid/prebid-server/stored_requests/events/http"
@@ -29,6 +31,25 @@ import (
 type dbConnection struct {
 	conn string
 	db   *sql.DB
+	// kvFetchers are shared by file path, so that a load through any of them is seen by all of them.
+	kvFetchers map[string]*kv_fetcher.Fetcher
+}
+
+// kvFetcher returns the fetcher for the file at path, opening it if this is the first use.
+func (dbc *dbConnection) kvFetcher(path string) *kv_fetcher.Fetcher {
+	if fetcher, ok := dbc.kvFetchers[path]; ok {
+		return fetcher
+	}
+	glog.Infof("Loading Stored Requests from the key-value store at %s", path)
+	fetcher, err := kv_fetcher.NewFetcher(path)
+	if err != nil {
+		glog.Fatalf("Failed to create a KV Fetcher: %v", err)
+	}
+	if dbc.kvFetchers == nil {
+		dbc.kvFetchers = make(map[string]*kv_fetcher.Fetcher)
+	}
+	dbc.kvFetchers[path] = fetcher
+	return fetcher
 }
 
 // CreateStoredRequests returns three things:
@@ -63,14 +84,26 @@ func CreateStoredRequests(cfg *config.StoredRequestsSlim, metricsEngine pbsmetri
 		}
 	}
 
+	var kvFetcher *kv_fetcher.Fetcher
+	if cfg.KVStore.Enabled {
+		kvFetcher = dbc.kvFetcher(cfg.KVStore.Path)
+		if cfg.KVStore.LoadEndpoint != "" {
+			router.POST(cfg.KVStore.LoadEndpoint, kvFetcher.NewLoadHandler(cfg.KVStore.MaxLoadBytes))
+		}
+	}
+
 	eventProducers := newEventProducers(cfg, client, dbc.db, router)
-	fetcher = newFetcher(cfg, client, dbc.db)
+	fetcher = newFetcher(cfg, client, dbc.db, kvFetcher)
 
 	var shutdown1 func()
+	var cache stored_requests.Cache
 
 	if cfg.InMemoryCache.Type != "" {
-		cache := newCache(cfg)
+		cache = newCache(cfg)
 		fetcher = stored_requests.WithCache(fetcher, cache, metricsEngine)
+		if kvFetcher != nil {
+			eventProducers = append(eventProducers, kvFetcher.LoadEvents())
+		}
 		shutdown1 = addListeners(cache, eventProducers)
 	}
 
@@ -78,6 +111,7 @@ func CreateStoredRequests(cfg *config.StoredRequestsSlim, metricsEngine pbsmetri
 		if shutdown1 != nil {
 			shutdown1()
 		}
+		closeCache(cache)
 		if dbc.db != nil {
 			db := dbc.db
 			dbc.db = nil
@@ -86,6 +120,12 @@ func CreateStoredRequests(cfg *config.StoredRequestsSlim, metricsEngine pbsmetri
 				glog.Errorf("Error closing DB connection: %v", err)
 			}
 		}
+		for path, kvFetcher := range dbc.kvFetchers {
+			if err := kvFetcher.Close(); err != nil {
+				glog.Errorf("Error closing the key-value store at %s: %v", path, err)
+			}
+		}
+		dbc.kvFetchers = nil
 	}
 
 	return
@@ -99,13 +139,15 @@ func CreateStoredRequests(cfg *config.StoredRequestsSlim, metricsEngine pbsmetri
 // 4. A Fetcher which can be used to get Stored Requests for /openrtb2/amp
 // 5. A Fetcher which can be used to get Category Mapping data
 // 6. A Fetcher which can be used to get Stored Requests for /openrtb2/video
+// 7. A Fetcher which can be used to get publisher Account data
+// 8. A Fetcher which can be used to get Stored Auction Responses and Stored Bid Responses
 //
 // If any errors occur, the program will exit with an error message.
 // It probably means you have a bad config or networking issue.
 //
 // As a side-effect, it will add some endpoints to the router if the config calls for it.
 // In the future we should look for ways to simplify this so that it's not doing two things.
-func NewStoredRequests(cfg *config.Configuration, metricsEngine pbsmetrics.MetricsEngine, client *http.Client, router *httprouter.Router) (db *sql.DB, shutdown func(), fetcher stored_requests.Fetcher, ampFetcher stored_requests.Fetcher, categoriesFetcher stored_requests.CategoryFetcher, videoFetcher stored_requests.Fetcher) {
+func NewStoredRequests(cfg *config.Configuration, metricsEngine pbsmetrics.MetricsEngine, client *http.Client, router *httprouter.Router) (db *sql.DB, shutdown func(), fetcher stored_requests.Fetcher, ampFetcher stored_requests.Fetcher, categoriesFetcher stored_requests.CategoryFetcher, videoFetcher stored_requests.Fetcher, accountsFetcher stored_requests.AccountFetcher, responsesFetcher stored_requests.ResponseFetcher) {
 	// Build individual slim options from combined config struct
 	slimAuction, slimAmp := resolvedStoredRequestsConfig(cfg)
 
@@ -120,6 +162,10 @@ func NewStoredRequests(cfg *config.Configuration, metricsEngine pbsmetrics.Metri
 	fetcher2, shutdown2 := CreateStoredRequests(&slimAmp, metricsEngine, client, router, &dbc)
 	fetcher3, shutdown3 := CreateStoredRequests(&cfg.CategoryMapping, metricsEngine, client, router, &dbc)
 	fetcher4, shutdown4 := CreateStoredRequests(&cfg.StoredVideo, metricsEngine, client, router, &dbc)
+	// Accounts get their own caches, so they never collide with Stored Request IDs.
+	fetcher5, shutdown5 := CreateStoredRequests(&cfg.Accounts, metricsEngine, client, router, &dbc)
+	// Stored Responses do too.
+	fetcher6, shutdown6 := CreateStoredRequests(&cfg.StoredResponses, metricsEngine, client, router, &dbc)
 
 	db = dbc.db
 
@@ -127,12 +173,16 @@ func NewStoredRequests(cfg *config.Configuration, metricsEngine pbsmetrics.Metri
 	ampFetcher = fetcher2.(stored_requests.Fetcher)
 	categoriesFetcher = fetcher3.(stored_requests.CategoryFetcher)
 	videoFetcher = fetcher4.(stored_requests.Fetcher)
+	accountsFetcher = fetcher5.(stored_requests.AccountFetcher)
+	responsesFetcher = fetcher6.(stored_requests.ResponseFetcher)
 
 	shutdown = func() {
 		shutdown1()
 		shutdown2()
 		shutdown3()
 		shutdown4()
+		shutdown5()
+		shutdown6()
 	}
 
 	return
@@ -152,7 +202,9 @@ func resolvedStoredRequestsConfig(cfg *config.Configuration) (auc, amp config.St
 	auc.Postgres.PollUpdates.Timeout = sr.Postgres.PollUpdates.Timeout
 	auc.Postgres.PollUpdates.Query = sr.Postgres.PollUpdates.Query
 	auc.HTTP.Endpoint = sr.HTTP.Endpoint
+	auc.KVStore = sr.KVStore
 	auc.InMemoryCache = sr.InMemoryCache
+	auc.RedisCache = sr.RedisCache
 	auc.CacheEvents.Enabled = sr.CacheEventsAPI
 	auc.CacheEvents.Endpoint = "/storedrequests/openrtb2"
 	auc.HTTPEvents.RefreshRate = sr.HTTPEvents.RefreshRate
@@ -170,7 +222,13 @@ func resolvedStoredRequestsConfig(cfg *config.Configuration) (auc, amp config.St
 	amp.Postgres.PollUpdates.Timeout = sr.Postgres.PollUpdates.Timeout
 	amp.Postgres.PollUpdates.Query = sr.Postgres.PollUpdates.AmpQuery
 	amp.HTTP.Endpoint = sr.HTTP.AmpEndpoint
+	// AMP shares the auction's key-value store, so loads through the auction's endpoint cover it too.
+	amp.KVStore.Enabled = sr.KVStore.Enabled
+	amp.KVStore.Path = sr.KVStore.Path
 	amp.InMemoryCache = sr.InMemoryCache
+	amp.RedisCache = sr.RedisCache
+	// AMP Stored Request IDs come from different queries and endpoints, so they need their own keys.
+	amp.RedisCache.KeyPrefix = sr.RedisCache.KeyPrefix + "amp:"
 	amp.CacheEvents.Enabled = sr.CacheEventsAPI
 	amp.CacheEvents.Endpoint = "/storedrequests/amp"
 	amp.HTTPEvents.RefreshRate = sr.HTTPEvents.RefreshRate
@@ -196,13 +254,16 @@ func addListeners(cache stored_requests.Cache, eventProducers []events.EventProd
 	}
 }
 
-func newFetcher(cfg *config.StoredRequestsSlim, client *http.Client, db *sql.DB) (fetcher stored_requests.AllFetcher) {
-	idList := make(stored_requests.MultiFetcher, 0, 3)
+func newFetcher(cfg *config.StoredRequestsSlim, client *http.Client, db *sql.DB, kvFetcher *kv_fetcher.Fetcher) (fetcher stored_requests.AllFetcher) {
+	idList := make(stored_requests.MultiFetcher, 0, 4)
 
 	if cfg.Files.Enabled {
 		fFetcher := newFilesystem(cfg.Files.Path)
 		idList = append(idList, fFetcher)
 	}
+	if kvFetcher != nil {
+		idList = append(idList, kvFetcher)
+	}
 	if cfg.Postgres.FetcherQueries.QueryTemplate != "" {
 		glog.Infof("Loading Stored Requests via Postgres.\nQuery: %s", cfg.Postgres.FetcherQueries.QueryTemplate)
 		idList = append(idList, db_fetcher.NewFetcher(db, cfg.Postgres.FetcherQueries.MakeQuery))
@@ -218,13 +279,34 @@ func newFetcher(cfg *config.StoredRequestsSlim, client *http.Client, db *sql.DB)
 
 func newCache(cfg *config.StoredRequestsSlim) stored_requests.Cache {
 	if cfg.InMemoryCache.Type == "none" {
+		if cfg.RedisCache.Enabled {
+			return redis.NewCache(&cfg.RedisCache)
+		}
 		glog.Info("No Stored Request cache configured. The Fetcher backend will be used for all Stored Requests.")
 		return &nil_cache.NilCache{}
 	}
 
+	if cfg.RedisCache.Enabled {
+		return stored_requests.ComposedCache{
+			memory.NewCache(&cfg.InMemoryCache),
+			redis.NewCache(&cfg.RedisCache),
+		}
+	}
 	return memory.NewCache(&cfg.InMemoryCache)
 }
 
+// closeCache releases the connections held by any Redis caches in the given cache.
+func closeCache(cache stored_requests.Cache) {
+	switch c := cache.(type) {
+	case *redis.Cache:
+		c.Close()
+	case stored_requests.ComposedCache:
+		for _, layer := range c {
+			closeCache(layer)
+		}
+	}
+}
+
 func newEventProducers(cfg *config.StoredRequestsSlim, client *http.Client, db *sql.DB, router *httprouter.Router) (eventProducers []events.EventProducer) {
 	if cfg.CacheEvents.Enabled {
 		eventProducers = append(eventProducers, newEventsAPI(router, cfg.CacheEvents.Endpoint))
@@ -4,23 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/julienschmidt/httprouter"
 	"github.com/prebid/prebid-server/config"
+	metricsConf "github.com/prebid/prebid-server/pbsmetrics/config"
 	"github.com/prebid/prebid-server/stored_requests/backends/empty_fetcher"
 	"github.com/prebid/prebid-server/stored_requests/backends/http_fetcher"
+	"github.com/prebid/prebid-server/stored_requests/caches/redis/redistest"
 	"github.com/prebid/prebid-server/stored_requests/events"
 	httpEvents "github.com/prebid/prebid-server/stored_requests/events/http"
 )
 
 func TestNewEmptyFetcher(t *testing.T) {
-	fetcher := newFetcher(&config.StoredRequestsSlim{}, nil, nil)
-	ampFetcher := newFetcher(&config.StoredRequestsSlim{}, nil, nil)
+	fetcher := newFetcher(&config.StoredRequestsSlim{}, nil, nil, nil)
+	ampFetcher := newFetcher(&config.StoredRequestsSlim{}, nil, nil, nil)
 	if fetcher == nil || ampFetcher == nil {
 		t.Errorf("The fetchers should be non-nil, even with an empty config.")
 	}
@@ -37,12 +44,12 @@ func TestNewHTTPFetcher(t *testing.T) {
 		HTTP: config.HTTPFetcherConfigSlim{
 			Endpoint: "stored-requests.prebid.com",
 		},
-	}, nil, nil)
+	}, nil, nil, nil)
 	ampFetcher := newFetcher(&config.StoredRequestsSlim{
 		HTTP: config.HTTPFetcherConfigSlim{
 			Endpoint: "stored-requests.prebid.com?type=amp",
 		},
-	}, nil, nil)
+	}, nil, nil, nil)
 	if httpFetcher, ok := fetcher.(*http_fetcher.HttpFetcher); ok {
 		if httpFetcher.Endpoint != "stored-requests.prebid.com?" {
 			t.Errorf("The HTTP fetcher is using the wrong endpoint. Expected %s, got %s", "stored-requests.prebid.com?", httpFetcher.Endpoint)
@@ -64,12 +71,12 @@ func TestNewHTTPFetcherNoAmp(t *testing.T) {
 		HTTP: config.HTTPFetcherConfigSlim{
 			Endpoint: "stored-requests.prebid.com",
 		},
-	}, nil, nil)
+	}, nil, nil, nil)
 	ampFetcher := newFetcher(&config.StoredRequestsSlim{
 		HTTP: config.HTTPFetcherConfigSlim{
 			Endpoint: "",
 		},
-	}, nil, nil)
+	}, nil, nil, nil)
 	if httpFetcher, ok := fetcher.(*http_fetcher.HttpFetcher); ok {
 		if httpFetcher.Endpoint != "stored-requests.prebid.com?" {
 			t.Errorf("The HTTP fetcher is using the wrong endpoint. Expected %s, got %s", "stored-requests.prebid.com?", httpFetcher.Endpoint)
@@ -108,12 +115,21 @@ func TestResolveConfig(t *testing.T) {
 			HTTP: config.HTTPFetcherConfig{
 				AmpEndpoint: "amp-http-fetcher-endpoint",
 			},
+			KVStore: config.KVFetcherConfig{
+				Enabled:      true,
+				Path:         "/test-path/stored.db",
+				LoadEndpoint: "/storedrequests/load",
+			},
 			InMemoryCache: config.InMemoryCache{
 				Type:             "none",
 				TTL:              50,
 				RequestCacheSize: 1,
 				ImpCacheSize:     2,
 			},
+			RedisCache: config.RedisCache{
+				Enabled:   true,
+				KeyPrefix: "pbs:",
+			},
 			CacheEventsAPI: true,
 			HTTPEvents: config.HTTPEventsConfig{
 				AmpEndpoint: "amp-http-events-endpoint",
@@ -136,6 +152,9 @@ func TestResolveConfig(t *testing.T) {
 	assertStringsEqual(t, auc.HTTP.Endpoint, cfg.StoredRequests.HTTP.Endpoint)
 	assertStringsEqual(t, auc.HTTPEvents.Endpoint, cfg.StoredRequests.HTTPEvents.Endpoint)
 	assertStringsEqual(t, auc.CacheEvents.Endpoint, "/storedrequests/openrtb2")
+	assertStringsEqual(t, auc.RedisCache.KeyPrefix, "pbs:")
+	assertStringsEqual(t, auc.KVStore.Path, cfg.StoredRequests.KVStore.Path)
+	assertStringsEqual(t, auc.KVStore.LoadEndpoint, cfg.StoredRequests.KVStore.LoadEndpoint)
 
 	// Amp slim should have the amp values in it
 	assertStringsEqual(t, amp.Postgres.FetcherQueries.QueryTemplate, cfg.StoredRequests.Postgres.FetcherQueries.AmpQueryTemplate)
@@ -144,6 +163,90 @@ func TestResolveConfig(t *testing.T) {
 	assertStringsEqual(t, amp.HTTP.Endpoint, cfg.StoredRequests.HTTP.AmpEndpoint)
 	assertStringsEqual(t, amp.HTTPEvents.Endpoint, cfg.StoredRequests.HTTPEvents.AmpEndpoint)
 	assertStringsEqual(t, amp.CacheEvents.Endpoint, "/storedrequests/amp")
+	assertStringsEqual(t, amp.RedisCache.KeyPrefix, "pbs:amp:")
+	assertStringsEqual(t, amp.KVStore.Path, cfg.StoredRequests.KVStore.Path)
+	// AMP shares the auction's file, so it shouldn't register the load endpoint again
+	assertStringsEqual(t, amp.KVStore.LoadEndpoint, "")
+}
+
+func TestKVStoreShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv_store")
+	if err != nil {
+		t.Fatalf("Failed to make a temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	router := httprouter.New()
+	var dbc dbConnection
+	kvStore := config.KVFetcherConfig{Enabled: true, Path: filepath.Join(dir, "stored.db")}
+	auctionCfg := &config.StoredRequestsSlim{KVStore: kvStore}
+	auctionCfg.KVStore.LoadEndpoint = "/storedrequests/load"
+	auctionCfg.KVStore.MaxLoadBytes = 1024
+	auctionFetcher, shutdown1 := CreateStoredRequests(auctionCfg, &metricsConf.DummyMetricsEngine{}, nil, router, &dbc)
+	defer shutdown1()
+	categoriesFetcher, shutdown2 := CreateStoredRequests(&config.StoredRequestsSlim{KVStore: kvStore}, &metricsConf.DummyMetricsEngine{}, nil, router, &dbc)
+	defer shutdown2()
+
+	handle, _, _ := router.Lookup("POST", "/storedrequests/load")
+	if handle == nil {
+		t.Fatal("CreateStoredRequests didn't add a POST /storedrequests/load route")
+	}
+	recorder := httptest.NewRecorder()
+	handle(recorder, httptest.NewRequest("POST", "/storedrequests/load", strings.NewReader(`{"requests":{"1":{}},"categories":{"freewheel":{"":{"IAB1-1":{"id":"Sports"}}}}}`)), nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("The load failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	storedReqs, _, errs := auctionFetcher.FetchRequests(context.Background(), []string{"1"}, nil)
+	if len(errs) != 0 || len(storedReqs) != 1 {
+		t.Errorf("The auction fetcher should have the loaded request. Got %v, errors: %v", storedReqs, errs)
+	}
+	category, err := categoriesFetcher.FetchCategories(context.Background(), "freewheel", "", "IAB1-1")
+	if err != nil || category != "Sports" {
+		t.Errorf("Fetchers for the same file should share the loaded data. Got %q, error: %v", category, err)
+	}
+}
+
+func TestKVStoreInvalidatesCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv_store")
+	if err != nil {
+		t.Fatalf("Failed to make a temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	router := httprouter.New()
+	var dbc dbConnection
+	cfg := &config.StoredRequestsSlim{
+		KVStore:       config.KVFetcherConfig{Enabled: true, Path: filepath.Join(dir, "stored.db"), LoadEndpoint: "/storedrequests/load", MaxLoadBytes: 1024},
+		InMemoryCache: config.InMemoryCache{Type: "unbounded"},
+	}
+	fetcher, shutdown := CreateStoredRequests(cfg, &metricsConf.DummyMetricsEngine{}, nil, router, &dbc)
+	defer shutdown()
+	handle, _, _ := router.Lookup("POST", "/storedrequests/load")
+	if handle == nil {
+		t.Fatal("CreateStoredRequests didn't add a POST /storedrequests/load route")
+	}
+
+	for _, version := range []string{"1", "2"} {
+		recorder := httptest.NewRecorder()
+		handle(recorder, httptest.NewRequest("POST", "/storedrequests/load", strings.NewReader(`{"requests":{"1":{"version":`+version+`}}}`)), nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("The load failed with status %d: %s", recorder.Code, recorder.Body.String())
+		}
+		// The listener invalidates the cache after it receives the event, so it may take a moment.
+		var storedReqs map[string]json.RawMessage
+		var errs []error
+		for i := 0; i < 100; i++ {
+			storedReqs, _, errs = fetcher.FetchRequests(context.Background(), []string{"1"}, nil)
+			if len(errs) == 0 && string(storedReqs["1"]) == `{"version":`+version+`}` {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(errs) != 0 || string(storedReqs["1"]) != `{"version":`+version+`}` {
+			t.Errorf("The cache should have dropped the old version. Got %s, errors: %v", storedReqs["1"], errs)
+		}
+	}
 }
 
 func TestNewHTTPEvents(t *testing.T) {
@@ -188,6 +291,71 @@ func TestNewInMemoryCache(t *testing.T) {
 	}
 }
 
+func TestNewRedisCache(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+	redisConfig := config.RedisCache{
+		Enabled:   true,
+		Address:   server.Addr(),
+		TimeoutMS: 500,
+		KeyPrefix: "pbs:",
+	}
+
+	cache := newCache(&config.StoredRequestsSlim{
+		InMemoryCache: config.InMemoryCache{
+			TTL:              60,
+			RequestCacheSize: 100,
+			ImpCacheSize:     100,
+		},
+		RedisCache: redisConfig,
+	})
+	cache.Save(context.Background(), map[string]json.RawMessage{"foo": json.RawMessage("true")}, nil)
+	if _, ok := server.Get(0, "pbs:request:foo"); !ok {
+		t.Errorf("The newCache method should save to Redis if the config asks for it.")
+	}
+
+	// A different PBS instance should be able to read the data, even without its own in-memory cache.
+	cache = newCache(&config.StoredRequestsSlim{
+		InMemoryCache: config.InMemoryCache{Type: "none"},
+		RedisCache:    redisConfig,
+	})
+	reqs, _ := cache.Get(context.Background(), []string{"foo"}, nil)
+	if len(reqs) != 1 {
+		t.Errorf("The newCache method should return a Redis cache if the config asks for it.")
+	}
+}
+
+func TestCloseRedisCache(t *testing.T) {
+	server := redistest.NewServer("")
+	defer server.Close()
+
+	cache := newCache(&config.StoredRequestsSlim{
+		InMemoryCache: config.InMemoryCache{
+			TTL:              60,
+			RequestCacheSize: 100,
+			ImpCacheSize:     100,
+		},
+		RedisCache: config.RedisCache{
+			Enabled:   true,
+			Address:   server.Addr(),
+			TimeoutMS: 500,
+		},
+	})
+	cache.Save(context.Background(), map[string]json.RawMessage{"foo": json.RawMessage("true")}, nil)
+	if open := server.OpenConnections(); open != 1 {
+		t.Fatalf("Expected 1 open Redis connection after a save. Got %d", open)
+	}
+
+	closeCache(cache)
+	// The server notices the closed connection asynchronously.
+	for i := 0; i < 50 && server.OpenConnections() != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if open := server.OpenConnections(); open != 0 {
+		t.Errorf("closeCache should close the Redis connections. %d are still open.", open)
+	}
+}
+
 func TestNewPostgresEventProducers(t *testing.T) {
 	cfg := &config.StoredRequestsSlim{
 		Postgres: config.PostgresConfigSlim{
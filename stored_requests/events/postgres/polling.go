@@ -20,7 +20,7 @@ import (
 //
 //   1. id: string
 //   2. data: JSON
-//   3. type: string ("request" or "imp")
+//   3. type: string ("request", "imp", "account" or "response")
 //
 // If data is empty or the JSON "null", then the ID will be invalidated (e.g. a deletion).
 // If data is not empty, it should be the Stored Request or Stored Imp data associated with the given ID.
@@ -110,7 +110,8 @@ func sendEvents(rows *sql.Rows, saves chan<- events.Save, invalidations chan<- e
 		}
 
 		switch dataType {
-		case "request":
+		case "request", "account", "response":
+			// Accounts and Stored Responses have their own Caches, which hold them in the same place as Stored Requests.
 			if len(data) == 0 || bytes.Equal(data, []byte("null")) {
 				requestInvalidations = append(requestInvalidations, id)
 			} else {
@@ -15,7 +15,7 @@ import (
 //
 //   1. id: string
 //   2. data: JSON
-//   3. type: string ("request" or "imp")
+//   3. type: string ("request", "imp", "account" or "response")
 //
 func LoadAll(ctx context.Context, db *sql.DB, query string) (eventProducer *PostgresLoader) {
 	if db == nil {
@@ -30,10 +30,28 @@ type CategoryFetcher interface {
 	FetchCategories(ctx context.Context, primaryAdServer, publisherId, iabCategory string) (string, error)
 }
 
-// AllFetcher is an iterface that encapsulates both the original Fetcher and the CategoryFetcher
+// AccountFetcher knows how to fetch the stored configuration of a publisher Account by id.
+type AccountFetcher interface {
+	// FetchAccount fetches the stored Account data for the given account ID.
+	// If the account doesn't exist, a NotFoundError will be returned.
+	FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error)
+}
+
+// ResponseFetcher knows how to fetch Stored Auction Responses and Stored Bid Responses by id.
+type ResponseFetcher interface {
+	// FetchResponses fetches the stored responses for the given IDs.
+	//
+	// The returned map will have a key for every ID in the list, unless errors exist.
+	// The returned objects can only be read from. They may not be written to.
+	FetchResponses(ctx context.Context, ids []string) (data map[string]json.RawMessage, errs []error)
+}
+
+// AllFetcher is an iterface that encapsulates the original Fetcher, the CategoryFetcher, the AccountFetcher and the ResponseFetcher
 type AllFetcher interface {
 	FetchRequests(ctx context.Context, requestIDs []string, impIDs []string) (requestData map[string]json.RawMessage, impData map[string]json.RawMessage, errs []error)
 	FetchCategories(ctx context.Context, primaryAdServer, publisherId, iabCategory string) (string, error)
+	FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error)
+	FetchResponses(ctx context.Context, ids []string) (data map[string]json.RawMessage, errs []error)
 }
 
 // NotFoundError is an error type to flag that an ID was not found by the Fetcher.
@@ -81,7 +99,8 @@ type Cache interface {
 type ComposedCache []Cache
 
 // Get will attempt to Get from the caches in the order in which they are in the slice,
-// stopping as soon as a value is found (or when all caches have been exhausted)
+// stopping as soon as a value is found (or when all caches have been exhausted).
+// Values which are found in a later cache are saved to the earlier ones.
 func (c ComposedCache) Get(ctx context.Context, requestIDs []string, impIDs []string) (requestData map[string]json.RawMessage, impData map[string]json.RawMessage) {
 	requestData = make(map[string]json.RawMessage, len(requestIDs))
 	impData = make(map[string]json.RawMessage, len(impIDs))
@@ -89,8 +108,13 @@ func (c ComposedCache) Get(ctx context.Context, requestIDs []string, impIDs []st
 	remainingReqIDs := requestIDs
 	remainingImpIDs := impIDs
 
-	for _, cache := range c {
+	for i, cache := range c {
 		cachedReqData, cachedImpData := cache.Get(ctx, remainingReqIDs, remainingImpIDs)
+		if i > 0 && (len(cachedReqData) > 0 || len(cachedImpData) > 0) {
+			for _, earlierCache := range c[:i] {
+				earlierCache.Save(ctx, cachedReqData, cachedImpData)
+			}
+		}
 
 		requestData, remainingReqIDs = updateFromCache(requestData, remainingReqIDs, cachedReqData)
 		impData, remainingImpIDs = updateFromCache(impData, remainingImpIDs, cachedImpData)
@@ -185,6 +209,36 @@ func (f *fetcherWithCache) FetchCategories(ctx context.Context, primaryAdServer,
 	return "", nil
 }
 
+// FetchAccount uses the request slot of the cache to store Account data. Accounts are given their own
+// Cache instance by the stored_requests/config package, so these never collide with Stored Request IDs.
+func (f *fetcherWithCache) FetchAccount(ctx context.Context, accountID string) (account json.RawMessage, errs []error) {
+	accountData, _ := f.cache.Get(ctx, []string{accountID}, nil)
+	if account, ok := accountData[accountID]; ok {
+		return account, nil
+	}
+
+	account, errs = f.fetcher.FetchAccount(ctx, accountID)
+	if len(errs) == 0 {
+		f.cache.Save(ctx, map[string]json.RawMessage{accountID: account}, nil)
+	}
+	return
+}
+
+// FetchResponses uses the request slot of the cache to store response data. Stored Responses are given their own
+// Cache instance by the stored_requests/config package, so these never collide with Stored Request IDs.
+func (f *fetcherWithCache) FetchResponses(ctx context.Context, ids []string) (data map[string]json.RawMessage, errs []error) {
+	data, _ = f.cache.Get(ctx, ids, nil)
+
+	if leftovers := findLeftovers(ids, data); len(leftovers) > 0 {
+		var fetcherData map[string]json.RawMessage
+		fetcherData, errs = f.fetcher.FetchResponses(ctx, leftovers)
+		f.cache.Save(ctx, fetcherData, nil)
+		data = mergeData(data, fetcherData)
+	}
+
+	return
+}
+
 func findLeftovers(ids []string, data map[string]json.RawMessage) (leftovers []string) {
 	leftovers = make([]string, 0, len(ids)-len(data))
 	for _, id := range ids {
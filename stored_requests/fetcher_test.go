@@ -183,6 +183,22 @@ func TestComposedCache(t *testing.T) {
 		map[string]json.RawMessage{
 			"3": json.RawMessage(`{"id": "3"}`),
 		})
+	c1.On("Save", ctx,
+		map[string]json.RawMessage{
+			"2": json.RawMessage(`{"id": "2"}`),
+		},
+		map[string]json.RawMessage{
+			"2": json.RawMessage(`{"id": "2"}`),
+		})
+	for _, earlierCache := range []*mockCache{c1, c2} {
+		earlierCache.On("Save", ctx,
+			map[string]json.RawMessage{
+				"3": json.RawMessage(`{"id": "3"}`),
+			},
+			map[string]json.RawMessage{
+				"3": json.RawMessage(`{"id": "3"}`),
+			})
+	}
 	metricsEngine.On("RecordStoredReqCacheResult", pbsmetrics.CacheHit, 3)
 	metricsEngine.On("RecordStoredReqCacheResult", pbsmetrics.CacheMiss, 0)
 	metricsEngine.On("RecordStoredImpCacheResult", pbsmetrics.CacheHit, 3)
@@ -206,6 +222,75 @@ func TestComposedCache(t *testing.T) {
 	assert.JSONEq(t, `{"id": "3"}`, string(reqData["3"]), "FetchRequests should fetch the right req data")
 }
 
+func TestAccountCacheHit(t *testing.T) {
+	cache := &mockCache{}
+	metricsEngine := &pbsmetrics.MetricsEngineMock{}
+	fetcher := &mockFetcher{}
+	aFetcherWithCache := WithCache(fetcher, cache, metricsEngine)
+	ctx := context.Background()
+
+	cache.On("Get", ctx, []string{"acc"}, []string(nil)).Return(
+		map[string]json.RawMessage{
+			"acc": json.RawMessage(`{"id": "acc"}`),
+		},
+		map[string]json.RawMessage{})
+
+	account, errs := aFetcherWithCache.FetchAccount(ctx, "acc")
+
+	cache.AssertExpectations(t)
+	fetcher.AssertExpectations(t)
+	assert.Len(t, errs, 0, "FetchAccount shouldn't return any errors")
+	assert.JSONEq(t, `{"id": "acc"}`, string(account), "FetchAccount should return the cached account")
+}
+
+func TestAccountCacheMiss(t *testing.T) {
+	cache := &mockCache{}
+	metricsEngine := &pbsmetrics.MetricsEngineMock{}
+	fetcher := &mockFetcher{}
+	aFetcherWithCache := WithCache(fetcher, cache, metricsEngine)
+	ctx := context.Background()
+
+	cache.On("Get", ctx, []string{"acc"}, []string(nil)).Return(
+		map[string]json.RawMessage{},
+		map[string]json.RawMessage{})
+	fetcher.On("FetchAccount", ctx, "acc").Return(json.RawMessage(`{"id": "acc"}`), []error{})
+	cache.On("Save", ctx, map[string]json.RawMessage{"acc": json.RawMessage(`{"id": "acc"}`)}, map[string]json.RawMessage(nil))
+
+	account, errs := aFetcherWithCache.FetchAccount(ctx, "acc")
+
+	cache.AssertExpectations(t)
+	fetcher.AssertExpectations(t)
+	assert.Len(t, errs, 0, "FetchAccount shouldn't return any errors")
+	assert.JSONEq(t, `{"id": "acc"}`, string(account), "FetchAccount should return the fetched account")
+}
+
+func TestResponseCacheMiss(t *testing.T) {
+	cache := &mockCache{}
+	metricsEngine := &pbsmetrics.MetricsEngineMock{}
+	fetcher := &mockFetcher{}
+	aFetcherWithCache := WithCache(fetcher, cache, metricsEngine)
+	ctx := context.Background()
+
+	cache.On("Get", ctx, []string{"resp-1", "resp-2"}, []string(nil)).Return(
+		map[string]json.RawMessage{
+			"resp-1": json.RawMessage(`[{"seat": "appnexus"}]`),
+		},
+		map[string]json.RawMessage{})
+	fetcher.On("FetchResponses", ctx, []string{"resp-2"}).Return(
+		map[string]json.RawMessage{
+			"resp-2": json.RawMessage(`{"id": "bidder-response"}`),
+		}, []error{})
+	cache.On("Save", ctx, map[string]json.RawMessage{"resp-2": json.RawMessage(`{"id": "bidder-response"}`)}, map[string]json.RawMessage(nil))
+
+	data, errs := aFetcherWithCache.FetchResponses(ctx, []string{"resp-1", "resp-2"})
+
+	cache.AssertExpectations(t)
+	fetcher.AssertExpectations(t)
+	assert.Len(t, errs, 0, "FetchResponses shouldn't return any errors")
+	assert.JSONEq(t, `[{"seat": "appnexus"}]`, string(data["resp-1"]), "FetchResponses should return the cached response")
+	assert.JSONEq(t, `{"id": "bidder-response"}`, string(data["resp-2"]), "FetchResponses should return the fetched response")
+}
+
 type mockFetcher struct {
 	mock.Mock
 }
@@ -219,6 +304,11 @@ func (f *mockFetcher) FetchCategories(ctx context.Context, primaryAdServer, publ
 	return "", nil
 }
 
+func (f *mockFetcher) FetchAccount(ctx context.Context, accountID string) (json.RawMessage, []error) {
+	args := f.Called(ctx, accountID)
+	return args.Get(0).(json.RawMessage), args.Get(1).([]error)
+}
+
 type mockCache struct {
 	mock.Mock
 }
@@ -235,3 +325,8 @@ func (c *mockCache) Save(ctx context.Context, storedRequests map[string]json.Raw
 func (c *mockCache) Invalidate(ctx context.Context, requestIDs []string, impIDs []string) {
 	c.Called(ctx, requestIDs, impIDs)
 }
+
+func (f *mockFetcher) FetchResponses(ctx context.Context, ids []string) (map[string]json.RawMessage, []error) {
+	args := f.Called(ctx, ids)
+	return args.Get(0).(map[string]json.RawMessage), args.Get(1).([]error)
+}
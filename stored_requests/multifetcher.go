@@ -51,6 +51,35 @@ func (mf MultiFetcher) FetchCategories(ctx context.Context, primaryAdServer, pub
 	return "", NotFoundError{errtype, "Category"}
 }
 
+// FetchAccount returns the Account data from the first sub-Fetcher which has it.
+func (mf MultiFetcher) FetchAccount(ctx context.Context, accountID string) (account json.RawMessage, errs []error) {
+	for _, f := range mf {
+		account, accErrs := f.FetchAccount(ctx, accountID)
+		if len(accErrs) == 0 {
+			return account, nil
+		}
+		// Drop NotFound errors, as other fetchers may have the account
+		errs = append(errs, dropMissingIDs(accErrs)...)
+	}
+	errs = append(errs, NotFoundError{accountID, "Account"})
+	return nil, errs
+}
+
+// FetchResponses implements the ResponseFetcher interface for MultiFetcher
+func (mf MultiFetcher) FetchResponses(ctx context.Context, ids []string) (data map[string]json.RawMessage, errs []error) {
+	data = make(map[string]json.RawMessage, len(ids))
+
+	for _, f := range mf {
+		ids = filter(ids, data)
+		theseData, rerrs := f.FetchResponses(ctx, ids)
+		// Drop NotFound errors, as other fetchers may have them.
+		errs = append(errs, dropMissingIDs(rerrs)...)
+		addAll(data, theseData)
+	}
+	errs = appendNotFoundErrors("Response", ids, data, errs)
+	return
+}
+
 func addAll(base map[string]json.RawMessage, toAdd map[string]json.RawMessage) {
 	for k, v := range toAdd {
 		base[k] = v
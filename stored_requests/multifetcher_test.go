@@ -125,3 +125,61 @@ func TestOtherError(t *testing.T) {
 	assert.JSONEq(t, `{"req_id": "def"}`, string(reqData["def"]), "MultiFetcher should return the right request data")
 	assert.JSONEq(t, `{"imp_id": "imp-1"}`, string(impData["imp-1"]), "MultiFetcher should return the right imp data")
 }
+
+func TestMultiFetcherAccount(t *testing.T) {
+	f1 := &mockFetcher{}
+	f2 := &mockFetcher{}
+	fetcher := &MultiFetcher{f1, f2}
+	ctx := context.Background()
+
+	f1.On("FetchAccount", ctx, "acc-1").Return(json.RawMessage(nil), []error{NotFoundError{"acc-1", "Account"}})
+	f2.On("FetchAccount", ctx, "acc-1").Return(json.RawMessage(`{"id": "acc-1"}`), []error{})
+
+	account, errs := fetcher.FetchAccount(ctx, "acc-1")
+
+	f1.AssertExpectations(t)
+	f2.AssertExpectations(t)
+	assert.Empty(t, errs, "MultiFetcher shouldn't return an error if any fetcher has the account")
+	assert.JSONEq(t, `{"id": "acc-1"}`, string(account), "MultiFetcher should return the right account data")
+}
+
+func TestMultiFetcherAccountNotFound(t *testing.T) {
+	f1 := &mockFetcher{}
+	f2 := &mockFetcher{}
+	fetcher := &MultiFetcher{f1, f2}
+	ctx := context.Background()
+
+	f1.On("FetchAccount", ctx, "acc-1").Return(json.RawMessage(nil), []error{NotFoundError{"acc-1", "Account"}})
+	f2.On("FetchAccount", ctx, "acc-1").Return(json.RawMessage(nil), []error{errors.New("Other error")})
+
+	account, errs := fetcher.FetchAccount(ctx, "acc-1")
+
+	f1.AssertExpectations(t)
+	f2.AssertExpectations(t)
+	assert.Nil(t, account, "MultiFetcher shouldn't return account data if no fetcher has it")
+	assert.Len(t, errs, 2, "MultiFetcher should keep non-NotFound errors and add a single NotFound error")
+	assert.Equal(t, NotFoundError{"acc-1", "Account"}, errs[1])
+}
+
+func TestMultiFetcherResponses(t *testing.T) {
+	f1 := &mockFetcher{}
+	f2 := &mockFetcher{}
+	fetcher := &MultiFetcher{f1, f2}
+	ctx := context.Background()
+
+	f1.On("FetchResponses", ctx, []string{"resp-1", "resp-2", "resp-3"}).Return(
+		map[string]json.RawMessage{"resp-1": json.RawMessage(`{"id": "resp-1"}`)},
+		[]error{NotFoundError{"resp-2", "Response"}, NotFoundError{"resp-3", "Response"}})
+	f2.On("FetchResponses", ctx, []string{"resp-2", "resp-3"}).Return(
+		map[string]json.RawMessage{"resp-2": json.RawMessage(`{"id": "resp-2"}`)},
+		[]error{NotFoundError{"resp-3", "Response"}})
+
+	data, errs := fetcher.FetchResponses(ctx, []string{"resp-1", "resp-2", "resp-3"})
+
+	f1.AssertExpectations(t)
+	f2.AssertExpectations(t)
+	assert.Len(t, data, 2, "MultiFetcher should return the data from every fetcher")
+	assert.JSONEq(t, `{"id": "resp-1"}`, string(data["resp-1"]))
+	assert.JSONEq(t, `{"id": "resp-2"}`, string(data["resp-2"]))
+	assert.Equal(t, []error{NotFoundError{"resp-3", "Response"}}, errs, "MultiFetcher should return a single NotFound error for missing IDs")
+}